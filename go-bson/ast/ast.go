@@ -0,0 +1,242 @@
+// Package ast declares the types used to represent the syntax tree of a
+// BulbaSaur Object Notation document.
+//
+// Every node records where it appears in the source, so tools such as
+// linters, formatters and editors can map the tree back to the text. Walk
+// visits the nodes of a tree and can replace or remove them, for tools that
+// rewrite documents.
+package ast
+
+// Position is a location in the source. Line and Column are 1-based and
+// Column counts bytes, not runes.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Span is the range of source covered by a node. End is the position of the
+// node's last character, so a single-character node starts and ends at the
+// same position.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// Node is implemented by every node in the tree.
+type Node interface {
+	Span() Span
+}
+
+// Entry is a node that can appear in the body of a document or a section:
+// a *KeyValue or a *Section, or at seed level an *Include.
+type Entry interface {
+	Node
+	entryNode()
+}
+
+// Value is a node that can appear on the right of a Vine Whip or inside an
+// array: *StringLit, *NumberLit, *TimeLit, *DurationLit, *BytesLit, *BoolLit,
+// *NullLit, *ArrayLit, *ObjectLit or *Reference.
+type Value interface {
+	Node
+	valueNode()
+}
+
+// Document is the root of the tree.
+type Document struct {
+	Header   Span       // The "BULBA!" cry
+	Version  int        // Version of the cry, as in "BULBA!v2", 1 for a plain one
+	Body     []Entry    // Seed level entries, in source order
+	Comments []*Comment // Comments after the last entry, if any
+}
+
+// Comment is a zZz comment. Comments are only recorded when the parser is
+// asked to keep them.
+type Comment struct {
+	Text string // The comment including its marker, e.g. "zZz napping"
+	Loc  Span
+}
+
+// Ident is a key, either on the left of a Vine Whip or in a section header.
+type Ident struct {
+	Name string
+	Loc  Span
+}
+
+// Section is an evolution block such as "(o) database (o)" and its body.
+type Section struct {
+	Level       int    // 1 for (o), 2 for (O), 3 for (@), 4 for (@@) and so on
+	Name        *Ident // Key of the section
+	Forme       *Ident // Profile the section belongs to, nil for the base
+	Header      Span   // The whole header line, markers and profile included
+	Body        []Entry
+	Comments    []*Comment // Comment lines directly above the header
+	LineComment *Comment   // Comment at the end of the header line
+}
+
+// KeyValue is an assignment such as `host ~~~~> "localhost"`.
+type KeyValue struct {
+	Key         *Ident
+	Vine        Span       // The Vine Whip operator
+	Tildes      int        // Tildes in the Vine Whip as written, 0 if not known
+	Value       Value      // nil for a key written without a value
+	Comments    []*Comment // Comment lines directly above the key
+	LineComment *Comment   // Comment at the end of the line
+}
+
+// StringLit is a double-quoted or raw string. Value holds the text without
+// quotes or backticks.
+type StringLit struct {
+	Value string
+	Raw   bool // Written between backticks
+	Loc   Span
+}
+
+// NumberLit is an integer or float. Literal holds the source text with any
+// digit separators removed.
+type NumberLit struct {
+	Literal string
+	Loc     Span
+}
+
+// TimeLit is an RFC 3339 timestamp such as 2024-05-01T12:00:00Z. Literal
+// holds the source text.
+type TimeLit struct {
+	Literal string
+	Loc     Span
+}
+
+// DurationLit is a Go-style duration such as 1h30m. Literal holds the source
+// text.
+type DurationLit struct {
+	Literal string
+	Loc     Span
+}
+
+// BytesLit is a base64 encoded byte string such as 0b64"aGVsbG8=". Literal
+// holds the text between the quotes.
+type BytesLit struct {
+	Literal string
+	Loc     Span
+}
+
+// BoolLit is SuperEffective (true) or NotVeryEffective (false).
+type BoolLit struct {
+	Value bool
+	Loc   Span
+}
+
+// NullLit is MissingNo.
+type NullLit struct {
+	Loc Span
+}
+
+// DialectLit is a literal recognized by a matcher of the dialect the
+// document was parsed with. Literal holds the source text.
+type DialectLit struct {
+	Literal string
+	Loc     Span
+}
+
+// Reference is a Copycat reference such as `Copycat defaults.timeout`, which
+// stands for a copy of the value at the path.
+type Reference struct {
+	Path string // Dotted path of the referenced value, e.g. "defaults.timeout"
+	Loc  Span   // From "Copycat" to the end of the path
+}
+
+// ArrayLit is a Razor Leaf array such as <| 1, 2 |>.
+type ArrayLit struct {
+	Elements []Value
+	Block    bool // Written across several lines, one *ObjectLit per element
+	Loc      Span // From "<|" to "|>" inclusive
+}
+
+// ObjectLit is an object value. As an element of a multi-line array it is a
+// bare evolution marker such as "(o)" followed by an indented body. Written
+// inline, as in { x ~> 1, y ~> 2 }, it holds only key-value pairs.
+type ObjectLit struct {
+	Marker   Span // The bare evolution marker, or the "{" of an inline object
+	Body     []Entry
+	Comments []*Comment // Comment lines directly above the marker
+	Inline   bool
+	Close    Span // The "}" of an inline object
+}
+
+// Include is a Transform directive such as `Transform "shared/db.bson"`,
+// which stands for the entries of another file.
+type Include struct {
+	Keyword     Span       // The Transform keyword
+	Path        *StringLit // Path of the included file, relative to this one
+	Comments    []*Comment // Comment lines directly above the directive
+	LineComment *Comment   // Comment at the end of the line
+}
+
+// Span returns the header and the whole document body.
+func (d *Document) Span() Span {
+	return Span{Start: d.Header.Start, End: bodyEnd(d.Header.End, d.Body)}
+}
+
+// Span returns the header line and everything nested under it.
+func (s *Section) Span() Span {
+	return Span{Start: s.Header.Start, End: bodyEnd(s.Header.End, s.Body)}
+}
+
+// Span returns the marker and everything nested under it.
+func (o *ObjectLit) Span() Span {
+	if o.Inline {
+		return Span{Start: o.Marker.Start, End: o.Close.End}
+	}
+	return Span{Start: o.Marker.Start, End: bodyEnd(o.Marker.End, o.Body)}
+}
+
+// Span returns the key through to the end of the value.
+func (kv *KeyValue) Span() Span {
+	end := kv.Vine.End
+	if kv.Value != nil {
+		end = kv.Value.Span().End
+	}
+	return Span{Start: kv.Key.Loc.Start, End: end}
+}
+
+// Span returns the keyword and the path.
+func (i *Include) Span() Span {
+	return Span{Start: i.Keyword.Start, End: i.Path.Loc.End}
+}
+
+func (x *Ident) Span() Span       { return x.Loc }
+func (x *Comment) Span() Span     { return x.Loc }
+func (x *StringLit) Span() Span   { return x.Loc }
+func (x *NumberLit) Span() Span   { return x.Loc }
+func (x *TimeLit) Span() Span     { return x.Loc }
+func (x *DurationLit) Span() Span { return x.Loc }
+func (x *BytesLit) Span() Span    { return x.Loc }
+func (x *BoolLit) Span() Span     { return x.Loc }
+func (x *NullLit) Span() Span     { return x.Loc }
+func (x *DialectLit) Span() Span  { return x.Loc }
+func (x *ArrayLit) Span() Span    { return x.Loc }
+func (x *Reference) Span() Span   { return x.Loc }
+
+func (*Section) entryNode()  {}
+func (*KeyValue) entryNode() {}
+func (*Include) entryNode()  {}
+
+func (*StringLit) valueNode()   {}
+func (*NumberLit) valueNode()   {}
+func (*TimeLit) valueNode()     {}
+func (*DurationLit) valueNode() {}
+func (*BytesLit) valueNode()    {}
+func (*BoolLit) valueNode()     {}
+func (*NullLit) valueNode()     {}
+func (*DialectLit) valueNode()  {}
+func (*ArrayLit) valueNode()    {}
+func (*ObjectLit) valueNode()   {}
+func (*Reference) valueNode()   {}
+
+// bodyEnd returns the end of the last entry in body, or def if it is empty.
+func bodyEnd(def Position, body []Entry) Position {
+	if len(body) == 0 {
+		return def
+	}
+	return body[len(body)-1].Span().End
+}
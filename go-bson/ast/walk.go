@@ -0,0 +1,139 @@
+package ast
+
+import "fmt"
+
+// Visitor is called by Walk on every node of a tree. Enter is called before
+// the children of a node are walked, and Exit after. Each returns the node to
+// put in place of the one it is given: the node itself, a replacement of a
+// fitting type, or nil to remove it.
+type Visitor interface {
+	// Enter returns the node to keep, and whether to walk its children.
+	Enter(node Node) (Node, bool)
+	// Exit returns the node to keep, once its children are walked.
+	Exit(node Node) Node
+}
+
+// VisitorFuncs is a Visitor made of functions, either of which may be nil.
+// A nil OnEnter walks the children of every node and a nil OnExit keeps
+// every node.
+type VisitorFuncs struct {
+	OnEnter func(node Node) (Node, bool)
+	OnExit  func(node Node) Node
+}
+
+func (f VisitorFuncs) Enter(node Node) (Node, bool) {
+	if f.OnEnter == nil {
+		return node, true
+	}
+	return f.OnEnter(node)
+}
+
+func (f VisitorFuncs) Exit(node Node) Node {
+	if f.OnExit == nil {
+		return node
+	}
+	return f.OnExit(node)
+}
+
+// Walk walks the tree rooted at node in source order, depth first, and
+// returns the node to put in its place. It visits entries, keys, section
+// names and Formes, values, the paths of Transform directives and comments.
+// Exit is called on every node Enter keeps, whether or not its children are
+// walked, and its children see the node Enter returned.
+//
+// A node replaced by nil is removed: from the body, array or comment list
+// holding it, or from the optional field holding it, such as the Value of a
+// KeyValue. Walk panics if a replacement does not fit where the node was, or
+// if a key, section name or Transform path is removed.
+//
+// Tools that rewrite documents, such as secret scrubbers and migrations, walk
+// the tree returned by ParseAST and write it back with Encoder.EncodeAST.
+func Walk(node Node, v Visitor) Node {
+	node, descend := v.Enter(node)
+	if node == nil {
+		return nil
+	}
+	if descend {
+		walkChildren(node, v)
+	}
+	return v.Exit(node)
+}
+
+// walkChildren walks the children of node, replacing them in node.
+func walkChildren(node Node, v Visitor) {
+	switch n := node.(type) {
+	case *Document:
+		n.Body = walkList(n.Body, v, "an entry")
+		n.Comments = walkList(n.Comments, v, "a comment")
+	case *Section:
+		n.Comments = walkList(n.Comments, v, "a comment")
+		n.Name = walkRequired(n.Name, v, "a section name")
+		if n.Forme != nil {
+			n.Forme = walkOptional(n.Forme, v, "a Forme")
+		}
+		if n.LineComment != nil {
+			n.LineComment = walkOptional(n.LineComment, v, "a comment")
+		}
+		n.Body = walkList(n.Body, v, "an entry")
+	case *KeyValue:
+		n.Comments = walkList(n.Comments, v, "a comment")
+		n.Key = walkRequired(n.Key, v, "a key")
+		if n.Value != nil {
+			n.Value = walkOptional(n.Value, v, "a value")
+		}
+		if n.LineComment != nil {
+			n.LineComment = walkOptional(n.LineComment, v, "a comment")
+		}
+	case *Include:
+		n.Comments = walkList(n.Comments, v, "a comment")
+		n.Path = walkRequired(n.Path, v, "a Transform path")
+		if n.LineComment != nil {
+			n.LineComment = walkOptional(n.LineComment, v, "a comment")
+		}
+	case *ArrayLit:
+		n.Elements = walkList(n.Elements, v, "a value")
+	case *ObjectLit:
+		n.Comments = walkList(n.Comments, v, "a comment")
+		n.Body = walkList(n.Body, v, "an entry")
+	}
+}
+
+// walkList walks the nodes of list, leaving out those removed.
+func walkList[T Node](list []T, v Visitor, what string) []T {
+	kept := list[:0]
+	for _, n := range list {
+		if r := Walk(n, v); r != nil {
+			kept = append(kept, fit[T](r, what))
+		}
+	}
+	clear(list[len(kept):])
+	return kept
+}
+
+// walkOptional walks n, which may be removed.
+func walkOptional[T Node](n T, v Visitor, what string) T {
+	r := Walk(n, v)
+	if r == nil {
+		var zero T
+		return zero
+	}
+	return fit[T](r, what)
+}
+
+// walkRequired walks n, which must not be removed.
+func walkRequired[T Node](n T, v Visitor, what string) T {
+	r := Walk(n, v)
+	if r == nil {
+		panic(fmt.Sprintf("ast: Walk cannot remove %s", what))
+	}
+	return fit[T](r, what)
+}
+
+// fit returns the replacement r as the type of the node it replaces.
+func fit[T Node](r Node, what string) T {
+	n, ok := r.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast: Walk cannot put a %T in place of %s", r, what))
+	}
+	return n
+}
@@ -0,0 +1,320 @@
+package bulbason
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+func TestParseAST(t *testing.T) {
+	input := `BULBA!
+app_name ~~> "Pokedex_API"
+
+(o) database (o)
+    host ~~~~> "127.0.0.1"
+    (O) pool (O)
+        sizes ~> <| 1, 2.5 |>
+flag ~> SuperEffective
+`
+	doc, err := ParseAST(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pos := func(line, col int) ast.Position { return ast.Position{Line: line, Column: col} }
+	span := func(l1, c1, l2, c2 int) ast.Span { return ast.Span{Start: pos(l1, c1), End: pos(l2, c2)} }
+
+	if got := doc.Span(); got != span(1, 1, 8, 22) {
+		t.Errorf("Unexpected document span %+v", got)
+	}
+	if len(doc.Body) != 3 {
+		t.Fatalf("Expected 3 root entries, got %d", len(doc.Body))
+	}
+
+	kv, ok := doc.Body[0].(*ast.KeyValue)
+	if !ok {
+		t.Fatalf("Expected a *ast.KeyValue, got %T", doc.Body[0])
+	}
+	if kv.Key.Name != "app_name" || kv.Key.Span() != span(2, 1, 2, 8) {
+		t.Errorf("Unexpected key %q at %+v", kv.Key.Name, kv.Key.Span())
+	}
+	if kv.Vine != span(2, 10, 2, 12) || kv.Tildes != 2 {
+		t.Errorf("Unexpected vine span %+v and %d tildes", kv.Vine, kv.Tildes)
+	}
+	if str, ok := kv.Value.(*ast.StringLit); !ok || str.Value != "Pokedex_API" || str.Span() != span(2, 14, 2, 26) {
+		t.Errorf("Unexpected value %#v", kv.Value)
+	}
+
+	db, ok := doc.Body[1].(*ast.Section)
+	if !ok {
+		t.Fatalf("Expected a *ast.Section, got %T", doc.Body[1])
+	}
+	if db.Level != 1 || db.Name.Name != "database" || db.Header != span(4, 1, 4, 16) || db.Span() != span(4, 1, 7, 29) {
+		t.Errorf("Unexpected section %q level %d header %+v span %+v", db.Name.Name, db.Level, db.Header, db.Span())
+	}
+
+	pool := db.Body[1].(*ast.Section)
+	sizes := pool.Body[0].(*ast.KeyValue)
+	arr, ok := sizes.Value.(*ast.ArrayLit)
+	if !ok || len(arr.Elements) != 2 || arr.Span() != span(7, 18, 7, 29) {
+		t.Fatalf("Unexpected array %#v", sizes.Value)
+	}
+	if num := arr.Elements[1].(*ast.NumberLit); num.Literal != "2.5" || num.Span() != span(7, 24, 7, 26) {
+		t.Errorf("Unexpected number %#v", num)
+	}
+
+	flag := doc.Body[2].(*ast.KeyValue)
+	if b, ok := flag.Value.(*ast.BoolLit); !ok || !b.Value || b.Span() != span(8, 9, 8, 22) {
+		t.Errorf("Unexpected bool %#v", flag.Value)
+	}
+}
+
+func TestParseAST_Errors(t *testing.T) {
+	if _, err := ParseAST("BULBA!\nkey ~> Nope\n"); err == nil || err.Error() != ErrType {
+		t.Errorf("Expected %q, got %v", ErrType, err)
+	}
+}
+
+func TestParseAST_Comments(t *testing.T) {
+	input := `BULBA!
+zZz Basic Configuration
+app_name ~~> "Pokedex_API" zZz Inline napping
+
+zZz Database Connection (Level 1)
+(o) database (o) zZz Level 1
+    host ~~~~> "127.0.0.1"
+zZz Trailing thoughts
+`
+	doc, err := ParseAST(input, ParseComments())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	kv := doc.Body[0].(*ast.KeyValue)
+	if len(kv.Comments) != 1 || kv.Comments[0].Text != "zZz Basic Configuration" {
+		t.Errorf("Unexpected leading comments %+v", kv.Comments)
+	}
+	if kv.LineComment == nil || kv.LineComment.Text != "zZz Inline napping" || kv.LineComment.Loc.Start != (ast.Position{Line: 3, Column: 28}) {
+		t.Errorf("Unexpected line comment %+v", kv.LineComment)
+	}
+
+	db := doc.Body[1].(*ast.Section)
+	if len(db.Comments) != 1 || db.Comments[0].Text != "zZz Database Connection (Level 1)" {
+		t.Errorf("Unexpected section comments %+v", db.Comments)
+	}
+	if db.LineComment == nil || db.LineComment.Text != "zZz Level 1" {
+		t.Errorf("Unexpected section line comment %+v", db.LineComment)
+	}
+	if len(doc.Comments) != 1 || doc.Comments[0].Text != "zZz Trailing thoughts" {
+		t.Errorf("Unexpected trailing comments %+v", doc.Comments)
+	}
+
+	// Without the option comments are dropped as before.
+	doc, err = ParseAST(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kv := doc.Body[0].(*ast.KeyValue); kv.Comments != nil || kv.LineComment != nil || doc.Comments != nil {
+		t.Errorf("Expected no comments without ParseComments")
+	}
+}
+
+func TestParseAST_HeredocSpan(t *testing.T) {
+	input := "BULBA!\nquery ~~> \"\"\"\n    SELECT *\n    FROM pokedex\n    \"\"\"\n"
+	doc, err := ParseAST(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	str := doc.Body[0].(*ast.KeyValue).Value.(*ast.StringLit)
+	want := ast.Span{Start: ast.Position{Line: 2, Column: 11}, End: ast.Position{Line: 5, Column: 7}}
+	if str.Loc != want {
+		t.Errorf("Expected span %+v, got %+v", want, str.Loc)
+	}
+}
+
+func TestParseAST_InlineObject(t *testing.T) {
+	doc, err := ParseAST("BULBA!\npoint ~~> { x ~> 1, y ~> 2 }\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	obj, ok := doc.Body[0].(*ast.KeyValue).Value.(*ast.ObjectLit)
+	if !ok || !obj.Inline || len(obj.Body) != 2 {
+		t.Fatalf("Expected an inline object with two members, got %#v", doc.Body[0].(*ast.KeyValue).Value)
+	}
+	want := ast.Span{Start: ast.Position{Line: 2, Column: 11}, End: ast.Position{Line: 2, Column: 28}}
+	if obj.Span() != want {
+		t.Errorf("Expected span %+v, got %+v", want, obj.Span())
+	}
+	if y := obj.Body[1].(*ast.KeyValue); y.Key.Loc.Start != (ast.Position{Line: 2, Column: 21}) {
+		t.Errorf("Unexpected member key position %+v", y.Key.Loc.Start)
+	}
+}
+
+func TestParseAST_NumberWithSeparators(t *testing.T) {
+	doc, err := ParseAST("BULBA!\nn ~~> 1_000_000\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	num := doc.Body[0].(*ast.KeyValue).Value.(*ast.NumberLit)
+	if num.Literal != "1000000" {
+		t.Errorf("Expected separators to be removed, got %q", num.Literal)
+	}
+	want := ast.Span{Start: ast.Position{Line: 2, Column: 7}, End: ast.Position{Line: 2, Column: 15}}
+	if num.Loc != want {
+		t.Errorf("Expected span %+v, got %+v", want, num.Loc)
+	}
+}
+
+func TestParseAST_QuotedKeySpan(t *testing.T) {
+	doc, err := ParseAST("BULBA!\n\"a-b\" ~> 1\n(o) \"c.d\" (o)\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	key := doc.Body[0].(*ast.KeyValue).Key
+	if key.Name != "a-b" || key.Loc.End != (ast.Position{Line: 2, Column: 5}) {
+		t.Errorf("Unexpected key %+v", key)
+	}
+	name := doc.Body[1].(*ast.Section).Name
+	if name.Name != "c.d" || name.Loc.Start != (ast.Position{Line: 3, Column: 5}) || name.Loc.End != (ast.Position{Line: 3, Column: 9}) {
+		t.Errorf("Unexpected section name %+v", name)
+	}
+}
+
+func TestParseAST_BlockComments(t *testing.T) {
+	input := `BULBA!
+zZz[ Hypnosis
+     two lines ]zZz
+key ~> 1 zZz[ trailing ]zZz
+`
+	doc, err := ParseAST(input, ParseComments())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	kv := doc.Body[0].(*ast.KeyValue)
+	expected := &ast.Comment{
+		Text: "zZz[ Hypnosis\n     two lines ]zZz",
+		Loc:  ast.Span{Start: ast.Position{Line: 2, Column: 1}, End: ast.Position{Line: 3, Column: 19}},
+	}
+	if len(kv.Comments) != 1 || *kv.Comments[0] != *expected {
+		t.Errorf("Unexpected leading comments %+v", kv.Comments)
+	}
+	if kv.LineComment == nil || kv.LineComment.Text != "zZz[ trailing ]zZz" || kv.LineComment.Loc.End != (ast.Position{Line: 4, Column: 27}) {
+		t.Errorf("Unexpected line comment %+v", kv.LineComment)
+	}
+}
+
+func TestWalkAST(t *testing.T) {
+	input := `BULBA!
+zZz Secrets of the database.
+(o) database (o)
+    host ~> "db"
+    password ~> "hunter2"
+    users ~> <| { name ~> "ash", password ~> "pikachu" } |>
+debug ~> SuperEffective
+`
+	doc, err := ParseAST(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var order []string
+	scrub := ast.VisitorFuncs{
+		OnEnter: func(n ast.Node) (ast.Node, bool) {
+			switch n := n.(type) {
+			case *ast.KeyValue:
+				order = append(order, "enter "+n.Key.Name)
+				if n.Key.Name == "debug" {
+					return nil, false
+				}
+			case *ast.Comment:
+				return nil, false
+			}
+			return n, true
+		},
+		OnExit: func(n ast.Node) ast.Node {
+			if kv, ok := n.(*ast.KeyValue); ok {
+				order = append(order, "exit "+kv.Key.Name)
+				if kv.Key.Name == "password" {
+					kv.Value = &ast.StringLit{Value: "***"}
+				}
+			}
+			return n
+		},
+	}
+	if ast.Walk(doc, scrub) != doc {
+		t.Error("Expected the document to be kept")
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `BULBA!
+(o) database (o)
+    host ~~~~> "db"
+    password ~~~~> "***"
+    users ~~~~> <| { name ~~~~> "ash", password ~~~~> "***" } |>
+`
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, buf.String())
+	}
+	wantOrder := "enter host,exit host,enter password,exit password,enter users," +
+		"enter name,exit name,enter password,exit password,exit users,enter debug"
+	if got := strings.Join(order, ","); got != wantOrder {
+		t.Errorf("Expected order %s, got %s", wantOrder, got)
+	}
+}
+
+func TestWalkAST_Replace(t *testing.T) {
+	doc, err := ParseAST("BULBA!\nold_name ~> <| 1, 2, 3 |>\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Keys are renamed by replacing their Ident, and array elements are
+	// removed by replacing them with nil.
+	ast.Walk(doc, ast.VisitorFuncs{OnExit: func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if n.Name == "old_name" {
+				return &ast.Ident{Name: "new_name"}
+			}
+		case *ast.NumberLit:
+			if n.Literal == "2" {
+				return nil
+			}
+		}
+		return n
+	}})
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "BULBA!\nnew_name ~~~~> <| 1, 3 |>\n"; buf.String() != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, buf.String())
+	}
+
+	for name, replace := range map[string]func(ast.Node) ast.Node{
+		"value for a key": func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.Ident); ok {
+				return &ast.NullLit{}
+			}
+			return n
+		},
+		"removed key": func(n ast.Node) ast.Node {
+			if _, ok := n.(*ast.Ident); ok {
+				return nil
+			}
+			return n
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			ast.Walk(doc, ast.VisitorFuncs{OnExit: replace})
+		}()
+	}
+}
@@ -0,0 +1,321 @@
+package bulbason
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// The binary encoding holds the values of a parsed document in a compact,
+// length-prefixed form, for caching documents and sending them between
+// services without parsing them again. It starts with binaryMagic and a
+// version byte, followed by the members of the document. Each value is a
+// tag byte and a payload; lengths and counts are unsigned varints. The
+// layout is given in section 9 of BSON_Format.md.
+const (
+	binaryMagic   = "BULB"
+	binaryVersion = 1
+
+	// binaryMaxDepth bounds the nesting of the values being decoded, so
+	// that hostile input cannot exhaust the stack.
+	binaryMaxDepth = 1000
+)
+
+// Tags of the values in the binary encoding.
+const (
+	tagNull     byte = 0x00
+	tagFalse    byte = 0x01
+	tagTrue     byte = 0x02
+	tagInt      byte = 0x03 // Zig-zag varint
+	tagUint     byte = 0x04 // Varint
+	tagFloat    byte = 0x05 // 8 bytes, little-endian IEEE 754
+	tagString   byte = 0x06 // Length, UTF-8 bytes
+	tagBytes    byte = 0x07 // Length, bytes
+	tagTime     byte = 0x08 // Length, time.Time.MarshalBinary
+	tagDuration byte = 0x09 // Zig-zag varint of nanoseconds
+	tagBigInt   byte = 0x0A // Length, decimal digits
+	tagNumber   byte = 0x0B // Length, literal
+	tagArray    byte = 0x0C // Count, values
+	tagSections byte = 0x0D // Count, sections without their tag
+	tagSection  byte = 0x0E // Count, then a length-prefixed key and a value each
+)
+
+// MarshalBinary returns the binary encoding of d. Members are written in
+// key order, so equal documents have equal encodings. It accepts the values
+// Parse returns, other integer and float types, and Documents nested in d.
+func (d Document) MarshalBinary() ([]byte, error) {
+	buf := append([]byte(binaryMagic), binaryVersion)
+	return appendSection(buf, d)
+}
+
+// UnmarshalBinary replaces the contents of d with the document encoded in
+// data by MarshalBinary. Values come back as Parse returns them.
+func (d *Document) UnmarshalBinary(data []byte) error {
+	if len(data) < len(binaryMagic)+1 || string(data[:len(binaryMagic)]) != binaryMagic {
+		return fmt.Errorf("bulbason: invalid binary document, missing the %s header", binaryMagic)
+	}
+	if v := data[len(binaryMagic)]; v != binaryVersion {
+		return fmt.Errorf("bulbason: unsupported binary document version %d", v)
+	}
+	r := binaryReader{data: data, pos: len(binaryMagic) + 1}
+	m, err := r.section(0)
+	if err != nil {
+		return err
+	}
+	if r.pos != len(data) {
+		return r.errorf("unexpected data after the document")
+	}
+	*d = m
+	return nil
+}
+
+// appendSection appends the members of m, without a tag.
+func appendSection(buf []byte, m map[string]interface{}) ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	for _, k := range keys {
+		buf = appendString(buf, k)
+		var err error
+		if buf, err = appendValue(buf, m[k]); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendValue appends the tag and payload of v.
+func appendValue(buf []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch v := normalizeValue(v).(type) {
+	case nil:
+		return append(buf, tagNull), nil
+	case bool:
+		if v {
+			return append(buf, tagTrue), nil
+		}
+		return append(buf, tagFalse), nil
+	case int64:
+		return binary.AppendVarint(append(buf, tagInt), v), nil
+	case uint64:
+		return binary.AppendUvarint(append(buf, tagUint), v), nil
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(buf, tagFloat), math.Float64bits(v)), nil
+	case string:
+		return appendString(append(buf, tagString), v), nil
+	case []byte:
+		return appendString(append(buf, tagBytes), string(v)), nil
+	case time.Time:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("bulbason: cannot encode time %v: %w", v, err)
+		}
+		return appendString(append(buf, tagTime), string(b)), nil
+	case time.Duration:
+		return binary.AppendVarint(append(buf, tagDuration), int64(v)), nil
+	case *big.Int:
+		return appendString(append(buf, tagBigInt), v.String()), nil
+	case Number:
+		return appendString(append(buf, tagNumber), string(v)), nil
+	case []interface{}:
+		buf = binary.AppendUvarint(append(buf, tagArray), uint64(len(v)))
+		for _, elem := range v {
+			if buf, err = appendValue(buf, elem); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case []map[string]interface{}:
+		buf = binary.AppendUvarint(append(buf, tagSections), uint64(len(v)))
+		for _, section := range v {
+			if buf, err = appendSection(buf, section); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		return appendSection(append(buf, tagSection), v)
+	case Document:
+		return appendSection(append(buf, tagSection), v)
+	default:
+		return nil, fmt.Errorf("bulbason: cannot encode value of type %T in binary form", v)
+	}
+}
+
+// appendString appends the length of s and s.
+func appendString(buf []byte, s string) []byte {
+	return append(binary.AppendUvarint(buf, uint64(len(s))), s...)
+}
+
+// binaryReader decodes the values of a binary document.
+type binaryReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *binaryReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("bulbason: invalid binary document at offset %d: %s", r.pos, fmt.Sprintf(format, args...))
+}
+
+// section reads the members of a section, without a tag.
+func (r *binaryReader) section(depth int) (map[string]interface{}, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := m[string(key)]; exists {
+			return nil, r.errorf("duplicate key %q", key)
+		}
+		if m[string(key)], err = r.value(depth); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// value reads a tag and its payload.
+func (r *binaryReader) value(depth int) (interface{}, error) {
+	if depth >= binaryMaxDepth {
+		return nil, r.errorf("values nested more than %d deep", binaryMaxDepth)
+	}
+	if r.pos >= len(r.data) {
+		return nil, r.errorf("unexpected end of data")
+	}
+	tag := r.data[r.pos]
+	r.pos++
+	switch tag {
+	case tagNull:
+		return nil, nil
+	case tagFalse:
+		return false, nil
+	case tagTrue:
+		return true, nil
+	case tagInt, tagDuration:
+		n, size := binary.Varint(r.data[r.pos:])
+		if size <= 0 {
+			return nil, r.errorf("invalid varint")
+		}
+		r.pos += size
+		if tag == tagDuration {
+			return time.Duration(n), nil
+		}
+		return n, nil
+	case tagUint:
+		return r.uvarint()
+	case tagFloat:
+		if len(r.data)-r.pos < 8 {
+			return nil, r.errorf("unexpected end of data")
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos:]))
+		r.pos += 8
+		return f, nil
+	case tagString, tagBytes, tagTime, tagBigInt, tagNumber:
+		start := r.pos
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagString:
+			return string(b), nil
+		case tagBytes:
+			return slices.Clone(b), nil
+		case tagTime:
+			var t time.Time
+			if err := t.UnmarshalBinary(b); err != nil {
+				r.pos = start
+				return nil, r.errorf("invalid time: %v", err)
+			}
+			return t, nil
+		case tagBigInt:
+			n, ok := new(big.Int).SetString(string(b), 10)
+			if !ok {
+				r.pos = start
+				return nil, r.errorf("invalid integer %q", b)
+			}
+			return n, nil
+		default:
+			return Number(b), nil
+		}
+	case tagArray:
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		var arr []interface{}
+		for i := 0; i < n; i++ {
+			elem, err := r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, elem)
+		}
+		return arr, nil
+	case tagSections:
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		var sections []map[string]interface{}
+		for i := 0; i < n; i++ {
+			section, err := r.section(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			sections = append(sections, section)
+		}
+		return sections, nil
+	case tagSection:
+		return r.section(depth + 1)
+	default:
+		r.pos--
+		return nil, r.errorf("unknown tag 0x%02x", tag)
+	}
+}
+
+// uvarint reads an unsigned varint.
+func (r *binaryReader) uvarint() (uint64, error) {
+	n, size := binary.Uvarint(r.data[r.pos:])
+	if size <= 0 {
+		return 0, r.errorf("invalid varint")
+	}
+	r.pos += size
+	return n, nil
+}
+
+// count reads the number of items that follow. Every item takes at least a
+// byte, which bounds the count by what is left of the data.
+func (r *binaryReader) count() (int, error) {
+	n, err := r.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		return 0, r.errorf("count %d past the end of data", n)
+	}
+	return int(n), nil
+}
+
+// bytes reads a length-prefixed byte string, sharing the memory of the data.
+func (r *binaryReader) bytes() ([]byte, error) {
+	n, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
@@ -0,0 +1,133 @@
+package bulbason
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocument_MarshalBinary(t *testing.T) {
+	input := `BULBA!
+name ~> "Pokedex_API"
+level ~> -42
+ratio ~> 0.25
+debug ~> SuperEffective
+cache ~> MissingNo
+started ~> 2024-05-01T10:00:00Z
+timeout ~> 1m30s
+blob ~> 0b64"aGk="
+tags ~> <| "a", 1, { x ~> 2 } |>
+empty ~> <| |>
+(o) database (o)
+    host ~> "db"
+servers ~> <|
+(o)
+    port ~> 80
+(o)
+    port ~> 81
+|>
+`
+	m, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := Document(m).MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("BULB\x01")) {
+		t.Errorf("Expected the BULB header, got %q", data[:5])
+	}
+	var doc Document
+	if err := doc.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(map[string]interface{}(doc), m) {
+		t.Errorf("Expected %v, got %v", m, doc)
+	}
+
+	// Members are written in key order, whatever the order of the map.
+	again, _ := doc.MarshalBinary()
+	if !bytes.Equal(data, again) {
+		t.Error("Expected equal documents to have equal encodings")
+	}
+}
+
+func TestDocument_MarshalBinaryTypes(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	doc := Document{
+		"small":  int8(-3),
+		"large":  uint64(1 << 63),
+		"single": float32(1.5),
+		"big":    huge,
+		"number": Number("1e3"),
+		"nested": Document{"ok": true},
+	}
+	data, err := doc.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded Document
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := Document{
+		"small":  int64(-3),
+		"large":  uint64(1 << 63),
+		"single": 1.5,
+		"big":    huge,
+		"number": Number("1e3"),
+		"nested": map[string]interface{}{"ok": true},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %v, got %v", expected, decoded)
+	}
+
+	if _, err := (Document{"bad": struct{}{}}).MarshalBinary(); err == nil || !strings.Contains(err.Error(), "cannot encode value of type struct {}") {
+		t.Errorf("Expected an error for a struct, got %v", err)
+	}
+}
+
+func TestDocument_UnmarshalBinaryErrors(t *testing.T) {
+	valid, _ := (Document{"k": "value"}).MarshalBinary()
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", "", "missing the BULB header"},
+		{"version", "BULB\x02", "unsupported binary document version 2"},
+		{"truncated", string(valid[:len(valid)-1]), "offset 10: count 5 past the end of data"},
+		{"trailing", string(valid) + "x", "unexpected data after the document"},
+		{"tag", "BULB\x01\x01\x01kz", "offset 8: unknown tag 0x7a"},
+		{"count", "BULB\x01\xff\xff\xff\xff\x0f", "past the end of data"},
+		{"duplicate", "BULB\x01\x02\x01k\x00\x01k\x00", "duplicate key \"k\""},
+		{"depth", "BULB\x01\x01\x01k" + strings.Repeat("\x0c\x01", 2000), "nested more than 1000 deep"},
+	}
+	for _, tt := range tests {
+		var doc Document
+		if err := doc.UnmarshalBinary([]byte(tt.data)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func BenchmarkDocument_UnmarshalBinary(b *testing.B) {
+	m, err := Parse(benchInput)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data, err := Document(m).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var doc Document
+		if err := doc.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
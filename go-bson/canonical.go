@@ -0,0 +1,62 @@
+package bulbason
+
+import (
+	"crypto/sha256"
+)
+
+// Canonicalize returns the canonical form of a parsed document: the one way
+// of writing its values, whatever the layout, comments, key order or
+// references of the source. Documents holding the same values have the same
+// canonical form, byte for byte, which makes it fit for detecting changes and
+// for signing. The rules are given in section 10 of BSON_Format.md; in short,
+// it is the output of Marshal for the document, with keys in byte order,
+// 4-space indents, ~~~~> Vine Whips, and inline objects written as sections.
+//
+// Numbers kept as written by the UseNumber option are written as the int64,
+// float64 or *big.Int they stand for, so that the option makes no
+// difference.
+func Canonicalize(doc map[string]interface{}) ([]byte, error) {
+	return Marshal(canonicalValue(doc))
+}
+
+// Hash returns the SHA-256 digest of the canonical form of doc.
+func Hash(doc map[string]interface{}) ([sha256.Size]byte, error) {
+	b, err := Canonicalize(doc)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
+
+// canonicalValue returns a copy of v with every Number replaced by its value.
+func canonicalValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Number:
+		if n, err := parseNumber(string(v), LargeIntegerBig); err == nil {
+			return n
+		}
+		return v
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = canonicalValue(val)
+		}
+		return m
+	case Document:
+		return canonicalValue(map[string]interface{}(v))
+	case []map[string]interface{}:
+		sections := make([]map[string]interface{}, len(v))
+		for i, section := range v {
+			sections[i] = canonicalValue(section).(map[string]interface{})
+		}
+		return sections
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, elem := range v {
+			arr[i] = canonicalValue(elem)
+		}
+		return arr
+	default:
+		return v
+	}
+}
@@ -0,0 +1,78 @@
+package bulbason
+
+import (
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	first := `BULBA!
+zZz The same values, written two ways.
+port ~> 8080
+name ~~~~~~> "api"
+(o) database (o)
+    host ~> "db"
+    hosts ~> <| "a", "b" |>
+replica ~> Copycat database.host
+`
+	second := `BULBA!
+name ~> "api"
+database ~> { hosts ~> <| "a", "b" |>, host ~> "db" }
+replica ~> "db"
+port ~~> 8_080
+`
+	expected := `BULBA!
+name ~~~~> "api"
+port ~~~~> 8080
+replica ~~~~> "db"
+(o) database (o)
+    host ~~~~> "db"
+    hosts ~~~~> <| "a", "b" |>
+`
+	var hashes [][32]byte
+	for _, input := range []string{first, second} {
+		for _, opts := range [][]ParseOption{nil, {UseNumber()}} {
+			doc, err := Parse(input, opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			out, err := Canonicalize(doc)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(out) != expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+			}
+			h, err := Hash(doc)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			hashes = append(hashes, h)
+		}
+	}
+	for _, h := range hashes[1:] {
+		if h != hashes[0] {
+			t.Errorf("Expected equal hashes, got %x and %x", hashes[0], h)
+		}
+	}
+
+	changed, _ := Parse(second + "debug ~> SuperEffective\n")
+	if h, _ := Hash(changed); h == hashes[0] {
+		t.Error("Expected a different hash for different values")
+	}
+}
+
+func TestCanonicalize_DoesNotModify(t *testing.T) {
+	doc, err := Parse("BULBA!\nport ~> 8080\nlist ~> <| 1.5 |>\n", UseNumber())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := Canonicalize(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if doc["port"] != Number("8080") || doc["list"].([]interface{})[0] != Number("1.5") {
+		t.Errorf("Expected the numbers to be left as they are, got %v", doc)
+	}
+	if _, err := Canonicalize(map[string]interface{}{"": 1}); err == nil {
+		t.Error("Expected an error for an empty key")
+	}
+}
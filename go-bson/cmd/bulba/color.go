@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// ANSI escape sequences coloring the parts of a document.
+const (
+	colorKey    = "\x1b[1;34m"
+	colorString = "\x1b[32m"
+	colorNumber = "\x1b[36m"
+	colorBool   = "\x1b[33m"
+	colorNull   = "\x1b[90m"
+	colorReset  = "\x1b[0m"
+)
+
+// useColor reports whether output to f is colored, given the value of a
+// -color flag: always, never, or auto, which colors terminals unless the
+// NO_COLOR variable is set, as https://no-color.org asks, or TERM is dumb.
+func useColor(mode string, f *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("invalid -color %q, want auto, always or never", mode)
+}
+
+// colorBSON returns src, the body of a document without its header, with the
+// keys and literals starting at or after the byte offset from colored. src is
+// returned as it is if it does not parse.
+func colorBSON(src []byte, from int) []byte {
+	doc, err := bulbason.ParseAST("BULBA!\n" + string(src))
+	if err != nil {
+		return src
+	}
+	lines := []int{0}
+	for i, c := range src {
+		if c == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	// offset returns the offset in src of a position in the parsed text,
+	// whose first line is the header.
+	offset := func(pos ast.Position) int {
+		return lines[pos.Line-2] + pos.Column - 1
+	}
+
+	var out bytes.Buffer
+	done := 0
+	paint := func(loc ast.Span, color string) {
+		start := offset(loc.Start)
+		if start < from || start < done {
+			return
+		}
+		end := offset(loc.End)
+		_, size := utf8.DecodeRune(src[end:])
+		end += size
+		out.Write(src[done:start])
+		out.WriteString(color)
+		out.Write(src[start:end])
+		out.WriteString(colorReset)
+		done = end
+	}
+	ast.Walk(doc, ast.VisitorFuncs{OnEnter: func(n ast.Node) (ast.Node, bool) {
+		switch n := n.(type) {
+		case *ast.Ident:
+			paint(n.Loc, colorKey)
+		case *ast.StringLit, *ast.BytesLit:
+			paint(n.Span(), colorString)
+		case *ast.NumberLit, *ast.TimeLit, *ast.DurationLit:
+			paint(n.Span(), colorNumber)
+		case *ast.BoolLit:
+			paint(n.Loc, colorBool)
+		case *ast.NullLit:
+			paint(n.Loc, colorNull)
+		}
+		return n, true
+	}})
+	out.Write(src[done:])
+	return out.Bytes()
+}
+
+// colorTree returns src, tree as written by Fprint in the tree format, with
+// its keys and values colored. The keys and values are found in src in the
+// order Fprint writes them; src is returned as it is if one is missing.
+func colorTree(src []byte, tree map[string]interface{}) []byte {
+	var out bytes.Buffer
+	done := 0
+	// paint colors the first occurrence of text after the part of src done.
+	paint := func(text, color string) bool {
+		i := bytes.Index(src[done:], []byte(text))
+		if i < 0 {
+			return false
+		}
+		out.Write(src[done : done+i])
+		if text != "" && color != "" {
+			out.WriteString(color)
+			out.WriteString(text)
+			out.WriteString(colorReset)
+		} else {
+			out.WriteString(text)
+		}
+		done += i + len(text)
+		return true
+	}
+	var walk func(v interface{}) bool
+	walk = func(v interface{}) bool {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if !paint(key, colorKey) || !walk(v[key]) {
+					return false
+				}
+			}
+		case []map[string]interface{}:
+			for _, elem := range v {
+				if !walk(elem) {
+					return false
+				}
+			}
+		case []interface{}:
+			for _, elem := range v {
+				if !walk(elem) {
+					return false
+				}
+			}
+		default:
+			return paint(fmt.Sprint(v), scalarColor(v))
+		}
+		return true
+	}
+	if !walk(tree) {
+		return src
+	}
+	out.Write(src[done:])
+	return out.Bytes()
+}
+
+// scalarColor returns the color of a value as returned by Parse, or "" for
+// one left uncolored.
+func scalarColor(v interface{}) string {
+	switch v.(type) {
+	case string, []byte:
+		return colorString
+	case int64, uint64, float64, *big.Int, bulbason.Number, time.Time, time.Duration:
+		return colorNumber
+	case bool:
+		return colorBool
+	case nil:
+		return colorNull
+	}
+	return ""
+}
+
+// colorJSON returns src, JSON as written by json.Indent, with its keys and
+// literals colored.
+func colorJSON(src []byte) []byte {
+	var out bytes.Buffer
+	paint := func(text []byte, color string) {
+		out.WriteString(color)
+		out.Write(text)
+		out.WriteString(colorReset)
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			// A string followed by a colon is a key.
+			color := colorString
+			if rest := bytes.TrimLeft(src[end:], " "); len(rest) > 0 && rest[0] == ':' {
+				color = colorKey
+			}
+			paint(src[i:end], color)
+			i = end
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(src) && bytes.IndexByte([]byte("0123456789+-.eE"), src[end]) >= 0 {
+				end++
+			}
+			paint(src[i:end], colorNumber)
+			i = end
+		case bytes.HasPrefix(src[i:], []byte("true")):
+			paint(src[i:i+4], colorBool)
+			i += 4
+		case bytes.HasPrefix(src[i:], []byte("false")):
+			paint(src[i:i+5], colorBool)
+			i += 5
+		case bytes.HasPrefix(src[i:], []byte("null")):
+			paint(src[i:i+4], colorNull)
+			i += 4
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+)
+
+// stripColor removes the ANSI escape sequences from s.
+func stripColor(s string) string {
+	return regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAllString(s, "")
+}
+
+func TestUseColor(t *testing.T) {
+	// /dev/null is a character device, and so stands in for a terminal.
+	terminal, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skipf("Cannot open %s: %v", os.DevNull, err)
+	}
+	defer terminal.Close()
+	if info, err := terminal.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		t.Skipf("%s is not a character device", os.DevNull)
+	}
+	file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		name     string
+		mode     string
+		noColor  string
+		term     string
+		f        *os.File
+		expected bool
+	}{
+		{"auto on a terminal", "auto", "", "xterm", terminal, true},
+		{"auto on a file", "auto", "", "xterm", file, false},
+		{"auto with NO_COLOR", "auto", "1", "xterm", terminal, false},
+		{"auto with TERM=dumb", "auto", "", "dumb", terminal, false},
+		{"always on a file", "always", "", "xterm", file, true},
+		{"always with NO_COLOR", "always", "1", "dumb", terminal, true},
+		{"never on a terminal", "never", "", "xterm", terminal, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			t.Setenv("TERM", tt.term)
+			color, err := useColor(tt.mode, tt.f)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if color != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, color)
+			}
+		})
+	}
+
+	if _, err := useColor("sometimes", terminal); err == nil {
+		t.Error("Expected an error for an invalid mode")
+	}
+}
+
+func TestColorJSON(t *testing.T) {
+	src := `{
+  "say": "he said \"hi\": \\",
+  "list": [1, -2.5e3, true, false, null]
+}
+`
+	expected := "{\n" +
+		"  " + colorKey + `"say"` + colorReset + ": " + colorString + `"he said \"hi\": \\"` + colorReset + ",\n" +
+		"  " + colorKey + `"list"` + colorReset + ": [" +
+		colorNumber + "1" + colorReset + ", " +
+		colorNumber + "-2.5e3" + colorReset + ", " +
+		colorBool + "true" + colorReset + ", " +
+		colorBool + "false" + colorReset + ", " +
+		colorNull + "null" + colorReset + "]\n" +
+		"}\n"
+	if got := string(colorJSON([]byte(src))); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestColorTree(t *testing.T) {
+	doc, err := bulbason.Parse(`BULBA!
+name ~> "port"
+port ~> 8080
+on ~> SuperEffective
+none ~> MissingNo
+servers ~> <|
+(o)
+    host ~> "a"
+|>
+tags ~> <| "grass", <| 1, 2 |> |>
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var tree strings.Builder
+	if err := bulbason.Fprint(&tree, doc, bulbason.PrintTree); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := string(colorTree([]byte(tree.String()), doc))
+	if stripped := stripColor(got); stripped != tree.String() {
+		t.Errorf("Expected the text to be kept, got %q", stripped)
+	}
+	for _, want := range []string{
+		colorKey + "name" + colorReset + ": " + colorString + "port" + colorReset + "\n",
+		colorKey + "port" + colorReset + ": " + colorNumber + "8080" + colorReset + "\n",
+		colorKey + "on" + colorReset + ": " + colorBool + "true" + colorReset + "\n",
+		colorKey + "none" + colorReset + ": " + colorNull + "<nil>" + colorReset + "\n",
+		"  " + colorKey + "host" + colorReset + ": " + colorString + "a" + colorReset + "\n",
+		"    - " + colorNumber + "2" + colorReset + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in %q", want, got)
+		}
+	}
+
+	// Text that does not match the document is left as it is.
+	if got := string(colorTree([]byte("other: text\n"), doc)); got != "other: text\n" {
+		t.Errorf("Expected the text to be kept, got %q", got)
+	}
+}
+
+func TestColorBSON(t *testing.T) {
+	src := "v ~> { a ~> \"x\", b ~> 1 }\n"
+	expected := "v ~> { " + colorKey + "a" + colorReset + " ~> " + colorString + `"x"` + colorReset +
+		", " + colorKey + "b" + colorReset + " ~> " + colorNumber + "1" + colorReset + " }\n"
+	if got := string(colorBSON([]byte(src), len("v ~> "))); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// readers convert a document from each format bulba convert knows.
+var readers = map[string]func(src []byte) (*ast.Document, error){
+	"bulba": func(src []byte) (*ast.Document, error) {
+		return bulbason.ParseAST(string(src), bulbason.ParseComments())
+	},
+	"json": bulbason.FromJSON,
+	"yaml": bulbason.FromYAML,
+	"toml": bulbason.FromTOML,
+}
+
+// writers convert a document to each format bulba convert knows.
+var writers = map[string]func(doc *ast.Document) ([]byte, error){
+	"bulba": func(doc *ast.Document) ([]byte, error) {
+		var buf bytes.Buffer
+		err := bulbason.NewEncoder(&buf).EncodeAST(doc)
+		return buf.Bytes(), err
+	},
+	"json": func(doc *ast.Document) ([]byte, error) {
+		data, err := bulbason.ToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		json.Indent(&buf, data, "", "  ")
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	},
+	"yaml": bulbason.ToYAML,
+	"toml": bulbason.ToTOML,
+}
+
+// extensions maps file extensions to the format they usually hold.
+var extensions = map[string]string{
+	".bson": "bulba",
+	".blb":  "bulba",
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "toml",
+}
+
+// runConvert converts the named files, or standard input, from one format to
+// another and writes the results to standard output.
+func runConvert(args []string) int {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := flags.String("from", "", "format of the input: json, yaml, toml or bulba (default: from the file extension, else bulba)")
+	to := flags.String("to", "", "format of the output: json, yaml, toml or bulba")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: bulba convert [--from format] --to format [file ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	write, ok := writers[*to]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "bulba convert: unknown output format %q\n", *to)
+		flags.Usage()
+		return 2
+	}
+	if _, ok := readers[*from]; *from != "" && !ok {
+		fmt.Fprintf(os.Stderr, "bulba convert: unknown input format %q\n", *from)
+		flags.Usage()
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	status := 0
+	for _, path := range paths {
+		format := *from
+		if format == "" {
+			format = extensions[strings.ToLower(filepath.Ext(path))]
+		}
+		if format == "" {
+			format = "bulba"
+		}
+
+		name, src, err := readInput(path)
+		var out []byte
+		if err == nil {
+			var doc *ast.Document
+			if doc, err = readers[format](src); err == nil {
+				out, err = write(doc)
+			}
+		}
+		if err != nil {
+			printError(name, err)
+			status = 1
+			continue
+		}
+		os.Stdout.Write(out)
+	}
+	return status
+}
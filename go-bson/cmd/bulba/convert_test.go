@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunConvert(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.json":    `{"name": "Bulby", "port": 8080}`,
+		"a.conf":    "BULBA!\nname ~> \"Bulby\" zZz kept\n",
+		"good.bson": "BULBA!\nname ~> \"Bulby\"\n",
+		"bad.bson":  "BULBA!\nname ~> \"Bulby\n",
+	})
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{
+			name:   "format from the extension",
+			args:   []string{"--to", "bulba", "a.json"},
+			stdout: "BULBA!\nname ~~~~> \"Bulby\"\nport ~~~~> 8080\n",
+		},
+		{
+			name:   "unknown extension read as BSON",
+			args:   []string{"--to", "bulba", "a.conf"},
+			stdout: "BULBA!\nname ~~~~> \"Bulby\" zZz kept\n",
+		},
+		{
+			name:   "to YAML",
+			args:   []string{"--to", "yaml", "good.bson"},
+			stdout: "name: Bulby\n",
+		},
+		{
+			name:   "standard input",
+			args:   []string{"--from", "json", "--to", "json"},
+			stdin:  `{"port":8080}`,
+			stdout: "{\n  \"port\": 8080\n}\n",
+		},
+		{
+			name:   "later files converted after an error",
+			args:   []string{"--to", "json", "bad.bson", "good.bson"},
+			stdout: "{\n  \"name\": \"Bulby\"\n}\n",
+			stderr: `bad.bson:2:9: Target is immune! ("\"Bulby" is not a value; strings need quotes, booleans are SuperEffective and NotVeryEffective, and null is MissingNo)
+    name ~> "Bulby
+            ^
+`,
+			code: 1,
+		},
+		{
+			name:   "unknown output format",
+			args:   []string{"--to", "xml", "good.bson"},
+			stderr: "bulba convert: unknown output format \"xml\"\nusage: bulba convert",
+			code:   2,
+		},
+		{
+			name:   "unknown input format",
+			args:   []string{"--from", "ini", "--to", "json", "good.bson"},
+			stderr: "bulba convert: unknown input format \"ini\"\nusage: bulba convert",
+			code:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = arg
+				if strings.Contains(arg, ".") {
+					args[i] = filepath.Join(dir, arg)
+				}
+			}
+			stdout, stderr, code := runCommand(t, runConvert, dir, tt.stdin, args...)
+			if code != tt.code {
+				t.Errorf("Expected exit status %d, got %d", tt.code, code)
+			}
+			if stdout != tt.stdout {
+				t.Errorf("Expected output %q, got %q", tt.stdout, stdout)
+			}
+			// Usage errors are followed by the flags, which are not compared.
+			if code == 2 && !strings.HasPrefix(stderr, tt.stderr) || code != 2 && stderr != tt.stderr {
+				t.Errorf("Expected errors %q, got %q", tt.stderr, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+)
+
+// runDiff compares two documents and prints the keys added, removed and
+// changed between them.
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	exitCode := flags.Bool("exit-code", false, "exit with status 1 if the documents differ")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: bulba diff [--exit-code] old new")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	var docs [2]map[string]interface{}
+	for i, path := range flags.Args() {
+		name, src, err := readInput(path)
+		if err == nil {
+			docs[i], err = bulbason.Parse(string(src), includes(path))
+		}
+		if err != nil {
+			printError(name, err)
+			return 2
+		}
+	}
+
+	changes := bulbason.Diff(docs[0], docs[1])
+	for _, c := range changes {
+		switch c.Kind {
+		case bulbason.ChangeAdded:
+			fmt.Printf("+ %s: %s\n", c.Path, formatValue(c.New))
+		case bulbason.ChangeRemoved:
+			fmt.Printf("- %s: %s\n", c.Path, formatValue(c.Old))
+		default:
+			fmt.Printf("~ %s: %s -> %s\n", c.Path, formatValue(c.Old), formatValue(c.New))
+		}
+	}
+	if *exitCode && len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// formatValue returns a parsed value written as a BSON literal, sections
+// being written as inline objects.
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "MissingNo"
+	case string:
+		return strconv.Quote(x)
+	case bool:
+		if x {
+			return "SuperEffective"
+		}
+		return "NotVeryEffective"
+	case float64:
+		// Keep floats apart from integers, so that 1 -> 1.0 reads as a change.
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case time.Duration:
+		return x.String()
+	case []byte:
+		return `0b64"` + base64.StdEncoding.EncodeToString(x) + `"`
+	case []interface{}:
+		parts := make([]string, len(x))
+		for i, elem := range x {
+			parts[i] = formatValue(elem)
+		}
+		return "<| " + strings.Join(parts, ", ") + " |>"
+	case []map[string]interface{}:
+		parts := make([]string, len(x))
+		for i, elem := range x {
+			parts[i] = formatValue(elem)
+		}
+		return "<| " + strings.Join(parts, ", ") + " |>"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + " ~> " + formatValue(x[k])
+		}
+		return "{ " + strings.Join(parts, ", ") + " }"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDiff(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"old.bson": "BULBA!\nname ~> \"Bulby\"\nport ~> 8080\nratio ~> 1\ntags ~> <| \"a\" |>\n",
+		"new.bson": "BULBA!\nname ~> \"Bulby\"\nport ~> 9090\nratio ~> 1.0\nhost ~> \"h\"\n",
+		"bad.bson": "BULBA!\nname ~> \"Bulby\n",
+	})
+	changes := `+ host: "h"
+~ port: 8080 -> 9090
+~ ratio: 1 -> 1.0
+- tags: <| "a" |>
+`
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{
+			name:   "changes",
+			args:   []string{"old.bson", "new.bson"},
+			stdout: changes,
+		},
+		{
+			name:   "changes with --exit-code",
+			args:   []string{"--exit-code", "old.bson", "new.bson"},
+			stdout: changes,
+			code:   1,
+		},
+		{
+			name: "same with --exit-code",
+			args: []string{"--exit-code", "old.bson", "old.bson"},
+		},
+		{
+			name:   "standard input",
+			args:   []string{"-", "new.bson"},
+			stdin:  "BULBA!\nname ~> \"Bulby\"\nport ~> 9090\nratio ~> 1.0\n",
+			stdout: "+ host: \"h\"\n",
+		},
+		{
+			name: "invalid document with --exit-code",
+			args: []string{"--exit-code", "old.bson", "bad.bson"},
+			stderr: `bad.bson:2:9: Target is immune! ("\"Bulby" is not a value; strings need quotes, booleans are SuperEffective and NotVeryEffective, and null is MissingNo)
+    name ~> "Bulby
+            ^
+`,
+			code: 2,
+		},
+		{
+			name:   "missing document",
+			args:   []string{"old.bson"},
+			stderr: "usage: bulba diff [--exit-code] old new\n",
+			code:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = arg
+				if strings.HasSuffix(arg, ".bson") {
+					args[i] = filepath.Join(dir, arg)
+				}
+			}
+			stdout, stderr, code := runCommand(t, runDiff, dir, tt.stdin, args...)
+			if code != tt.code {
+				t.Errorf("Expected exit status %d, got %d", tt.code, code)
+			}
+			if stdout != tt.stdout {
+				t.Errorf("Expected output %q, got %q", tt.stdout, stdout)
+			}
+			// Usage errors are followed by the flags, which are not compared.
+			if !strings.HasPrefix(stderr, tt.stderr) || tt.stderr == "" && stderr != "" {
+				t.Errorf("Expected errors %q, got %q", tt.stderr, stderr)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "MissingNo"},
+		{"say \"hi\"", `"say \"hi\""`},
+		{true, "SuperEffective"},
+		{false, "NotVeryEffective"},
+		{int64(1), "1"},
+		{1.0, "1.0"},
+		{1.5, "1.5"},
+		{[]byte("hi"), `0b64"aGk="`},
+		{[]interface{}{int64(1), "a"}, `<| 1, "a" |>`},
+		{map[string]interface{}{"b": int64(2), "a": int64(1)}, "{ a ~> 1, b ~> 2 }"},
+		{[]map[string]interface{}{{"a": int64(1)}}, "<| { a ~> 1 } |>"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.expected {
+			t.Errorf("formatValue(%#v): expected %s, got %s", tt.value, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+)
+
+// runFmt formats the named files, or standard input.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := flags.Bool("l", false, "list files whose formatting differs")
+	write := flags.Bool("w", false, "write the result to the file instead of standard output")
+	keepVines := flags.Bool("keep-vines", false, "keep the Vine Whips as written instead of making them ~~~~>")
+	var keys conventionFlag
+	flags.Var(&keys, "keys", "rename keys to the `convention`: "+conventionNames())
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: bulba fmt [-l] [-w] [-keep-vines] [-keys convention] [file ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	var opts []bulbason.FormatOption
+	if *keepVines {
+		opts = append(opts, bulbason.KeepVines())
+	}
+	if keys.set {
+		opts = append(opts, bulbason.RenameKeys(keys.convention))
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "bulba fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := formatSource("<standard input>", src, opts, *list, false); err != nil {
+			printError("<standard input>", err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			err = formatSource(path, src, opts, *list, *write)
+		}
+		if err != nil {
+			printError(path, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// formatSource formats the document src read from the named file. The result
+// is written to standard output, unless list or write is set, in which case
+// the name is listed or the file rewritten only if its formatting differs.
+func formatSource(name string, src []byte, opts []bulbason.FormatOption, list, write bool) error {
+	out, err := bulbason.Format(src, opts...)
+	if err != nil {
+		return err
+	}
+	changed := !bytes.Equal(src, out)
+	if list && changed {
+		fmt.Println(name)
+	}
+	if write {
+		if !changed {
+			return nil
+		}
+		return writeFile(name, out)
+	}
+	if !list {
+		_, err = os.Stdout.Write(out)
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFmt(t *testing.T) {
+	messy := "BULBA!\nname   ~> \"Bulby\"   zZz kept\n(o) db (o)\nport ~~> 1\n"
+	tidy := "BULBA!\nname ~~~~> \"Bulby\" zZz kept\n(o) db (o)\nport ~~~~> 1\n"
+	files := map[string]string{
+		"messy.bson": messy,
+		"tidy.bson":  tidy,
+		"camel.bson": "BULBA!\nmyKey ~~~~> 1\n",
+		"bad.bson":   "BULBA!\nname ~> \"Bulby\n",
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		stdout string
+		stderr string
+		code   int
+		files  map[string]string // the files changed afterwards
+	}{
+		{
+			name:   "file",
+			args:   []string{"messy.bson"},
+			stdout: tidy,
+		},
+		{
+			name:   "standard input",
+			stdin:  messy,
+			stdout: tidy,
+		},
+		{
+			name:   "list",
+			args:   []string{"-l", "messy.bson", "tidy.bson"},
+			stdout: "messy.bson\n",
+		},
+		{
+			name:  "write",
+			args:  []string{"-w", "messy.bson", "tidy.bson"},
+			files: map[string]string{"messy.bson": tidy},
+		},
+		{
+			name:   "list and write",
+			args:   []string{"-l", "-w", "messy.bson", "tidy.bson"},
+			stdout: "messy.bson\n",
+			files:  map[string]string{"messy.bson": tidy},
+		},
+		{
+			name:   "keep vines",
+			args:   []string{"-keep-vines", "messy.bson"},
+			stdout: "BULBA!\nname ~> \"Bulby\" zZz kept\n(o) db (o)\nport ~~> 1\n",
+		},
+		{
+			name:  "rename keys",
+			args:  []string{"-w", "-keys", "snake_case", "camel.bson"},
+			files: map[string]string{"camel.bson": "BULBA!\nmy_key ~~~~> 1\n"},
+		},
+		{
+			name: "invalid file",
+			args: []string{"-w", "bad.bson", "messy.bson"},
+			stderr: `bad.bson:2:9: Target is immune! ("\"Bulby" is not a value; strings need quotes, booleans are SuperEffective and NotVeryEffective, and null is MissingNo)
+    name ~> "Bulby
+            ^
+`,
+			code:  1,
+			files: map[string]string{"messy.bson": tidy},
+		},
+		{
+			name:   "write to standard input",
+			args:   []string{"-w"},
+			stdin:  messy,
+			stderr: "bulba fmt: cannot use -w with standard input\n",
+			code:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, files)
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = arg
+				if strings.HasSuffix(arg, ".bson") {
+					args[i] = filepath.Join(dir, arg)
+				}
+			}
+			stdout, stderr, code := runCommand(t, runFmt, dir, tt.stdin, args...)
+			if code != tt.code {
+				t.Errorf("Expected exit status %d, got %d", tt.code, code)
+			}
+			if stdout != tt.stdout {
+				t.Errorf("Expected output %q, got %q", tt.stdout, stdout)
+			}
+			if stderr != tt.stderr {
+				t.Errorf("Expected errors %q, got %q", tt.stderr, stderr)
+			}
+
+			for name, content := range files {
+				if changed, ok := tt.files[name]; ok {
+					content = changed
+				}
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if string(got) != content {
+					t.Errorf("Expected %s to hold %q, got %q", name, content, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// runGet prints the values a query selects in the named file, or standard
+// input.
+func runGet(args []string) int {
+	flags := flag.NewFlagSet("get", flag.ExitOnError)
+	raw := flags.Bool("raw", false, "print strings without quotes")
+	asJSON := flags.Bool("json", false, "print each value as JSON")
+	colorMode := flags.String("color", "auto", "color the output: auto, always or never")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: bulba get [--raw | --json] [--color when] query [file]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 || *raw && *asJSON {
+		flags.Usage()
+		return 2
+	}
+
+	color, err := useColor(*colorMode, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	query, err := bulbason.CompileQuery(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	input := "-"
+	if flags.NArg() == 2 {
+		input = flags.Arg(1)
+	}
+	name, src, err := readInput(input)
+	if err != nil {
+		printError(name, err)
+		return 1
+	}
+	doc, err := bulbason.ParseAST(string(src), includes(input))
+	if err != nil {
+		printError(name, err)
+		return 1
+	}
+	values := query.EvalAST(doc)
+	if len(values) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: %s not found\n", name, query)
+		return 1
+	}
+
+	for _, v := range values {
+		var out []byte
+		switch {
+		case *asJSON:
+			out, err = valueJSON(v)
+			if err == nil && color {
+				out = colorJSON(out)
+			}
+		case *raw:
+			if s, ok := v.(*ast.StringLit); ok {
+				out = []byte(s.Value + "\n")
+				break
+			}
+			out, err = valueBSON(v, color)
+		default:
+			out, err = valueBSON(v, color)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 1
+		}
+		os.Stdout.Write(out)
+	}
+	return 0
+}
+
+// valueBSON returns v as BSON: the entries of an object one per line, and any
+// other value as the literal written after a Vine Whip. With color its keys
+// and literals are colored.
+func valueBSON(v ast.Value, color bool) ([]byte, error) {
+	if obj, ok := v.(*ast.ObjectLit); ok {
+		out, err := encodeBody(obj.Body)
+		if err != nil || !color {
+			return out, err
+		}
+		return colorBSON(out, 0), nil
+	}
+	out, err := encodeBody([]ast.Entry{&ast.KeyValue{Key: &ast.Ident{Name: "v"}, Value: v}})
+	if err != nil {
+		return nil, err
+	}
+	prefix := []byte("v ~~~~> ")
+	if color {
+		out = colorBSON(out, len(prefix))
+	}
+	return bytes.TrimPrefix(out, prefix), nil
+}
+
+// encodeBody returns the entries of body in BSON, without the document header.
+func encodeBody(body []ast.Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := bulbason.NewEncoder(&buf).EncodeAST(&ast.Document{Body: body}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(buf.Bytes(), []byte("BULBA!\n")), nil
+}
+
+// valueJSON returns v as indented JSON.
+func valueJSON(v ast.Value) ([]byte, error) {
+	data, err := bulbason.ToJSON(&ast.Document{Body: []ast.Entry{&ast.KeyValue{Key: &ast.Ident{Name: "v"}, Value: v}}})
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSuffix(bytes.TrimPrefix(data, []byte(`{"v":`)), []byte("}"))
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
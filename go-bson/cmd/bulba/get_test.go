@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRunGet(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"g.bson": `BULBA!
+name ~> "Bulby"
+(o) database (o)
+    host ~~> "db"
+    port ~~> 5432
+servers ~> <|
+(o)
+    host ~> "a"
+    port ~> 80
+(o)
+    host ~> "b"
+    port ~> 8080
+|>
+`,
+	})
+	file := filepath.Join(dir, "g.bson")
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{
+			name:   "string",
+			args:   []string{"name", file},
+			stdout: "\"Bulby\"\n",
+		},
+		{
+			name:   "raw string",
+			args:   []string{"--raw", "name", file},
+			stdout: "Bulby\n",
+		},
+		{
+			name:   "section",
+			args:   []string{"database", file},
+			stdout: "host ~~~~> \"db\"\nport ~~~~> 5432\n",
+		},
+		{
+			name:   "section as JSON",
+			args:   []string{"--json", "database", file},
+			stdout: "{\n  \"host\": \"db\",\n  \"port\": 5432\n}\n",
+		},
+		{
+			name:   "array element",
+			args:   []string{"servers[-1].host", file},
+			stdout: "\"b\"\n",
+		},
+		{
+			name:   "several values",
+			args:   []string{"servers[*].port", file},
+			stdout: "80\n8080\n",
+		},
+		{
+			name:   "filter",
+			args:   []string{"servers[?port > 100].host", file},
+			stdout: "\"b\"\n",
+		},
+		{
+			name:   "standard input",
+			args:   []string{"port"},
+			stdin:  "BULBA!\nport ~> 8080\n",
+			stdout: "8080\n",
+		},
+		{
+			name:   "colored",
+			args:   []string{"--color", "always", "name", file},
+			stdout: colorString + "\"Bulby\"" + colorReset + "\n",
+		},
+		{
+			name:   "not found",
+			args:   []string{"missing", file},
+			stderr: "g.bson: missing not found\n",
+			code:   1,
+		},
+		{
+			name:   "invalid query",
+			args:   []string{"servers[", file},
+			stderr: "bulbason: query \"servers[\": missing ]\n",
+			code:   2,
+		},
+		{
+			name:   "invalid color",
+			args:   []string{"--color", "sometimes", "name", file},
+			stderr: "invalid -color \"sometimes\", want auto, always or never\n",
+			code:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, code := runCommand(t, runGet, dir, tt.stdin, tt.args...)
+			if code != tt.code {
+				t.Errorf("Expected exit status %d, got %d", tt.code, code)
+			}
+			if stdout != tt.stdout {
+				t.Errorf("Expected output %q, got %q", tt.stdout, stdout)
+			}
+			if stderr != tt.stderr {
+				t.Errorf("Expected errors %q, got %q", tt.stderr, stderr)
+			}
+		})
+	}
+}
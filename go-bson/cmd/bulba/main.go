@@ -0,0 +1,200 @@
+// Command bulba works with BulbaSaur Object Notation files.
+//
+// Usage:
+//
+//	bulba [-format tree|json|compact] [-color when] [file]
+//	bulba fmt [-l] [-w] [-keep-vines] [-keys convention] [file ...]
+//	bulba validate [-keys convention] [file|pattern|- ...]
+//	bulba convert [--from format] --to format [file ...]
+//	bulba get [--raw | --json] [--color when] query [file]
+//	bulba set path value [file]
+//	bulba diff [--exit-code] old new
+//
+// Without a command, bulba parses a document and prints its AST, as a tree by
+// default, as indented JSON with -format json, or on a single line with
+// -format compact. When no file is given the document is read from standard
+// input.
+//
+// Every format, and the output of the get command, colors keys, strings,
+// numbers, booleans and MissingNo when writing to a terminal, unless the
+// NO_COLOR environment variable is set or TERM is dumb. -color always and
+// -color never force colors on and off.
+//
+// The fmt command rewrites documents in the canonical layout, keeping their
+// comments. By default the result is written to standard output. With -l the
+// names of files whose layout differs are listed instead, and with -w the
+// files are rewritten in place. With -keys every key is renamed to a naming
+// convention, one of snake_case, camelCase, PascalCase and kebab-case, along
+// with the Copycat references to it.
+//
+// The validate command checks documents and prints every problem found as
+// file:line:column: message (explanation), followed by the line with a caret
+// under the column, exiting with status 1 if there is any. Glob patterns are
+// expanded, and - stands for standard input, which is also read when no file
+// is given. With -keys, keys that do not follow the naming
+// convention are reported as problems too. Diagnostics, such as trailing
+// whitespace, are printed as file:line:column: severity: message, without
+// changing the exit status.
+//
+// The convert command converts documents between json, yaml, toml and bulba,
+// the BSON format itself, and writes the results to standard output. Without
+// --from the input format is taken from the file extension, and standard
+// input and files with an unknown extension are read as BSON.
+//
+// The get command prints the value at a path such as database.pool.size or
+// servers[2].host, in BSON by default. The path is a query, so it may select
+// several values, such as servers[*].port or servers[?port > 8000].host, which
+// are printed in turn; see CompileQuery for the syntax. With --raw strings are
+// printed without quotes, and with --json each value is printed as JSON.
+//
+// The set command replaces the value at a path with a BSON literal, such as
+// '"10.0.0.5"' or '<| 1, 2 |>', rewriting the file in place. The path is a
+// query as with get, which must select a single value. Only the bytes of the
+// old value change; comments and layout are kept. Standard input is written
+// to standard output instead.
+//
+// The diff command compares two documents by path rather than line by line,
+// printing "+ path: value" for each key added, "- path: value" for each key
+// removed and "~ path: old -> new" for each value changed. As with git diff,
+// --exit-code makes it exit with status 1 when the documents differ; errors
+// exit with status 2.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+)
+
+// commands maps the name of each subcommand to the function running it with
+// the remaining arguments. The function returns the exit status.
+var commands = map[string]func(args []string) int{
+	"convert":  runConvert,
+	"diff":     runDiff,
+	"fmt":      runFmt,
+	"get":      runGet,
+	"set":      runSet,
+	"validate": runValidate,
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+	os.Exit(runPrint(os.Args[1:]))
+}
+
+// printFormats maps the names accepted by -format to the formats of Fprint.
+var printFormats = map[string]bulbason.PrintFormat{
+	bulbason.PrintTree.String():    bulbason.PrintTree,
+	bulbason.PrintJSON.String():    bulbason.PrintJSON,
+	bulbason.PrintCompact.String(): bulbason.PrintCompact,
+}
+
+// runPrint parses the document in the named file, or standard input, and
+// prints its AST.
+func runPrint(args []string) int {
+	flags := flag.NewFlagSet("bulba", flag.ExitOnError)
+	formatName := flags.String("format", "tree", "output format: tree, json or compact")
+	colorMode := flags.String("color", "auto", "color the output: auto, always or never")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: bulba [-format tree|json|compact] [-color when] [file]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	format, ok := printFormats[*formatName]
+	if !ok || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	color, err := useColor(*colorMode, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	name, path := "<standard input>", "-"
+	if flags.NArg() == 1 {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in, name, path = f, flags.Arg(0), flags.Arg(0)
+	}
+
+	var ast map[string]interface{}
+	if err := bulbason.NewDecoder(in, includes(path)).Decode(&ast); err != nil {
+		printError(name, err)
+		return 1
+	}
+	var out bytes.Buffer
+	if err := bulbason.Fprint(&out, ast, format); err != nil {
+		printError(name, err)
+		return 1
+	}
+	switch {
+	case color && format == bulbason.PrintTree:
+		os.Stdout.Write(colorTree(out.Bytes(), ast))
+	case color && format == bulbason.PrintJSON:
+		os.Stdout.Write(colorJSON(out.Bytes()))
+	case color && format == bulbason.PrintCompact:
+		// The record is colored as the value of a key.
+		prefix := "v ~> "
+		colored := colorBSON(append([]byte(prefix), out.Bytes()...), len(prefix))
+		os.Stdout.Write(colored[len(prefix):])
+	default:
+		os.Stdout.Write(out.Bytes())
+	}
+	return 0
+}
+
+// printError prints an error about the named input to standard error. Parse
+// errors are prefixed with their line and column, followed by their plain
+// explanation, and shown in their line.
+func printError(name string, err error) {
+	var list bulbason.ErrorList
+	var pe *bulbason.ParseError
+	var ie *bulbason.IncludeError
+	switch {
+	case errors.As(err, &ie):
+		// The error may be located in another file, which Err names.
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: Transform %q: %v\n", name, ie.Line, ie.Column, ie.Path, ie.Err)
+	case errors.As(err, &list):
+		for _, pe := range list {
+			printParseError(name, pe)
+		}
+	case errors.As(err, &pe):
+		printParseError(name, pe)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+	}
+}
+
+// printParseError prints pe, followed by the line it is about with a caret
+// under its column, indented so that it stands apart from the messages.
+func printParseError(name string, pe *bulbason.ParseError) {
+	fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", name, pe.Line, pe.Column, describe(pe))
+	if excerpt := pe.Excerpt(); excerpt != "" {
+		fmt.Fprintf(os.Stderr, "    %s\n", strings.ReplaceAll(excerpt, "\n", "\n    "))
+	}
+}
+
+// describe returns the message of pe followed by its explanation, unless the
+// message already ends with it, as the message of a KeyRule does.
+func describe(pe *bulbason.ParseError) string {
+	if pe.Detail == "" || strings.HasSuffix(pe.Message, pe.Detail) {
+		return pe.Message
+	}
+	return fmt.Sprintf("%s (%s)", pe.Message, pe.Detail)
+}
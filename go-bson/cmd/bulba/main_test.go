@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCommand calls run with args and standard input reading stdin, and returns
+// what it writes to standard output and standard error, with dir left out of
+// the file names, and its exit status.
+func runCommand(t *testing.T, run func([]string) int, dir, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	files := make([]*os.File, 3)
+	for i := range files {
+		f, err := os.CreateTemp(t.TempDir(), "std")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer f.Close()
+		files[i] = f
+	}
+	if _, err := io.WriteString(files[0], stdin); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files[0].Seek(0, io.SeekStart)
+
+	stdinWas, stdoutWas, stderrWas := os.Stdin, os.Stdout, os.Stderr
+	os.Stdin, os.Stdout, os.Stderr = files[0], files[1], files[2]
+	code := run(args)
+	os.Stdin, os.Stdout, os.Stderr = stdinWas, stdoutWas, stderrWas
+
+	var out [2]string
+	for i, f := range files[1:] {
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		out[i] = string(data)
+		if dir != "" {
+			out[i] = strings.ReplaceAll(out[i], dir+string(filepath.Separator), "")
+		}
+	}
+	return out[0], out[1], code
+}
+
+// writeFiles writes files, mapping names to contents, to a new temporary
+// directory and returns its name.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return dir
+}
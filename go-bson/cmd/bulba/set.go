@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// runSet replaces the value at a path in the named file, or standard input.
+func runSet(args []string) int {
+	flags := flag.NewFlagSet("set", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: bulba set path value [file]")
+	}
+	flags.Parse(args)
+	if flags.NArg() < 2 || flags.NArg() > 3 {
+		flags.Usage()
+		return 2
+	}
+
+	input := "-"
+	if flags.NArg() == 3 {
+		input = flags.Arg(2)
+	}
+	name, src, err := readInput(input)
+	var out []byte
+	if err == nil {
+		out, err = setValue(src, flags.Arg(0), flags.Arg(1))
+	}
+	if err == nil {
+		if input == "-" {
+			_, err = os.Stdout.Write(out)
+		} else {
+			err = writeFile(input, out)
+		}
+	}
+	if err != nil {
+		printError(name, err)
+		return 1
+	}
+	return 0
+}
+
+// setValue returns src with the value at path replaced by literal, a BSON
+// value such as "10.0.0.5" (quotes included) or <| 1, 2 |>. Every other byte
+// of src is kept, comments and layout included.
+func setValue(src []byte, path, literal string) ([]byte, error) {
+	doc, err := bulbason.ParseAST(string(src))
+	if err != nil {
+		return nil, err
+	}
+	v, err := lookup(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	if obj, ok := v.(*ast.ObjectLit); ok && !obj.Inline {
+		return nil, fmt.Errorf("%s is a section, only values can be set", path)
+	}
+
+	literal = strings.TrimSpace(literal)
+	if strings.ContainsAny(literal, "\r\n") {
+		return nil, fmt.Errorf("invalid value %s, it must fit on one line", literal)
+	}
+	if _, err := bulbason.ParseAST("BULBA!\nv ~> " + literal + "\n"); err != nil {
+		return nil, fmt.Errorf("invalid value %s: %v", literal, err)
+	}
+
+	span := v.Span()
+	start, end := offset(src, span.Start), offset(src, span.End)+1
+	out := make([]byte, 0, len(src)-(end-start)+len(literal))
+	out = append(out, src[:start]...)
+	out = append(out, literal...)
+	out = append(out, src[end:]...)
+	if _, err := bulbason.ParseAST(string(out)); err != nil {
+		return nil, fmt.Errorf("cannot set %s to %s: %v", path, literal, err)
+	}
+	return out, nil
+}
+
+// offset returns the byte offset in src of a position.
+func offset(src []byte, pos ast.Position) int {
+	i := 0
+	for line := 1; line < pos.Line; line++ {
+		i += bytes.IndexByte(src[i:], '\n') + 1
+	}
+	return i + pos.Column - 1
+}
+
+// writeFile replaces the content of the named file, keeping its permissions.
+func writeFile(name string, data []byte) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, info.Mode().Perm())
+}
+
+// lookup returns the value at path, a query such as database.pool or
+// servers[2].host selecting a single value. Sections are returned as objects.
+func lookup(doc *ast.Document, path string) (ast.Value, error) {
+	query, err := bulbason.CompileQuery(path)
+	if err != nil {
+		return nil, err
+	}
+	values := query.EvalAST(doc)
+	switch len(values) {
+	case 0:
+		return nil, fmt.Errorf("%s not found", path)
+	case 1:
+		return values[0], nil
+	default:
+		return nil, fmt.Errorf("%s selects %d values, only one can be set", path, len(values))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSet(t *testing.T) {
+	src := `BULBA!
+zZz settings
+port ~>   8080   zZz keep me
+(o) db (o)
+    hosts ~~> <| "a",   "b" |>
+    opts ~~> { tls ~> SuperEffective }
+`
+
+	tests := []struct {
+		name     string
+		path     string
+		value    string
+		expected string // the file afterwards, or "" if it is unchanged
+		stderr   string
+		code     int
+	}{
+		{
+			name:     "number",
+			path:     "port",
+			value:    "9090",
+			expected: strings.Replace(src, "8080", "9090", 1),
+		},
+		{
+			name:     "array element",
+			path:     "db.hosts[-1]",
+			value:    ` "c" `,
+			expected: strings.Replace(src, `"b"`, `"c"`, 1),
+		},
+		{
+			name:     "inline object member",
+			path:     "db.opts.tls",
+			value:    "NotVeryEffective",
+			expected: strings.Replace(src, "SuperEffective", "NotVeryEffective", 1),
+		},
+		{
+			name:     "inline object",
+			path:     "db.opts",
+			value:    "<| 1, 2 |>",
+			expected: strings.Replace(src, "{ tls ~> SuperEffective }", "<| 1, 2 |>", 1),
+		},
+		{
+			name:   "section",
+			path:   "db",
+			value:  "1",
+			stderr: "s.bson: db is a section, only values can be set\n",
+			code:   1,
+		},
+		{
+			name:   "several values",
+			path:   "db.*",
+			value:  "1",
+			stderr: "s.bson: db.* selects 2 values, only one can be set\n",
+			code:   1,
+		},
+		{
+			name:   "not found",
+			path:   "db.user",
+			value:  "1",
+			stderr: "s.bson: db.user not found\n",
+			code:   1,
+		},
+		{
+			name:   "invalid value",
+			path:   "port",
+			value:  `"oops`,
+			stderr: "s.bson: invalid value \"oops: Target is immune!\n",
+			code:   1,
+		},
+		{
+			name:   "multi-line value",
+			path:   "port",
+			value:  "1\n2",
+			stderr: "s.bson: invalid value 1\n2, it must fit on one line\n",
+			code:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"s.bson": src})
+			file := filepath.Join(dir, "s.bson")
+			stdout, stderr, code := runCommand(t, runSet, dir, "", tt.path, tt.value, file)
+			if code != tt.code {
+				t.Errorf("Expected exit status %d, got %d", tt.code, code)
+			}
+			if stdout != "" {
+				t.Errorf("Expected no output, got %q", stdout)
+			}
+			if stderr != tt.stderr {
+				t.Errorf("Expected errors %q, got %q", tt.stderr, stderr)
+			}
+
+			expected := tt.expected
+			if expected == "" {
+				expected = src
+			}
+			got, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != expected {
+				t.Errorf("Expected the file to hold %q, got %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestRunSet_StandardInput(t *testing.T) {
+	stdout, stderr, code := runCommand(t, runSet, "", "BULBA!\nport ~> 8080 zZz port\n", "port", "9090")
+	if code != 0 || stderr != "" {
+		t.Fatalf("Expected success, got status %d and %q", code, stderr)
+	}
+	if expected := "BULBA!\nport ~> 9090 zZz port\n"; stdout != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout)
+	}
+}
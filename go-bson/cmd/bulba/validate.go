@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+)
+
+// runValidate checks the named files, or standard input, and reports every
+// problem found in them. Diagnostics are reported too, but do not fail the
+// check.
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	var keys conventionFlag
+	flags.Var(&keys, "keys", "require keys in the `convention`: "+conventionNames())
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: bulba validate [-keys convention] [file|pattern|- ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	opts := []bulbason.ParseOption{bulbason.CollectErrors()}
+	if keys.set {
+		opts = append(opts, bulbason.KeyRules(bulbason.KeyNaming(keys.convention)))
+	}
+
+	paths, err := expandPatterns(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bulba validate:", err)
+		return 2
+	}
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	status := 0
+	for _, path := range paths {
+		name, src, err := readInput(path)
+		if err == nil {
+			warn := bulbason.Diagnostics(func(d bulbason.Diagnostic) {
+				fmt.Fprintf(os.Stderr, "%s:%d:%d: %s: %s\n", name, d.Line, d.Column, d.Severity, d.Message)
+			})
+			_, err = bulbason.Parse(string(src), append(opts, includes(path), warn)...)
+		}
+		if err != nil {
+			printError(name, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// expandPatterns replaces the arguments holding glob patterns, which a shell
+// or hook may pass on unexpanded, with the files they match.
+func expandPatterns(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		if arg == "-" || !strings.ContainsAny(arg, "*?[") {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// readInput reads the named file, or standard input for "-", and returns the
+// name to use for it in messages.
+func readInput(path string) (string, []byte, error) {
+	if path == "-" {
+		src, err := io.ReadAll(os.Stdin)
+		return "<standard input>", src, err
+	}
+	src, err := os.ReadFile(path)
+	return path, src, err
+}
+
+// includes returns the option resolving the Transform directives of the named
+// input against its directory, or the working directory for standard input.
+func includes(path string) bulbason.ParseOption {
+	if path == "-" {
+		return bulbason.Includes(os.DirFS("."), "")
+	}
+	return bulbason.Includes(os.DirFS(filepath.Dir(path)), filepath.Base(path))
+}
+
+// conventions lists the naming conventions of keys, by name.
+var conventions = []bulbason.NamingConvention{
+	bulbason.SnakeCase,
+	bulbason.CamelCase,
+	bulbason.PascalCase,
+	bulbason.KebabCase,
+}
+
+// conventionNames returns the names of the conventions, for usage messages.
+func conventionNames() string {
+	names := make([]string, len(conventions))
+	for i, c := range conventions {
+		names[i] = c.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// conventionFlag is a flag naming a convention of keys, such as snake_case.
+type conventionFlag struct {
+	convention bulbason.NamingConvention
+	set        bool
+}
+
+func (f *conventionFlag) String() string {
+	if !f.set {
+		return ""
+	}
+	return f.convention.String()
+}
+
+func (f *conventionFlag) Set(name string) error {
+	for _, c := range conventions {
+		if c.String() == name {
+			f.convention, f.set = c, true
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown convention %q, expected one of %s", name, conventionNames())
+}
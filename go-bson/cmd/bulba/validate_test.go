@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunValidate(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"good.bson":  "BULBA!\nname ~> \"Bulby\"\n",
+		"bad.bson":   "BULBA!\nname ~> \"Bulby\nport ~> MissingNo\n",
+		"camel.bson": "BULBA!\nmyKey ~> 1 \n",
+	})
+	bad := `bad.bson:2:9: Target is immune! ("\"Bulby" is not a value; strings need quotes, booleans are SuperEffective and NotVeryEffective, and null is MissingNo)
+    name ~> "Bulby
+            ^
+`
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		stderr string
+		code   int
+	}{
+		{
+			name: "valid file",
+			args: []string{"good.bson"},
+		},
+		{
+			name:   "invalid file",
+			args:   []string{"bad.bson", "good.bson"},
+			stderr: bad,
+			code:   1,
+		},
+		{
+			name:   "diagnostics only",
+			args:   []string{"camel.bson"},
+			stderr: "camel.bson:2:11: warning: trailing whitespace\n",
+		},
+		{
+			name: "key convention",
+			args: []string{"-keys", "snake_case", "camel.bson"},
+			stderr: "camel.bson:2:11: warning: trailing whitespace\n" +
+				"camel.bson:2:1: It burns the bulb: key \"myKey\" is not snake_case\n" +
+				"    myKey ~> 1 \n" +
+				"    ^\n",
+			code: 1,
+		},
+		{
+			name:   "pattern",
+			args:   []string{"*.bson"},
+			stderr: bad + "camel.bson:2:11: warning: trailing whitespace\n",
+			code:   1,
+		},
+		{
+			name:   "pattern matching nothing",
+			args:   []string{"none*.bson"},
+			stderr: "bulba validate: no files match none*.bson\n",
+			code:   2,
+		},
+		{
+			name:   "standard input",
+			stdin:  "BULBA!\nname ~> \"Bulby\n",
+			stderr: strings.ReplaceAll(bad, "bad.bson", "<standard input>"),
+			code:   1,
+		},
+		{
+			name:   "missing file",
+			args:   []string{"missing.bson"},
+			stderr: "missing.bson: open missing.bson: no such file or directory\n",
+			code:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = arg
+				if strings.HasSuffix(arg, ".bson") {
+					args[i] = filepath.Join(dir, arg)
+				}
+			}
+			stdout, stderr, code := runCommand(t, runValidate, dir, tt.stdin, args...)
+			if code != tt.code {
+				t.Errorf("Expected exit status %d, got %d", tt.code, code)
+			}
+			if stdout != "" {
+				t.Errorf("Expected no output, got %q", stdout)
+			}
+			if stderr != tt.stderr {
+				t.Errorf("Expected errors %q, got %q", tt.stderr, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+// Command bulbacodec generates BulbaSaur Object Notation codecs for Go
+// structs, so that decoding and encoding them needs no reflection.
+//
+// Usage:
+//
+//	bulbacodec [-all] [-o file] [file.go ...]
+//
+// For each struct type of a file whose doc comment holds the directive
+// //bulba:codec, or for every struct type with -all, bulbacodec writes the
+// methods of bulbason.Marshaler and bulbason.Unmarshaler, along with those of
+// bulbason.ObjectMarshaler and bulbason.ValueUnmarshaler. Marshal and
+// Unmarshal call the latter instead of reflecting on the struct, at the top
+// of a document as well as for nested values:
+//
+//	//bulba:codec
+//	type Config struct {
+//	    Host string `bson:"host"`
+//	    Port int    `bson:"port,omitempty"`
+//	}
+//
+// Fields are matched by their bson tag, or by their Go name without one, as
+// by the reflection codec. Strings, booleans, integers, floats, time.Time,
+// time.Duration, []byte and the structs generated alongside are handled
+// directly; fields of other types, and values that need converting, such as
+// an integer decoded into a float64, go through the reflection codec. The
+// omitempty option is supported, while the other tag options, and embedded
+// fields, are reported as errors; types that need them are best left to the
+// reflection codec.
+//
+// The code generated for name.go is written to name_bulba.go, or to the file
+// given by -o when there is a single input. Without arguments the file go
+// generate runs for is used, so a typical go:generate line is:
+//
+//	//go:generate go run github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/cmd/bulbacodec
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// directive marks the struct types to generate a codec for.
+const directive = "//bulba:codec"
+
+func main() {
+	all := flag.Bool("all", false, "generate a codec for every struct type")
+	output := flag.String("o", "", "write the code to this file instead of name_bulba.go")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: bulbacodec [-all] [-o file] [file.go ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		if gofile := os.Getenv("GOFILE"); gofile != "" {
+			files = []string{gofile}
+		}
+	}
+	if len(files) == 0 || *output != "" && len(files) > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	for _, name := range files {
+		code, err := generateFile(name, *all)
+		if err != nil {
+			fail(err)
+		}
+		out := *output
+		if out == "" {
+			out = strings.TrimSuffix(name, ".go") + "_bulba.go"
+		}
+		if err := os.WriteFile(out, code, 0o644); err != nil {
+			fail(err)
+		}
+	}
+}
+
+// fail reports an error and exits.
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "bulbacodec:", err)
+	os.Exit(1)
+}
+
+// kind says how the value of a field is written and read.
+type kind int
+
+const (
+	kindOther    kind = iota // Through the reflection codec
+	kindString               // string
+	kindBool                 // bool
+	kindInt                  // Signed integers
+	kindUint                 // Unsigned integers
+	kindFloat                // float32 and float64
+	kindTime                 // time.Time
+	kindDuration             // time.Duration
+	kindBytes                // []byte
+	kindStruct               // A struct generated alongside
+)
+
+// codecField is a field of a struct a codec is generated for.
+type codecField struct {
+	name      string // Go name
+	key       string // Key in the document
+	typ       string // Go type, as written in the source
+	kind      kind
+	omitEmpty bool
+	emptyTest string // Condition under which an omitempty field is written
+}
+
+// codecType is a struct type a codec is generated for.
+type codecType struct {
+	name   string
+	fields []*codecField
+}
+
+// generateFile returns the formatted source of the codecs for the struct
+// types of the Go file name.
+func generateFile(name string, all bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []*ast.TypeSpec
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if _, ok := ts.Type.(*ast.StructType); !ok {
+				continue
+			}
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			if all || hasDirective(doc) {
+				specs = append(specs, ts)
+			}
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%s: no struct type marked with %s", name, directive)
+	}
+
+	generated := make(map[string]bool)
+	for _, ts := range specs {
+		generated[ts.Name.Name] = true
+	}
+	var codecs []*codecType
+	for _, ts := range specs {
+		if ts.TypeParams != nil {
+			return nil, fmt.Errorf("%s: %s: generic types are not supported", fset.Position(ts.Pos()), ts.Name.Name)
+		}
+		ct, err := structCodec(ts, generated)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fset.Position(ts.Pos()), err)
+		}
+		codecs = append(codecs, ct)
+	}
+	return generate(file.Name.Name, codecs)
+}
+
+// hasDirective reports whether a doc comment holds the bulba:codec directive.
+func hasDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// structCodec describes the fields of the struct type ts. generated holds the
+// names of the types codecs are generated for.
+func structCodec(ts *ast.TypeSpec, generated map[string]bool) (*codecType, error) {
+	ct := &codecType{name: ts.Name.Name}
+	keys := make(map[string]bool)
+	for _, f := range ts.Type.(*ast.StructType).Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded field %s is not supported", ct.name, types.ExprString(f.Type))
+		}
+		var tag string
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid tag %s", ct.name, f.Tag.Value)
+			}
+			tag = reflect.StructTag(s).Get("bson")
+		}
+		if tag == "-" {
+			continue
+		}
+		key, opts, _ := strings.Cut(tag, ",")
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+			cf := &codecField{name: name.Name, key: key, typ: types.ExprString(f.Type), kind: fieldKind(f.Type, generated)}
+			if cf.key == "" {
+				cf.key = name.Name
+			}
+			if keys[cf.key] {
+				return nil, fmt.Errorf("%s.%s: duplicate key %q", ct.name, name.Name, cf.key)
+			}
+			keys[cf.key] = true
+			if err := cf.setOptions(opts, f.Type); err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", ct.name, name.Name, err)
+			}
+			ct.fields = append(ct.fields, cf)
+		}
+	}
+	return ct, nil
+}
+
+// setOptions applies the options of the field's tag.
+func (f *codecField) setOptions(opts string, typ ast.Expr) error {
+	if opts == "" {
+		return nil
+	}
+	for _, opt := range strings.Split(opts, ",") {
+		name, _, _ := strings.Cut(opt, "=")
+		if name != "omitempty" {
+			return fmt.Errorf("the %s option is not supported by generated codecs", name)
+		}
+		f.omitEmpty = true
+	}
+	x := "x." + f.name
+	switch f.kind {
+	case kindString:
+		f.emptyTest = x + ` != ""`
+	case kindBool:
+		f.emptyTest = x
+	case kindInt, kindUint, kindFloat, kindDuration:
+		f.emptyTest = x + " != 0"
+	case kindBytes:
+		f.emptyTest = "len(" + x + ") != 0"
+	}
+	switch t := typ.(type) {
+	case *ast.ArrayType, *ast.MapType:
+		f.emptyTest = "len(" + x + ") != 0"
+	case *ast.StarExpr, *ast.InterfaceType:
+		f.emptyTest = x + " != nil"
+	case *ast.Ident:
+		if t.Name == "any" {
+			f.emptyTest = x + " != nil"
+		}
+	}
+	if f.emptyTest == "" {
+		return fmt.Errorf("omitempty is not supported for fields of type %s", f.typ)
+	}
+	return nil
+}
+
+// fieldKind returns the kind of a field of type typ.
+func fieldKind(typ ast.Expr, generated map[string]bool) kind {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return kindString
+		case "bool":
+			return kindBool
+		case "int", "int8", "int16", "int32", "int64":
+			return kindInt
+		case "uint", "uint8", "uint16", "uint32", "uint64":
+			return kindUint
+		case "float32", "float64":
+			return kindFloat
+		}
+		if generated[t.Name] {
+			return kindStruct
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" {
+			switch t.Sel.Name {
+			case "Time":
+				return kindTime
+			case "Duration":
+				return kindDuration
+			}
+		}
+	case *ast.ArrayType:
+		if elem, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && elem.Name == "byte" {
+			return kindBytes
+		}
+	}
+	return kindOther
+}
+
+// generator writes the methods of the generated codecs.
+type generator struct {
+	buf  bytes.Buffer
+	time bool // Whether the code uses package time
+}
+
+// generate returns the formatted source of a file declaring the methods of
+// codecs.
+func generate(pkg string, codecs []*codecType) ([]byte, error) {
+	g := &generator{}
+	for _, ct := range codecs {
+		g.marshal(ct)
+		g.unmarshal(ct)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by bulbacodec. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	if g.time {
+		out.WriteString("\t\"time\"\n\n")
+	}
+	out.WriteString("\tbulbason \"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson\"\n)\n\n")
+	out.Write(g.buf.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// Methods of bulbason.ObjectWriter writing each kind, and the type they take.
+var writers = map[kind][2]string{
+	kindString:   {"String", ""},
+	kindBool:     {"Bool", ""},
+	kindInt:      {"Int", "int64"},
+	kindUint:     {"Uint", "uint64"},
+	kindFloat:    {"Float", "float64"},
+	kindTime:     {"Time", ""},
+	kindDuration: {"Duration", ""},
+	kindBytes:    {"ByteString", ""},
+	kindOther:    {"Value", ""},
+}
+
+// marshal writes the MarshalBulba and MarshalBulbaObject methods of ct.
+func (g *generator) marshal(ct *codecType) {
+	fmt.Fprintf(&g.buf, "// MarshalBulba implements bulbason.Marshaler.\n")
+	fmt.Fprintf(&g.buf, "func (x %s) MarshalBulba() ([]byte, error) {\n", ct.name)
+	g.buf.WriteString("\tvar w bulbason.ObjectWriter\n\tx.MarshalBulbaObject(&w)\n\treturn w.Bytes()\n}\n\n")
+
+	fmt.Fprintf(&g.buf, "// MarshalBulbaObject implements bulbason.ObjectMarshaler.\n")
+	fmt.Fprintf(&g.buf, "func (x %s) MarshalBulbaObject(w *bulbason.ObjectWriter) {\n", ct.name)
+	for _, f := range ct.fields {
+		var call string
+		if f.kind == kindStruct {
+			call = fmt.Sprintf("w.Object(%q, x.%s.MarshalBulbaObject)", f.key, f.name)
+		} else {
+			value := "x." + f.name
+			if conv := writers[f.kind][1]; conv != "" {
+				value = conv + "(" + value + ")"
+			}
+			call = fmt.Sprintf("w.%s(%q, %s)", writers[f.kind][0], f.key, value)
+		}
+		if f.omitEmpty {
+			fmt.Fprintf(&g.buf, "\tif %s {\n\t\t%s\n\t}\n", f.emptyTest, call)
+		} else {
+			fmt.Fprintf(&g.buf, "\t%s\n", call)
+		}
+	}
+	g.buf.WriteString("}\n\n")
+}
+
+// unmarshal writes the UnmarshalBulba and UnmarshalBulbaValue methods of ct.
+func (g *generator) unmarshal(ct *codecType) {
+	fmt.Fprintf(&g.buf, "// UnmarshalBulba implements bulbason.Unmarshaler.\n")
+	fmt.Fprintf(&g.buf, "func (x *%s) UnmarshalBulba(data []byte) error {\n", ct.name)
+	g.buf.WriteString("\tv, err := bulbason.ParseValue(data)\n\tif err != nil {\n\t\treturn err\n\t}\n")
+	g.buf.WriteString("\treturn x.UnmarshalBulbaValue(v, \"\")\n}\n\n")
+
+	fmt.Fprintf(&g.buf, "// UnmarshalBulbaValue implements bulbason.ValueUnmarshaler.\n")
+	fmt.Fprintf(&g.buf, "func (x *%s) UnmarshalBulbaValue(v interface{}, path string) error {\n", ct.name)
+	g.buf.WriteString("\tm, ok := v.(map[string]interface{})\n\tif !ok {\n\t\treturn bulbason.DecodeValue(v, x, path)\n\t}\n")
+	for _, f := range ct.fields {
+		fmt.Fprintf(&g.buf, "\tif val, ok := m[%q]; ok {\n", f.key)
+		g.decodeField(f)
+		g.buf.WriteString("\t}\n")
+	}
+	g.buf.WriteString("\treturn nil\n}\n\n")
+}
+
+// decodeField writes the statements storing val in the field f.
+func (g *generator) decodeField(f *codecField) {
+	dst := "x." + f.name
+	fallback := fmt.Sprintf("if err := bulbason.DecodeValue(val, &%s, bulbason.JoinPath(path, %q)); err != nil {\n\t\t\treturn err\n\t\t}", dst, f.key)
+
+	// The values the parser gives in the field's own type are stored
+	// directly; others, MissingNo included, are left to the reflection
+	// codec, which converts them or reports the mismatch.
+	var assert, assign, cond string
+	switch f.kind {
+	case kindStruct:
+		fmt.Fprintf(&g.buf, "\t\tif val == nil {\n\t\t\t%s = %s{}\n\t\t} else if err := %s.UnmarshalBulbaValue(val, bulbason.JoinPath(path, %q)); err != nil {\n\t\t\treturn err\n\t\t}\n", dst, f.typ, dst, f.key)
+		return
+	case kindString, kindBool, kindBytes:
+		assert, assign = f.typ, "s"
+	case kindInt, kindUint:
+		assert, assign = "int64", f.typ+"(s)"
+		switch {
+		case f.kind == kindUint:
+			cond = " && s >= 0 && int64(" + f.typ + "(s)) == s"
+		case f.typ != "int64":
+			cond = " && int64(" + f.typ + "(s)) == s"
+		}
+	case kindFloat:
+		if f.typ != "float64" {
+			fmt.Fprintf(&g.buf, "\t\t%s\n", fallback)
+			return
+		}
+		assert, assign = "float64", "s"
+	case kindTime, kindDuration:
+		g.time = true
+		assert, assign = f.typ, "s"
+	default:
+		fmt.Fprintf(&g.buf, "\t\t%s\n", fallback)
+		return
+	}
+	fmt.Fprintf(&g.buf, "\t\tif s, ok := val.(%s); ok%s {\n\t\t\t%s = %s\n\t\t} else %s\n", assert, cond, dst, assign, fallback)
+}
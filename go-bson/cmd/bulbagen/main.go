@@ -0,0 +1,445 @@
+// Command bulbagen generates Go struct definitions, with bson tags, for
+// BulbaSaur Object Notation configuration.
+//
+// Usage:
+//
+//	bulbagen [-schema] [-type name] [-package name] [-o file] [file]
+//
+// By default the input is a sample document, and the type of each field is
+// taken from its value: strings, integers, floats, booleans, timestamps,
+// durations and byte strings become string, int, float64, bool, time.Time,
+// time.Duration and []byte, sections and objects become structs, and arrays
+// become slices of the type their elements share. MissingNo, and elements of
+// mixed types, become interface{}.
+//
+// With -schema the input is a schema instead: a document of the same shape
+// whose values name the type of each key, one of "string", "int", "float",
+// "bool", "timestamp", "duration", "bytes" or "any", prefixed by "[]" for an
+// array of them. An array of sections is written as a multi-line array with a
+// single section describing its elements. A type ending in "!" marks a
+// required key, whose field gets the required tag option:
+//
+//	BULBA!
+//	name ~> "string!"
+//	tags ~> "[]string"
+//	(o) database (o)
+//	    port ~> "int"
+//
+// The root type is named by -type, Config by default, and nested structs are
+// named after it and their key, such as ConfigDatabase. The package is named
+// by -package, by default the package go generate runs for, or main. When no
+// file is given the input is read from standard input, and without -o the
+// generated code is written to standard output. A typical go:generate line
+// is:
+//
+//	//go:generate go run github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/cmd/bulbagen -type Config -o config_gen.go config.bson
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+func main() {
+	schema := flag.Bool("schema", false, "read a schema instead of a sample document")
+	typeName := flag.String("type", "Config", "name of the root type")
+	pkg := flag.String("package", "", "name of the package (default $GOPACKAGE, else main)")
+	output := flag.String("o", "", "write the code to this file instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: bulbagen [-schema] [-type name] [-package name] [-o file] [file]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *pkg == "" {
+		*pkg = os.Getenv("GOPACKAGE")
+	}
+	if *pkg == "" {
+		*pkg = "main"
+	}
+
+	var src []byte
+	var err error
+	includes := bulbason.Includes(os.DirFS("."), "")
+	if flag.NArg() == 1 {
+		src, err = os.ReadFile(flag.Arg(0))
+		includes = bulbason.Includes(os.DirFS(filepath.Dir(flag.Arg(0))), filepath.Base(flag.Arg(0)))
+	} else {
+		src, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fail(err)
+	}
+	doc, err := bulbason.ParseAST(string(src), includes)
+	if err != nil {
+		fail(err)
+	}
+
+	var root *goType
+	if *schema {
+		root, err = structFromSchema(doc.Body, "")
+	} else {
+		root = structFromSample(doc.Body)
+	}
+	if err != nil {
+		fail(err)
+	}
+	code, err := generate(*pkg, *typeName, root)
+	if err != nil {
+		fail(err)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(code)
+		return
+	}
+	if err := os.WriteFile(*output, code, 0o644); err != nil {
+		fail(err)
+	}
+}
+
+// fail reports an error and exits.
+func fail(err error) {
+	if pe, ok := err.(*bulbason.ParseError); ok {
+		fmt.Fprintf(os.Stderr, "bulbagen: %d:%d: %s\n", pe.Line, pe.Column, pe.Message)
+	} else {
+		fmt.Fprintln(os.Stderr, "bulbagen:", err)
+	}
+	os.Exit(1)
+}
+
+// goType is the Go type generated for a value. Exactly one of basic, elem and
+// fields describes it, or none for a value whose type is unknown, such as
+// MissingNo in a sample.
+type goType struct {
+	basic    string     // A predeclared or standard library type, e.g. "time.Duration"
+	elem     *goType    // Element type of a slice
+	fields   []*goField // Fields of a struct, in document order
+	isStruct bool
+}
+
+// goField is a field of a generated struct.
+type goField struct {
+	key      string // Key in the document
+	typ      *goType
+	required bool
+}
+
+// Go types of the names a schema can use.
+var schemaTypes = map[string]string{
+	"string":    "string",
+	"int":       "int",
+	"float":     "float64",
+	"bool":      "bool",
+	"timestamp": "time.Time",
+	"duration":  "time.Duration",
+	"bytes":     "[]byte",
+	"any":       "interface{}",
+}
+
+// structFromSchema returns the struct described by the entries of a schema
+// section at path.
+func structFromSchema(body []ast.Entry, path string) (*goType, error) {
+	st := &goType{isStruct: true}
+	for _, entry := range body {
+		var (
+			key      string
+			typ      *goType
+			required bool
+			err      error
+		)
+		switch e := entry.(type) {
+		case *ast.Section:
+			if e.Forme != nil {
+				// Profiles only change the values of the base.
+				continue
+			}
+			key = e.Name.Name
+			typ, err = structFromSchema(e.Body, joinPath(path, key))
+		case *ast.KeyValue:
+			key = e.Key.Name
+			typ, required, err = typeFromSchema(e.Value, joinPath(path, key))
+		}
+		if err != nil {
+			return nil, err
+		}
+		st.setField(key, typ, required)
+	}
+	return st, nil
+}
+
+// typeFromSchema returns the type described by the schema value at path, and
+// whether it is marked as required.
+func typeFromSchema(v ast.Value, path string) (*goType, bool, error) {
+	switch n := v.(type) {
+	case *ast.StringLit:
+		name, required := strings.CutSuffix(n.Value, "!")
+		typ, err := parseSchemaType(name)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %v", path, err)
+		}
+		return typ, required, nil
+	case *ast.ObjectLit:
+		typ, err := structFromSchema(n.Body, path)
+		return typ, false, err
+	case *ast.ArrayLit:
+		if len(n.Elements) == 1 {
+			if obj, ok := n.Elements[0].(*ast.ObjectLit); ok {
+				elem, err := structFromSchema(obj.Body, path+"[]")
+				return &goType{elem: elem}, false, err
+			}
+		}
+		return nil, false, fmt.Errorf(`%s: an array of sections must hold a single section describing its elements; use "[]type" for other arrays`, path)
+	}
+	return nil, false, fmt.Errorf("%s: expected a type name such as \"string\"", path)
+}
+
+// parseSchemaType returns the type named by a schema type such as "[]int".
+func parseSchemaType(name string) (*goType, error) {
+	if elem, ok := strings.CutPrefix(name, "[]"); ok {
+		typ, err := parseSchemaType(elem)
+		if err != nil {
+			return nil, err
+		}
+		return &goType{elem: typ}, nil
+	}
+	basic, ok := schemaTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", name)
+	}
+	return &goType{basic: basic}, nil
+}
+
+// structFromSample returns the struct matching the entries of a sample
+// section.
+func structFromSample(body []ast.Entry) *goType {
+	st := &goType{isStruct: true}
+	for _, entry := range body {
+		switch e := entry.(type) {
+		case *ast.Section:
+			if e.Forme == nil {
+				st.setField(e.Name.Name, structFromSample(e.Body), false)
+			}
+		case *ast.KeyValue:
+			st.setField(e.Key.Name, typeFromSample(e.Value), false)
+		}
+	}
+	return st
+}
+
+// typeFromSample returns the type of a sample value.
+func typeFromSample(v ast.Value) *goType {
+	switch n := v.(type) {
+	case *ast.StringLit:
+		return &goType{basic: "string"}
+	case *ast.NumberLit:
+		// Eternatus and Unown, infinity and NaN, are floats too.
+		if strings.ContainsAny(n.Literal, ".eE") || n.Literal == "Unown" {
+			return &goType{basic: "float64"}
+		}
+		return &goType{basic: "int"}
+	case *ast.TimeLit:
+		return &goType{basic: "time.Time"}
+	case *ast.DurationLit:
+		return &goType{basic: "time.Duration"}
+	case *ast.BytesLit:
+		return &goType{basic: "[]byte"}
+	case *ast.BoolLit:
+		return &goType{basic: "bool"}
+	case *ast.ObjectLit:
+		return structFromSample(n.Body)
+	case *ast.ArrayLit:
+		var elem *goType
+		for i, e := range n.Elements {
+			if i == 0 {
+				elem = typeFromSample(e)
+			} else {
+				elem = unify(elem, typeFromSample(e))
+			}
+		}
+		if elem == nil {
+			elem = &goType{}
+		}
+		return &goType{elem: elem}
+	}
+	return &goType{}
+}
+
+// unify returns a type that can hold values of both a and b: the type itself
+// if they agree, float64 for integers and floats, a struct with the fields of
+// both for structs, and interface{} otherwise. A type that is unknown gives
+// way to the other.
+func unify(a, b *goType) *goType {
+	switch {
+	case a.unknown():
+		return b
+	case b.unknown():
+		return a
+	case a.basic != "" && a.basic == b.basic:
+		return a
+	case a.basic == "int" && b.basic == "float64", a.basic == "float64" && b.basic == "int":
+		return &goType{basic: "float64"}
+	case a.elem != nil && b.elem != nil:
+		return &goType{elem: unify(a.elem, b.elem)}
+	case a.isStruct && b.isStruct:
+		st := &goType{isStruct: true}
+		for _, f := range a.fields {
+			st.setField(f.key, f.typ, false)
+		}
+		for _, f := range b.fields {
+			st.setField(f.key, f.typ, false)
+		}
+		return st
+	}
+	return &goType{basic: "interface{}"}
+}
+
+// unknown reports whether nothing is known about the type.
+func (t *goType) unknown() bool {
+	return t.basic == "" && t.elem == nil && !t.isStruct
+}
+
+// setField adds a field to a struct. A key seen before keeps its position,
+// and its type is unified with the new one, so that the elements of an array
+// of objects can each contribute fields.
+func (t *goType) setField(key string, typ *goType, required bool) {
+	for _, f := range t.fields {
+		if f.key == key {
+			f.typ = unify(f.typ, typ)
+			f.required = f.required || required
+			return
+		}
+	}
+	t.fields = append(t.fields, &goField{key: key, typ: typ, required: required})
+}
+
+// generator writes the declarations of the generated structs.
+type generator struct {
+	buf   bytes.Buffer
+	names map[string]bool // Type names already used
+	time  bool            // Whether the code uses package time
+}
+
+// generate returns the formatted source of a file declaring root, named
+// typeName, and the structs nested in it.
+func generate(pkg, typeName string, root *goType) ([]byte, error) {
+	g := &generator{names: make(map[string]bool)}
+	g.names[typeName] = true
+	g.declare(typeName, root)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by bulbagen. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if g.time {
+		out.WriteString("import \"time\"\n\n")
+	}
+	out.Write(g.buf.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// declare writes the declaration of the struct st, named name, followed by
+// those of the structs nested in it.
+func (g *generator) declare(name string, st *goType) {
+	var nested []func()
+	fmt.Fprintf(&g.buf, "type %s struct {\n", name)
+	used := make(map[string]bool)
+	for _, f := range st.fields {
+		fieldName := uniqueName(goName(f.key), used)
+		typ := g.typeString(f.typ, name+fieldName, &nested)
+		tag := f.key
+		if f.required {
+			tag += ",required"
+		}
+		fmt.Fprintf(&g.buf, "\t%s %s `bson:%q`\n", fieldName, typ, tag)
+	}
+	g.buf.WriteString("}\n\n")
+	for _, declare := range nested {
+		declare()
+	}
+}
+
+// typeString returns the Go form of typ. A struct is given a name based on
+// hint, and its declaration is queued on nested.
+func (g *generator) typeString(typ *goType, hint string, nested *[]func()) string {
+	switch {
+	case typ.isStruct:
+		name := uniqueName(hint, g.names)
+		*nested = append(*nested, func() { g.declare(name, typ) })
+		return name
+	case typ.elem != nil:
+		return "[]" + g.typeString(typ.elem, hint, nested)
+	case typ.basic != "":
+		if strings.HasPrefix(typ.basic, "time.") {
+			g.time = true
+		}
+		return typ.basic
+	}
+	return "interface{}"
+}
+
+// uniqueName returns name, with a number appended if it is already in used,
+// and records it.
+func uniqueName(name string, used map[string]bool) string {
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// initialisms are written in capitals in Go names, as golint suggests.
+var initialisms = map[string]bool{
+	"API": true, "CPU": true, "DNS": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"IP": true, "JSON": true, "SQL": true, "SSH": true, "TLS": true, "TTL": true,
+	"UI": true, "URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+// goName returns the exported Go name for a key, such as MaxConnections for
+// max_connections or KernelFlags for KERNEL_FLAGS.
+func goName(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var sb strings.Builder
+	for _, word := range words {
+		// Words written in a single case are capitalized; camelCase words
+		// keep their inner capitals.
+		if strings.ToUpper(word) == word || strings.ToLower(word) == word {
+			if upper := strings.ToUpper(word); initialisms[upper] {
+				sb.WriteString(upper)
+				continue
+			}
+			word = strings.ToLower(word)
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	name := sb.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// joinPath joins a key to the path of its parent.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
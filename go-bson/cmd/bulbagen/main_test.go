@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bulbason "github.com/kubabialy/BulbaSaur-Object-Notation/go-bson"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		input    string
+		schema   bool
+		pkg      string
+		typeName string
+	}{
+		{"sample.bson", false, "main", "Config"},
+		{"schema.bson", true, "conf", "Schema"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("testdata", tt.input))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			doc, err := bulbason.ParseAST(string(src))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			root := structFromSample(doc.Body)
+			if tt.schema {
+				if root, err = structFromSchema(doc.Body, ""); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			code, err := generate(tt.pkg, tt.typeName, root)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			golden := filepath.Join("testdata", strings.TrimSuffix(tt.input, ".bson")+".golden")
+			if *update {
+				if err := os.WriteFile(golden, code, 0o644); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(code) != string(expected) {
+				t.Errorf("Expected:\n%s\nGot:\n%s", expected, code)
+			}
+			typeCheck(t, code)
+		})
+	}
+}
+
+// typeCheck fails the test if code, a Go source file, does not compile.
+func typeCheck(t *testing.T, code []byte) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "gen.go", code, 0)
+	if err != nil {
+		t.Fatalf("Generated code does not parse: %v", err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(file.Name.Name, fset, []*ast.File{file}, nil); err != nil {
+		t.Errorf("Generated code does not compile: %v", err)
+	}
+}
+
+func TestStructFromSchema_Errors(t *testing.T) {
+	doc, err := bulbason.ParseAST("BULBA!\nport ~> \"integer\"\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := structFromSchema(doc.Body, ""); err == nil {
+		t.Error("Expected an error for an unknown type")
+	}
+}
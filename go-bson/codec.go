@@ -0,0 +1,169 @@
+package bulbason
+
+import (
+	"encoding/base64"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ObjectWriter collects the members of an object, one at a time, for
+// ObjectMarshaler and MarshalBulba methods. Members of the common types are
+// added without reflection, which the code bulbacodec generates relies on.
+// The zero value is an empty object ready to use.
+//
+// The first error, such as a key that cannot be written, is kept and
+// reported when the object is encoded; the members added after it are
+// ignored.
+type ObjectWriter struct {
+	members []objectMember
+	err     error
+}
+
+// objectMember is a member added to an ObjectWriter. Strings and objects are
+// only encoded once it is known whether they are written inline.
+type objectMember struct {
+	name    string        // Key as given
+	key     string        // Encoded key
+	literal string        // Encoded value of the other members
+	text    string        // Value of a string member
+	isText  bool          // The member is a string
+	object  *ObjectWriter // Members of an object member
+}
+
+// String adds a string member.
+func (w *ObjectWriter) String(key, s string) {
+	w.add(objectMember{key: key, text: s, isText: true}, nil)
+}
+
+// Int adds an integer member.
+func (w *ObjectWriter) Int(key string, n int64) {
+	w.add(objectMember{key: key, literal: strconv.FormatInt(n, 10)}, nil)
+}
+
+// Uint adds an unsigned integer member.
+func (w *ObjectWriter) Uint(key string, n uint64) {
+	w.add(objectMember{key: key, literal: strconv.FormatUint(n, 10)}, nil)
+}
+
+// Float adds a float member, written so that it is read back as a float.
+func (w *ObjectWriter) Float(key string, f float64) {
+	literal, err := encodeFloat(f)
+	w.add(objectMember{key: key, literal: literal}, err)
+}
+
+// Bool adds a boolean member.
+func (w *ObjectWriter) Bool(key string, b bool) {
+	literal := "NotVeryEffective"
+	if b {
+		literal = "SuperEffective"
+	}
+	w.add(objectMember{key: key, literal: literal}, nil)
+}
+
+// Time adds a timestamp member.
+func (w *ObjectWriter) Time(key string, t time.Time) {
+	w.add(objectMember{key: key, literal: t.Format(time.RFC3339Nano)}, nil)
+}
+
+// Duration adds a duration member.
+func (w *ObjectWriter) Duration(key string, d time.Duration) {
+	w.add(objectMember{key: key, literal: d.String()}, nil)
+}
+
+// ByteString adds a byte string member.
+func (w *ObjectWriter) ByteString(key string, b []byte) {
+	w.add(objectMember{key: key, literal: "0b64\"" + base64.StdEncoding.EncodeToString(b) + "\""}, nil)
+}
+
+// Object adds a member holding the object whose members write adds, such as
+// the MarshalBulbaObject method of a nested struct.
+func (w *ObjectWriter) Object(key string, write func(*ObjectWriter)) {
+	nested := new(ObjectWriter)
+	write(nested)
+	w.add(objectMember{key: key, object: nested}, nested.err)
+}
+
+// Value adds a member of any type, encoded as Marshal encodes the values of
+// a section.
+func (w *ObjectWriter) Value(key string, v interface{}) {
+	rv := indirect(reflect.ValueOf(v))
+	if m, ok := implementer[ObjectMarshaler](rv); ok {
+		w.Object(key, m.MarshalBulbaObject)
+		return
+	}
+	if !encodesItself(rv) && rv.Kind() == reflect.String {
+		w.String(key, rv.String())
+		return
+	}
+	literal, err := newEncodeState().encodeValue(rv, false)
+	w.add(objectMember{key: key, literal: literal}, err)
+}
+
+// add appends m, unless err or an earlier error is set.
+func (w *ObjectWriter) add(m objectMember, err error) {
+	if w.err != nil {
+		return
+	}
+	if err == nil {
+		m.name = m.key
+		m.key, err = encodeKey(m.key)
+	}
+	if err != nil {
+		w.err = err
+		return
+	}
+	w.members = append(w.members, m)
+}
+
+// Bytes returns the members added so far as an inline object, such as
+// { host ~~~~> "db", port ~~~~> 5432 }, or the first error met.
+func (w *ObjectWriter) Bytes() ([]byte, error) {
+	literal, err := w.inline(newEncodeState())
+	if err != nil {
+		return nil, err
+	}
+	return []byte(literal), nil
+}
+
+// sorted returns the members ordered by keyOrder, if set, or in the order
+// they were added.
+func (w *ObjectWriter) sorted(keyOrder func(a, b string) int) []objectMember {
+	if keyOrder == nil {
+		return w.members
+	}
+	members := slices.Clone(w.members)
+	slices.SortStableFunc(members, func(a, b objectMember) int { return keyOrder(a.name, b.name) })
+	return members
+}
+
+// inline returns the members as an inline object, in the layout of e.
+func (w *ObjectWriter) inline(e *encodeState) (string, error) {
+	if w.err != nil {
+		return "", w.err
+	}
+	parts := make([]string, len(w.members))
+	for i, m := range w.sorted(e.keyOrder) {
+		literal := m.literal
+		var err error
+		switch {
+		case m.isText:
+			literal, err = e.encodeString(m.text, true)
+		case m.object != nil:
+			literal, err = m.object.inline(e)
+		}
+		if err != nil {
+			return "", err
+		}
+		parts[i] = m.key + " " + e.vine + " " + literal
+	}
+	return inlineObject(parts), nil
+}
+
+// JoinPath appends key to the dotted path of a value, giving "database.port"
+// for "database" and "port". UnmarshalBulbaValue methods use it to name the
+// values nested in theirs.
+func JoinPath(path, key string) string {
+	return joinPath(path, key)
+}
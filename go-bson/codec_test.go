@@ -0,0 +1,179 @@
+package bulbason
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// codecPool and codecServer implement their codecs by hand, the way the code
+// bulbacodec generates does.
+type codecPool struct {
+	Size    int           `bson:"size"`
+	Timeout time.Duration `bson:"timeout"`
+}
+
+type codecServer struct {
+	Name  string    `bson:"name"`
+	Tags  []string  `bson:"tags"`
+	Notes string    `bson:"notes"`
+	Pool  codecPool `bson:"pool"`
+}
+
+func (x codecPool) MarshalBulbaObject(w *ObjectWriter) {
+	w.Int("size", int64(x.Size))
+	w.Duration("timeout", x.Timeout)
+}
+
+func (x *codecPool) UnmarshalBulbaValue(v interface{}, path string) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return DecodeValue(v, x, path)
+	}
+	if val, ok := m["size"]; ok {
+		if n, ok := val.(int64); ok {
+			x.Size = int(n)
+		} else if err := DecodeValue(val, &x.Size, JoinPath(path, "size")); err != nil {
+			return err
+		}
+	}
+	if val, ok := m["timeout"]; ok {
+		if err := DecodeValue(val, &x.Timeout, JoinPath(path, "timeout")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x codecServer) MarshalBulbaObject(w *ObjectWriter) {
+	w.String("name", x.Name)
+	w.Value("tags", x.Tags)
+	w.String("notes", x.Notes)
+	w.Object("pool", x.Pool.MarshalBulbaObject)
+}
+
+func (x *codecServer) UnmarshalBulbaValue(v interface{}, path string) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return DecodeValue(v, x, path)
+	}
+	fields := []struct {
+		key string
+		dst interface{}
+	}{{"name", &x.Name}, {"tags", &x.Tags}, {"notes", &x.Notes}}
+	for _, f := range fields {
+		if val, ok := m[f.key]; ok {
+			if err := DecodeValue(val, f.dst, JoinPath(path, f.key)); err != nil {
+				return err
+			}
+		}
+	}
+	if val, ok := m["pool"]; ok {
+		return x.Pool.UnmarshalBulbaValue(val, JoinPath(path, "pool"))
+	}
+	return nil
+}
+
+func TestObjectMarshaler(t *testing.T) {
+	server := codecServer{Name: "api", Tags: []string{"a", "b"}, Notes: "line one\nline two", Pool: codecPool{Size: 5, Timeout: time.Minute}}
+	out, err := Marshal(server)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+name ~~~~> "api"
+tags ~~~~> <| "a", "b" |>
+notes ~~~~> """
+    line one
+    line two
+    """
+(o) pool (o)
+    size ~~~~> 5
+    timeout ~~~~> 1m0s
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	var decoded codecServer
+	if err := Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, server) {
+		t.Errorf("Expected %+v, got %+v", server, decoded)
+	}
+
+	// Where a section does not fit, the objects are written inline.
+	list := map[string]interface{}{"pools": []interface{}{codecPool{Size: 1}, 2}}
+	if out, err = Marshal(list); err != nil || !strings.Contains(string(out), "pools ~~~~> <| { size ~~~~> 1, timeout ~~~~> 0s }, 2 |>") {
+		t.Errorf("Unexpected result %q, %v", out, err)
+	}
+}
+
+func TestValueUnmarshaler_Errors(t *testing.T) {
+	var server codecServer
+	err := Unmarshal([]byte("BULBA!\n(o) pool (o)\n    size ~> \"big\"\n"), &server)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Path != "pool.size" {
+		t.Errorf("Expected a type error at pool.size, got %v", err)
+	}
+
+	// DecodeValue does not call the method that calls it back.
+	err = Unmarshal([]byte("BULBA!\npool ~> 5\n"), &server)
+	if !errors.As(err, &typeErr) || typeErr.Path != "pool" || typeErr.Type != reflect.TypeOf(codecPool{}) {
+		t.Errorf("Expected a type error at pool, got %v", err)
+	}
+}
+
+func TestObjectWriter(t *testing.T) {
+	var w ObjectWriter
+	w.String("name", `say "hi"`)
+	w.Int("count", -3)
+	w.Uint("big", 1<<40)
+	w.Float("ratio", 2)
+	w.Bool("on", true)
+	w.Time("at", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	w.ByteString("blob", []byte("hi"))
+	w.Value("missing", nil)
+	w.Object("empty", func(*ObjectWriter) {})
+	out, err := w.Bytes()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "{ name ~~~~> `say \"hi\"`, count ~~~~> -3, big ~~~~> 1099511627776, ratio ~~~~> 2.0, " +
+		"on ~~~~> SuperEffective, at ~~~~> 2024-05-01T10:00:00Z, blob ~~~~> 0b64\"aGk=\", missing ~~~~> MissingNo, empty ~~~~> { } }"
+	if string(out) != expected {
+		t.Errorf("Expected %s, got %s", expected, out)
+	}
+	if _, err := ParseValue(out); err != nil {
+		t.Errorf("Expected the object to parse, got %v", err)
+	}
+
+	w = ObjectWriter{}
+	w.String("", "no key")
+	w.Int("after", 1)
+	if _, err := w.Bytes(); err == nil {
+		t.Error("Expected an error for an empty key")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	v, err := ParseValue([]byte(` { port ~> 5432, hosts ~> <| "a" |> } `))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"port": int64(5432), "hosts": []interface{}{"a"}}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("Expected %v, got %v", expected, v)
+	}
+	for _, bad := range []string{"", "\"a\"\n\"b\"", "<| 1"} {
+		if _, err := ParseValue([]byte(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+	if v, err := ParseValue([]byte("1.50"), UseNumber()); err != nil || v != Number("1.50") {
+		t.Errorf("Expected the options to apply, got %v (%v)", v, err)
+	}
+}
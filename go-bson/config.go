@@ -0,0 +1,219 @@
+package bulbason
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Config layers configuration from several sources into a single Document,
+// for services whose settings come from more than one place. From lowest to
+// highest precedence, the layers are:
+//
+//  1. defaults, set with SetDefault and SetDefaults;
+//  2. documents, added with AddFile, AddFS and AddDocument, later ones
+//     overriding earlier ones;
+//  3. environment variables, loaded with LoadEnv;
+//  4. overrides, set with Set, such as values of command-line flags.
+//
+// Each layer overrides the values of the layers below it key by key, with
+// sections merged deeply and arrays replaced, as Merge does by default. The
+// typed getters read the merged document, and Unmarshal decodes it into a
+// struct. A Config is safe for concurrent use.
+type Config struct {
+	mu        sync.RWMutex
+	defaults  Document
+	documents []map[string]interface{}
+	env       Document
+	overrides Document
+	merged    Document // Cached result, nil after a change
+}
+
+// NewConfig returns an empty Config.
+func NewConfig() *Config {
+	return &Config{defaults: Document{}, env: Document{}, overrides: Document{}}
+}
+
+// SetDefault sets the default value at path, which applies when no other
+// layer sets it.
+func (c *Config) SetDefault(path string, value interface{}) error {
+	return c.update(func() error { return c.defaults.Set(path, value) })
+}
+
+// SetDefaults merges doc, such as a parsed document of defaults, into the
+// defaults.
+func (c *Config) SetDefaults(doc map[string]interface{}) {
+	c.update(func() error {
+		mergeSection(c.defaults, doc, MergeOptions{})
+		return nil
+	})
+}
+
+// AddFile parses the file at path and adds it above the documents already
+// added. The files it includes are read from its directory and below.
+func (c *Config) AddFile(path string, opts ...ParseOption) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	opts = append([]ParseOption{Includes(os.DirFS(filepath.Dir(path)), filepath.Base(path))}, opts...)
+	doc, err := Parse(string(data), opts...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	c.AddDocument(doc)
+	return nil
+}
+
+// AddFS parses the files of fsys matching pattern, as ParseFS does, and adds
+// the result above the documents already added.
+func (c *Config) AddFS(fsys fs.FS, pattern string, opts ...ParseOption) error {
+	doc, err := ParseFS(fsys, pattern, opts...)
+	if err != nil {
+		return err
+	}
+	c.AddDocument(doc)
+	return nil
+}
+
+// AddDocument adds a parsed document above the documents already added.
+func (c *Config) AddDocument(doc map[string]interface{}) {
+	c.update(func() error {
+		c.documents = append(c.documents, copyValue(doc).(map[string]interface{}))
+		return nil
+	})
+}
+
+// LoadEnv loads the environment variables whose names start with prefix and
+// an underscore, replacing those loaded before. The rest of the name gives
+// the path, lowercased, with a double underscore between keys, so that with
+// prefix "BULBA" the variable BULBA_DATABASE__MAX_CONNECTIONS sets
+// database.max_connections.
+//
+// A value that is a BSON literal, such as 5432, 30s, SuperEffective or
+// <| "a", "b" |>, takes the type of the literal. Any other value is a
+// string, so BULBA_DATABASE__HOST=localhost needs no quotes. Variables naming
+// an empty key, or a key both as a value and as a section, are an error.
+func (c *Config) LoadEnv(prefix string) error {
+	prefix += "_"
+	var names []string
+	values := make(map[string]string)
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			names = append(names, rest)
+			values[rest] = value
+		}
+	}
+	// Sorted, the variables of a section follow one another, and errors do
+	// not depend on the order of the environment.
+	sort.Strings(names)
+
+	env := Document{}
+	for _, name := range names {
+		path := strings.ReplaceAll(strings.ToLower(name), "__", ".")
+		if err := env.Set(path, literalValue(values[name])); err != nil {
+			return fmt.Errorf("bulbason: environment variable %s%s: %w", prefix, name, err)
+		}
+	}
+	return c.update(func() error {
+		c.env = env
+		return nil
+	})
+}
+
+// literalValue returns the value of text such as an environment variable: the
+// BSON literal it holds, or the text itself.
+func literalValue(s string) interface{} {
+	if strings.ContainsAny(s, "\r\n") {
+		return s
+	}
+	m, err := Parse("BULBA!\nv ~> " + s + "\n")
+	if err != nil {
+		return s
+	}
+	return m["v"]
+}
+
+// Set overrides the value at path, above every other layer.
+func (c *Config) Set(path string, value interface{}) error {
+	return c.update(func() error { return c.overrides.Set(path, value) })
+}
+
+// update runs a change to the layers and drops the cached merge.
+func (c *Config) update(change func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.merged = nil
+	return change()
+}
+
+// Document returns the merged configuration. It is shared with other
+// callers, so it must not be modified; use Set to change a value.
+func (c *Config) Document() Document {
+	c.mu.RLock()
+	merged := c.merged
+	c.mu.RUnlock()
+	if merged != nil {
+		return merged
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.merged == nil {
+		merged := Merge(map[string]interface{}(c.defaults), nil, MergeOptions{})
+		for _, layer := range c.documents {
+			mergeSection(merged, layer, MergeOptions{})
+		}
+		mergeSection(merged, c.env, MergeOptions{})
+		mergeSection(merged, c.overrides, MergeOptions{})
+		c.merged = merged
+	}
+	return c.merged
+}
+
+// Unmarshal decodes the merged configuration into the value pointed to by
+// v, following the same rules as Unmarshal. The hooks convert values on the
+// way, as they do for Decoder.UseHooks.
+func (c *Config) Unmarshal(v interface{}, hooks ...DecodeHook) error {
+	return (&decodeState{hooks: hooks}).decodeDocument(map[string]interface{}(c.Document()), v)
+}
+
+// Get returns the merged value at path, as Document.Get does.
+func (c *Config) Get(path string) (interface{}, error) {
+	return c.Document().Get(path)
+}
+
+// GetString returns the merged string at path, as Document.GetString does.
+func (c *Config) GetString(path string) (string, error) {
+	return c.Document().GetString(path)
+}
+
+// GetInt returns the merged integer at path, as Document.GetInt does.
+func (c *Config) GetInt(path string) (int64, error) {
+	return c.Document().GetInt(path)
+}
+
+// GetBool returns the merged boolean at path, as Document.GetBool does.
+func (c *Config) GetBool(path string) (bool, error) {
+	return c.Document().GetBool(path)
+}
+
+// GetStringOr returns the merged string at path, or def if there is none.
+func (c *Config) GetStringOr(path, def string) string {
+	return c.Document().GetStringOr(path, def)
+}
+
+// GetIntOr returns the merged integer at path, or def if there is none.
+func (c *Config) GetIntOr(path string, def int64) int64 {
+	return c.Document().GetIntOr(path, def)
+}
+
+// GetBoolOr returns the merged boolean at path, or def if there is none.
+func (c *Config) GetBoolOr(path string, def bool) bool {
+	return c.Document().GetBoolOr(path, def)
+}
@@ -0,0 +1,113 @@
+package bulbason
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.bson")
+	err := os.WriteFile(path, []byte(`BULBA!
+name ~> "app"
+(o) database (o)
+    host ~> "db.internal"
+    port ~> 5432
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewConfig()
+	c.SetDefaults(map[string]interface{}{
+		"name":  "default",
+		"debug": false,
+		"database": map[string]interface{}{
+			"host":            "localhost",
+			"max_connections": int64(10),
+		},
+	})
+	if err := c.SetDefault("timeout", 30*time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.AddFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.AddFS(testFS, "conf.d/20-*.bson"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	t.Setenv("BULBA_DATABASE__MAX_CONNECTIONS", "50")
+	t.Setenv("BULBA_DEBUG", "SuperEffective")
+	t.Setenv("BULBA_REGION", "eu-west")
+	t.Setenv("OTHER_NAME", "ignored")
+	if err := c.LoadEnv("BULBA"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.Set("database.port", 6543); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := Document{
+		"name":    "app",
+		"debug":   true,
+		"region":  "eu-west",
+		"timeout": 30 * time.Second,
+		"database": map[string]interface{}{
+			"host":            "db.internal",
+			"port":            int64(6543),
+			"max_connections": int64(50),
+		},
+	}
+	if doc := c.Document(); !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, doc)
+	}
+
+	if n := c.GetIntOr("database.max_connections", 0); n != 50 {
+		t.Errorf("Expected 50, got %d", n)
+	}
+	if b, err := c.GetBool("debug"); err != nil || !b {
+		t.Errorf("Expected true, got %v (%v)", b, err)
+	}
+	if s := c.GetStringOr("missing", "fallback"); s != "fallback" {
+		t.Errorf("Expected the fallback, got %q", s)
+	}
+
+	var cfg struct {
+		Name     string `bson:"name"`
+		Database struct {
+			Port int `bson:"port"`
+		} `bson:"database"`
+	}
+	if err := c.Unmarshal(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Name != "app" || cfg.Database.Port != 6543 {
+		t.Errorf("Unexpected result %+v", cfg)
+	}
+
+	// A change to any layer is seen by the getters.
+	if err := c.Set("name", "override"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s := c.GetStringOr("name", ""); s != "override" {
+		t.Errorf("Expected the override, got %q", s)
+	}
+}
+
+func TestConfig_Errors(t *testing.T) {
+	c := NewConfig()
+	if err := c.AddFile(filepath.Join(t.TempDir(), "missing.bson")); !os.IsNotExist(err) {
+		t.Errorf("Expected a not-exist error, got %v", err)
+	}
+
+	t.Setenv("BULBA_DB", "1")
+	t.Setenv("BULBA_DB__HOST", "localhost")
+	if err := c.LoadEnv("BULBA"); err == nil || !strings.Contains(err.Error(), "BULBA_DB__HOST") {
+		t.Errorf("Expected an error naming BULBA_DB__HOST, got %v", err)
+	}
+}
@@ -0,0 +1,769 @@
+package bulbason
+
+import (
+	"bytes"
+	"cmp"
+	"encoding"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// UnmarshalTypeError describes a document value that cannot be stored in the
+// Go value it was decoded into.
+type UnmarshalTypeError struct {
+	Path  string       // Dotted path of the key, e.g. "database.pool.max_connections"
+	Value string       // Description of the document value, e.g. "string"
+	Type  reflect.Type // Type of the Go value it could not be assigned to
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("%s (cannot decode %s into %s at %q)", ErrType, e.Value, e.Type, e.Path)
+}
+
+// Is reports whether target is ErrTypeError, whose message e starts with.
+func (e *UnmarshalTypeError) Is(target error) bool {
+	return target == ErrTypeError
+}
+
+// Unmarshaler is implemented by types that decode a BSON value themselves,
+// such as IP ranges or version numbers. UnmarshalBulba receives the value as
+// a literal, e.g. "10.0.0.0/8" with its quotes, 42 or { major ~> 1 }. It is
+// not called for MissingNo, which resets the value as for any other type.
+type Unmarshaler interface {
+	UnmarshalBulba([]byte) error
+}
+
+// ValueUnmarshaler is implemented by types that decode themselves from a
+// value already parsed, in the form Parse gives it, which spares writing the
+// value back as a literal for UnmarshalBulba. path is the dotted path of the
+// value, which the errors returned should mention. It is used before
+// Unmarshaler, and is not called for MissingNo either. The code bulbacodec
+// generates implements it.
+type ValueUnmarshaler interface {
+	UnmarshalBulbaValue(v interface{}, path string) error
+}
+
+// Unmarshal parses the BSON document in data and stores the result in the
+// value pointed to by v.
+//
+// Sections decode into structs or maps, Razor Leaf arrays into slices or
+// arrays, timestamps into time.Time, durations into time.Duration, byte
+// strings into []byte, and MissingNo into the zero value. Integers decode into any integer or float
+// type they fit in, and into big.Int. Struct fields are matched by
+// their `bson` tag, e.g. `bson:"app_name"`, or by their Go name when the tag
+// is absent. The fields of embedded structs, and of struct fields tagged
+// `bson:",inline"` or `bson:",squash"`, are read from the section of the
+// struct that holds them. Document keys without a matching field are
+// ignored, unless the struct has a map field tagged `bson:",remain"`, which
+// receives them. A field tagged with the default option, as in
+// `bson:"port,default=8080"`, is decoded from the literal that follows when
+// its key is missing, and one tagged with the required option makes a
+// missing key, or one set to MissingNo, fail with a RequiredFieldError. The
+// min, max, enum and regex options validate values, as in
+// `bson:"level,enum=debug|info|warn"` or `bson:"port,min=1,max=65535"`;
+// decoding carries on past the values that break them, and a
+// ValidationErrors lists them all at the end. Types
+// implementing ValueUnmarshaler or Unmarshaler decode their own values, and
+// other types implementing encoding.TextUnmarshaler decode strings.
+func Unmarshal(data []byte, v interface{}) error {
+	return new(decodeState).decodeFrom(newStringLexer(string(data), newParseConfig(nil)), v)
+}
+
+// Decode is like Unmarshal, but returns the decoded value instead of storing
+// it through a pointer:
+//
+//	cfg, err := bulbason.Decode[Config](data)
+func Decode[T any](data []byte) (T, error) {
+	var v T
+	err := Unmarshal(data, &v)
+	return v, err
+}
+
+// DecodeValue stores src, a value in the form Parse gives it, in the value
+// pointed to by v, as Unmarshal does for the values of a document. path is
+// the dotted path of src, for error messages.
+//
+// The Unmarshaler and ValueUnmarshaler methods of v itself are not used, so
+// such a method can hand DecodeValue the values it does not handle. Those of
+// the values nested in v are.
+func DecodeValue(src interface{}, v interface{}, path string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("bulbason: DecodeValue requires a non-nil pointer")
+	}
+	d := &decodeState{skipMethods: true}
+	if err := d.decodeValue(src, rv.Elem(), path); err != nil {
+		return err
+	}
+	if len(d.invalid) > 0 {
+		return d.invalid
+	}
+	return nil
+}
+
+// UnknownFieldError reports a document key that no struct field matches, when
+// decoding with Decoder.DisallowUnknownFields.
+type UnknownFieldError struct {
+	Path       string // Dotted path of the key, e.g. "database.hots"
+	Line       int    // 1-based position of the key, 0 if it cannot be located
+	Column     int
+	Suggestion string // The key of the field it is likely a typo of, e.g. "host", if any
+}
+
+func (e *UnknownFieldError) Error() string {
+	msg := fmt.Sprintf("unknown key %q", e.Path)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %q?", e.Suggestion)
+	}
+	if e.Line == 0 {
+		return "bulbason: " + msg
+	}
+	return fmt.Sprintf("bulbason: line %d: %s", e.Line, msg)
+}
+
+// RequiredFieldError reports a key that the document does not hold, or sets to
+// MissingNo, while the struct field it decodes into is tagged with the
+// required option, as in `bson:"port,required"`.
+type RequiredFieldError struct {
+	Path string // Dotted path of the key, e.g. "database.port"
+}
+
+func (e *RequiredFieldError) Error() string {
+	return fmt.Sprintf("bulbason: required key %q is missing", e.Path)
+}
+
+// decodeState holds the settings of one decoding.
+type decodeState struct {
+	// disallowUnknownFields rejects the keys no struct field matches, which
+	// are located in tree when it is set.
+	disallowUnknownFields bool
+	tree                  *ast.Document
+	hooks                 []DecodeHook
+
+	// caseInsensitiveKeys matches keys to struct fields regardless of case
+	// when no key matches exactly.
+	caseInsensitiveKeys bool
+
+	// invalid gathers the values that break validation options, which do
+	// not stop decoding.
+	invalid ValidationErrors
+
+	// skipMethods makes the next value decoded ignore its own
+	// Unmarshaler and ValueUnmarshaler methods, for DecodeValue.
+	skipMethods bool
+}
+
+// decodeDocument stores an already parsed document, or a single value, in the
+// value pointed to by v.
+func (d *decodeState) decodeDocument(doc interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("bulbason: Unmarshal requires a non-nil pointer")
+	}
+	if err := d.decodeValue(doc, rv.Elem(), ""); err != nil {
+		return err
+	}
+	if len(d.invalid) > 0 {
+		return d.invalid
+	}
+	return nil
+}
+
+// decodeFrom parses the document read by l and stores it in the value pointed
+// to by v, keeping the syntax tree to locate the keys errors are about.
+func (d *decodeState) decodeFrom(l *Lexer, v interface{}) error {
+	tree, err := parseAST(l)
+	if err == nil {
+		err = l.contextErr()
+	}
+	if err != nil {
+		return err
+	}
+	doc, err := documentToMap(tree, l.cfg)
+	if err != nil {
+		return err
+	}
+	d.tree = tree
+	return d.decodeDocument(doc, v)
+}
+
+// decodeValue assigns the parsed value src to dst.
+// path is the dotted key path used in error messages.
+func (d *decodeState) decodeValue(src interface{}, dst reflect.Value, path string) error {
+	// Hooks are not given MissingNo, but may return it.
+	for i := 0; i < len(d.hooks) && src != nil; i++ {
+		var err error
+		if src, err = d.hooks[i](src, dst.Type()); err != nil {
+			return fmt.Errorf("bulbason: cannot decode %q: %w", path, err)
+		}
+	}
+
+	// MissingNo resets the destination to its zero value.
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	skipMethods := d.skipMethods
+	d.skipMethods = false
+	if dst.CanAddr() && !skipMethods {
+		switch u := dst.Addr().Interface().(type) {
+		case ValueUnmarshaler:
+			return u.UnmarshalBulbaValue(src, path)
+		case Unmarshaler:
+			return decodeUnmarshaler(u, src, path)
+		}
+	}
+
+	// With UseNumber the literal is only converted once the type it is
+	// stored in is known.
+	if n, ok := src.(Number); ok && dst.Type() != numberType && dst.Kind() != reflect.Interface && dst.Kind() != reflect.Ptr {
+		v, err := parseNumber(string(n), LargeIntegerBig)
+		if err != nil {
+			return typeError(src, dst, path)
+		}
+		src = v
+	}
+
+	// Timestamps and durations need their own literal, not a section or
+	// a number, while big integers are structs that hold a number.
+	switch dst.Type() {
+	case timeType:
+		t, ok := src.(time.Time)
+		if !ok {
+			return typeError(src, dst, path)
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, ok := src.(time.Duration)
+		if !ok {
+			return typeError(src, dst, path)
+		}
+		dst.SetInt(int64(d))
+		return nil
+	case bigIntType:
+		b := new(big.Int)
+		switch n := src.(type) {
+		case int64:
+			b.SetInt64(n)
+		case uint64:
+			b.SetUint64(n)
+		case *big.Int:
+			b.Set(n)
+		default:
+			return typeError(src, dst, path)
+		}
+		dst.Set(reflect.ValueOf(b).Elem())
+		return nil
+	case numberType:
+		var literal string
+		switch n := src.(type) {
+		case Number:
+			literal = string(n)
+		case int64:
+			literal = strconv.FormatInt(n, 10)
+		case uint64:
+			literal = strconv.FormatUint(n, 10)
+		case *big.Int:
+			literal = n.String()
+		case float64:
+			literal = strconv.FormatFloat(n, 'g', -1, 64)
+		default:
+			return typeError(src, dst, path)
+		}
+		dst.SetString(literal)
+		return nil
+	}
+
+	// Values of the destination's own type, such as those a LiteralMatcher
+	// returns, are stored as they are. Maps, slices and pointers are still
+	// copied, so as not to share memory with src.
+	if sv := reflect.ValueOf(src); sv.Type() == dst.Type() {
+		switch sv.Kind() {
+		case reflect.Map, reflect.Slice, reflect.Ptr:
+		default:
+			dst.Set(sv)
+			return nil
+		}
+	}
+
+	if dst.CanAddr() {
+		if u, ok := dst.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			s, ok := src.(string)
+			if !ok {
+				return typeError(src, dst, path)
+			}
+			if err := u.UnmarshalText([]byte(s)); err != nil {
+				return fmt.Errorf("bulbason: cannot decode %q: %w", path, err)
+			}
+			return nil
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return typeError(src, dst, path)
+		}
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return d.decodeValue(src, dst.Elem(), path)
+	case reflect.Struct:
+		section, ok := src.(map[string]interface{})
+		if !ok {
+			return typeError(src, dst, path)
+		}
+		fields := typeFields(dst.Type())
+		keys, err := d.matchKeys(section, fields, path)
+		if err != nil {
+			return err
+		}
+		remain := remainField(fields)
+		if d.disallowUnknownFields && remain == nil {
+			if err := d.checkUnknownFields(section, keys, path); err != nil {
+				return err
+			}
+		}
+		for i, f := range fields {
+			if f.remain {
+				continue
+			}
+			val, ok := section[keys[i]]
+			if !ok {
+				if err := d.decodeMissing(f, dst, joinPath(path, f.name)); err != nil {
+					return err
+				}
+				continue
+			}
+			if val == nil && f.required {
+				return &RequiredFieldError{Path: joinPath(path, keys[i])}
+			}
+			fv, _ := fieldByIndex(dst, f.index, true)
+			if err := d.decodeValue(val, fv, joinPath(path, keys[i])); err != nil {
+				return err
+			}
+			if f.rules != nil {
+				if msg := f.rules.check(indirect(fv)); msg != "" {
+					err := &ValidationError{Path: joinPath(path, keys[i]), Message: msg}
+					err.Line, err.Column = d.position(err.Path)
+					d.invalid = append(d.invalid, err)
+				}
+			}
+		}
+		if remain != nil {
+			if rest := unmatchedKeys(section, keys); len(rest) > 0 {
+				fv, _ := fieldByIndex(dst, remain.index, true)
+				return d.decodeValue(rest, fv, path)
+			}
+		}
+		return nil
+	case reflect.Map:
+		section, ok := src.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return typeError(src, dst, path)
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(section)))
+		}
+		for key, val := range section {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := d.decodeValue(val, elem, joinPath(path, key)); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Slice:
+		if b, ok := src.([]byte); ok {
+			if dst.Type().Elem().Kind() != reflect.Uint8 {
+				return typeError(src, dst, path)
+			}
+			dst.SetBytes(bytes.Clone(b))
+			return nil
+		}
+		arr, ok := asArray(src)
+		if !ok {
+			return typeError(src, dst, path)
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, val := range arr {
+			if err := d.decodeValue(val, slice.Index(i), indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+		return nil
+	case reflect.Array:
+		arr, ok := asArray(src)
+		if !ok || len(arr) > dst.Len() {
+			return typeError(src, dst, path)
+		}
+		for i := 0; i < dst.Len(); i++ {
+			if i >= len(arr) {
+				dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+				continue
+			}
+			if err := d.decodeValue(arr[i], dst.Index(i), indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		s, ok := src.(string)
+		if !ok {
+			return typeError(src, dst, path)
+		}
+		dst.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return typeError(src, dst, path)
+		}
+		dst.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := src.(int64)
+		if !ok || dst.OverflowInt(n) {
+			return typeError(src, dst, path)
+		}
+		dst.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := src.(type) {
+		case int64:
+			if n < 0 {
+				return typeError(src, dst, path)
+			}
+			u = uint64(n)
+		case uint64:
+			u = n
+		case *big.Int:
+			if !n.IsUint64() {
+				return typeError(src, dst, path)
+			}
+			u = n.Uint64()
+		default:
+			return typeError(src, dst, path)
+		}
+		if dst.OverflowUint(u) {
+			return typeError(src, dst, path)
+		}
+		dst.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch n := src.(type) {
+		case int64:
+			f = float64(n)
+		case uint64:
+			f = float64(n)
+		case *big.Int:
+			f, _ = new(big.Float).SetInt(n).Float64()
+		case float64:
+			f = n
+		default:
+			return typeError(src, dst, path)
+		}
+		if dst.Kind() == reflect.Float32 && !math.IsInf(f, 0) && math.Abs(f) > math.MaxFloat32 {
+			return typeError(src, dst, path)
+		}
+		dst.SetFloat(f)
+		return nil
+	default:
+		return typeError(src, dst, path)
+	}
+}
+
+// decodeMissing handles the field f of struct v, whose key at path the
+// document does not hold: a required field is an error, a field with a
+// default is decoded from it, and the fields of a nested struct, unless it is
+// behind a pointer, are handled in turn.
+func (d *decodeState) decodeMissing(f field, v reflect.Value, path string) error {
+	if f.required {
+		return &RequiredFieldError{Path: path}
+	}
+	if f.hasDefault {
+		fv, _ := fieldByIndex(v, f.index, true)
+		return d.decodeValue(literalValue(f.def), fv, path)
+	}
+	fv, ok := fieldByIndex(v, f.index, false)
+	if !ok || !isStructType(fv.Type()) {
+		return nil
+	}
+	for _, sub := range typeFields(fv.Type()) {
+		if sub.remain {
+			continue
+		}
+		if err := d.decodeMissing(sub, fv, joinPath(path, sub.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUnknownFields returns an UnknownFieldError for the key of section
+// that none of fields matches and that comes first in the document, if any.
+func (d *decodeState) checkUnknownFields(section map[string]interface{}, keys []string, path string) error {
+	// The keys of fields the document leaves unset are what a misspelt key
+	// was meant to be.
+	var unset []string
+	for _, key := range keys {
+		if _, ok := section[key]; !ok && key != "" {
+			unset = append(unset, key)
+		}
+	}
+	var unknown []*UnknownFieldError
+	for key := range unmatchedKeys(section, keys) {
+		err := d.unknownField(joinPath(path, key))
+		err.Suggestion = closestKey(key, unset)
+		unknown = append(unknown, err)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	// Keys that cannot be located go last, in the order of their paths.
+	return slices.MinFunc(unknown, func(a, b *UnknownFieldError) int {
+		if (a.Line == 0) != (b.Line == 0) {
+			return cmp.Compare(b.Line, a.Line)
+		}
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column), strings.Compare(a.Path, b.Path))
+	})
+}
+
+// unmatchedKeys returns the keys of section, with their values, that are not
+// among the keys matched by fields.
+func unmatchedKeys(section map[string]interface{}, keys []string) map[string]interface{} {
+	rest := maps.Clone(section)
+	for _, key := range keys {
+		delete(rest, key)
+	}
+	return rest
+}
+
+// matchKeys returns the key of section that each of fields is decoded from,
+// which is the name of the field unless caseInsensitiveKeys finds a key
+// differing from it only in case. An exact match always wins; of several
+// others, none does, and an error is returned. The remain field matches no
+// key.
+func (d *decodeState) matchKeys(section map[string]interface{}, fields []field, path string) ([]string, error) {
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		if f.remain {
+			keys[i] = "" // Not a key of the section, as keys are never empty
+			continue
+		}
+		keys[i] = f.name
+		if _, ok := section[f.name]; ok || !d.caseInsensitiveKeys {
+			continue
+		}
+		var found []string
+		for key := range section {
+			if strings.EqualFold(key, f.name) {
+				found = append(found, key)
+			}
+		}
+		switch len(found) {
+		case 0:
+		case 1:
+			keys[i] = found[0]
+		default:
+			slices.Sort(found)
+			return nil, fmt.Errorf("bulbason: cannot decode %q: several keys match the field: %q", joinPath(path, f.name), found)
+		}
+	}
+	return keys, nil
+}
+
+// unknownField returns the UnknownFieldError for the key at path.
+func (d *decodeState) unknownField(path string) *UnknownFieldError {
+	err := &UnknownFieldError{Path: path}
+	err.Line, err.Column = d.position(path)
+	return err
+}
+
+// closestKey returns the candidate nearest to key by edit distance, the first
+// of them on a tie, or "" if none is near enough to be a typo of it: two
+// edits at most, and fewer than the length of key.
+func closestKey(key string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if dist := levenshtein(key, c); dist < bestDist && dist < utf8.RuneCountInString(key) {
+			best, bestDist = c, dist
+		}
+	}
+	return best
+}
+
+// levenshtein returns the number of single rune insertions, deletions and
+// substitutions that turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// position returns the line and column of the key at path in the syntax tree,
+// or zeros if there is no tree or the key cannot be located in it.
+func (d *decodeState) position(path string) (int, int) {
+	if d.tree == nil {
+		return 0, 0
+	}
+	// Keys holding dots or brackets cannot be told apart from a path.
+	steps, err := parsePath(path)
+	if err != nil {
+		return 0, 0
+	}
+	pos, _ := keyPosition(d.tree.Body, steps)
+	return pos.Line, pos.Column
+}
+
+// keyPosition returns where the key at steps is defined in body, the last
+// definition winning, or false if the tree does not hold it, as for keys
+// copied by a reference. Profile sections are searched as well.
+func keyPosition(body []ast.Entry, steps []pathStep) (ast.Position, bool) {
+	step := steps[0]
+	if step.isIndex {
+		return ast.Position{}, false
+	}
+	for i := len(body) - 1; i >= 0; i-- {
+		switch e := body[i].(type) {
+		case *ast.Section:
+			if e.Name.Name != step.key {
+				continue
+			}
+			if len(steps) == 1 {
+				return e.Name.Loc.Start, true
+			}
+			if pos, ok := keyPosition(e.Body, steps[1:]); ok {
+				return pos, true
+			}
+		case *ast.KeyValue:
+			if e.Key.Name != step.key {
+				continue
+			}
+			if len(steps) == 1 {
+				return e.Key.Loc.Start, true
+			}
+			if pos, ok := valueKeyPosition(e.Value, steps[1:]); ok {
+				return pos, true
+			}
+		}
+	}
+	return ast.Position{}, false
+}
+
+// valueKeyPosition is keyPosition for the keys below a value.
+func valueKeyPosition(v ast.Value, steps []pathStep) (ast.Position, bool) {
+	switch n := v.(type) {
+	case *ast.ObjectLit:
+		return keyPosition(n.Body, steps)
+	case *ast.ArrayLit:
+		if i := steps[0].index; steps[0].isIndex && i < len(n.Elements) && len(steps) > 1 {
+			return valueKeyPosition(n.Elements[i], steps[1:])
+		}
+	}
+	return ast.Position{}, false
+}
+
+// decodeUnmarshaler hands src, written back as a literal, to u.
+func decodeUnmarshaler(u Unmarshaler, src interface{}, path string) error {
+	literal, err := newEncodeState().encodeValue(reflect.ValueOf(src), false)
+	if err != nil {
+		return fmt.Errorf("bulbason: cannot decode %q: %w", path, err)
+	}
+	if err := u.UnmarshalBulba([]byte(literal)); err != nil {
+		return fmt.Errorf("bulbason: cannot decode %q: %w", path, err)
+	}
+	return nil
+}
+
+// typeError builds an UnmarshalTypeError for assigning src to dst.
+func typeError(src interface{}, dst reflect.Value, path string) error {
+	return &UnmarshalTypeError{Path: path, Value: describeValue(src), Type: dst.Type()}
+}
+
+// describeValue names the kind of a parsed value for error messages.
+func describeValue(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64, uint64, *big.Int, float64, Number:
+		return "number"
+	case time.Time:
+		return "timestamp"
+	case time.Duration:
+		return "duration"
+	case []byte:
+		return "bytes"
+	case []interface{}, []map[string]interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "section"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// asArray returns the elements of a parsed array. Multi-line arrays of
+// sections are parsed as []map[string]interface{} and are accepted as well.
+func asArray(src interface{}) ([]interface{}, bool) {
+	switch arr := src.(type) {
+	case []interface{}:
+		return arr, true
+	case []map[string]interface{}:
+		elems := make([]interface{}, len(arr))
+		for i, m := range arr {
+			elems[i] = m
+		}
+		return elems, true
+	}
+	return nil, false
+}
+
+// joinPath appends key to a dotted path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// indexPath appends an array index to a path.
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,859 @@
+package bulbason
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	AppName      string   `bson:"app_name"`
+	Version      float64  `bson:"version"`
+	IsProduction bool     `bson:"is_production"`
+	Missing      *string  `bson:"missing_data"`
+	Whitelist    []string `bson:"whitelist"`
+	Database     struct {
+		Host string `bson:"host"`
+		Pool struct {
+			MaxConnections int `bson:"max_connections"`
+			Flags          struct {
+				PanicOnFail bool `bson:"panic_on_fail"`
+			} `bson:"KERNEL_FLAGS"`
+		} `bson:"pool"`
+	} `bson:"database"`
+	Ignored string `bson:"-"`
+}
+
+func TestUnmarshal_Struct(t *testing.T) {
+	input := `BULBA!
+app_name ~~~~~~> "Pokedex_API"
+version  ~~~~~~> 1.5
+is_production ~> NotVeryEffective
+missing_data ~> MissingNo
+unknown ~> "ignored"
+
+(o) database (o)
+    host ~~~~> "127.0.0.1"
+    (O) pool (O)
+        max_connections ~~~~> 100
+        (@) KERNEL_FLAGS (@)
+            panic_on_fail ~~~~> SuperEffective
+
+whitelist ~~~~> <| "Prof_Oak", "Mom" |>
+`
+
+	var cfg testConfig
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cfg.AppName != "Pokedex_API" || cfg.Version != 1.5 || cfg.IsProduction || cfg.Missing != nil {
+		t.Errorf("Unexpected top-level values: %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Whitelist, []string{"Prof_Oak", "Mom"}) {
+		t.Errorf("Unexpected whitelist: %v", cfg.Whitelist)
+	}
+	if cfg.Database.Host != "127.0.0.1" || cfg.Database.Pool.MaxConnections != 100 || !cfg.Database.Pool.Flags.PanicOnFail {
+		t.Errorf("Unexpected database section: %+v", cfg.Database)
+	}
+}
+
+func TestUnmarshal_Map(t *testing.T) {
+	input := `BULBA!
+(o) ports (o)
+    http ~> 80
+    https ~> 443
+`
+	var cfg map[string]map[string]int
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]map[string]int{"ports": {"http": 80, "https": 443}}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Expected %v, got %v", expected, cfg)
+	}
+}
+
+func TestUnmarshal_TypeError(t *testing.T) {
+	input := `BULBA!
+(o) database (o)
+    host ~~~~> 42
+`
+	var cfg testConfig
+	err := Unmarshal([]byte(input), &cfg)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("Expected an UnmarshalTypeError, got %v", err)
+	}
+	if typeErr.Path != "database.host" {
+		t.Errorf("Expected path %q, got %q", "database.host", typeErr.Path)
+	}
+	if !contains(err.Error(), ErrType) {
+		t.Errorf("Expected error containing %q, got %q", ErrType, err.Error())
+	}
+}
+
+func TestUnmarshal_NonPointer(t *testing.T) {
+	var cfg testConfig
+	if err := Unmarshal([]byte("BULBA!\n"), cfg); err == nil {
+		t.Error("Expected an error for a non-pointer target, got nil")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	cfg, err := Decode[testConfig]([]byte(benchInput))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.AppName != "Pokedex_API" || cfg.Database.Pool.MaxConnections != 100 {
+		t.Errorf("Unexpected values: %+v", cfg)
+	}
+
+	ports, err := Decode[*map[string]int]([]byte("BULBA!\nhttp ~> 80\n"))
+	if err != nil || ports == nil || (*ports)["http"] != 80 {
+		t.Errorf("Unexpected result %v, %v", ports, err)
+	}
+
+	_, err = Decode[testConfig]([]byte("BULBA!\nversion ~> \"1.5\"\n"))
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Expected an UnmarshalTypeError, got %v", err)
+	}
+}
+
+func TestMarshal_Struct(t *testing.T) {
+	var cfg testConfig
+	cfg.AppName = "Pokedex_API"
+	cfg.Whitelist = []string{"Mom"}
+	cfg.Database.Host = "127.0.0.1"
+	cfg.Database.Pool.MaxConnections = 100
+	cfg.Ignored = "secret"
+
+	out, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var decoded testConfig
+	if err := Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, out)
+	}
+	cfg.Ignored = ""
+	if !reflect.DeepEqual(cfg, decoded) {
+		t.Errorf("Expected:\n%+v\nGot:\n%+v\nDocument:\n%s", cfg, decoded, out)
+	}
+}
+
+func TestUnmarshal_ArrayOfObjects(t *testing.T) {
+	input := `BULBA!
+servers ~~~~> <|
+(o)
+    host ~~~~> "10.0.0.1"
+    port ~~~~> 8080
+(o)
+    host ~~~~> "10.0.0.2"
+    port ~~~~> 8081
+|>
+`
+	var cfg struct {
+		Servers []struct {
+			Host string `bson:"host"`
+			Port int    `bson:"port"`
+		} `bson:"servers"`
+	}
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Servers) != 2 || cfg.Servers[1].Host != "10.0.0.2" || cfg.Servers[1].Port != 8081 {
+		t.Errorf("Unexpected result: %+v", cfg)
+	}
+}
+
+func TestUnmarshal_Timestamps(t *testing.T) {
+	input := `BULBA!
+created ~~> 2024-05-01T12:30:00Z
+expires ~~> 2024-05-01T14:30:00.5+02:00
+history ~~> <| 2023-01-01T00:00:00Z, 2023-06-01T00:00:00Z |>
+`
+	var cfg struct {
+		Created time.Time   `bson:"created"`
+		Expires *time.Time  `bson:"expires"`
+		History []time.Time `bson:"history"`
+	}
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC); !cfg.Created.Equal(want) {
+		t.Errorf("Expected created %v, got %v", want, cfg.Created)
+	}
+	if want := time.Date(2024, 5, 1, 12, 30, 0, 5e8, time.UTC); cfg.Expires == nil || !cfg.Expires.Equal(want) {
+		t.Errorf("Expected expires %v, got %v", want, cfg.Expires)
+	}
+	if len(cfg.History) != 2 || cfg.History[1].Month() != time.June {
+		t.Errorf("Unexpected history %v", cfg.History)
+	}
+
+	var wrong struct {
+		Created time.Time `bson:"created"`
+	}
+	err := Unmarshal([]byte("BULBA!\ncreated ~~> \"2024-05-01\"\n"), &wrong)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Value != "string" {
+		t.Errorf("Expected an UnmarshalTypeError for a string, got %v", err)
+	}
+}
+
+func TestMarshal_Timestamps(t *testing.T) {
+	type event struct {
+		Name string    `bson:"name"`
+		At   time.Time `bson:"at"`
+	}
+	in := event{Name: "Evolve", At: time.Date(2024, 5, 1, 12, 30, 0, 250, time.FixedZone("", 3600))}
+
+	out, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nname ~~~~> \"Evolve\"\nat ~~~~> 2024-05-01T12:30:00.00000025+01:00\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	var decoded event
+	if err := Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded.Name != in.Name || !decoded.At.Equal(in.At) {
+		t.Errorf("Expected %+v, got %+v", in, decoded)
+	}
+}
+
+func TestUnmarshal_Durations(t *testing.T) {
+	input := `BULBA!
+timeout ~~> 30s
+retry ~~> 1h30m
+backoff ~~> <| 100ms, 2.5s |>
+`
+	var cfg struct {
+		Timeout time.Duration   `bson:"timeout"`
+		Retry   time.Duration   `bson:"retry"`
+		Backoff []time.Duration `bson:"backoff"`
+	}
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Timeout != 30*time.Second || cfg.Retry != 90*time.Minute {
+		t.Errorf("Unexpected durations %v and %v", cfg.Timeout, cfg.Retry)
+	}
+	if !reflect.DeepEqual(cfg.Backoff, []time.Duration{100 * time.Millisecond, 2500 * time.Millisecond}) {
+		t.Errorf("Unexpected backoff %v", cfg.Backoff)
+	}
+
+	// A plain number is not a duration, even though time.Duration is an int64.
+	err := Unmarshal([]byte("BULBA!\ntimeout ~~> 30\n"), &cfg)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Value != "number" {
+		t.Errorf("Expected an UnmarshalTypeError for a number, got %v", err)
+	}
+}
+
+func TestMarshal_Durations(t *testing.T) {
+	out, err := Marshal(map[string]interface{}{"timeout": 90 * time.Second, "never": time.Duration(0)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nnever ~~~~> 0s\ntimeout ~~~~> 1m30s\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if result["timeout"] != 90*time.Second || result["never"] != time.Duration(0) {
+		t.Errorf("Unexpected round trip %v", result)
+	}
+}
+
+func TestUnmarshal_Integers(t *testing.T) {
+	input := `BULBA!
+id ~~> 9007199254740993
+flags ~~> 18446744073709551615
+huge ~~> 340282366920938463463374607431768211456
+ratio ~~> 3
+`
+	var cfg struct {
+		ID    int64    `bson:"id"`
+		Flags uint64   `bson:"flags"`
+		Huge  *big.Int `bson:"huge"`
+		Ratio float32  `bson:"ratio"`
+	}
+	if err := NewDecoder(strings.NewReader(input), LargeIntegers(LargeIntegerBig)).Decode(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.ID != 9007199254740993 || cfg.Flags != math.MaxUint64 || cfg.Ratio != 3 {
+		t.Errorf("Unexpected values %+v", cfg)
+	}
+	if cfg.Huge == nil || cfg.Huge.String() != "340282366920938463463374607431768211456" {
+		t.Errorf("Unexpected big integer %v", cfg.Huge)
+	}
+
+	var small struct {
+		ID int8 `bson:"id"`
+	}
+	err := Unmarshal([]byte("BULBA!\nid ~~> 300\n"), &small)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Expected an UnmarshalTypeError for an overflowing int8, got %v", err)
+	}
+}
+
+func TestMarshal_BigInt(t *testing.T) {
+	huge, _ := new(big.Int).SetString("340282366920938463463374607431768211456", 10)
+	out, err := Marshal(map[string]interface{}{"huge": huge, "id": uint64(math.MaxUint64)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nhuge ~~~~> 340282366920938463463374607431768211456\nid ~~~~> 18446744073709551615\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestUseNumber(t *testing.T) {
+	input := `BULBA!
+id ~~> 123456789012345678901234567890
+price ~~> 19.99
+count ~~> 1_000
+`
+	result, err := Parse(input, UseNumber())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"id":    Number("123456789012345678901234567890"),
+		"price": Number("19.99"),
+		"count": Number("1000"),
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+	if n, err := result["count"].(Number).Int64(); err != nil || n != 1000 {
+		t.Errorf("Expected Int64 to return 1000, got %v, %v", n, err)
+	}
+	if _, err := result["id"].(Number).Int64(); err == nil {
+		t.Error("Expected Int64 to fail for a number beyond int64")
+	}
+
+	var cfg struct {
+		ID    Number   `bson:"id"`
+		Price float64  `bson:"price"`
+		Count *int     `bson:"count"`
+		Big   *big.Int `bson:"id"`
+	}
+	if err := NewDecoder(strings.NewReader(input), UseNumber()).Decode(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.ID != "123456789012345678901234567890" || cfg.Price != 19.99 || cfg.Count == nil || *cfg.Count != 1000 {
+		t.Errorf("Unexpected values %+v", cfg)
+	}
+	if cfg.Big == nil || cfg.Big.String() != string(cfg.ID) {
+		t.Errorf("Expected the big integer %s, got %v", cfg.ID, cfg.Big)
+	}
+
+	// Without UseNumber, numbers are converted when decoding into a Number.
+	var plain struct {
+		Price Number `bson:"price"`
+	}
+	if err := Unmarshal([]byte("BULBA!\nprice ~~> 19.99\n"), &plain); err != nil || plain.Price != "19.99" {
+		t.Errorf("Expected 19.99, got %q, %v", plain.Price, err)
+	}
+}
+
+func TestMarshal_Number(t *testing.T) {
+	out, err := Marshal(map[string]interface{}{"id": Number("123456789012345678901234567890")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != "BULBA!\nid ~~~~> 123456789012345678901234567890\n" {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+
+	for _, bad := range []Number{"", "12abc", "NaN", "1e999"} {
+		if _, err := Marshal(map[string]interface{}{"n": bad}); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	input := `BULBA!
+key ~~> 0b64"aGVsbG8="
+empty ~~> 0b64""
+`
+	var cfg struct {
+		Key   []byte `bson:"key"`
+		Empty []byte `bson:"empty"`
+	}
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(cfg.Key) != "hello" || cfg.Empty == nil || len(cfg.Empty) != 0 {
+		t.Errorf("Unexpected values %q and %q", cfg.Key, cfg.Empty)
+	}
+
+	out, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nkey ~~~~> 0b64\"aGVsbG8=\"\nempty ~~~~> 0b64\"\"\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	_, err = Parse("BULBA!\nkey ~~> 0b64\"not base64!\"\n")
+	if pe, ok := err.(*ParseError); !ok || pe.Code != CodeType || pe.Column != 9 {
+		t.Errorf("Expected a type error at column 9, got %v", err)
+	}
+
+	var wrong struct {
+		Key string `bson:"key"`
+	}
+	var typeErr *UnmarshalTypeError
+	if err := Unmarshal([]byte(input), &wrong); !errors.As(err, &typeErr) || typeErr.Value != "bytes" {
+		t.Errorf("Expected an UnmarshalTypeError for bytes, got %v", err)
+	}
+}
+
+// version decodes from and encodes to a string such as "1.2.3".
+type version struct {
+	Major, Minor, Patch int
+}
+
+func (v *version) UnmarshalBulba(data []byte) error {
+	var s string
+	if _, err := fmt.Sscanf(string(data), "%q", &s); err != nil {
+		return fmt.Errorf("version must be a string, got %s", data)
+	}
+	if _, err := fmt.Sscanf(s, "%d.%d.%d", &v.Major, &v.Minor, &v.Patch); err != nil {
+		return fmt.Errorf("invalid version %q", s)
+	}
+	return nil
+}
+
+func (v version) MarshalBulba() ([]byte, error) {
+	return []byte(fmt.Sprintf("\"%d.%d.%d\"", v.Major, v.Minor, v.Patch)), nil
+}
+
+// rawValue keeps the literal it was decoded from.
+type rawValue string
+
+func (r *rawValue) UnmarshalBulba(data []byte) error {
+	*r = rawValue(data)
+	return nil
+}
+
+func (r rawValue) MarshalBulba() ([]byte, error) {
+	return []byte(r), nil
+}
+
+func TestUnmarshal_Unmarshaler(t *testing.T) {
+	input := `BULBA!
+version ~> "1.2.3"
+previous ~> <| "1.0.0", "1.1.0" |>
+(o) raw (o)
+    point ~> { x ~> 1, y ~> <| "a", "b" |> }
+    when ~> 2024-05-01T12:30:00Z
+    missing ~> MissingNo
+`
+	var cfg struct {
+		Version  version             `bson:"version"`
+		Previous []*version          `bson:"previous"`
+		Raw      map[string]rawValue `bson:"raw"`
+	}
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Version != (version{1, 2, 3}) {
+		t.Errorf("Expected 1.2.3, got %v", cfg.Version)
+	}
+	if len(cfg.Previous) != 2 || *cfg.Previous[1] != (version{1, 1, 0}) {
+		t.Errorf("Unexpected previous versions %v", cfg.Previous)
+	}
+	expected := map[string]rawValue{
+		"point":   `{ x ~~~~> 1, y ~~~~> <| "a", "b" |> }`,
+		"when":    "2024-05-01T12:30:00Z",
+		"missing": "",
+	}
+	if !reflect.DeepEqual(cfg.Raw, expected) {
+		t.Errorf("Expected %v, got %v", expected, cfg.Raw)
+	}
+
+	err := Unmarshal([]byte("BULBA!\nversion ~> 5\n"), &cfg)
+	if err == nil || !strings.Contains(err.Error(), `cannot decode "version": version must be a string`) {
+		t.Errorf("Expected the error of UnmarshalBulba, got %v", err)
+	}
+}
+
+func TestMarshal_Marshaler(t *testing.T) {
+	cfg := struct {
+		Version  version   `bson:"version"`
+		Previous []version `bson:"previous"`
+		Raw      rawValue  `bson:"raw"`
+	}{
+		Version:  version{1, 2, 3},
+		Previous: []version{{1, 0, 0}, {1, 1, 0}},
+		Raw:      "{ x ~> 1 }",
+	}
+	out, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nversion ~~~~> \"1.2.3\"\nprevious ~~~~> <| \"1.0.0\", \"1.1.0\" |>\nraw ~~~~> { x ~> 1 }\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	for _, raw := range []rawValue{"", "1, 2", "\"a\"\nb ~> 1", "<| 1"} {
+		_, err := Marshal(map[string]interface{}{"list": []rawValue{raw}})
+		if err == nil || !strings.Contains(err.Error(), "MarshalBulba returned the invalid value") {
+			t.Errorf("Expected %q to be rejected, got %v", raw, err)
+		}
+	}
+}
+
+func TestTextMarshaler(t *testing.T) {
+	input := `BULBA!
+addr ~> "10.0.0.1"
+gateway ~> "10.0.0.254"
+allowed ~> <| "10.0.0.0/8", "192.168.0.0/16" |>
+`
+	var cfg struct {
+		Addr    netip.Addr     `bson:"addr"`
+		Gateway *netip.Addr    `bson:"gateway"`
+		Allowed []netip.Prefix `bson:"allowed"`
+	}
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Addr != netip.MustParseAddr("10.0.0.1") || cfg.Gateway == nil || *cfg.Gateway != netip.MustParseAddr("10.0.0.254") {
+		t.Errorf("Unexpected addresses %v and %v", cfg.Addr, cfg.Gateway)
+	}
+	if len(cfg.Allowed) != 2 || cfg.Allowed[1] != netip.MustParsePrefix("192.168.0.0/16") {
+		t.Errorf("Unexpected prefixes %v", cfg.Allowed)
+	}
+
+	out, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\naddr ~~~~> \"10.0.0.1\"\ngateway ~~~~> \"10.0.0.254\"\nallowed ~~~~> <| \"10.0.0.0/8\", \"192.168.0.0/16\" |>\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	// The types with a literal of their own keep it.
+	out, err = Marshal(map[string]interface{}{"at": time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), "n": big.NewInt(7)})
+	if err != nil || string(out) != "BULBA!\nat ~~~~> 2024-05-01T12:30:00Z\nn ~~~~> 7\n" {
+		t.Errorf("Unexpected output %q, %v", out, err)
+	}
+
+	var typeErr *UnmarshalTypeError
+	if err := Unmarshal([]byte("BULBA!\naddr ~> 10\n"), &cfg); !errors.As(err, &typeErr) || typeErr.Value != "number" {
+		t.Errorf("Expected an UnmarshalTypeError, got %v", err)
+	}
+	err = Unmarshal([]byte("BULBA!\naddr ~> \"10.0.0.300\"\n"), &cfg)
+	if err == nil || !strings.Contains(err.Error(), `cannot decode "addr"`) {
+		t.Errorf("Expected the error of UnmarshalText, got %v", err)
+	}
+}
+
+func TestRemainField(t *testing.T) {
+	type plugin struct {
+		Name    string                 `bson:"name"`
+		Options map[string]interface{} `bson:",remain"`
+	}
+	input := `BULBA!
+name ~> "cache"
+size ~> 128
+(o) backend (o)
+    kind ~> "redis"
+`
+	var p plugin
+	if err := Unmarshal([]byte(input), &p); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"size": int64(128), "backend": map[string]interface{}{"kind": "redis"}}
+	if p.Name != "cache" || !reflect.DeepEqual(p.Options, expected) {
+		t.Errorf("Unexpected result %+v", p)
+	}
+
+	out, err := Marshal(p)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "BULBA!\nname ~~~~> \"cache\"\nsize ~~~~> 128\n(o) backend (o)\n    kind ~~~~> \"redis\"\n"
+	if string(out) != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, out)
+	}
+
+	// A remain field accepts every key, even when unknown keys are refused.
+	dec := NewDecoder(strings.NewReader(input))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&plugin{}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// The values are decoded into the type of the map.
+	var typed struct {
+		Ports map[string]int `bson:",remain"`
+	}
+	if err := Unmarshal([]byte("BULBA!\nhttp ~> 80\nhttps ~> 443\n"), &typed); err != nil || typed.Ports["https"] != 443 {
+		t.Errorf("Unexpected result %v, %v", typed.Ports, err)
+	}
+	var typeErr *UnmarshalTypeError
+	if err := Unmarshal([]byte("BULBA!\nhttp ~> \"80\"\n"), &typed); !errors.As(err, &typeErr) || typeErr.Path != "http" {
+		t.Errorf("Expected an UnmarshalTypeError at http, got %v", err)
+	}
+}
+
+type embeddedBase struct {
+	Name  string `bson:"name"`
+	Level int    `bson:"level"`
+}
+
+type EmbeddedTLS struct {
+	Cert string `bson:"cert"`
+}
+
+type embeddedConfig struct {
+	embeddedBase
+	*EmbeddedTLS
+	Limits struct {
+		Rate int `bson:"rate"`
+	} `bson:",squash"`
+	Extra struct {
+		Label string `bson:"label"`
+	} `bson:"extra,inline"`
+	Level  string  `bson:"level"` // Shadows embeddedBase.Level
+	Parent *string `bson:"parent"`
+}
+
+func TestUnmarshal_Embedded(t *testing.T) {
+	input := `BULBA!
+name ~> "bulbasaur"
+level ~> "seed"
+cert ~> "bulb.pem"
+rate ~> 10
+label ~> "grass"
+parent ~> MissingNo
+`
+	cfg := embeddedConfig{Parent: new(string)}
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Name != "bulbasaur" || cfg.Level != "seed" || cfg.embeddedBase.Level != 0 {
+		t.Errorf("Unexpected promoted fields %+v", cfg)
+	}
+	if cfg.EmbeddedTLS == nil || cfg.Cert != "bulb.pem" {
+		t.Errorf("Expected the embedded pointer to be allocated, got %+v", cfg.EmbeddedTLS)
+	}
+	if cfg.Limits.Rate != 10 || cfg.Extra.Label != "grass" {
+		t.Errorf("Unexpected flattened fields %+v and %+v", cfg.Limits, cfg.Extra)
+	}
+	if cfg.Parent != nil {
+		t.Errorf("Expected MissingNo to reset the pointer, got %v", cfg.Parent)
+	}
+
+	// An embedded pointer is only allocated for keys it holds.
+	var partial embeddedConfig
+	if err := Unmarshal([]byte("BULBA!\nname ~> \"ivysaur\"\n"), &partial); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if partial.EmbeddedTLS != nil {
+		t.Errorf("Expected the embedded pointer to stay nil, got %+v", partial.EmbeddedTLS)
+	}
+
+	out, err := Marshal(partial)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nname ~~~~> \"ivysaur\"\nrate ~~~~> 0\nlabel ~~~~> \"\"\nlevel ~~~~> \"\"\nparent ~~~~> MissingNo\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestTypeFields_Conflicts(t *testing.T) {
+	type a struct {
+		X int
+		Y int `bson:"y"`
+	}
+	type b struct {
+		X int
+		Y int
+	}
+	type recursive struct {
+		*recursive
+		Z int
+	}
+	var names []string
+	for _, f := range typeFields(reflect.TypeOf(struct {
+		a
+		b
+		recursive
+	}{})) {
+		names = append(names, f.name)
+	}
+	// Both X are kept, as two fields of the same struct would be, while the
+	// tagged y wins over the plain Y.
+	if expected := []string{"X", "y", "X", "Y", "Z"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestTypeFields_Cached(t *testing.T) {
+	typ := reflect.TypeOf(testConfig{})
+	first, second := typeFields(typ), typeFields(typ)
+	if len(first) == 0 || &first[0] != &second[0] {
+		t.Error("Expected the fields of a type to be cached")
+	}
+}
+
+func TestUnmarshal_Defaults(t *testing.T) {
+	type pool struct {
+		Size    int           `bson:"size,default=10"`
+		Timeout time.Duration `bson:"timeout,default=30s"`
+	}
+	type config struct {
+		Host   string   `bson:"host,default=localhost"`
+		Port   int      `bson:"port,default=8080"`
+		Name   string   `bson:"name,default=\"a, b\""`
+		Ports  []int    `bson:"ports,default=<| 80, 443 |>"`
+		Debug  *bool    `bson:"debug,default=SuperEffective"`
+		Pool   pool     `bson:"pool"`
+		Backup *pool    `bson:"backup"`
+		Level  string   `bson:"level,omitempty,default=info"`
+		Unset  string   `bson:"unset,default=x"`
+		Extras []string `bson:"extras"`
+	}
+	var cfg config
+	if err := Unmarshal([]byte("BULBA!\nport ~> 9090\nunset ~> MissingNo\n"), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Host != "localhost" || cfg.Port != 9090 || cfg.Name != "a, b" || cfg.Level != "info" {
+		t.Errorf("Unexpected values %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Ports, []int{80, 443}) || cfg.Debug == nil || !*cfg.Debug {
+		t.Errorf("Unexpected values %v and %v", cfg.Ports, cfg.Debug)
+	}
+	// The defaults of a missing section apply, unless it is behind a pointer.
+	if cfg.Pool != (pool{Size: 10, Timeout: 30 * time.Second}) || cfg.Backup != nil {
+		t.Errorf("Unexpected pools %+v and %+v", cfg.Pool, cfg.Backup)
+	}
+	// MissingNo is not missing.
+	if cfg.Unset != "" {
+		t.Errorf("Expected MissingNo to leave the zero value, got %q", cfg.Unset)
+	}
+
+	var typeErr *UnmarshalTypeError
+	var bad struct {
+		Port int `bson:"port,default=high"`
+	}
+	if err := Unmarshal([]byte("BULBA!\n"), &bad); !errors.As(err, &typeErr) || typeErr.Path != "port" {
+		t.Errorf("Expected an UnmarshalTypeError for the default, got %v", err)
+	}
+}
+
+func TestUnmarshal_Required(t *testing.T) {
+	type config struct {
+		Name     string `bson:"name,required"`
+		Database struct {
+			Host string `bson:"host,required"`
+		} `bson:"database"`
+		Cache *struct {
+			Host string `bson:"host,required"`
+		} `bson:"cache"`
+	}
+	tests := []struct{ input, path string }{
+		{"BULBA!\n(o) database (o)\n    host ~> \"db\"\n", "name"},
+		{"BULBA!\nname ~> MissingNo\n(o) database (o)\n    host ~> \"db\"\n", "name"},
+		{"BULBA!\nname ~> \"app\"\n(o) database (o)\n    port ~> 1\n", "database.host"},
+		{"BULBA!\nname ~> \"app\"\n", "database.host"},
+		{"BULBA!\nname ~> \"app\"\n(o) database (o)\n    host ~> \"db\"\n(o) cache (o)\n    port ~> 1\n", "cache.host"},
+	}
+	for _, tt := range tests {
+		var cfg config
+		err := Unmarshal([]byte(tt.input), &cfg)
+		var rfe *RequiredFieldError
+		if !errors.As(err, &rfe) || rfe.Path != tt.path {
+			t.Errorf("Expected %s to be required, got %v", tt.path, err)
+		}
+	}
+
+	var cfg config
+	if err := Unmarshal([]byte("BULBA!\nname ~> \"app\"\n(o) database (o)\n    host ~> \"db\"\n"), &cfg); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// benchInput is a document of a typical size, decoded into testConfig by
+// the codec benchmarks.
+const benchInput = `BULBA!
+app_name ~> "Pokedex_API"
+version ~> 1.5
+is_production ~> NotVeryEffective
+whitelist ~> <| "Prof_Oak", "Mom", "Nurse_Joy" |>
+(o) database (o)
+    host ~> "127.0.0.1"
+    (O) pool (O)
+        max_connections ~> 100
+        (@) KERNEL_FLAGS (@)
+            panic_on_fail ~> SuperEffective
+`
+
+func BenchmarkUnmarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var cfg testConfig
+		if err := Unmarshal([]byte(benchInput), &cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeDocument(b *testing.B) {
+	doc, err := Parse(benchInput)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var cfg testConfig
+		if err := new(decodeState).decodeDocument(doc, &cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	var cfg testConfig
+	if err := Unmarshal([]byte(benchInput), &cfg); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
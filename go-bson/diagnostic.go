@@ -0,0 +1,151 @@
+package bulbason
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// Severity tells how much a Diagnostic matters.
+type Severity int
+
+const (
+	// SeverityWarning marks a likely mistake, such as a value hidden by
+	// another one with the same key.
+	SeverityWarning Severity = iota
+	// SeverityInfo marks a matter of style.
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// DiagnosticCode identifies the kind of a Diagnostic, as ErrorCode does for
+// a ParseError.
+type DiagnosticCode string
+
+const (
+	CodeTrailingSpace DiagnosticCode = "trailing_space"
+	CodeLongVine      DiagnosticCode = "long_vine"
+	CodeShadowedKey   DiagnosticCode = "shadowed_key"
+)
+
+// Diagnostic is a problem in a document that does not make it invalid, for
+// linters and editors to point out.
+type Diagnostic struct {
+	Severity Severity
+	Code     DiagnosticCode
+	Message  string
+	Line     int // 1-based line number
+	Column   int // 1-based column number
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// maxVineTildes is the length of the longest Vine Whip not reported with
+// CodeLongVine. The spec's own long-range whip has 9 tildes.
+const maxVineTildes = 12
+
+// Diagnostics makes the parser call report with every Diagnostic found in
+// the documents it reads, whether or not they are valid:
+//
+//   - CodeTrailingSpace, for spaces at the end of a line outside a heredoc
+//   - CodeLongVine, for a Vine Whip of more than 12 tildes
+//   - CodeShadowedKey, for a key repeating one before it in the same section,
+//     whose value DuplicateLastWins or DuplicateFirstWins drops
+//
+// Diagnostics of the lexer are reported line by line as the document is
+// read, and shadowed keys once its syntax tree is built, so they are not
+// reported in order of position. Walk does not report shadowed keys, as it
+// keeps no tree.
+func Diagnostics(report func(Diagnostic)) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.diagnostics = report
+	}
+}
+
+// diagnoseLine reports the diagnostics of a line of source, given the tokens
+// it was lexed into.
+func diagnoseLine(line string, lineNum int, tokens []Token, cfg *parseConfig) {
+	if trimmed := strings.TrimRight(line, " "); len(trimmed) < len(line) {
+		cfg.diagnostics(Diagnostic{
+			Severity: SeverityWarning,
+			Code:     CodeTrailingSpace,
+			Message:  "trailing whitespace",
+			Line:     lineNum,
+			Column:   len(trimmed) + 1,
+		})
+	}
+	for _, tok := range tokens {
+		if tok.Type == TOKEN_VINE_WHIP && vineTildes(tok) > maxVineTildes {
+			cfg.diagnostics(Diagnostic{
+				Severity: SeverityInfo,
+				Code:     CodeLongVine,
+				Message:  fmt.Sprintf("Vine Whip of %d tildes, more than %d", vineTildes(tok), maxVineTildes),
+				Line:     tok.Line,
+				Column:   tok.Column,
+			})
+		}
+	}
+}
+
+// diagnoseShadowedKeys reports the keys of body, and of the sections and
+// objects below it, that repeat a key before them in the same body.
+func diagnoseShadowedKeys(body []ast.Entry, cfg *parseConfig) {
+	seen := make(map[[2]string]*ast.Ident)
+	for _, entry := range body {
+		var key *ast.Ident
+		switch e := entry.(type) {
+		case *ast.Section:
+			key = e.Name
+			diagnoseShadowedKeys(e.Body, cfg)
+		case *ast.KeyValue:
+			key = e.Key
+			diagnoseValueShadowedKeys(e.Value, cfg)
+		case *ast.Include:
+			continue
+		}
+
+		id := entryID(entry)
+		first, repeated := seen[id]
+		if !repeated {
+			seen[id] = key
+			continue
+		}
+		msg := fmt.Sprintf("%q hides the value set on line %d", key.Name, first.Loc.Start.Line)
+		if cfg.duplicateKeys == DuplicateFirstWins {
+			msg = fmt.Sprintf("%q is ignored, as it is set on line %d", key.Name, first.Loc.Start.Line)
+		}
+		cfg.diagnostics(Diagnostic{
+			Severity: SeverityWarning,
+			Code:     CodeShadowedKey,
+			Message:  msg,
+			Line:     key.Loc.Start.Line,
+			Column:   key.Loc.Start.Column,
+		})
+	}
+}
+
+// diagnoseValueShadowedKeys runs diagnoseShadowedKeys over the objects held
+// by a value, directly or as array elements.
+func diagnoseValueShadowedKeys(v ast.Value, cfg *parseConfig) {
+	switch n := v.(type) {
+	case *ast.ObjectLit:
+		diagnoseShadowedKeys(n.Body, cfg)
+	case *ast.ArrayLit:
+		for _, elem := range n.Elements {
+			diagnoseValueShadowedKeys(elem, cfg)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package bulbason
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_Diagnostics(t *testing.T) {
+	input := "BULBA!\n" +
+		"name ~> \"api\"  \n" +
+		"port ~~~~~~~~~~~~~> 8080\n" +
+		"text ~> \"\"\"\n" +
+		"    kept as is  \n" +
+		"\"\"\"\n" +
+		"    \n" +
+		"name ~> \"web\"\n" +
+		"(o) database (o)\n" +
+		"    host ~> \"db\"\n" +
+		"    opts ~> { a ~> 1, a ~> 2 }\n" +
+		"(o) database (o)\n"
+	var got []Diagnostic
+	doc, err := Parse(input, Diagnostics(func(d Diagnostic) { got = append(got, d) }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if doc["name"] != "web" {
+		t.Errorf("Expected the last value to win, got %v", doc["name"])
+	}
+	expected := []Diagnostic{
+		{SeverityWarning, CodeTrailingSpace, "trailing whitespace", 2, 14},
+		{SeverityInfo, CodeLongVine, "Vine Whip of 13 tildes, more than 12", 3, 6},
+		{SeverityWarning, CodeTrailingSpace, "trailing whitespace", 7, 1},
+		{SeverityWarning, CodeShadowedKey, `"name" hides the value set on line 2`, 8, 1},
+		{SeverityWarning, CodeShadowedKey, `"a" hides the value set on line 11`, 11, 23},
+		{SeverityWarning, CodeShadowedKey, `"database" hides the value set on line 9`, 12, 5},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, got)
+	}
+
+	got = nil
+	Parse("BULBA!\nk ~> 1\nk ~> 2\n", DuplicateKeys(DuplicateFirstWins), Diagnostics(func(d Diagnostic) { got = append(got, d) }))
+	if len(got) != 1 || got[0].String() != `3:1: warning: "k" is ignored, as it is set on line 2` {
+		t.Errorf("Unexpected diagnostics %v", got)
+	}
+
+	// Duplicates are errors, not diagnostics, when they are rejected.
+	got = nil
+	Parse("BULBA!\nk ~> 1\nk ~> 2\n", DuplicateKeys(DuplicateError), Diagnostics(func(d Diagnostic) { got = append(got, d) }))
+	if len(got) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", got)
+	}
+}
+
+func TestParse_DiagnosticsOfInvalidDocuments(t *testing.T) {
+	var got []Diagnostic
+	_, err := Parse("BULBA!\nok ~> 1 \n  bad ~> 2 \n", CollectErrors(), Diagnostics(func(d Diagnostic) { got = append(got, d) }))
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if len(got) != 2 || got[0].Line != 2 || got[1].Line != 3 {
+		t.Errorf("Expected diagnostics on lines 2 and 3, got %v", got)
+	}
+}
+
+func TestDecoder_Diagnostics(t *testing.T) {
+	var lines []int
+	d := NewDecoder(strings.NewReader("BULBA!\na ~> 1 \nBULBA!\nb ~> 2\nb ~> 3\n"), Diagnostics(func(d Diagnostic) { lines = append(lines, d.Line) }))
+	for {
+		var doc map[string]interface{}
+		if err := d.Decode(&doc); err != nil {
+			break
+		}
+	}
+	if !reflect.DeepEqual(lines, []int{2, 5}) {
+		t.Errorf("Expected diagnostics on lines 2 and 5, got %v", lines)
+	}
+}
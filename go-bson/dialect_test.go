@@ -0,0 +1,132 @@
+package bulbason
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// Color is a value type of its own, read from literals such as #22aa44.
+type Color struct{ R, G, B uint8 }
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func matchColor(text string) (interface{}, bool) {
+	if !colorPattern.MatchString(text) {
+		return nil, false
+	}
+	n, _ := strconv.ParseUint(text[1:], 16, 32)
+	return Color{uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+}
+
+var testDialect = Dialect{
+	True:     []string{"Shiny"},
+	False:    []string{"NotShiny"},
+	Null:     []string{"Fainted"},
+	Matchers: []LiteralMatcher{matchColor},
+}
+
+func TestParse_Dialect(t *testing.T) {
+	input := `BULBA!
+sparkles ~> Shiny
+dull ~> NotShiny
+gone ~> Fainted
+color ~> #22aa44
+flags ~> <| Shiny, SuperEffective, #000000 |>
+standard ~> MissingNo
+`
+	got, err := Parse(input, UseDialect(testDialect))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"sparkles": true,
+		"dull":     false,
+		"gone":     nil,
+		"color":    Color{0x22, 0xaa, 0x44},
+		"flags":    []interface{}{true, true, Color{}},
+		"standard": nil,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// Without the dialect, the same document is invalid.
+	var pe *ParseError
+	if _, err := Parse(input); !errors.As(err, &pe) || pe.Code != CodeType || pe.Line != 2 {
+		t.Errorf("Expected a type error on line 2, got %v", err)
+	}
+}
+
+func TestParse_DialectKeepsStandardLiterals(t *testing.T) {
+	// A matcher accepting anything must not change what a standard document
+	// means.
+	d := Dialect{Matchers: []LiteralMatcher{func(text string) (interface{}, bool) { return "matched " + text, true }}}
+	input := "BULBA!\nn ~> 42\nok ~> SuperEffective\ns ~> \"text\"\nref ~> Copycat n\nodd ~> pikachu\n"
+	got, err := Parse(input, UseDialect(d))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"n": int64(42), "ok": true, "s": "text", "ref": int64(42), "odd": "matched pikachu"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestUnmarshal_Dialect(t *testing.T) {
+	var cfg struct {
+		Sparkles bool        `bson:"sparkles"`
+		Gone     *string     `bson:"gone"`
+		Color    Color       `bson:"color"`
+		Any      interface{} `bson:"any"`
+	}
+	input := "BULBA!\nsparkles ~> Shiny\ngone ~> Fainted\ncolor ~> #ff0001\nany ~> #010203\n"
+	if err := NewDecoder(strings.NewReader(input), UseDialect(testDialect)).Decode(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cfg.Sparkles || cfg.Gone != nil || cfg.Color != (Color{0xff, 0x00, 0x01}) || cfg.Any != (Color{1, 2, 3}) {
+		t.Errorf("Unexpected result %+v", cfg)
+	}
+
+	var wrong struct {
+		Color string `bson:"color"`
+	}
+	if err := NewDecoder(strings.NewReader(input), UseDialect(testDialect)).Decode(&wrong); err == nil {
+		t.Error("Expected an error decoding a color into a string")
+	}
+}
+
+func TestParseAST_Dialect(t *testing.T) {
+	input := "BULBA!\nsparkles ~> Shiny\ncolor ~> #22aa44\n"
+	doc, err := ParseAST(input, UseDialect(testDialect))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	span := func(l1, c1, l2, c2 int) ast.Span {
+		return ast.Span{Start: ast.Position{Line: l1, Column: c1}, End: ast.Position{Line: l2, Column: c2}}
+	}
+	b, ok := doc.Body[0].(*ast.KeyValue).Value.(*ast.BoolLit)
+	if !ok || !b.Value || b.Span() != span(2, 13, 2, 17) {
+		t.Errorf("Unexpected value %#v", doc.Body[0].(*ast.KeyValue).Value)
+	}
+	lit, ok := doc.Body[1].(*ast.KeyValue).Value.(*ast.DialectLit)
+	if !ok || lit.Literal != "#22aa44" || lit.Span() != span(3, 10, 3, 16) {
+		t.Errorf("Unexpected value %#v", doc.Body[1].(*ast.KeyValue).Value)
+	}
+
+	// Literals of the dialect are written back as they are; the added
+	// spellings of standard literals become the standard ones.
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "BULBA!\nsparkles ~~~~> SuperEffective\ncolor ~~~~> #22aa44\n"; buf.String() != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,199 @@
+package bulbason
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ChangeKind says how a value differs between two documents.
+type ChangeKind int
+
+const (
+	// ChangeAdded is a key or array element only present in the new document.
+	ChangeAdded ChangeKind = iota
+	// ChangeRemoved is a key or array element only present in the old
+	// document.
+	ChangeRemoved
+	// ChangeModified is a value present in both documents that differs.
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// Change is a single difference found by Diff.
+type Change struct {
+	Path string      // Path of the value, e.g. "database.pool" or "servers[2].host"
+	Kind ChangeKind  // Whether the value was added, removed or modified
+	Old  interface{} // Value in the old document, nil when added
+	New  interface{} // Value in the new document, nil when removed
+}
+
+// Diff compares two documents as returned by Parse and lists the values that
+// differ between them, by path rather than line. Sections are compared key by
+// key, in sorted order, and arrays element by element, so a change deep in a
+// section is reported at its own path. A section or array added or removed as
+// a whole is reported once, with its whole value. Values of different types
+// differ even if they are numerically equal, such as 1 and 1.0. Two equal
+// documents give no changes.
+func Diff(old, new map[string]interface{}) []Change {
+	return diffValues(nil, "", old, new)
+}
+
+// diffValues appends the differences between the values at path to changes.
+func diffValues(changes []Change, path string, old, new interface{}) []Change {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		for k := range oldMap {
+			keys = append(keys, k)
+		}
+		for k := range newMap {
+			if _, ok := oldMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			o, inOld := oldMap[k]
+			n, inNew := newMap[k]
+			switch {
+			case !inOld:
+				changes = append(changes, Change{Path: joinPath(path, k), Kind: ChangeAdded, New: n})
+			case !inNew:
+				changes = append(changes, Change{Path: joinPath(path, k), Kind: ChangeRemoved, Old: o})
+			default:
+				changes = diffValues(changes, joinPath(path, k), o, n)
+			}
+		}
+		return changes
+	}
+
+	oldArr, oldIsArr := asArray(old)
+	newArr, newIsArr := asArray(new)
+	if oldIsArr && newIsArr {
+		for i := 0; i < len(oldArr) || i < len(newArr); i++ {
+			switch {
+			case i >= len(oldArr):
+				changes = append(changes, Change{Path: indexPath(path, i), Kind: ChangeAdded, New: newArr[i]})
+			case i >= len(newArr):
+				changes = append(changes, Change{Path: indexPath(path, i), Kind: ChangeRemoved, Old: oldArr[i]})
+			default:
+				changes = diffValues(changes, indexPath(path, i), oldArr[i], newArr[i])
+			}
+		}
+		return changes
+	}
+
+	// NaN is unequal to itself, but a document should not differ from itself.
+	if o, ok := old.(float64); ok && math.IsNaN(o) {
+		if n, ok := new.(float64); ok && math.IsNaN(n) {
+			return changes
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		changes = append(changes, Change{Path: path, Kind: ChangeModified, Old: old, New: new})
+	}
+	return changes
+}
+
+// EqualOptions configures Equal. The zero value compares documents as the
+// Equal function does.
+type EqualOptions struct {
+	// MissingAsAbsent makes a key set to MissingNo equal to a key that is not
+	// there at all, at any level.
+	MissingAsAbsent bool
+}
+
+// Equal reports whether two parsed documents hold the same values, which
+// makes it fit for detecting drift between a deployed configuration and the
+// one expected. Key order, Vine Whip lengths, comments and references are
+// gone once a document is parsed, so they make no difference. Numbers kept as
+// written by the UseNumber option equal the int64, float64 or *big.Int they
+// stand for, timestamps are equal when they name the same instant, and NaN
+// equals itself. As with Diff, values of different types differ even if they
+// are numerically equal, such as 1 and 1.0.
+func Equal(a, b Document) bool {
+	return EqualOptions{}.Equal(a, b)
+}
+
+// Equal reports whether a and b hold the same values, as the Equal function
+// does, following o.
+func (o EqualOptions) Equal(a, b Document) bool {
+	return o.equalValues(canonicalValue(a), canonicalValue(b))
+}
+
+// equalValues compares two values with their Numbers already replaced.
+func (o EqualOptions) equalValues(a, b interface{}) bool {
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	if aIsMap || bIsMap {
+		return aIsMap && bIsMap && o.equalSections(aMap, bMap)
+	}
+
+	aArr, aIsArr := asArray(a)
+	bArr, bIsArr := asArray(b)
+	if aIsArr || bIsArr {
+		if !aIsArr || !bIsArr || len(aArr) != len(bArr) {
+			return false
+		}
+		for i := range aArr {
+			if !o.equalValues(aArr[i], bArr[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok && math.IsNaN(x) && math.IsNaN(y) {
+			return true
+		}
+	case *big.Int:
+		y, ok := b.(*big.Int)
+		return ok && x.Cmp(y) == 0
+	case time.Time:
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// equalSections compares two sections key by key.
+func (o EqualOptions) equalSections(a, b map[string]interface{}) bool {
+	if !o.MissingAsAbsent && len(a) != len(b) {
+		return false
+	}
+	for k, av := range a {
+		bv, ok := b[k]
+		if !ok {
+			if !o.MissingAsAbsent || av != nil {
+				return false
+			}
+			continue
+		}
+		if !o.equalValues(av, bv) {
+			return false
+		}
+	}
+	for k, bv := range b {
+		if _, ok := a[k]; !ok && (!o.MissingAsAbsent || bv != nil) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+package bulbason
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Parse(`BULBA!
+name ~> "Bulby"
+level ~> 5
+ratio ~> Unown
+tags ~> <| "grass", "poison", "seed" |>
+(o) database (o)
+    host ~> "localhost"
+    (O) pool (O)
+        size ~> 10
+(o) legacy (o)
+    enabled ~> SuperEffective
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	new, err := Parse(`BULBA!
+name ~> "Ivy"
+level ~> 5.0
+ratio ~> Unown
+tags ~> <| "grass", "poison" |>
+(o) database (o)
+    host ~> "localhost"
+    (O) pool (O)
+        size ~> 20
+        idle ~> 30s
+owner ~> MissingNo
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Change{
+		{Path: "database.pool.idle", Kind: ChangeAdded, New: 30 * time.Second},
+		{Path: "database.pool.size", Kind: ChangeModified, Old: int64(10), New: int64(20)},
+		{Path: "legacy", Kind: ChangeRemoved, Old: map[string]interface{}{"enabled": true}},
+		{Path: "level", Kind: ChangeModified, Old: int64(5), New: 5.0},
+		{Path: "name", Kind: ChangeModified, Old: "Bulby", New: "Ivy"},
+		{Path: "owner", Kind: ChangeAdded, New: nil},
+		{Path: "tags[2]", Kind: ChangeRemoved, Old: "seed"},
+	}
+	changes := Diff(old, new)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected:\n%#v\nGot:\n%#v", expected, changes)
+	}
+
+	if changes := Diff(old, old); len(changes) != 0 {
+		t.Errorf("Expected no changes between a document and itself, got %v", changes)
+	}
+}
+
+func TestChangeKind_String(t *testing.T) {
+	for kind, expected := range map[ChangeKind]string{
+		ChangeAdded:    "added",
+		ChangeRemoved:  "removed",
+		ChangeModified: "modified",
+	} {
+		if kind.String() != expected {
+			t.Errorf("Expected %s, got %s", expected, kind)
+		}
+	}
+}
+
+func TestDiff_ArrayOfSections(t *testing.T) {
+	old, err := Parse(`BULBA!
+servers ~> <|
+(o)
+    host ~> "10.0.0.1"
+(o)
+    host ~> "10.0.0.2"
+|>
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	new, err := Parse(`BULBA!
+servers ~> <|
+(o)
+    host ~> "10.0.0.1"
+(o)
+    host ~> "10.0.0.3"
+|>
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Change{
+		{Path: "servers[1].host", Kind: ChangeModified, Old: "10.0.0.2", New: "10.0.0.3"},
+	}
+	if changes := Diff(old, new); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected:\n%#v\nGot:\n%#v", expected, changes)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	parse := func(src string, opts ...ParseOption) Document {
+		t.Helper()
+		m, err := Parse(src, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return Document(m)
+	}
+	a := parse(`BULBA!
+zZz The deployed configuration.
+port ~> 8080
+ratio ~> Unown
+since ~> 2024-05-01T12:00:00Z
+(o) database (o)
+    host ~> "db"
+servers ~> <|
+(o)
+    host ~> "a"
+|>
+replica ~> Copycat database.host
+`)
+	b := parse(`BULBA!
+replica ~~~~> "db"
+servers ~> <| { host ~> "a" } |>
+database ~> { host ~> "db" }
+since ~> 2024-05-01T14:00:00+02:00
+ratio ~> Unown
+port ~~> 8_080
+`, UseNumber())
+	if !Equal(a, b) || !Equal(b, a) {
+		t.Error("Expected the documents to be equal")
+	}
+
+	b["port"] = 8080.0
+	if Equal(a, b) {
+		t.Error("Expected 8080 and 8080.0 to differ")
+	}
+	b["port"] = int64(8080)
+	b["extra"] = nil
+	if Equal(a, b) {
+		t.Error("Expected a key set to MissingNo to differ from an absent one")
+	}
+	if !(EqualOptions{MissingAsAbsent: true}).Equal(a, b) {
+		t.Error("Expected MissingAsAbsent to ignore a key set to MissingNo")
+	}
+	b.Set("database.user", nil)
+	if !(EqualOptions{MissingAsAbsent: true}).Equal(b, a) {
+		t.Error("Expected MissingAsAbsent to ignore a nested key set to MissingNo")
+	}
+	b.Set("database.host", "other")
+	if (EqualOptions{MissingAsAbsent: true}).Equal(a, b) {
+		t.Error("Expected a changed value to differ")
+	}
+}
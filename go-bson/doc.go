@@ -0,0 +1,49 @@
+// Package bulbason implements a lexer and parser for BulbaSaur Object Notation
+// (BSON), the indentation-based configuration format described in
+// BSON_Format.md at the root of the repository.
+//
+// The typical entry point is Parse, which turns a document into a
+// map[string]interface{}. Converted to a Document, the result can be read by
+// path, such as database.pool.max_connections, or queried with expressions
+// such as servers[?port > 8000].host (see CompileQuery). ParseAST returns the
+// syntax tree instead (see the ast subpackage), with the position of every
+// node, for tools to walk and rewrite before writing it back with
+// Encoder.EncodeAST, and Lex exposes the raw token stream for tools that want
+// to work at that level. ParseFragment parses the body of a document without
+// its BULBA! header, such as a snippet kept in a database, and ParseValue a
+// single literal.
+//
+// ParseFile and ParseFS load documents from an fs.FS, such as configuration
+// embedded with go:embed, resolving the Transform directives that include
+// other files (see Includes). The Profile option picks the sections tagged
+// for one environment, and UseDialect adds literals of an organization's
+// own; Versions picks the options by the version in a BULBA!v2 header.
+// Diagnostics reports problems that leave a document valid, such as trailing
+// whitespace, for linters and editors. A Watcher keeps a configuration file
+// loaded, reloading it whenever it changes, and a Store shares a document
+// between goroutines, following a Watcher if asked. A Config layers defaults, files,
+// environment variables and overrides into a single Document. DecodeRequest
+// and WriteResponse read and write BSON bodies in HTTP handlers.
+//
+// Format rewrites a document in the canonical layout, keeping its comments,
+// and Diff lists the values that differ between two parsed documents, while
+// Equal only tells whether they hold the same values. Merge
+// layers one parsed document over another, such as environment overrides over
+// defaults. SchemaOf describes the documents a struct decodes, in the schema
+// format the bulbagen command reads, and ValidateSchema checks documents
+// against such a schema. The bulbacodec command generates the
+// ObjectMarshaler and ValueUnmarshaler methods of structs, which Marshal and
+// Unmarshal use in place of reflection.
+//
+// ToJSON and FromJSON convert syntax trees to and from JSON, ToYAML and
+// FromYAML to and from YAML, and ToTOML and FromTOML to and from TOML, for
+// migrating existing configuration and for tools that only speak those
+// formats. ToDotenv and FromDotenv flatten documents to .env files and read
+// them back, and Flatten and Unflatten do the same with the single-level maps
+// of key-value stores such as Consul. A RecordWriter and a RecordReader write and read NDBulba, the
+// line-delimited form holding one inline object per line, for logs and other
+// append-only data. Document.MarshalBinary gives a compact binary encoding of
+// parsed documents, for caching them and sending them between services.
+// Canonicalize writes a document in its one canonical form, and Hash digests
+// that form, so that changes to a configuration can be detected and signed.
+package bulbason
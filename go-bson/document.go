@@ -0,0 +1,391 @@
+package bulbason
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document is a parsed document, as returned by Parse, with methods reading
+// values by path instead of asserting the type of every map along the way:
+//
+//	m, err := bulbason.Parse(src)
+//	if err != nil {
+//		return err
+//	}
+//	doc := bulbason.Document(m)
+//	host, err := doc.GetString("database.host")
+//	max := doc.GetIntOr("database.pool.max_connections", 10)
+//
+// Set and Delete change a document by path, MapValues changes every value at
+// once, and Marshal writes it back, for programs migrating configuration from
+// one layout to the next. Clone gives a copy to change while the original is
+// still in use.
+//
+// A path is a dotted list of keys, each of which may be followed by array
+// indexes, such as servers[2].host.
+type Document map[string]interface{}
+
+// PathError is returned by the Document methods when a path is malformed or
+// does not lead to a value.
+type PathError struct {
+	Path   string // The path looked up, e.g. "database.pool.max_connections"
+	Reason string // What went wrong, e.g. "database.pool not found"
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("bulbason: path %q: %s", e.Path, e.Reason)
+}
+
+// Get returns the value at path, as Parse stores it. It returns a
+// *PathError if the path is malformed or leads to no value. A key set to
+// MissingNo holds the value nil.
+func (d Document) Get(path string) (interface{}, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return lookupPath(map[string]interface{}(d), steps, path, nil)
+}
+
+// lookupPath returns the value at steps below v, the root of a document.
+// deref, if set, replaces each value along the way before it is looked into.
+func lookupPath(v interface{}, steps []pathStep, path string, deref func(interface{}) (interface{}, error)) (interface{}, error) {
+	done := ""
+	for _, step := range steps {
+		if deref != nil {
+			var err error
+			if v, err = deref(v); err != nil {
+				return nil, err
+			}
+		}
+		if !step.isIndex {
+			section, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, &PathError{Path: path, Reason: fmt.Sprintf("%s is a %s, not a section", done, describeValue(v))}
+			}
+			done = joinPath(done, step.key)
+			if v, ok = section[step.key]; !ok {
+				return nil, &PathError{Path: path, Reason: done + " not found"}
+			}
+			continue
+		}
+
+		arr, ok := asArray(v)
+		if !ok {
+			return nil, &PathError{Path: path, Reason: fmt.Sprintf("%s is a %s, not an array", done, describeValue(v))}
+		}
+		if step.index >= len(arr) {
+			return nil, &PathError{Path: path, Reason: fmt.Sprintf("%s not found, the array has %d elements", indexPath(done, step.index), len(arr))}
+		}
+		v = arr[step.index]
+		done = indexPath(done, step.index)
+	}
+	return v, nil
+}
+
+// GetString returns the string at path. It returns a *PathError if there is
+// no value at path, and an *UnmarshalTypeError if the value is not a string.
+func (d Document) GetString(path string) (string, error) {
+	v, err := d.Get(path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", &UnmarshalTypeError{Path: path, Value: describeValue(v), Type: reflect.TypeOf("")}
+	}
+	return s, nil
+}
+
+// GetInt returns the integer at path. It returns a *PathError if there is
+// no value at path, and an *UnmarshalTypeError if the value is not an
+// integer or does not fit in an int64.
+func (d Document) GetInt(path string) (int64, error) {
+	v, err := d.Get(path)
+	if err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case uint64:
+		if n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+	case *big.Int:
+		if n.IsInt64() {
+			return n.Int64(), nil
+		}
+	case Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+	}
+	return 0, &UnmarshalTypeError{Path: path, Value: describeValue(v), Type: reflect.TypeOf(int64(0))}
+}
+
+// GetBool returns the boolean at path. It returns a *PathError if there is
+// no value at path, and an *UnmarshalTypeError if the value is not a
+// boolean.
+func (d Document) GetBool(path string) (bool, error) {
+	v, err := d.Get(path)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, &UnmarshalTypeError{Path: path, Value: describeValue(v), Type: reflect.TypeOf(false)}
+	}
+	return b, nil
+}
+
+// GetStringOr returns the string at path, or def if there is none.
+func (d Document) GetStringOr(path, def string) string {
+	if s, err := d.GetString(path); err == nil {
+		return s
+	}
+	return def
+}
+
+// GetIntOr returns the integer at path, or def if there is none.
+func (d Document) GetIntOr(path string, def int64) int64 {
+	if n, err := d.GetInt(path); err == nil {
+		return n
+	}
+	return def
+}
+
+// GetBoolOr returns the boolean at path, or def if there is none.
+func (d Document) GetBoolOr(path string, def bool) bool {
+	if b, err := d.GetBool(path); err == nil {
+		return b
+	}
+	return def
+}
+
+// splitPathSegment splits a path segment such as servers[2] into its key and
+// array indexes.
+func splitPathSegment(segment string) (string, []int, error) {
+	key, rest, _ := strings.Cut(segment, "[")
+	if key == "" {
+		return "", nil, fmt.Errorf("empty key in %q", segment)
+	}
+	var indexes []int
+	for rest != "" {
+		num, after, ok := strings.Cut(rest, "]")
+		i, err := strconv.Atoi(num)
+		if !ok || err != nil || i < 0 {
+			return "", nil, fmt.Errorf("invalid index in %q", segment)
+		}
+		indexes = append(indexes, i)
+		if after == "" {
+			break
+		}
+		if after[0] != '[' {
+			return "", nil, fmt.Errorf("unexpected %q after an index", after)
+		}
+		rest = after[1:]
+	}
+	return key, indexes, nil
+}
+
+// Set stores value at path, creating the sections leading to it as needed,
+// so that the document can then be written back with Marshal. Array elements
+// along the path, such as servers[1], must already exist. Set returns a
+// *PathError if the path is malformed or runs into a value that is not a
+// section or array.
+//
+// value should be of one of the types Parse returns, or a section or array
+// made of them. Other integer and float types are converted to int64 and
+// float64, so that the typed getters find them.
+func (d Document) Set(path string, value interface{}) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	_, err = updatePath(map[string]interface{}(d), steps, path, "", normalizeValue(value))
+	return err
+}
+
+// Delete removes the value at path. An array element is removed from its
+// array, shifting the following elements down. Delete returns a *PathError if
+// the path is malformed or leads to no value.
+func (d Document) Delete(path string) error {
+	steps, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	_, err = updatePath(map[string]interface{}(d), steps, path, "", deleteValue{})
+	return err
+}
+
+// MapValues returns a copy of d with every value replaced by what f returns
+// for it, given its path, such as servers[1].host, for bulk changes such as
+// lowercasing hosts or converting units in one call. f is called on the values
+// held by sections and arrays, not on the sections and arrays themselves, and
+// on the keys of a section in sorted order. Its results are converted as Set
+// converts values. d is left as it is.
+func (d Document) MapValues(f func(path string, v interface{}) interface{}) Document {
+	return mapValue(map[string]interface{}(d), "", f).(map[string]interface{})
+}
+
+// Clone returns a deep copy of d, whose sections, arrays, byte strings and
+// big integers can be changed without affecting d.
+func (d Document) Clone() Document {
+	return Document(copyValue(map[string]interface{}(d)).(map[string]interface{}))
+}
+
+// mapValue returns a copy of v, whose path is path, with the values below it
+// replaced by f.
+func mapValue(v interface{}, path string, f func(string, interface{}) interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		m := make(map[string]interface{}, len(x))
+		for _, k := range keys {
+			m[k] = mapValue(x[k], joinPath(path, k), f)
+		}
+		return m
+	case []interface{}, []map[string]interface{}:
+		elems, _ := asArray(x)
+		arr := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			arr[i] = mapValue(elem, indexPath(path, i), f)
+		}
+		if _, ok := x.([]map[string]interface{}); ok {
+			return restoreSections(arr)
+		}
+		return arr
+	}
+	return normalizeValue(f(path, v))
+}
+
+// deleteValue is passed to updatePath in place of a value to delete the
+// value at the path instead.
+type deleteValue struct{}
+
+// pathStep is a key or an array index of a parsed path.
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath splits a path such as servers[2].host into its steps.
+func parsePath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	for _, segment := range strings.Split(path, ".") {
+		key, indexes, err := splitPathSegment(segment)
+		if err != nil {
+			return nil, &PathError{Path: path, Reason: err.Error()}
+		}
+		steps = append(steps, pathStep{key: key})
+		for _, i := range indexes {
+			steps = append(steps, pathStep{index: i, isIndex: true})
+		}
+	}
+	return steps, nil
+}
+
+// updatePath sets or, given a deleteValue, deletes the value at steps below
+// v, whose own path is done, and returns v as updated. Sections are updated
+// in place, but arrays may be replaced by a new slice, which the caller
+// stores back into their parent.
+func updatePath(v interface{}, steps []pathStep, path, done string, value interface{}) (interface{}, error) {
+	step, last := steps[0], len(steps) == 1
+	_, remove := value.(deleteValue)
+
+	if !step.isIndex {
+		section, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, &PathError{Path: path, Reason: fmt.Sprintf("%s is a %s, not a section", done, describeValue(v))}
+		}
+		done = joinPath(done, step.key)
+		child, exists := section[step.key]
+		switch {
+		case !exists && remove:
+			return nil, &PathError{Path: path, Reason: done + " not found"}
+		case last && remove:
+			delete(section, step.key)
+			return section, nil
+		case last:
+			section[step.key] = value
+			return section, nil
+		case !exists:
+			child = make(map[string]interface{})
+		}
+		child, err := updatePath(child, steps[1:], path, done, value)
+		if err != nil {
+			return nil, err
+		}
+		section[step.key] = child
+		return section, nil
+	}
+
+	arr, ok := asArray(v)
+	if !ok {
+		return nil, &PathError{Path: path, Reason: fmt.Sprintf("%s is a %s, not an array", done, describeValue(v))}
+	}
+	if step.index >= len(arr) {
+		return nil, &PathError{Path: path, Reason: fmt.Sprintf("%s not found, the array has %d elements", indexPath(done, step.index), len(arr))}
+	}
+	switch {
+	case last && remove:
+		arr = append(arr[:step.index:step.index], arr[step.index+1:]...)
+	case last:
+		arr[step.index] = value
+	default:
+		elem, err := updatePath(arr[step.index], steps[1:], path, indexPath(done, step.index), value)
+		if err != nil {
+			return nil, err
+		}
+		arr[step.index] = elem
+	}
+	if _, ok := v.([]map[string]interface{}); ok {
+		return restoreSections(arr), nil
+	}
+	return arr, nil
+}
+
+// restoreSections returns arr as []map[string]interface{}, the type Parse
+// gives arrays of sections, if it only holds sections.
+func restoreSections(arr []interface{}) interface{} {
+	sections := make([]map[string]interface{}, len(arr))
+	for i, elem := range arr {
+		section, ok := elem.(map[string]interface{})
+		if !ok {
+			return arr
+		}
+		sections[i] = section
+	}
+	return sections
+}
+
+// normalizeValue converts integers and floats of any type to the int64,
+// uint64 and float64 values Parse returns.
+func normalizeValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Type() != durationType {
+			return rv.Int()
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u > math.MaxInt64 {
+			return u
+		}
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return v
+}
@@ -0,0 +1,312 @@
+package bulbason
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const documentInput = `BULBA!
+name ~> "Bulby"
+debug ~> SuperEffective
+owner ~> MissingNo
+tags ~> <| "grass", <| 1, 2 |> |>
+(o) database (o)
+    host ~> "localhost"
+    (O) pool (O)
+        max_connections ~> 50
+servers ~> <|
+(o)
+    host ~> "10.0.0.1"
+(o)
+    host ~> "10.0.0.2"
+|>
+`
+
+func parseDocument(t *testing.T) Document {
+	t.Helper()
+	m, err := Parse(documentInput)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return Document(m)
+}
+
+func TestDocument_Get(t *testing.T) {
+	doc := parseDocument(t)
+
+	tests := []struct {
+		path     string
+		expected interface{}
+	}{
+		{"name", "Bulby"},
+		{"owner", nil},
+		{"database.pool.max_connections", int64(50)},
+		{"tags[0]", "grass"},
+		{"tags[1][1]", int64(2)},
+		{"servers[1].host", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			v, err := doc.Get(tt.path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if v != tt.expected {
+				t.Errorf("Expected %#v, got %#v", tt.expected, v)
+			}
+		})
+	}
+}
+
+func TestDocument_GetErrors(t *testing.T) {
+	doc := parseDocument(t)
+
+	tests := []struct {
+		path   string
+		reason string
+	}{
+		{"database.port", "database.port not found"},
+		{"name.first", "name is a string, not a section"},
+		{"name[0]", "name is a string, not an array"},
+		{"servers[2].host", "servers[2] not found, the array has 2 elements"},
+		{"database..host", `empty key in ""`},
+		{"tags[x]", `invalid index in "tags[x]"`},
+		{"tags[0]x", `unexpected "x" after an index`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := doc.Get(tt.path)
+			var pathErr *PathError
+			if !errors.As(err, &pathErr) {
+				t.Fatalf("Expected a PathError, got %v", err)
+			}
+			if pathErr.Path != tt.path || pathErr.Reason != tt.reason {
+				t.Errorf("Expected %q at %q, got %q at %q", tt.reason, tt.path, pathErr.Reason, pathErr.Path)
+			}
+		})
+	}
+}
+
+func TestDocument_TypedGetters(t *testing.T) {
+	doc := parseDocument(t)
+
+	if s, err := doc.GetString("database.host"); err != nil || s != "localhost" {
+		t.Errorf("Expected localhost, got %q (%v)", s, err)
+	}
+	if n, err := doc.GetInt("database.pool.max_connections"); err != nil || n != 50 {
+		t.Errorf("Expected 50, got %d (%v)", n, err)
+	}
+	if b, err := doc.GetBool("debug"); err != nil || !b {
+		t.Errorf("Expected true, got %v (%v)", b, err)
+	}
+
+	var typeErr *UnmarshalTypeError
+	if _, err := doc.GetInt("name"); !errors.As(err, &typeErr) || typeErr.Path != "name" || typeErr.Value != "string" {
+		t.Errorf("Expected a type error for name, got %v", err)
+	}
+	if _, err := doc.GetString("database"); !errors.As(err, &typeErr) || typeErr.Value != "section" {
+		t.Errorf("Expected a type error for database, got %v", err)
+	}
+	if _, err := doc.GetBool("owner"); !errors.As(err, &typeErr) {
+		t.Errorf("Expected a type error for owner, got %v", err)
+	}
+
+	m, err := Parse("BULBA!\nbig ~> 18446744073709551615\n", LargeIntegers(LargeIntegerBig))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := Document(m).GetInt("big"); !errors.As(err, &typeErr) {
+		t.Errorf("Expected a type error for an integer beyond int64, got %v", err)
+	}
+}
+
+func TestDocument_Defaults(t *testing.T) {
+	doc := parseDocument(t)
+
+	if s := doc.GetStringOr("database.host", "db"); s != "localhost" {
+		t.Errorf("Expected localhost, got %q", s)
+	}
+	if s := doc.GetStringOr("database.user", "admin"); s != "admin" {
+		t.Errorf("Expected the default, got %q", s)
+	}
+	if n := doc.GetIntOr("database.pool.max_connections", 10); n != 50 {
+		t.Errorf("Expected 50, got %d", n)
+	}
+	if n := doc.GetIntOr("name", 10); n != 10 {
+		t.Errorf("Expected the default for a string, got %d", n)
+	}
+	if b := doc.GetBoolOr("verbose", true); !b {
+		t.Errorf("Expected the default, got %v", b)
+	}
+}
+
+func TestDocument_Set(t *testing.T) {
+	doc := parseDocument(t)
+
+	sets := []struct {
+		path  string
+		value interface{}
+	}{
+		{"name", "Ivy"},
+		{"database.pool.max_connections", 100},
+		{"database.replica.host", "replica.local"},
+		{"servers[1].host", "10.0.0.3"},
+		{"tags[1][0]", uint8(7)},
+	}
+	for _, s := range sets {
+		if err := doc.Set(s.path, s.value); err != nil {
+			t.Fatalf("Unexpected error setting %s: %v", s.path, err)
+		}
+	}
+
+	if s := doc.GetStringOr("name", ""); s != "Ivy" {
+		t.Errorf("Expected Ivy, got %q", s)
+	}
+	if n := doc.GetIntOr("database.pool.max_connections", 0); n != 100 {
+		t.Errorf("Expected 100, got %d", n)
+	}
+	if s := doc.GetStringOr("database.replica.host", ""); s != "replica.local" {
+		t.Errorf("Expected the new section to be created, got %q", s)
+	}
+	if s := doc.GetStringOr("servers[1].host", ""); s != "10.0.0.3" {
+		t.Errorf("Expected 10.0.0.3, got %q", s)
+	}
+	if n := doc.GetIntOr("tags[1][0]", 0); n != 7 {
+		t.Errorf("Expected 7, got %d", n)
+	}
+	if _, ok := doc["servers"].([]map[string]interface{}); !ok {
+		t.Errorf("Expected servers to stay an array of sections, got %T", doc["servers"])
+	}
+
+	var pathErr *PathError
+	for _, path := range []string{"name.first", "servers[5].host", "database[0]", "a..b"} {
+		if err := doc.Set(path, 1); !errors.As(err, &pathErr) {
+			t.Errorf("Expected a PathError setting %s, got %v", path, err)
+		}
+	}
+}
+
+func TestDocument_Delete(t *testing.T) {
+	doc := parseDocument(t)
+
+	for _, path := range []string{"owner", "database.pool.max_connections", "servers[0]", "tags[1][0]"} {
+		if err := doc.Delete(path); err != nil {
+			t.Fatalf("Unexpected error deleting %s: %v", path, err)
+		}
+	}
+
+	if _, err := doc.Get("owner"); err == nil {
+		t.Errorf("Expected owner to be deleted")
+	}
+	if pool, _ := doc.Get("database.pool"); len(pool.(map[string]interface{})) != 0 {
+		t.Errorf("Expected an empty pool, got %v", pool)
+	}
+	if s := doc.GetStringOr("servers[0].host", ""); s != "10.0.0.2" {
+		t.Errorf("Expected the second server to move up, got %q", s)
+	}
+	if tags, _ := doc.Get("tags[1]"); len(tags.([]interface{})) != 1 {
+		t.Errorf("Expected one element left, got %v", tags)
+	}
+
+	var pathErr *PathError
+	for _, path := range []string{"owner", "database.missing.key", "servers[1]"} {
+		if err := doc.Delete(path); !errors.As(err, &pathErr) {
+			t.Errorf("Expected a PathError deleting %s, got %v", path, err)
+		}
+	}
+}
+
+func TestDocument_MapValues(t *testing.T) {
+	doc := parseDocument(t)
+
+	var paths []string
+	mapped := doc.MapValues(func(path string, v interface{}) interface{} {
+		paths = append(paths, path)
+		switch v := v.(type) {
+		case string:
+			return strings.ToUpper(v)
+		case int64:
+			return int32(v * 10)
+		}
+		return v
+	})
+
+	expected := []string{
+		"database.host", "database.pool.max_connections", "debug", "name", "owner",
+		"servers[0].host", "servers[1].host", "tags[0]", "tags[1][0]", "tags[1][1]",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected paths %v, got %v", expected, paths)
+	}
+	if s := mapped.GetStringOr("servers[1].host", ""); s != "10.0.0.2" {
+		t.Errorf("Expected 10.0.0.2, got %q", s)
+	}
+	if s := mapped.GetStringOr("name", ""); s != "BULBY" {
+		t.Errorf("Expected BULBY, got %q", s)
+	}
+	if n, err := mapped.GetInt("database.pool.max_connections"); err != nil || n != 500 {
+		t.Errorf("Expected 500, got %d (%v)", n, err)
+	}
+	if tags, _ := mapped.Get("tags[1]"); !reflect.DeepEqual(tags, []interface{}{int64(10), int64(20)}) {
+		t.Errorf("Expected <| 10, 20 |>, got %v", tags)
+	}
+	if _, ok := mapped["servers"].([]map[string]interface{}); !ok {
+		t.Errorf("Expected servers to stay an array of sections, got %T", mapped["servers"])
+	}
+	if s := doc.GetStringOr("name", ""); s != "Bulby" {
+		t.Errorf("Expected the original to be left as it is, got %q", s)
+	}
+}
+
+func TestDocument_Clone(t *testing.T) {
+	doc := parseDocument(t)
+	doc["big"] = big.NewInt(1)
+	doc["raw"] = []byte("abc")
+
+	clone := doc.Clone()
+	if !reflect.DeepEqual(clone, doc) {
+		t.Fatalf("Expected %v, got %v", doc, clone)
+	}
+	clone.Set("database.pool.max_connections", 1)
+	clone.Set("servers[0].host", "changed")
+	clone.Set("tags[1][0]", 0)
+	clone["big"].(*big.Int).SetInt64(2)
+	clone["raw"].([]byte)[0] = 'x'
+
+	expected := parseDocument(t)
+	expected["big"] = big.NewInt(1)
+	expected["raw"] = []byte("abc")
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected the original to be left as it is, got %v", doc)
+	}
+	if Document(nil).Clone() != nil {
+		t.Error("Expected a nil clone of a nil document")
+	}
+}
+
+func TestDocument_SetMarshal(t *testing.T) {
+	doc := Document{}
+	if err := doc.Set("database.pool.size", 10); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := doc.Set("name", "app"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+name ~~~~> "app"
+(o) database (o)
+    (O) pool (O)
+        size ~~~~> 10
+`
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, data)
+	}
+}
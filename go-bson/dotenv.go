@@ -0,0 +1,366 @@
+package bulbason
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// ToDotenv flattens a document to the KEY=VALUE lines of a .env file,
+// keeping the order of its entries.
+//
+// The keys of sections, objects and arrays are joined with sep into a single
+// name, array elements being named by their index, so that with sep "__" the
+// key port of section db becomes db__port. With an empty sep only a flat
+// document can be converted. Every value is written as text: timestamps,
+// durations and byte strings as their literal text, base64 in the case of
+// byte strings, and infinity and NaN as +Inf, -Inf and NaN. Values are quoted
+// only where a .env reader needs it. Keys without a value, and empty arrays
+// and objects, are left out. When a key appears more than once, the last value
+// wins, as with Parse. A name that is not a valid variable name, or a key that
+// contains sep, is an error.
+func ToDotenv(doc *ast.Document, sep string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeDotenvBody(&buf, doc.Body, "", "", sep); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeDotenvBody writes the entries of a body at path, whose variables are
+// named starting with prefix.
+func writeDotenvBody(buf *bytes.Buffer, body []ast.Entry, prefix, path, sep string) error {
+	last := make(map[string]int, len(body))
+	for i, entry := range body {
+		last[entryName(entry)] = i
+	}
+
+	for i, entry := range body {
+		name := entryName(entry)
+		if last[name] != i {
+			continue
+		}
+		keyPath := joinPath(path, name)
+		if sep != "" && strings.Contains(name, sep) {
+			return fmt.Errorf("bulbason: cannot convert %s to dotenv, the key contains the separator %q", keyPath, sep)
+		}
+
+		var value ast.Value
+		switch e := entry.(type) {
+		case *ast.Section:
+			if e.Forme != nil {
+				return formeError(e, keyPath, "dotenv")
+			}
+			value = &ast.ObjectLit{Body: e.Body}
+		case *ast.KeyValue:
+			value = e.Value
+		default:
+			return fmt.Errorf("bulbason: cannot convert node of type %T to dotenv", entry)
+		}
+		if err := writeDotenvValue(buf, value, prefix+name, keyPath, sep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDotenvValue writes the value at path as the variable name, or as
+// variables starting with name and sep if it is an array or object.
+func writeDotenvValue(buf *bytes.Buffer, v ast.Value, name, path, sep string) error {
+	switch n := v.(type) {
+	case *ast.ObjectLit, *ast.ArrayLit:
+		if sep == "" {
+			return fmt.Errorf("bulbason: cannot convert %s to dotenv without a separator", path)
+		}
+		if obj, ok := n.(*ast.ObjectLit); ok {
+			return writeDotenvBody(buf, obj.Body, name+sep, path, sep)
+		}
+		for i, elem := range n.(*ast.ArrayLit).Elements {
+			if err := writeDotenvValue(buf, elem, name+sep+strconv.Itoa(i), indexPath(path, i), sep); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.NullLit, nil:
+		return nil
+	}
+
+	if !isDotenvName(name) {
+		return fmt.Errorf("bulbason: cannot convert %s to dotenv, %q is not a valid variable name", path, name)
+	}
+	var text string
+	switch n := v.(type) {
+	case *ast.StringLit:
+		text = n.Value
+	case *ast.NumberLit:
+		switch n.Literal {
+		case literalInf:
+			text = "+Inf"
+		case literalNegInf:
+			text = "-Inf"
+		case literalNaN:
+			text = "NaN"
+		default:
+			text = n.Literal
+		}
+	case *ast.TimeLit:
+		text = n.Literal
+	case *ast.DurationLit:
+		text = n.Literal
+	case *ast.BytesLit:
+		text = n.Literal
+	case *ast.BoolLit:
+		text = strconv.FormatBool(n.Value)
+	default:
+		return fmt.Errorf("bulbason: cannot convert %s of type %T to dotenv", path, v)
+	}
+	buf.WriteString(name + "=" + dotenvValue(text) + "\n")
+	return nil
+}
+
+// dotenvValue returns s as a .env value: bare if it holds nothing a reader
+// would treat specially, between single quotes if it fits on a line without
+// one, and between double quotes with escapes otherwise.
+func dotenvValue(s string) string {
+	if !strings.ContainsAny(s, " \t\r\n'\"#\\$`") {
+		return s
+	}
+	if !strings.ContainsAny(s, "'\r\n") {
+		return "'" + s + "'"
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\', '$', '`':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// isDotenvName reports whether name can be used as a variable name: letters,
+// digits, underscores, dots and dashes, not starting with a digit.
+func isDotenvName(name string) bool {
+	if name == "" || isDigit(name[0]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c == '_' || c == '.' || c == '-' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// FromDotenv converts the KEY=VALUE lines of a .env file to a document, in the
+// order in which the variables first appear, ready to be written with
+// Encoder.EncodeAST.
+//
+// Values are kept as strings, as the environment sees them. With an empty sep
+// every variable becomes a key of the document. Otherwise names are split on
+// sep, the leading parts becoming sections, so that with sep "__" the
+// variable db__port becomes the key port of section db. Blank lines, comments
+// and a leading export are skipped. Values may be bare, with any trailing
+// comment removed, or between single quotes, taken literally, or double
+// quotes, where \n, \r, \t, \", \\, \$ and \` are escapes. Quoted values may
+// span several lines. When a variable is set more than once, the last value
+// wins. Names that are not valid variable names, or that split into keys BSON
+// cannot hold, are rejected with an error naming the line.
+func FromDotenv(data []byte, sep string) (*ast.Document, error) {
+	root := &ast.ObjectLit{Inline: true}
+	p := &dotenvParser{s: strings.ReplaceAll(string(data), "\r\n", "\n"), line: 1}
+	for {
+		p.skipBlank()
+		if p.i == len(p.s) {
+			break
+		}
+		line := p.line
+		name, value, err := p.variable()
+		if err != nil {
+			return nil, err
+		}
+		if err := setDotenv(root, name, value, sep); err != nil {
+			return nil, fmt.Errorf("bulbason: cannot convert dotenv line %d: %w", line, err)
+		}
+	}
+	return &ast.Document{Body: sectionsFromObjects(root.Body)}, nil
+}
+
+// setDotenv sets the variable name to value in root, splitting name on sep.
+func setDotenv(root *ast.ObjectLit, name, value, sep string) error {
+	keys := []string{name}
+	if sep != "" {
+		keys = strings.Split(name, sep)
+	}
+	table := root
+	for i, key := range keys {
+		if _, err := encodeKey(key); err != nil {
+			return fmt.Errorf("%q is not a valid key", key)
+		}
+		prefix := strings.Join(keys[:i+1], sep)
+		kv := findKey(table, key)
+		if i == len(keys)-1 {
+			if kv == nil {
+				table.Body = append(table.Body, &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: &ast.StringLit{Value: value}})
+				return nil
+			}
+			if _, ok := kv.Value.(*ast.ObjectLit); ok {
+				return fmt.Errorf("%s is already used as a prefix", prefix)
+			}
+			kv.Value = &ast.StringLit{Value: value}
+			return nil
+		}
+		if kv == nil {
+			kv = &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: &ast.ObjectLit{Inline: true}}
+			table.Body = append(table.Body, kv)
+		}
+		obj, ok := kv.Value.(*ast.ObjectLit)
+		if !ok {
+			return fmt.Errorf("%s is already set to a value", prefix)
+		}
+		table = obj
+	}
+	return nil
+}
+
+// dotenvParser reads the variables of a .env file.
+type dotenvParser struct {
+	s    string
+	i    int // Offset of the next byte to read
+	line int // Number of the line holding offset i
+}
+
+// errorf returns an error located at the given line.
+func (p *dotenvParser) errorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("bulbason: cannot convert dotenv line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips whitespace, line breaks and comment lines.
+func (p *dotenvParser) skipBlank() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case ' ', '\t':
+			p.i++
+		case '\n':
+			p.i++
+			p.line++
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+// skipComment skips to the end of the line.
+func (p *dotenvParser) skipComment() {
+	for p.i < len(p.s) && p.s[p.i] != '\n' {
+		p.i++
+	}
+}
+
+// variable reads a KEY=VALUE line and returns its name and value.
+func (p *dotenvParser) variable() (string, string, error) {
+	line := p.line
+	end := strings.IndexByte(p.s[p.i:], '\n')
+	if end == -1 {
+		end = len(p.s) - p.i
+	}
+	text := p.s[p.i : p.i+end]
+	eq := strings.IndexByte(text, '=')
+	if eq == -1 {
+		return "", "", p.errorf(line, "expected KEY=VALUE")
+	}
+	name := strings.TrimSpace(text[:eq])
+	if rest, ok := strings.CutPrefix(name, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+		name = strings.TrimLeft(rest, " \t")
+	}
+	if !isDotenvName(name) {
+		return "", "", p.errorf(line, "%q is not a valid variable name", name)
+	}
+	p.i += eq + 1
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+
+	if p.i == len(p.s) || p.s[p.i] != '\'' && p.s[p.i] != '"' {
+		// A bare value runs to the end of the line or to a comment.
+		start := p.i
+		for p.i < len(p.s) && p.s[p.i] != '\n' {
+			if p.s[p.i] == '#' && p.i > start && (p.s[p.i-1] == ' ' || p.s[p.i-1] == '\t') {
+				break
+			}
+			p.i++
+		}
+		value := strings.TrimSpace(p.s[start:p.i])
+		p.skipComment()
+		return name, value, nil
+	}
+
+	value, err := p.quoted()
+	if err != nil {
+		return "", "", err
+	}
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+	if p.i < len(p.s) && p.s[p.i] != '\n' && p.s[p.i] != '#' {
+		return "", "", p.errorf(p.line, "unexpected text after the value of %s", name)
+	}
+	p.skipComment()
+	return name, value, nil
+}
+
+// quoted reads a value between single or double quotes.
+func (p *dotenvParser) quoted() (string, error) {
+	line := p.line
+	q := p.s[p.i]
+	p.i++
+	var sb strings.Builder
+	for {
+		if p.i == len(p.s) {
+			return "", p.errorf(line, "unterminated value")
+		}
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == q:
+			return sb.String(), nil
+		case c == '\n':
+			p.line++
+			sb.WriteByte(c)
+		case c == '\\' && q == '"' && p.i < len(p.s):
+			e := p.s[p.i]
+			p.i++
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '"', '\\', '$', '`':
+				sb.WriteByte(e)
+			default:
+				// Other backslashes are kept as they are.
+				p.i--
+				sb.WriteByte('\\')
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package bulbason
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+func TestToDotenv(t *testing.T) {
+	input := `BULBA!
+APP_NAME ~~> "Bulby"
+PORT ~> 8080
+DEBUG ~> SuperEffective
+OWNER ~> MissingNo
+GREETING ~> "Hello, trainer #1"
+QUOTE ~> "it's"
+(o) db (o)
+    host ~> "localhost"
+    (O) pool (O)
+        size ~> 10
+        idle ~> 30s
+hosts ~> <| "a", "b" |>
+PORT ~> 9090
+`
+	doc, err := ParseAST(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := ToDotenv(doc, "__")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `APP_NAME=Bulby
+DEBUG=true
+GREETING='Hello, trainer #1'
+QUOTE="it's"
+db__host=localhost
+db__pool__size=10
+db__pool__idle=30s
+hosts__0=a
+hosts__1=b
+PORT=9090
+`
+	if string(out) != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	// Reading the file back gives the same keys, with every value a string.
+	back, err := FromDotenv(out, "__")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(back); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := Parse(buf.String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, buf.String())
+	}
+	want := map[string]interface{}{
+		"APP_NAME": "Bulby",
+		"DEBUG":    "true",
+		"GREETING": "Hello, trainer #1",
+		"QUOTE":    "it's",
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"pool": map[string]interface{}{"size": "10", "idle": "30s"},
+		},
+		"hosts": map[string]interface{}{"0": "a", "1": "b"},
+		"PORT":  "9090",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", want, got)
+	}
+}
+
+func TestToDotenv_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		sep   string
+		msg   string
+	}{
+		{"Nested Without Separator", "BULBA!\n(o) db (o)\n    host ~> 1\n", "", "cannot convert db to dotenv without a separator"},
+		{"Key Contains Separator", "BULBA!\n(o) db (o)\n    a_b ~> 1\n", "_", `db.a_b to dotenv, the key contains the separator "_"`},
+		{"Invalid Name", "BULBA!\n\"my key\" ~> 1\n", "", `"my key" is not a valid variable name`},
+		{"Leading Digit", "BULBA!\n\"1st\" ~> 1\n", "", `"1st" is not a valid variable name`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseAST(tt.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			_, err = ToDotenv(doc, tt.sep)
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
+
+func TestFromDotenv(t *testing.T) {
+	input := "# Service settings\n" +
+		"export APP_NAME=bulby\n" +
+		"PORT = 8080 # default port\n" +
+		"EMPTY=\n" +
+		"HASH=a#b\n" +
+		"RAW='C:\\path $HOME'\n" +
+		"ESCAPED=\"line\\none \\\"quoted\\\" \\$HOME\"\n" +
+		"CERT=\"-----BEGIN-----\n" +
+		"abc\n" +
+		"-----END-----\"\n" +
+		"DB__HOST=localhost\r\n" +
+		"DB__PORT=5432\n" +
+		"PORT=9090\n"
+	doc, err := FromDotenv([]byte(input), "__")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+APP_NAME ~~~~> "bulby"
+PORT ~~~~> "9090"
+EMPTY ~~~~> ""
+HASH ~~~~> "a#b"
+RAW ~~~~> "C:\path $HOME"
+ESCAPED ~~~~> """
+    line
+    one "quoted" $HOME
+    """
+CERT ~~~~> """
+    -----BEGIN-----
+    abc
+    -----END-----
+    """
+(o) DB (o)
+    HOST ~~~~> "localhost"
+    PORT ~~~~> "5432"
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	// Without a separator the names are kept whole.
+	doc, err = FromDotenv([]byte("DB__HOST=localhost\n"), "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name := doc.Body[0].(*ast.KeyValue).Key.Name; name != "DB__HOST" {
+		t.Errorf("Expected key DB__HOST, got %s", name)
+	}
+}
+
+func TestFromDotenv_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+	}{
+		{"Missing Equals", "A=1\nJUST_A_NAME\n", "line 2: expected KEY=VALUE"},
+		{"Invalid Name", "MY KEY=1\n", `line 1: "MY KEY" is not a valid variable name`},
+		{"Unterminated Value", "A='one\nB=2\n", "line 1: unterminated value"},
+		{"Text After Quotes", "A=\"one\" two\n", "line 1: unexpected text after the value of A"},
+		{"Value Then Prefix", "DB=1\nDB__HOST=x\n", "line 2: DB is already set to a value"},
+		{"Prefix Then Value", "DB__HOST=x\nDB=1\n", "line 2: DB is already used as a prefix"},
+		{"Empty Key", "DB____HOST=x\n", `line 1: "" is not a valid key`},
+		{"Reserved Key", "Charizard=1\n", `line 1: "Charizard" is not a valid key`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromDotenv([]byte(tt.input), "__")
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
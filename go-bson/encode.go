@@ -0,0 +1,970 @@
+package bulbason
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// Marshaler is implemented by types that encode themselves as a BSON value.
+// MarshalBulba returns a single literal, such as "10.0.0.0/8" with its
+// quotes, 42 or { major ~> 1 }, which is checked before it is written.
+type Marshaler interface {
+	MarshalBulba() ([]byte, error)
+}
+
+// ObjectMarshaler is implemented by types that encode themselves as an
+// object, adding their members to w: written as a section where a section
+// fits, and as an inline object elsewhere. It is used before Marshaler, and
+// spares parsing the literal MarshalBulba returns to check it. The code
+// bulbacodec generates implements it.
+type ObjectMarshaler interface {
+	MarshalBulbaObject(w *ObjectWriter)
+}
+
+// Marshal returns the BSON encoding of v.
+//
+// v must be a struct or a map with string keys (typically
+// map[string]interface{}). Nested maps and structs become sections, or inline
+// objects inside arrays, slices and arrays become Razor Leaf arrays,
+// time.Time and time.Duration become timestamps and durations, []byte becomes
+// a base64 byte string, and nil becomes MissingNo. Types implementing Marshaler
+// are written as the value they return, and other types implementing
+// encoding.TextMarshaler as a string. Map keys
+// are written in sorted order and struct fields in declaration order, with
+// plain values before the sections of each level. The keys of a map field
+// tagged `bson:",remain"` are written after the other fields of its struct.
+// Fields tagged with the omitempty option are left out when they are false,
+// 0, "", nil or empty, and those tagged with omitzero when they are their
+// zero value, according to their IsZero method if they have one. Types
+// implementing ObjectMarshaler are written as sections holding the members
+// they add.
+func Marshal(v interface{}) ([]byte, error) {
+	rv := indirect(reflect.ValueOf(v))
+	if !isSection(rv) {
+		return nil, fmt.Errorf("bulbason: cannot marshal %T, expected a struct or a map with string keys", v)
+	}
+
+	e := newEncodeState()
+	if err := e.marshal(rv); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// Default layout used by Marshal and by a new Encoder.
+const (
+	defaultIndentWidth = 4
+	defaultVineLength  = 4
+)
+
+// encodeState holds the output buffer and layout settings for one encoding.
+type encodeState struct {
+	buf    bytes.Buffer
+	indent string // One level of indentation
+	vine   string // The assignment operator, e.g. "~~~~>"
+
+	// source holds the lines of the document a syntax tree was parsed from,
+	// when formatting it. Blank lines and the spelling of numbers are then
+	// taken from the source.
+	source []string
+	last   int // Source line of the last node written
+
+	// keyOrder, if set, orders the keys of every section and object
+	// written. Otherwise they keep the order of the source.
+	keyOrder func(a, b string) int
+
+	vinePolicy VinePolicy
+	quoteStyle QuoteStyle
+	arrayWrap  int // Widest line an array of sections is written inline on
+
+	// rename, if set, gives the new name of every key Format writes.
+	rename func(key string) string
+}
+
+func newEncodeState() *encodeState {
+	return &encodeState{
+		indent: strings.Repeat(" ", defaultIndentWidth),
+		vine:   strings.Repeat("~", defaultVineLength) + ">",
+	}
+}
+
+// marshal writes a complete document, header included, for the section v.
+func (e *encodeState) marshal(v reflect.Value) error {
+	e.buf.WriteString("BULBA!\n")
+	return e.writeSection(v, 0)
+}
+
+// entry is a single key and its value within a section being encoded.
+type entry struct {
+	key string
+	val reflect.Value
+}
+
+// timeType is encoded as a timestamp literal rather than as a section,
+// durationType as a duration literal rather than as a number, bigIntType as
+// an integer rather than as a section, and numberType as a number rather
+// than as a string.
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	bigIntType   = reflect.TypeOf(big.Int{})
+	numberType   = reflect.TypeOf(Number(""))
+)
+
+// isSection reports whether v is encoded as a section rather than a value.
+func isSection(v reflect.Value) bool {
+	if _, ok := implementer[ObjectMarshaler](v); ok {
+		return true
+	}
+	if encodesItself(v) {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		return v.Type().Key().Kind() == reflect.String
+	case reflect.Struct:
+		return v.Type() != timeType && v.Type() != bigIntType
+	}
+	return false
+}
+
+// sectionEntries lists the keys of a map or struct in the order they are written.
+func sectionEntries(v reflect.Value) []entry {
+	var entries []entry
+	if v.Kind() == reflect.Struct {
+		fields := typeFields(v.Type())
+		for _, f := range fields {
+			// The fields of a nil flattened struct are left out.
+			if fv, ok := fieldByIndex(v, f.index, false); ok && !f.remain && !f.omitted(fv) {
+				entries = append(entries, entry{key: f.name, val: indirect(fv)})
+			}
+		}
+		// The keys captured by a remain field follow, unless a field has
+		// the same key.
+		if f := remainField(fields); f != nil {
+			fv, _ := fieldByIndex(v, f.index, false)
+			if m := indirect(fv); m.Kind() == reflect.Map && m.Type().Key().Kind() == reflect.String {
+				for _, ent := range sectionEntries(m) {
+					if !slices.ContainsFunc(entries, func(e entry) bool { return e.key == ent.key }) {
+						entries = append(entries, ent)
+					}
+				}
+			}
+		}
+		return entries
+	}
+
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	for _, k := range keys {
+		entries = append(entries, entry{key: k.String(), val: indirect(v.MapIndex(k))})
+	}
+	return entries
+}
+
+// sortEntries orders entries by e.keyOrder, if set, and returns them.
+func (e *encodeState) sortEntries(entries []entry) []entry {
+	if e.keyOrder != nil {
+		slices.SortStableFunc(entries, func(a, b entry) int { return e.keyOrder(a.key, b.key) })
+	}
+	return entries
+}
+
+// writeSection writes the contents of a map or struct at the given evolution
+// level. Plain key-value pairs come first, followed by nested sections,
+// because a key written after a section header would otherwise belong to
+// that section.
+func (e *encodeState) writeSection(v reflect.Value, level int) error {
+	if m, ok := implementer[ObjectMarshaler](v); ok {
+		var w ObjectWriter
+		m.MarshalBulbaObject(&w)
+		return e.writeObject(&w, level)
+	}
+	indent := strings.Repeat(e.indent, level)
+	entries := e.sortEntries(sectionEntries(v))
+	keys := make([]string, len(entries))
+	width := 0
+	for i, ent := range entries {
+		var err error
+		if keys[i], err = encodeKey(ent.key); err != nil {
+			return err
+		}
+		if !isSection(ent.val) {
+			width = max(width, keyWidth(keys[i]))
+		}
+	}
+
+	var sections []entry
+	for i, ent := range entries {
+		key := keys[i]
+		if isSection(ent.val) {
+			sections = append(sections, entry{key: key, val: ent.val})
+			continue
+		}
+		vine := e.vineFor(key, width)
+		if isSectionList(ent.val) {
+			if literal, ok := e.wrapSections(ent.val, indent+key+" "+vine+" "); ok {
+				fmt.Fprintf(&e.buf, "%s%s %s %s\n", indent, key, vine, literal)
+				continue
+			}
+			if err := e.writeBlockArray(key, vine, ent.val, level); err != nil {
+				return err
+			}
+			continue
+		}
+		if !encodesItself(ent.val) && ent.val.Kind() == reflect.String && strings.Contains(ent.val.String(), "\n") {
+			fmt.Fprintf(&e.buf, "%s%s %s \"\"\"\n", indent, key, vine)
+			if err := e.writeHeredoc(ent.val.String(), level); err != nil {
+				return err
+			}
+			continue
+		}
+
+		literal, err := e.encodeValue(ent.val, false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&e.buf, "%s%s %s %s\n", indent, key, vine, literal)
+	}
+
+	// The keys of sections have already been encoded above.
+	for _, ent := range sections {
+		marker := sectionMarker(level + 1)
+		fmt.Fprintf(&e.buf, "%s%s %s %s\n", indent, marker, ent.key, marker)
+		if err := e.writeSection(ent.val, level+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyWidth returns the number of columns an encoded key takes.
+func keyWidth(key string) int {
+	return utf8.RuneCountInString(key)
+}
+
+// vineFor returns the Vine Whip written after an encoded key in a section
+// whose widest key is width columns wide. When aligning, shorter keys get
+// longer Vine Whips so that the values start in the same column.
+func (e *encodeState) vineFor(key string, width int) string {
+	if e.vinePolicy != VineAligned {
+		return e.vine
+	}
+	return strings.Repeat("~", width-keyWidth(key)) + e.vine
+}
+
+// sourceVine returns the Vine Whip of kv as written, when keeping them and
+// it is known.
+func (e *encodeState) sourceVine(kv *ast.KeyValue) (string, bool) {
+	if e.vinePolicy != VineSource || kv.Tildes < 1 {
+		return "", false
+	}
+	return strings.Repeat("~", kv.Tildes) + ">", true
+}
+
+// wrapSections returns the array of sections v as an inline array, when it
+// fits on a line of e.arrayWrap columns starting with prefix.
+func (e *encodeState) wrapSections(v reflect.Value, prefix string) (string, bool) {
+	if e.arrayWrap <= 0 {
+		return "", false
+	}
+	literal, err := e.encodeValue(v, false)
+	if err != nil || utf8.RuneCountInString(prefix+literal) > e.arrayWrap {
+		return "", false
+	}
+	return literal, true
+}
+
+// writeObject writes the members of w as the contents of a section at the
+// given evolution level, objects last as writeSection does.
+func (e *encodeState) writeObject(w *ObjectWriter, level int) error {
+	if w.err != nil {
+		return w.err
+	}
+	indent := strings.Repeat(e.indent, level)
+	members := w.sorted(e.keyOrder)
+	width := 0
+	for _, m := range members {
+		if m.object == nil {
+			width = max(width, keyWidth(m.key))
+		}
+	}
+
+	var sections []objectMember
+	for _, m := range members {
+		literal := m.literal
+		vine := e.vineFor(m.key, width)
+		var err error
+		switch {
+		case m.object != nil:
+			sections = append(sections, m)
+			continue
+		case m.isText && strings.Contains(m.text, "\n"):
+			fmt.Fprintf(&e.buf, "%s%s %s \"\"\"\n", indent, m.key, vine)
+			if err := e.writeHeredoc(m.text, level); err != nil {
+				return err
+			}
+			continue
+		case m.isText:
+			literal, err = e.encodeString(m.text, false)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&e.buf, "%s%s %s %s\n", indent, m.key, vine, literal)
+	}
+	for _, m := range sections {
+		marker := sectionMarker(level + 1)
+		fmt.Fprintf(&e.buf, "%s%s %s %s\n", indent, marker, m.key, marker)
+		if err := e.writeObject(m.object, level+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSectionList reports whether v is a non-empty slice or array whose
+// elements are all sections, which is written as a multi-line array.
+func isSectionList(v reflect.Value) bool {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array || v.Len() == 0 {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if !isSection(indirect(v.Index(i))) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeBlockArray writes a multi-line array of sections: each element is
+// introduced by a bare marker one evolution level above the key.
+func (e *encodeState) writeBlockArray(key, vine string, v reflect.Value, level int) error {
+	indent := strings.Repeat(e.indent, level)
+	fmt.Fprintf(&e.buf, "%s%s %s <|\n", indent, key, vine)
+	for i := 0; i < v.Len(); i++ {
+		fmt.Fprintf(&e.buf, "%s%s\n", indent, sectionMarker(level+1))
+		if err := e.writeSection(indirect(v.Index(i)), level+1); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(&e.buf, "%s|>\n", indent)
+	return nil
+}
+
+// writeDocument writes a complete document from its syntax tree, keeping the
+// order of entries and any comments attached to them.
+func (e *encodeState) writeDocument(doc *ast.Document) error {
+	e.buf.WriteString("BULBA!")
+	if doc.Version > 1 {
+		fmt.Fprintf(&e.buf, "v%d", doc.Version)
+	}
+	e.buf.WriteByte('\n')
+	e.last = doc.Header.End.Line
+	if err := e.writeBody(doc.Body, 0); err != nil {
+		return err
+	}
+	e.writeComments(doc.Comments, "")
+	return nil
+}
+
+// writeBody writes the entries of a document or section at the given level.
+func (e *encodeState) writeBody(body []ast.Entry, level int) error {
+	indent := strings.Repeat(e.indent, level)
+	body = e.sortBody(body)
+	width := 0
+	for _, entry := range body {
+		if kv, ok := entry.(*ast.KeyValue); ok {
+			// A key that cannot be encoded is reported below.
+			key, _ := encodeKey(kv.Key.Name)
+			width = max(width, keyWidth(key))
+		}
+	}
+
+	for _, entry := range body {
+		switch n := entry.(type) {
+		case *ast.Section:
+			name, err := encodeKey(n.Name.Name)
+			if err != nil {
+				return err
+			}
+			e.writeComments(n.Comments, indent)
+			e.space(n.Header.Start)
+			marker := sectionMarker(level + 1)
+			fmt.Fprintf(&e.buf, "%s%s %s %s", indent, marker, name, marker)
+			if n.Forme != nil {
+				fmt.Fprintf(&e.buf, " Forme %s", n.Forme.Name)
+			}
+			e.endLine(n.LineComment)
+			e.last = n.Header.End.Line
+			if err := e.writeBody(n.Body, level+1); err != nil {
+				return err
+			}
+		case *ast.KeyValue:
+			key, err := encodeKey(n.Key.Name)
+			if err != nil {
+				return err
+			}
+			vine := e.vineFor(key, width)
+			if source, ok := e.sourceVine(n); ok {
+				vine = source
+			}
+			if arr, ok := n.Value.(*ast.ArrayLit); ok && arr.Block {
+				if err := e.writeBlockNode(key, vine, n, arr, level); err != nil {
+					return err
+				}
+				continue
+			}
+			if str, ok := n.Value.(*ast.StringLit); ok && e.isHeredoc(str) {
+				e.writeComments(n.Comments, indent)
+				e.space(n.Key.Loc.Start)
+				fmt.Fprintf(&e.buf, "%s%s %s \"\"\"", indent, key, vine)
+				e.endLine(n.LineComment)
+				if err := e.writeHeredoc(str.Value, level); err != nil {
+					return err
+				}
+				e.last = str.Loc.End.Line
+				continue
+			}
+			literal, err := e.encodeNode(n.Value, false)
+			if err != nil {
+				return err
+			}
+			e.writeComments(n.Comments, indent)
+			e.space(n.Key.Loc.Start)
+			fmt.Fprintf(&e.buf, "%s%s %s %s", indent, key, vine, literal)
+			e.endLine(n.LineComment)
+			e.last = n.Span().End.Line
+		case *ast.Include:
+			if level > 0 {
+				return fmt.Errorf("bulbason: cannot marshal an include inside a section")
+			}
+			path, err := e.encodeNode(n.Path, false)
+			if err != nil {
+				return err
+			}
+			e.writeComments(n.Comments, indent)
+			e.space(n.Keyword.Start)
+			fmt.Fprintf(&e.buf, "Transform %s", path)
+			e.endLine(n.LineComment)
+			e.last = n.Span().End.Line
+		default:
+			return fmt.Errorf("bulbason: cannot marshal node of type %T", entry)
+		}
+	}
+	return nil
+}
+
+// sortBody returns the entries of body ordered by e.keyOrder, if set, with
+// includes first, or body itself.
+func (e *encodeState) sortBody(body []ast.Entry) []ast.Entry {
+	if e.keyOrder == nil {
+		return body
+	}
+	key := func(entry ast.Entry) (string, bool) {
+		switch n := entry.(type) {
+		case *ast.Section:
+			return n.Name.Name, true
+		case *ast.KeyValue:
+			return n.Key.Name, true
+		}
+		return "", false
+	}
+	sorted := slices.Clone(body)
+	slices.SortStableFunc(sorted, func(a, b ast.Entry) int {
+		ka, okA := key(a)
+		kb, okB := key(b)
+		switch {
+		case okA && okB:
+			return e.keyOrder(ka, kb)
+		case okB:
+			// Includes, which have no key, go first.
+			return -1
+		case okA:
+			return 1
+		}
+		return 0
+	})
+	return sorted
+}
+
+// writeBlockNode writes a key whose value is a multi-line array node. key is
+// the already encoded form of the node's key, and vine the Vine Whip after it.
+func (e *encodeState) writeBlockNode(key, vine string, kv *ast.KeyValue, arr *ast.ArrayLit, level int) error {
+	indent := strings.Repeat(e.indent, level)
+	e.writeComments(kv.Comments, indent)
+	e.space(kv.Key.Loc.Start)
+	fmt.Fprintf(&e.buf, "%s%s %s <|", indent, key, vine)
+	e.endLine(kv.LineComment)
+	e.last = kv.Key.Loc.Start.Line
+	for _, elem := range arr.Elements {
+		obj, ok := elem.(*ast.ObjectLit)
+		if !ok {
+			return fmt.Errorf("bulbason: cannot marshal %T inside a multi-line array", elem)
+		}
+		e.writeComments(obj.Comments, indent)
+		e.space(obj.Marker.Start)
+		fmt.Fprintf(&e.buf, "%s%s\n", indent, sectionMarker(level+1))
+		e.last = obj.Marker.End.Line
+		if err := e.writeBody(obj.Body, level+1); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(&e.buf, "%s|>\n", indent)
+	e.last = arr.Loc.End.Line
+	return nil
+}
+
+// writeHeredoc writes the content and closing quotes of a multi-line string
+// whose key is at the given level. The content is indented one level deeper.
+func (e *encodeState) writeHeredoc(s string, level int) error {
+	indent := strings.Repeat(e.indent, level+1)
+	for _, line := range strings.Split(s, "\n") {
+		if strings.ContainsAny(line, "\r\t") {
+			return fmt.Errorf("bulbason: cannot marshal string %q, it contains a carriage return or tab", s)
+		}
+		if strings.TrimSpace(line) == "\"\"\"" {
+			return fmt.Errorf("bulbason: cannot marshal string %q, a line cannot consist of three quotes", s)
+		}
+		if line == "" {
+			e.buf.WriteByte('\n')
+			continue
+		}
+		e.buf.WriteString(indent + line + "\n")
+	}
+	e.buf.WriteString(indent + "\"\"\"\n")
+	return nil
+}
+
+// writeComments writes comment lines at the given indentation.
+func (e *encodeState) writeComments(comments []*ast.Comment, indent string) {
+	for _, c := range comments {
+		e.space(c.Loc.Start)
+		fmt.Fprintf(&e.buf, "%s%s\n", indent, c.Text)
+		e.last = c.Loc.End.Line
+	}
+}
+
+// space writes a blank line before a node starting at pos when formatting
+// and the source has one or more blank lines there.
+func (e *encodeState) space(pos ast.Position) {
+	if e.source != nil && e.last > 0 && pos.Line > e.last+1 {
+		e.buf.WriteByte('\n')
+	}
+}
+
+// isHeredoc reports whether a string is written as a multi-line string: when
+// it spans several lines, or was written as one in the source being formatted.
+func (e *encodeState) isHeredoc(s *ast.StringLit) bool {
+	return strings.Contains(s.Value, "\n") || e.source != nil && s.Loc.End.Line > s.Loc.Start.Line
+}
+
+// sourceText returns the source text covered by a single-line span, if the
+// node being written was parsed from the source being formatted.
+func (e *encodeState) sourceText(loc ast.Span) (string, bool) {
+	line := loc.Start.Line
+	if e.source == nil || line < 1 || line > len(e.source) || loc.End.Line != line {
+		return "", false
+	}
+	text := e.source[line-1]
+	if loc.Start.Column < 1 || loc.End.Column < loc.Start.Column || loc.End.Column > len(text) {
+		return "", false
+	}
+	return text[loc.Start.Column-1 : loc.End.Column], true
+}
+
+// endLine finishes the current line, with its inline comment if there is one.
+func (e *encodeState) endLine(c *ast.Comment) {
+	if c != nil {
+		e.buf.WriteString(" " + c.Text)
+	}
+	e.buf.WriteByte('\n')
+}
+
+// encodeNode returns the literal form of a value node.
+func (e *encodeState) encodeNode(v ast.Value, inArray bool) (string, error) {
+	switch n := v.(type) {
+	case *ast.StringLit:
+		if n.Raw {
+			return encodeRawString(n.Value)
+		}
+		return encodeString(n.Value, inArray)
+	case *ast.NumberLit:
+		// Digit separators are kept when formatting.
+		if text, ok := e.sourceText(n.Loc); ok && strings.ReplaceAll(text, "_", "") == n.Literal {
+			return text, nil
+		}
+		return n.Literal, nil
+	case *ast.TimeLit:
+		return n.Literal, nil
+	case *ast.DurationLit:
+		return n.Literal, nil
+	case *ast.BytesLit:
+		return "0b64\"" + n.Literal + "\"", nil
+	case *ast.BoolLit:
+		return e.encodeValue(reflect.ValueOf(n.Value), inArray)
+	case *ast.NullLit, nil:
+		return "MissingNo", nil
+	case *ast.DialectLit:
+		return n.Literal, nil
+	case *ast.Reference:
+		return "Copycat " + n.Path, nil
+	case *ast.ArrayLit:
+		if inArray {
+			return "", fmt.Errorf("bulbason: cannot marshal nested arrays")
+		}
+		parts := make([]string, len(n.Elements))
+		for i, elem := range n.Elements {
+			s, err := e.encodeNode(elem, true)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		if len(parts) == 0 {
+			return "<| |>", nil
+		}
+		return "<| " + strings.Join(parts, ", ") + " |>", nil
+	case *ast.ObjectLit:
+		if !n.Inline {
+			return "", fmt.Errorf("bulbason: cannot marshal sections inside inline arrays")
+		}
+		parts := make([]string, 0, len(n.Body))
+		for _, entry := range e.sortBody(n.Body) {
+			kv, ok := entry.(*ast.KeyValue)
+			if !ok {
+				return "", fmt.Errorf("bulbason: cannot marshal sections inside inline objects")
+			}
+			key, err := encodeKey(kv.Key.Name)
+			if err != nil {
+				return "", err
+			}
+			var literal string
+			if str, ok := kv.Value.(*ast.StringLit); ok && !str.Raw {
+				literal, err = encodeString(str.Value, true)
+			} else {
+				literal, err = e.encodeNode(kv.Value, false)
+			}
+			if err != nil {
+				return "", err
+			}
+			vine := e.vine
+			if source, ok := e.sourceVine(kv); ok {
+				vine = source
+			}
+			parts = append(parts, key+" "+vine+" "+literal)
+		}
+		return inlineObject(parts), nil
+	default:
+		return "", fmt.Errorf("bulbason: cannot marshal node of type %T", v)
+	}
+}
+
+// encodeValue returns the literal form of a single value.
+// inArray is set for array elements, which have stricter rules because the
+// lexer splits arrays on the commas outside quotes.
+func (e *encodeState) encodeValue(v reflect.Value, inArray bool) (string, error) {
+	if !v.IsValid() {
+		return "MissingNo", nil
+	}
+	if m, ok := implementer[ObjectMarshaler](v); ok {
+		var w ObjectWriter
+		m.MarshalBulbaObject(&w)
+		return w.inline(e)
+	}
+	if m, ok := implementer[Marshaler](v); ok {
+		return encodeMarshaler(m, v.Type(), inArray)
+	}
+	switch v.Type() {
+	case timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	case durationType:
+		return time.Duration(v.Int()).String(), nil
+	case bigIntType:
+		b := v.Interface().(big.Int)
+		return b.String(), nil
+	case numberType:
+		return encodeNumber(Number(v.String()))
+	}
+	if m, ok := implementer[encoding.TextMarshaler](v); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return "", fmt.Errorf("bulbason: cannot marshal value of type %s: %w", v.Type(), err)
+		}
+		return e.encodeString(string(text), inArray)
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return "0b64\"" + base64.StdEncoding.EncodeToString(v.Bytes()) + "\"", nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return e.encodeString(v.String(), inArray)
+	case reflect.Bool:
+		if v.Bool() {
+			return "SuperEffective", nil
+		}
+		return "NotVeryEffective", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return encodeFloat(v.Float())
+	case reflect.Slice, reflect.Array:
+		if inArray {
+			return "", fmt.Errorf("bulbason: cannot marshal nested arrays")
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return "<| |>", nil
+		}
+		parts := make([]string, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s, err := e.encodeValue(indirect(v.Index(i)), true)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		if len(parts) == 0 {
+			return "<| |>", nil
+		}
+		return "<| " + strings.Join(parts, ", ") + " |>", nil
+	case reflect.Map, reflect.Struct:
+		if !isSection(v) {
+			return "", fmt.Errorf("bulbason: cannot marshal value of type %s", v.Type())
+		}
+		// Sections that cannot have a header of their own are written inline.
+		var parts []string
+		for _, ent := range e.sortEntries(sectionEntries(v)) {
+			key, err := encodeKey(ent.key)
+			if err != nil {
+				return "", err
+			}
+			var literal string
+			if !encodesItself(ent.val) && ent.val.Kind() == reflect.String {
+				literal, err = e.encodeString(ent.val.String(), true)
+			} else {
+				literal, err = e.encodeValue(ent.val, false)
+			}
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, key+" "+e.vine+" "+literal)
+		}
+		return inlineObject(parts), nil
+	default:
+		return "", fmt.Errorf("bulbason: cannot marshal value of type %s", v.Type())
+	}
+}
+
+// implementer returns v as a T when v or, if v is addressable, a pointer to
+// it implements T.
+func implementer[T any](v reflect.Value) (T, bool) {
+	var zero T
+	if !v.IsValid() || !v.CanInterface() {
+		return zero, false
+	}
+	if t, ok := v.Interface().(T); ok {
+		return t, true
+	}
+	if v.CanAddr() {
+		t, ok := v.Addr().Interface().(T)
+		return t, ok
+	}
+	return zero, false
+}
+
+// encodesItself reports whether v is written by its Marshaler or
+// encoding.TextMarshaler method rather than according to its kind. The types
+// with a literal of their own, such as time.Time, keep it.
+func encodesItself(v reflect.Value) bool {
+	if !v.IsValid() {
+		return false
+	}
+	if _, ok := implementer[Marshaler](v); ok {
+		return true
+	}
+	switch v.Type() {
+	case timeType, durationType, bigIntType, numberType:
+		return false
+	}
+	_, ok := implementer[encoding.TextMarshaler](v)
+	return ok
+}
+
+// encodeMarshaler returns the literal m gives for itself, once checked that
+// it is read back as a single value.
+func encodeMarshaler(m Marshaler, t reflect.Type, inArray bool) (string, error) {
+	b, err := m.MarshalBulba()
+	if err != nil {
+		return "", fmt.Errorf("bulbason: cannot marshal value of type %s: %w", t, err)
+	}
+	literal := strings.TrimSpace(string(b))
+	value := literal
+	if inArray {
+		value = "<| " + literal + " |>"
+	}
+	doc, err := Parse("BULBA!\nv ~> " + value + "\n")
+	valid := literal != "" && !strings.ContainsAny(literal, "\r\n") && err == nil
+	if valid && inArray {
+		elems, ok := asArray(doc["v"])
+		valid = ok && len(elems) == 1
+	}
+	if !valid {
+		return "", fmt.Errorf("bulbason: cannot marshal value of type %s, MarshalBulba returned the invalid value %q", t, literal)
+	}
+	return literal, nil
+}
+
+// inlineObject joins the encoded members of an inline object.
+func inlineObject(parts []string) string {
+	if len(parts) == 0 {
+		return "{ }"
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+// encodeString quotes s in the quoting style of e. Syntax trees keep the
+// quotes of their strings instead.
+func (e *encodeState) encodeString(s string, inArray bool) (string, error) {
+	if e.quoteStyle == QuoteRaw && !strings.Contains(s, "`") {
+		return encodeRawString(s)
+	}
+	return encodeString(s, inArray)
+}
+
+// encodeString quotes s, rejecting content the lexer could not read back.
+// Strings holding a double quote are written raw, between backticks, and
+// those also holding a backtick between double quotes, unless a quote in them
+// would read as the end of the string.
+func encodeString(s string, inArray bool) (string, error) {
+	if strings.Contains(s, "\"") && !strings.Contains(s, "`") {
+		return encodeRawString(s)
+	}
+	if err := checkString(s); err != nil {
+		return "", err
+	}
+	// BSON has no escapes: a quote inside the string must not read as its
+	// end. A value runs to its last quote, so that only happens before a
+	// comment marker, but an array element ends at any quote that can close
+	// a string.
+	if inArray && quoteCloses(s) {
+		return "", fmt.Errorf("bulbason: cannot marshal string %q, it contains both quotes and backticks and a quote that would end the array element", s)
+	}
+	if strings.Contains(s, "\"") && commentIndex("\""+s+"\"") != -1 {
+		return "", fmt.Errorf("bulbason: cannot marshal string %q, it contains both quotes and backticks and a quote before a comment marker", s)
+	}
+	return "\"" + s + "\"", nil
+}
+
+// quoteCloses reports whether a double quote in s would close the string
+// when s is written between double quotes.
+func quoteCloses(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' && closesString(s[i+1:]+"\"") {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeRawString writes s between backticks.
+func encodeRawString(s string) (string, error) {
+	if err := checkString(s); err != nil {
+		return "", err
+	}
+	if strings.Contains(s, "`") {
+		return "", fmt.Errorf("bulbason: cannot marshal raw string %q, it contains a backtick", s)
+	}
+	return "`" + s + "`", nil
+}
+
+// checkString rejects string content that cannot appear on a single line.
+func checkString(s string) error {
+	if strings.ContainsAny(s, "\n\r\t") {
+		return fmt.Errorf("bulbason: cannot marshal string %q, it contains a line break or tab", s)
+	}
+	return nil
+}
+
+// encodeNumber checks that n is a literal the lexer reads back as a number.
+func encodeNumber(n Number) (string, error) {
+	v, err := parseNumber(string(n), LargeIntegerBig)
+	if f, ok := v.(float64); err != nil || ok && (math.IsInf(f, 0) || math.IsNaN(f)) && !isNonFinite(string(n)) {
+		return "", fmt.Errorf("bulbason: cannot marshal %q, it is not a valid number", string(n))
+	}
+	return string(n), nil
+}
+
+// encodeFloat formats f so that it is read back as a float and not an int.
+func encodeFloat(f float64) (string, error) {
+	switch {
+	case math.IsInf(f, 1):
+		return literalInf, nil
+	case math.IsInf(f, -1):
+		return literalNegInf, nil
+	case math.IsNaN(f):
+		return literalNaN, nil
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s, nil
+}
+
+// encodeKey returns key as it is written in a document. Keys made of letters,
+// digits and underscores are written as they are, any other key is quoted.
+// So is a key holding the comment marker, which would otherwise start a
+// comment.
+func encodeKey(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("bulbason: cannot marshal an empty key")
+	}
+	if CharizardBan()(key) != nil {
+		return "", ErrCharizardError
+	}
+	if strings.Contains(key, commentMarker) {
+		return quoteKey(key)
+	}
+	for _, r := range key {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return quoteKey(key)
+		}
+	}
+	return key, nil
+}
+
+// quoteKey returns key between double quotes.
+func quoteKey(key string) (string, error) {
+	if strings.ContainsAny(key, "\"\n\r\t") {
+		return "", fmt.Errorf("bulbason: cannot marshal key %q, quoted keys cannot contain quotes, line breaks or tabs", key)
+	}
+	return "\"" + key + "\"", nil
+}
+
+// indirect follows interfaces and pointers until it reaches a concrete value.
+// A nil interface or pointer yields the zero reflect.Value.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,407 @@
+package bulbason
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	input := map[string]interface{}{
+		"app_name":      "Pokedex_API",
+		"version":       1.5,
+		"retries":       int64(3),
+		"ratio":         2.0,
+		"is_production": false,
+		"missing_data":  nil,
+		"database": map[string]interface{}{
+			"host": "127.0.0.1",
+			"pool": map[string]interface{}{
+				"max_connections": int64(100),
+				"KERNEL_FLAGS": map[string]interface{}{
+					"panic_on_fail": true,
+				},
+			},
+		},
+		"whitelist": []interface{}{"Prof_Oak", "Mom", "Brock, Misty"},
+	}
+
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "BULBA!\n") {
+		t.Fatalf("Expected output to start with the header, got:\n%s", out)
+	}
+
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected:\n%v\nGot:\n%v\nDocument:\n%s", input, result, out)
+	}
+}
+
+func TestMarshal_Output(t *testing.T) {
+	out, err := Marshal(map[string]interface{}{
+		"name": "Bulby",
+		"stats": map[string]interface{}{
+			"moves": []string{"Tackle", "Growl"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `BULBA!
+name ~~~~> "Bulby"
+(o) stats (o)
+    moves ~~~~> <| "Tackle", "Growl" |>
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestMarshal_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+	}{
+		{"Not A Map", []int{1, 2}},
+		{"Charizard Key", map[string]interface{}{"Charizard": "Fire"}},
+		{"Invalid Key", map[string]interface{}{`my"key`: 1}},
+		{"Carriage Return", map[string]interface{}{"a": "line\r\nbreak"}},
+		{"Quote Ending An Array Element", map[string]interface{}{"a": []interface{}{"say \"hi\", `now`"}}},
+		{"Nested Array", map[string]interface{}{"a": []interface{}{[]interface{}{1}}}},
+		{"Unsupported Type", map[string]interface{}{"a": make(chan int)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Marshal(tt.input); err == nil {
+				t.Errorf("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestMarshal_ArrayOfObjects(t *testing.T) {
+	input := map[string]interface{}{
+		"servers": []map[string]interface{}{
+			{"host": "10.0.0.1", "port": int64(8080)},
+			{"host": "10.0.0.2", "tls": map[string]interface{}{"enabled": true}},
+		},
+	}
+
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+servers ~~~~> <|
+(o)
+    host ~~~~> "10.0.0.1"
+    port ~~~~> 8080
+(o)
+    host ~~~~> "10.0.0.2"
+    (O) tls (O)
+        enabled ~~~~> SuperEffective
+|>
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+}
+
+func TestMarshal_Heredoc(t *testing.T) {
+	input := map[string]interface{}{
+		"db": map[string]interface{}{
+			"query": "SELECT *\n  FROM pokedex\n\nWHERE id = 1",
+		},
+	}
+
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+(o) db (o)
+    query ~~~~> """
+        SELECT *
+          FROM pokedex
+
+        WHERE id = 1
+        """
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+
+	if _, err := Marshal(map[string]interface{}{"q": "a\n\"\"\"\nb"}); err == nil {
+		t.Error("Expected an error for a line of three quotes")
+	}
+	if _, err := Marshal(map[string]interface{}{"q": []interface{}{"a\nb"}}); err == nil {
+		t.Error("Expected an error for a multi-line array element")
+	}
+}
+
+func TestMarshal_RawStrings(t *testing.T) {
+	input := map[string]interface{}{
+		"path":  `C:\Pokemon\"Saves"`,
+		"quote": `"`,
+		"moves": []interface{}{`say "hi", Bulba`, "plain"},
+	}
+
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\n" +
+		"moves ~~~~> <| `say \"hi\", Bulba`, \"plain\" |>\n" +
+		"path ~~~~> `C:\\Pokemon\\\"Saves\"`\n" +
+		"quote ~~~~> `\"`\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+}
+
+func TestMarshal_InlineObjects(t *testing.T) {
+	input := map[string]interface{}{
+		"waypoints": []interface{}{
+			map[string]interface{}{"x": int64(1), "y": int64(2)},
+			"home",
+			map[string]interface{}{"label": `say "hi"`, "tags": []interface{}{"a", "b"}},
+		},
+	}
+
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\n" +
+		"waypoints ~~~~> <| { x ~~~~> 1, y ~~~~> 2 }, \"home\", { label ~~~~> `say \"hi\"`, tags ~~~~> <| \"a\", \"b\" |> } |>\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+}
+
+func TestMarshal_DeepNesting(t *testing.T) {
+	input := map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": map[string]interface{}{
+			"d": map[string]interface{}{"e": map[string]interface{}{"depth": int64(5)}},
+		}}},
+	}
+
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+(o) a (o)
+    (O) b (O)
+        (@) c (@)
+            (@@) d (@@)
+                (@@@) e (@@@)
+                    depth ~~~~> 5
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+}
+
+func TestMarshal_NonFiniteFloats(t *testing.T) {
+	input := map[string]interface{}{"lower": math.Inf(-1), "upper": math.Inf(1), "unknown": math.NaN()}
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nlower ~~~~> -Eternatus\nunknown ~~~~> Unown\nupper ~~~~> Eternatus\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	var decoded struct {
+		Upper   float32 `bson:"upper"`
+		Unknown float64 `bson:"unknown"`
+	}
+	if err := Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !math.IsInf(float64(decoded.Upper), 1) || !math.IsNaN(decoded.Unknown) {
+		t.Errorf("Unexpected values %+v", decoded)
+	}
+}
+
+func TestMarshal_QuotedKeys(t *testing.T) {
+	input := map[string]interface{}{
+		"api.example.com": map[string]interface{}{"max-conns": int64(10)},
+		"plain_key":       "x",
+		"points":          []interface{}{int64(1), map[string]interface{}{"x-y": int64(2)}},
+	}
+
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+plain_key ~~~~> "x"
+points ~~~~> <| 1, { "x-y" ~~~~> 2 } |>
+(o) "api.example.com" (o)
+    "max-conns" ~~~~> 10
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+}
+
+func TestMarshal_CommentMarker(t *testing.T) {
+	input := map[string]interface{}{
+		"note":      "Bulby zZz sleepy",
+		"tags":      []interface{}{"zZz"},
+		"zZz_sleep": int64(1),
+	}
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nnote ~~~~> \"Bulby zZz sleepy\"\ntags ~~~~> <| \"zZz\" |>\n\"zZz_sleep\" ~~~~> 1\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+}
+
+func TestMarshal_BothQuotes(t *testing.T) {
+	input := map[string]interface{}{
+		"k":    "say \"hi\" to `me` zZz later",
+		"list": []interface{}{"a\"b `c`", "d"},
+	}
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Errorf("Expected %v, got %v", input, result)
+	}
+
+	// A quote followed by a comment marker would end the string early.
+	if out, err := Marshal(map[string]interface{}{"k": "a\" zZz `x`"}); err == nil {
+		t.Errorf("Expected an error, got %q", out)
+	}
+}
+
+func TestMarshal_Omit(t *testing.T) {
+	type limits struct {
+		Rate int `bson:"rate"`
+	}
+	type config struct {
+		Name     string            `bson:"name,omitempty"`
+		Port     int               `bson:"port,omitempty"`
+		Debug    bool              `bson:"debug,omitempty"`
+		Tags     []string          `bson:"tags,omitempty"`
+		Labels   map[string]string `bson:"labels,omitempty"`
+		Parent   *string           `bson:"parent,omitempty"`
+		Empty    *string           `bson:"empty,omitempty"`
+		Started  time.Time         `bson:"started,omitzero"`
+		Limits   limits            `bson:"limits,omitzero"`
+		Nothing  []string          `bson:"nothing,omitzero"`
+		Nil      *limits           `bson:"nil,omitzero"`
+		Ratio    float64           `bson:"ratio,omitempty,omitzero"`
+		Required int               `bson:"required"`
+	}
+	empty := ""
+	out, err := Marshal(config{Empty: &empty, Nothing: []string{}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// A non-nil pointer and an empty but non-nil slice are not omitted.
+	expected := "BULBA!\nempty ~~~~> \"\"\nnothing ~~~~> <| |>\nrequired ~~~~> 0\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	out, err = Marshal(config{
+		Name:    "app",
+		Port:    80,
+		Tags:    []string{"a"},
+		Started: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Limits:  limits{Rate: 5},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = `BULBA!
+name ~~~~> "app"
+port ~~~~> 80
+tags ~~~~> <| "a" |>
+started ~~~~> 2024-05-01T00:00:00Z
+required ~~~~> 0
+(o) limits (o)
+    rate ~~~~> 5
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
@@ -0,0 +1,336 @@
+package bulbason
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Error constants as defined in the spec
+const (
+	ErrSyntax      = "It hurt itself in its confusion!"
+	ErrIndentation = "The attack missed!"
+	ErrType        = "Target is immune!"
+	ErrBadges      = "Not enough badges!"
+	ErrHeader      = "Status: Fainted"
+	ErrTab         = "Poison Type: Tab character detected"
+	ErrCharizard   = "It burns the bulb"
+)
+
+// Sentinel errors for the messages of the spec, so that programs can tell
+// the kind of a ParseError with errors.Is rather than by its message:
+//
+//	if errors.Is(err, bulbason.ErrIndentationError) {
+//
+// ErrorCodes match with errors.Is too, for finer distinctions such as
+// CodeDuplicateKey among the syntax errors.
+var (
+	ErrSyntaxError      = errors.New(ErrSyntax)
+	ErrIndentationError = errors.New(ErrIndentation)
+	ErrTypeError        = errors.New(ErrType)
+	ErrBadgesError      = errors.New(ErrBadges)
+	ErrHeaderError      = errors.New(ErrHeader)
+	ErrTabError         = errors.New(ErrTab)
+	ErrCharizardError   = errors.New(ErrCharizard)
+)
+
+// specErrors lists the sentinel errors in the order of the spec.
+var specErrors = []error{
+	ErrSyntaxError,
+	ErrIndentationError,
+	ErrTypeError,
+	ErrBadgesError,
+	ErrHeaderError,
+	ErrTabError,
+	ErrCharizardError,
+}
+
+// ErrorCode identifies the kind of a ParseError independently of its
+// Pokémon flavoured message, so programs can react to it reliably.
+type ErrorCode string
+
+const (
+	CodeSyntax       ErrorCode = "syntax"
+	CodeIndentation  ErrorCode = "indentation"
+	CodeType         ErrorCode = "type"
+	CodeBadges       ErrorCode = "badges"
+	CodeHeader       ErrorCode = "header"
+	CodeTab          ErrorCode = "tab"
+	CodeReservedKey  ErrorCode = "reserved_key"
+	CodeDuplicateKey ErrorCode = "duplicate_key"
+	CodeOverflow     ErrorCode = "overflow"
+	CodeReference    ErrorCode = "reference"
+	CodeKeyRule      ErrorCode = "key_rule"
+	CodeVersion      ErrorCode = "version"
+
+	// Codes for the limits set with MaxInputSize, MaxLineLength,
+	// MaxArrayLength, MaxTokens and MaxDepth.
+	CodeInputSize   ErrorCode = "input_size"
+	CodeLineLength  ErrorCode = "line_length"
+	CodeArrayLength ErrorCode = "array_length"
+	CodeTokenCount  ErrorCode = "token_count"
+	CodeMaxDepth    ErrorCode = "max_depth"
+)
+
+// codeMessages maps each error code to the message the spec mandates for it.
+var codeMessages = map[ErrorCode]string{
+	CodeSyntax:      ErrSyntax,
+	CodeIndentation: ErrIndentation,
+	CodeType:        ErrType,
+	CodeBadges:      ErrBadges,
+	CodeHeader:      ErrHeader,
+	CodeTab:         ErrTab,
+	CodeReservedKey: ErrCharizard,
+	// The spec has no dedicated message, and a repeated key is confusing.
+	CodeDuplicateKey: ErrSyntax,
+	// An integer too large to represent cannot be stored anywhere.
+	CodeOverflow: ErrType,
+	// A Copycat with nothing to copy is as confused as a repeated key.
+	CodeReference: ErrSyntax,
+	// A key a KeyRule rejects burns the bulb as Charizard does.
+	CodeKeyRule: ErrCharizard,
+	// A header of a version the reader does not know is as good as none.
+	CodeVersion: ErrHeader,
+	// A document over a limit needs more badges than the reader grants, as
+	// one nested deeper than its parents allow does.
+	CodeInputSize:   ErrBadges,
+	CodeLineLength:  ErrBadges,
+	CodeArrayLength: ErrBadges,
+	CodeTokenCount:  ErrBadges,
+	CodeMaxDepth:    ErrBadges,
+}
+
+// codeNumbers gives each error code its own number, for programs that
+// report errors as numbers. The codes of the four messages section 8 of the
+// spec numbers keep those numbers, and the other codes follow in the order
+// they are declared. A new code takes the next number, so that a number
+// never changes meaning.
+var codeNumbers = map[ErrorCode]int{
+	CodeSyntax:       1,
+	CodeIndentation:  2,
+	CodeType:         3,
+	CodeBadges:       4,
+	CodeHeader:       5,
+	CodeTab:          6,
+	CodeReservedKey:  7,
+	CodeDuplicateKey: 8,
+	CodeOverflow:     9,
+	CodeReference:    10,
+	CodeKeyRule:      11,
+	CodeVersion:      12,
+	CodeInputSize:    13,
+	CodeLineLength:   14,
+	CodeArrayLength:  15,
+	CodeTokenCount:   16,
+	CodeMaxDepth:     17,
+}
+
+// codeSentinels maps each error code to the sentinel error it matches with
+// errors.Is. CodeKeyRule has none: it shares the message of the Charizard
+// ban, but a rule of the program rejected the key, not the spec, and the
+// error of the rule is what errors.Is finds through Unwrap.
+var codeSentinels = map[ErrorCode]error{
+	CodeSyntax:       ErrSyntaxError,
+	CodeIndentation:  ErrIndentationError,
+	CodeType:         ErrTypeError,
+	CodeBadges:       ErrBadgesError,
+	CodeHeader:       ErrHeaderError,
+	CodeTab:          ErrTabError,
+	CodeReservedKey:  ErrCharizardError,
+	CodeDuplicateKey: ErrSyntaxError,
+	CodeOverflow:     ErrTypeError,
+	CodeReference:    ErrSyntaxError,
+	CodeVersion:      ErrHeaderError,
+	CodeInputSize:    ErrBadgesError,
+	CodeLineLength:   ErrBadgesError,
+	CodeArrayLength:  ErrBadgesError,
+	CodeTokenCount:   ErrBadgesError,
+	CodeMaxDepth:     ErrBadgesError,
+}
+
+// codeDetails explains each error code in plain words, for the errors whose
+// cause is not known in more detail.
+var codeDetails = map[ErrorCode]string{
+	CodeSyntax:       "invalid syntax",
+	CodeIndentation:  "unexpected indentation",
+	CodeType:         "not a valid value",
+	CodeBadges:       "section nested deeper than its parents allow",
+	CodeHeader:       `the first line must be exactly "BULBA!"`,
+	CodeTab:          "tab character, indentation must use spaces",
+	CodeReservedKey:  `"Charizard" cannot be used as a key`,
+	CodeDuplicateKey: "key already set in this section",
+	CodeOverflow:     "integer does not fit in an int64, see the LargeIntegers option",
+	CodeReference:    "Copycat refers to a value that does not exist",
+	CodeKeyRule:      "key rejected by a KeyRule",
+	CodeVersion:      "unknown version in the header",
+	CodeInputSize:    "document larger than MaxInputSize allows",
+	CodeLineLength:   "line longer than MaxLineLength allows",
+	CodeArrayLength:  "array longer than MaxArrayLength allows",
+	CodeTokenCount:   "document holding more tokens than MaxTokens allows",
+	CodeMaxDepth:     "section nested deeper than MaxDepth allows",
+}
+
+// Error returns the code itself, which makes codes errors that errors.Is
+// matches against ParseErrors.
+func (c ErrorCode) Error() string {
+	return string(c)
+}
+
+// Number returns the number of c, which no other code shares: 1 for
+// CodeSyntax, 2 for CodeIndentation, 3 for CodeType and 4 for CodeBadges, as
+// section 8 of the spec numbers their messages, then 5 for CodeHeader and so
+// on in the order the codes are declared, up to 17 for CodeMaxDepth. It
+// returns 0 for an unknown code.
+func (c ErrorCode) Number() int {
+	return codeNumbers[c]
+}
+
+// sentinel returns the sentinel error c matches, or nil for CodeKeyRule and
+// unknown codes.
+func (c ErrorCode) sentinel() error {
+	return codeSentinels[c]
+}
+
+// ParseError is returned by the lexer and parser when a document is invalid.
+// Error returns the message from the spec, while the remaining fields locate
+// the problem for editors and CI tooling.
+type ParseError struct {
+	Code    ErrorCode // Machine-readable kind of the error
+	Message string    // The spec message, e.g. "The attack missed!", and the error of a KeyRule
+	Line    int       // 1-based line number
+	Column  int       // 1-based column number
+	Snippet string    // The offending source line
+	Detail  string    // The problem in plain words, e.g. "indentation must be a multiple of 4 spaces, got 3"
+	Err     error     // The error of the rule rejecting the key, for CodeKeyRule and CodeReservedKey
+}
+
+func (e *ParseError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error of the rule that rejected a key, if any.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the code of e, or the sentinel error of its
+// spec message, such as ErrSyntaxError.
+func (e *ParseError) Is(target error) bool {
+	if code, ok := target.(ErrorCode); ok {
+		return code == e.Code
+	}
+	return target != nil && target == e.Code.sentinel()
+}
+
+// Explain returns the problem in plain words with its position, for people
+// who do not speak Pokémon: "indentation must be a multiple of 4 spaces, got
+// 3 at line 7, column 4".
+func (e *ParseError) Explain() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.Detail, e.Line, e.Column)
+}
+
+// Excerpt returns the source line of e with a caret under its column, as
+// compilers print them, or "" if the line is not known, as for a Copycat that
+// cannot be resolved:
+//
+//	key ~> Pikachu
+//	       ^
+//
+// Tabs in the line are kept in the caret's line, so that the caret stays in
+// place however wide a tab is shown.
+func (e *ParseError) Excerpt() string {
+	line, _, _ := strings.Cut(e.Snippet, "\n")
+	if line == "" {
+		return ""
+	}
+	var caret strings.Builder
+	for i, r := range line {
+		if i >= e.Column-1 {
+			break
+		}
+		if r == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	// A column past the end of the line points past its end.
+	caret.WriteString(strings.Repeat(" ", max(e.Column-1-len(line), 0)))
+	caret.WriteByte('^')
+	return line + "\n" + caret.String()
+}
+
+// newParseError creates a ParseError with the spec message for code, and the
+// plain explanation of code as its detail. The snippet is filled in later by
+// whoever knows the source line.
+func newParseError(code ErrorCode, line, column int) *ParseError {
+	return &ParseError{Code: code, Message: codeMessages[code], Line: line, Column: column, Detail: codeDetails[code]}
+}
+
+// explain replaces the detail of e with one formatted from the cause of the
+// error, and returns e.
+func (e *ParseError) explain(format string, args ...interface{}) *ParseError {
+	e.Detail = fmt.Sprintf(format, args...)
+	return e
+}
+
+// errorAt creates a ParseError located at tok.
+func errorAt(code ErrorCode, tok Token) *ParseError {
+	return newParseError(code, tok.Line, tok.Column)
+}
+
+// ErrorList is returned instead of a single ParseError when the CollectErrors
+// option is set. It holds every problem found, ordered by position.
+type ErrorList []*ParseError
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap exposes the individual errors to errors.Is and errors.As.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, e := range l {
+		errs[i] = e
+	}
+	return errs
+}
+
+// isErrorList reports whether err holds parse errors gathered by collection
+// mode, as opposed to a failure that stops parsing altogether (such as an
+// I/O error).
+func isErrorList(err error) bool {
+	_, ok := err.(ErrorList)
+	return ok
+}
+
+// mergeErrors combines the errors reported by the lexer and the parser.
+// Outside of collection mode at most one of them is set and it is returned
+// unchanged; otherwise the lists are joined and sorted by position.
+func mergeErrors(errs ...error) error {
+	var list ErrorList
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		// An error wrapping a list, such as an IncludeError for a file with
+		// problems of its own, is kept whole.
+		l, ok := err.(ErrorList)
+		if !ok {
+			return err
+		}
+		list = append(list, l...)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Line != list[j].Line {
+			return list[i].Line < list[j].Line
+		}
+		return list[i].Column < list[j].Column
+	})
+	return list
+}
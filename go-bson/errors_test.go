@@ -0,0 +1,299 @@
+package bulbason
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseError_Position(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		code    ErrorCode
+		line    int
+		column  int
+		snippet string
+	}{
+		{
+			name:    "Invalid Header",
+			input:   "NOT_BULBA!\nkey ~> \"value\"",
+			code:    CodeHeader,
+			line:    1,
+			column:  1,
+			snippet: "NOT_BULBA!",
+		},
+		{
+			name:    "Tab Character",
+			input:   "BULBA!\nkey ~>\t\"value\"",
+			code:    CodeTab,
+			line:    2,
+			column:  7,
+			snippet: "key ~>\t\"value\"",
+		},
+		{
+			name:    "Bad Indentation",
+			input:   "BULBA!\nok ~> 1\n   key ~> \"value\"",
+			code:    CodeIndentation,
+			line:    3,
+			column:  4,
+			snippet: "   key ~> \"value\"",
+		},
+		{
+			name:    "Invalid Type",
+			input:   "BULBA!\n(o) s (o)\n    key ~~> UnknownType",
+			code:    CodeType,
+			line:    3,
+			column:  13,
+			snippet: "    key ~~> UnknownType",
+		},
+		{
+			name:    "Invalid Array Element",
+			input:   "BULBA!\nkey ~> <| 1, Nope |>",
+			code:    CodeType,
+			line:    2,
+			column:  14,
+			snippet: "key ~> <| 1, Nope |>",
+		},
+		{
+			name:    "Charizard Key",
+			input:   "BULBA!\n(o) s (o)\n    Charizard ~> \"Fire\"",
+			code:    CodeReservedKey,
+			line:    3,
+			column:  5,
+			snippet: "    Charizard ~> \"Fire\"",
+		},
+		{
+			name:    "Deep Nesting Violation",
+			input:   "BULBA!\n(o) level1 (o)\n        (@) level3 (@)",
+			code:    CodeBadges,
+			line:    3,
+			column:  9,
+			snippet: "        (@) level3 (@)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a *ParseError, got %v", err)
+			}
+			if pe.Code != tt.code || pe.Line != tt.line || pe.Column != tt.column || pe.Snippet != tt.snippet {
+				t.Errorf("Expected %s at %d:%d in %q, got %s at %d:%d in %q",
+					tt.code, tt.line, tt.column, tt.snippet, pe.Code, pe.Line, pe.Column, pe.Snippet)
+			}
+			if pe.Error() != codeMessages[tt.code] {
+				t.Errorf("Expected message %q, got %q", codeMessages[tt.code], pe.Error())
+			}
+		})
+	}
+}
+
+func TestParse_CollectErrors(t *testing.T) {
+	input := `BULBA!
+good ~> 1
+   bad_indent ~> 2
+also_good ~> "yes"
+bad_type ~> Pikachu
+	tabbed ~> 3
+(o) section (o)
+    ok ~> SuperEffective
+        too_deep ~> 4
+`
+	_, err := Parse(input, CollectErrors())
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("Expected an ErrorList, got %v", err)
+	}
+
+	expected := []struct {
+		code ErrorCode
+		line int
+	}{
+		{CodeIndentation, 3},
+		{CodeType, 5},
+		{CodeTab, 6},
+		{CodeIndentation, 9},
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(list), list)
+	}
+	for i, e := range expected {
+		if list[i].Code != e.code || list[i].Line != e.line {
+			t.Errorf("Error %d: expected %s on line %d, got %s on line %d", i, e.code, e.line, list[i].Code, list[i].Line)
+		}
+	}
+
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe != list[0] {
+		t.Errorf("Expected errors.As to find the first ParseError")
+	}
+}
+
+func TestParse_CollectErrorsValid(t *testing.T) {
+	result, err := Parse("BULBA!\nkey ~> 1\n", CollectErrors())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result["key"] != int64(1) {
+		t.Errorf("Expected key to be 1, got %v", result["key"])
+	}
+}
+
+func TestParseError_Is(t *testing.T) {
+	tests := []struct {
+		input    string
+		sentinel error
+		code     ErrorCode
+		number   int
+	}{
+		{"BULBA!\njustakey\n", ErrSyntaxError, CodeSyntax, 1},
+		{"BULBA!\nk ~> 1\nk ~> 2\n", ErrSyntaxError, CodeDuplicateKey, 8},
+		{"BULBA!\n   key ~> 1\n", ErrIndentationError, CodeIndentation, 2},
+		{"BULBA!\nkey ~> Pikachu\n", ErrTypeError, CodeType, 3},
+		{"BULBA!\n(o) s (o)\n        (@) deep (@)\n", ErrBadgesError, CodeBadges, 4},
+		{"BULBA\n", ErrHeaderError, CodeHeader, 5},
+		{"BULBA!\nkey ~>\t1\n", ErrTabError, CodeTab, 6},
+		{"BULBA!\nCharizard ~> 1\n", ErrCharizardError, CodeReservedKey, 7},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input, DuplicateKeys(DuplicateError))
+		if !errors.Is(err, tt.sentinel) || !errors.Is(err, tt.code) {
+			t.Errorf("%q: expected %v and %s, got %v", tt.input, tt.sentinel, tt.code, err)
+		}
+		if n := tt.code.Number(); n != tt.number {
+			t.Errorf("%s: expected number %d, got %d", tt.code, tt.number, n)
+		}
+		for _, other := range specErrors {
+			if other != tt.sentinel && errors.Is(err, other) {
+				t.Errorf("%q: unexpected match of %v", tt.input, other)
+			}
+		}
+	}
+	if n := ErrorCode("unknown").Number(); n != 0 {
+		t.Errorf("Expected 0 for an unknown code, got %d", n)
+	}
+
+	// Every code has a number of its own, and the sentinel of its message.
+	seen := map[int]ErrorCode{}
+	for code, msg := range codeMessages {
+		n := code.Number()
+		if other, ok := seen[n]; n == 0 || ok {
+			t.Errorf("%s: expected a number of its own, got %d, as %s", code, n, other)
+		}
+		seen[n] = code
+		if sentinel := code.sentinel(); code != CodeKeyRule && (sentinel == nil || sentinel.Error() != msg) {
+			t.Errorf("%s: expected the sentinel of %q, got %v", code, msg, sentinel)
+		}
+	}
+
+	// A key a KeyRule rejects matches the error of the rule, not the
+	// Charizard ban.
+	errAdmin := errors.New("admin is reserved")
+	rule := func(key string) error {
+		if key == "admin" {
+			return errAdmin
+		}
+		return nil
+	}
+	_, err := Parse("BULBA!\nadmin ~> 1\n", KeyRules(rule))
+	if !errors.Is(err, CodeKeyRule) || !errors.Is(err, errAdmin) || errors.Is(err, ErrCharizardError) {
+		t.Errorf("Expected the error of the KeyRule only, got %v", err)
+	}
+
+	// Matching sees through lists, and through the errors wrapping them.
+	_, err = Parse("BULBA!\n   a ~> 1\nb ~> Pikachu\n", CollectErrors())
+	if !errors.Is(err, ErrIndentationError) || !errors.Is(err, ErrTypeError) || errors.Is(err, ErrTabError) {
+		t.Errorf("Expected the errors of the list to match, got %v", err)
+	}
+	if wrapped := fmt.Errorf("loading config: %w", err); !errors.Is(wrapped, CodeType) {
+		t.Errorf("Expected a wrapped list to match, got %v", wrapped)
+	}
+
+	var v struct{ N int }
+	if err := Unmarshal([]byte("BULBA!\nN ~> \"x\"\n"), &v); !errors.Is(err, ErrTypeError) {
+		t.Errorf("Expected a decoding error to match ErrTypeError, got %v", err)
+	}
+	if _, err := Marshal(map[string]int{"Charizard": 1}); !errors.Is(err, ErrCharizardError) {
+		t.Errorf("Expected a marshaling error to match ErrCharizardError, got %v", err)
+	}
+}
+
+func TestParseError_Detail(t *testing.T) {
+	tests := []struct {
+		input  string
+		opts   []ParseOption
+		detail string
+	}{
+		{"BULBA!\n(o) s (o)\n   key ~> 1\n", nil, "indentation must be a multiple of 4 spaces, got 3"},
+		{"BULBA!\n   key ~> 1\n", []ParseOption{IndentWidth(2)}, "indentation must be a multiple of 2 spaces, got 3"},
+		{"BULBA!\nkey ~> 1\n    other ~> 2\n", nil, "key indented by 4 spaces, but its section only allows 0"},
+		{"BULBA!\n    (o) s (o)\n", nil, "a (o) section must be indented by 0 spaces, got 4"},
+		{"BULBA!\n(o) s (o)\n        (@) deep (@)\n", nil, "a (@) section must be inside a (O) section"},
+		{"BULBA!\nkey ~> yes\n", nil, `"yes" is not a value; strings need quotes, booleans are SuperEffective and NotVeryEffective, and null is MissingNo`},
+		{"BULBA!\nk ~> 1\nk ~> 2\n", []ParseOption{DuplicateKeys(DuplicateError)}, `key "k" already set in this section`},
+		{"BULBA!\nk ~> Copycat nowhere\n", nil, "Copycat nowhere refers to a value that does not exist"},
+		{"BULBA!\nkey ~> 99999999999999999999\n", nil, "integer 99999999999999999999 does not fit in an int64, see the LargeIntegers option"},
+		{"BULBA!v3\n", nil, "version 3 of the format is not known, see the Versions option"},
+		{"BULBA\n", nil, `the first line must be exactly "BULBA!"`},
+		{"BULBA!\nkey ~> \"\"\"\ntext\n", nil, `heredoc never closed with """`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input, tt.opts...)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%q: expected a ParseError, got %v", tt.input, err)
+			continue
+		}
+		if pe.Detail != tt.detail {
+			t.Errorf("%q: expected detail %q, got %q", tt.input, tt.detail, pe.Detail)
+		}
+		if pe.Error() != codeMessages[pe.Code] {
+			t.Errorf("%q: expected the spec message, got %q", tt.input, pe.Error())
+		}
+	}
+
+	for code := range codeMessages {
+		if codeDetails[code] == "" {
+			t.Errorf("Expected an explanation of %s", code)
+		}
+	}
+
+	_, err := Parse("BULBA!\n(o) s (o)\n   key ~> 1\n")
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Explain() != "indentation must be a multiple of 4 spaces, got 3 at line 3, column 4" {
+		t.Errorf("Unexpected explanation of %v", err)
+	}
+}
+
+func TestParseError_Excerpt(t *testing.T) {
+	tests := []struct {
+		input   string
+		excerpt string
+	}{
+		{"BULBA!\nkey ~> Pikachu\n", "key ~> Pikachu\n       ^"},
+		{"BULBA!\n(o) s (o)\n   key ~> 1\n", "   key ~> 1\n   ^"},
+		{"BULBA!\nname ~> \"é\" 3\n", "name ~> \"é\" 3\n        ^"},
+		{"BULBA!\nk ~>\t1\n", "k ~>\t1\n    ^"},
+		{"NOPE\n", "NOPE\n^"},
+		{"BULBA!\nk ~> Copycat nowhere\n", ""},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%q: expected a ParseError, got %v", tt.input, err)
+			continue
+		}
+		if got := pe.Excerpt(); got != tt.excerpt {
+			t.Errorf("%q: expected excerpt:\n%s\ngot:\n%s", tt.input, tt.excerpt, got)
+		}
+	}
+
+	pe := &ParseError{Snippet: "key ~>", Column: 8}
+	if got, want := pe.Excerpt(), "key ~>\n       ^"; got != want {
+		t.Errorf("Expected a caret past the end of the line, got:\n%s", got)
+	}
+}
@@ -0,0 +1,258 @@
+package bulbason
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// field describes how a single struct field maps onto a document key.
+type field struct {
+	name   string // Key used in the document
+	index  []int  // Path to the field through flattened structs, as for FieldByIndex
+	remain bool   // The field holds the keys no other field matches
+	tagged bool   // The key comes from the tag
+
+	omitEmpty bool // Marshal skips the field when it is empty
+	omitZero  bool // Marshal skips the field when it is its zero value
+
+	required   bool   // Unmarshal fails when the key is missing or MissingNo
+	def        string // Literal decoded when the key is missing
+	hasDefault bool
+	rules      *fieldRules // Validation options, nil without any
+}
+
+// typeFields returns the fields of struct type t that take part in encoding
+// and decoding.
+//
+// The key for a field comes from its `bson` tag, falling back to the Go field
+// name. A tag of "-" excludes the field, as do unexported fields. A field
+// tagged with the remain option, as in `bson:",remain"`, has no key of its
+// own: it is a map holding the keys of the section that no other field
+// matches.
+//
+// The fields of embedded structs without a key in their tag, and of struct
+// fields tagged with the inline or squash option, are flattened into t, as
+// if they were declared in its place. As Go does for promoted fields, when
+// several fields have the same key the least deeply flattened ones win, and
+// of those the ones with a tag, if any. The others are dropped.
+//
+// The fields of each type are worked out once and cached, so callers must
+// not modify the returned slice.
+func typeFields(t reflect.Type) []field {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]field)
+	}
+	fields, _ := fieldCache.LoadOrStore(t, computeFields(t))
+	return fields.([]field)
+}
+
+// fieldCache maps struct types to their fields, as []field.
+var fieldCache sync.Map
+
+// computeFields does the work of typeFields, without the cache.
+func computeFields(t reflect.Type) []field {
+	fields := collectFields(t, nil, map[reflect.Type]bool{})
+	byName := make(map[string][]field)
+	for _, f := range fields {
+		if !f.remain {
+			byName[f.name] = append(byName[f.name], f)
+		}
+	}
+	dominant := fields[:0]
+	for _, f := range fields {
+		if f.remain || isDominant(f, byName[f.name]) {
+			dominant = append(dominant, f)
+		}
+	}
+	return dominant
+}
+
+// collectFields lists the fields of struct type t, which is found at index
+// within the struct being described. visiting holds the structs being
+// flattened, to stop at recursive embedding.
+func collectFields(t reflect.Type, index []int, visiting map[reflect.Type]bool) []field {
+	if visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+		fieldIndex := append(slices.Clone(index), i)
+		name, _ := parseTag(tag)
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		flatten := sf.Anonymous && name == "" || hasTagOption(tag, "inline") || hasTagOption(tag, "squash")
+		if flatten && isStructType(ft) {
+			// A nil pointer to an unexported struct cannot be allocated.
+			if sf.IsExported() || sf.Type.Kind() != reflect.Ptr {
+				fields = append(fields, collectFields(ft, fieldIndex, visiting)...)
+			}
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+		if hasTagOption(tag, "remain") {
+			fields = append(fields, field{index: fieldIndex, remain: true})
+			continue
+		}
+		f := field{
+			name:      name,
+			index:     fieldIndex,
+			tagged:    name != "",
+			omitEmpty: hasTagOption(tag, "omitempty"),
+			omitZero:  hasTagOption(tag, "omitzero"),
+			required:  hasTagOption(tag, "required"),
+		}
+		f.def, f.hasDefault = tagValue(tag, "default")
+		f.rules = parseRules(tag)
+		if name == "" {
+			f.name = sf.Name
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// omitted reports whether Marshal skips the field f, whose value is v.
+//
+// With the omitempty option, false, 0, "", nil pointers and interfaces, and
+// empty slices, arrays and maps are skipped. With omitzero, zero values are
+// skipped, according to their IsZero method if they have one, as for
+// time.Time.
+func (f field) omitted(v reflect.Value) bool {
+	if f.omitZero && isZero(v) {
+		return true
+	}
+	if f.omitEmpty {
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+			return v.Len() == 0
+		case reflect.Ptr, reflect.Interface:
+			return v.IsNil()
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64:
+			return v.IsZero()
+		}
+	}
+	return false
+}
+
+// isZero reports whether v is a nil pointer or interface, or a zero value
+// according to its IsZero method or, without one, to reflect.
+func isZero(v reflect.Value) bool {
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return true
+	}
+	if z, ok := implementer[interface{ IsZero() bool }](v); ok {
+		return z.IsZero()
+	}
+	return v.IsZero()
+}
+
+// isDominant reports whether f wins over the other fields with its key.
+func isDominant(f field, rivals []field) bool {
+	for _, r := range rivals {
+		switch {
+		case slices.Equal(r.index, f.index):
+		case len(r.index) < len(f.index):
+			return false
+		case len(r.index) == len(f.index) && r.tagged && !f.tagged:
+			return false
+		}
+	}
+	return true
+}
+
+// fieldByIndex returns the field of struct v at index. Nil pointers to
+// flattened structs on the way are allocated when alloc is set; otherwise
+// the field is reported missing.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// trailingOptions are the tag options whose value may hold commas, as in
+// `bson:"ports,default=<| 80, 443 |>"`. They come after the other options,
+// and each runs to the next of them or to the end of the tag.
+var trailingOptions = []string{"default", "regex"}
+
+// parseTag splits a `bson` struct tag into the key name and its options,
+// the trailing options aside.
+func parseTag(tag string) (string, string) {
+	for _, opt := range trailingOptions {
+		tag, _, _ = strings.Cut(tag, ","+opt+"=")
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	return name, opts
+}
+
+// tagValue returns the value of the option opt of a `bson` struct tag, such
+// as 8080 for default in "port,default=8080".
+func tagValue(tag, opt string) (string, bool) {
+	if !slices.Contains(trailingOptions, opt) {
+		_, opts := parseTag(tag)
+		for opts != "" {
+			var o string
+			o, opts, _ = strings.Cut(opts, ",")
+			if value, ok := strings.CutPrefix(o, opt+"="); ok {
+				return value, true
+			}
+		}
+		return "", false
+	}
+	_, value, ok := strings.Cut(tag, ","+opt+"=")
+	for _, other := range trailingOptions {
+		value, _, _ = strings.Cut(value, ","+other+"=")
+	}
+	return value, ok
+}
+
+// hasTagOption reports whether a `bson` struct tag carries the option opt.
+func hasTagOption(tag, opt string) bool {
+	_, opts := parseTag(tag)
+	for opts != "" {
+		var o string
+		o, opts, _ = strings.Cut(opts, ",")
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// remainField returns the field of fields tagged with the remain option, or
+// nil if there is none. Only the first one counts.
+func remainField(fields []field) *field {
+	for i := range fields {
+		if fields[i].remain {
+			return &fields[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package bulbason
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flatten turns a document, as returned by Parse, into a map with a single
+// level of keys, for flat key-value stores such as environment variables,
+// Consul or parameter stores. The keys of sections and arrays are joined with
+// sep, array elements being named by their index, so that with sep "." the
+// key host of the second element of servers becomes servers.1.host.
+//
+// Empty sections and arrays are kept as values, so that Unflatten restores
+// them. With an empty sep only a flat document can be flattened. A key that
+// contains sep is an error, as Unflatten would split it.
+func Flatten(doc map[string]interface{}, sep string) (map[string]interface{}, error) {
+	flat := make(map[string]interface{})
+	if err := flattenValue(flat, doc, "", "", sep); err != nil {
+		return nil, err
+	}
+	return flat, nil
+}
+
+// flattenValue stores v, found at path, in flat under name, or under names
+// starting with name and sep if it is a non-empty section or array.
+func flattenValue(flat map[string]interface{}, v interface{}, name, path, sep string) error {
+	prefix := name
+	if path != "" {
+		prefix += sep
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if len(x) == 0 && path != "" {
+			break
+		}
+		if sep == "" && path != "" {
+			return fmt.Errorf("bulbason: cannot flatten %s without a separator", path)
+		}
+		for k, elem := range x {
+			if sep != "" && strings.Contains(k, sep) {
+				return fmt.Errorf("bulbason: cannot flatten %s, the key contains the separator %q", joinPath(path, k), sep)
+			}
+			if err := flattenValue(flat, elem, prefix+k, joinPath(path, k), sep); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}, []map[string]interface{}:
+		arr, _ := asArray(x)
+		if len(arr) == 0 {
+			break
+		}
+		if sep == "" {
+			return fmt.Errorf("bulbason: cannot flatten %s without a separator", path)
+		}
+		for i, elem := range arr {
+			if err := flattenValue(flat, elem, prefix+strconv.Itoa(i), indexPath(path, i), sep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	flat[name] = copyValue(v)
+	return nil
+}
+
+// Unflatten is the inverse of Flatten: it splits the keys of flat on sep and
+// nests the values under them in sections, so that with sep "." the key
+// database.host becomes the key host of section database. A section whose
+// keys are the indexes 0 to n-1 becomes an array, which is how Flatten names
+// array elements.
+//
+// Values are converted as Document.Set converts them. With an empty sep the
+// keys are kept as they are. A key used both for a value and as the prefix of
+// other keys, such as a and a.b, is an error.
+func Unflatten(flat map[string]interface{}, sep string) (map[string]interface{}, error) {
+	names := make([]string, 0, len(flat))
+	for name := range flat {
+		names = append(names, name)
+	}
+	// A name sorts before the names it is the prefix of, so that an empty
+	// section kept by Flatten is filled rather than replaced.
+	sort.Strings(names)
+
+	root := make(map[string]interface{})
+	for _, name := range names {
+		keys := []string{name}
+		if sep != "" {
+			keys = strings.Split(name, sep)
+		}
+		section := root
+		for i, key := range keys[:len(keys)-1] {
+			child, exists := section[key]
+			if !exists {
+				child = make(map[string]interface{})
+				section[key] = child
+			}
+			next, ok := child.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("bulbason: cannot unflatten %q, %s is already set to a value", name, strings.Join(keys[:i+1], sep))
+			}
+			section = next
+		}
+		last := keys[len(keys)-1]
+		if _, exists := section[last]; exists {
+			return nil, fmt.Errorf("bulbason: cannot unflatten %q, it is already used as a prefix", name)
+		}
+		section[last] = normalizeValue(copyValue(flat[name]))
+	}
+	return restoreArrays(root).(map[string]interface{}), nil
+}
+
+// restoreArrays returns v with the sections below it whose keys are the
+// indexes 0 to n-1 turned into arrays. The root section is never turned into
+// an array.
+func restoreArrays(v interface{}) interface{} {
+	section, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	for k, elem := range section {
+		section[k] = restoreArrays(elem)
+		if arr, ok := sectionArray(section[k]); ok {
+			section[k] = arr
+		}
+	}
+	return section
+}
+
+// sectionArray returns the values of v as an array, if v is a non-empty
+// section whose keys are the indexes 0 to n-1.
+func sectionArray(v interface{}) (interface{}, bool) {
+	section, ok := v.(map[string]interface{})
+	if !ok || len(section) == 0 {
+		return nil, false
+	}
+	arr := make([]interface{}, len(section))
+	for k, elem := range section {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= len(arr) || strconv.Itoa(i) != k {
+			return nil, false
+		}
+		arr[i] = elem
+	}
+	return restoreSections(arr), true
+}
@@ -0,0 +1,93 @@
+package bulbason
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	doc, err := Parse(documentInput + "empty ~> <| |>\n(o) unused (o)\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	flat, err := Flatten(doc, ".")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"name":                          "Bulby",
+		"debug":                         true,
+		"owner":                         nil,
+		"tags.0":                        "grass",
+		"tags.1.0":                      int64(1),
+		"tags.1.1":                      int64(2),
+		"database.host":                 "localhost",
+		"database.pool.max_connections": int64(50),
+		"servers.0.host":                "10.0.0.1",
+		"servers.1.host":                "10.0.0.2",
+		"empty":                         doc["empty"],
+		"unused":                        map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Errorf("Expected %v, got %v", expected, flat)
+	}
+
+	back, err := Unflatten(flat, ".")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(back, doc) {
+		t.Errorf("Expected %v, got %v", doc, back)
+	}
+}
+
+func TestFlatten_Errors(t *testing.T) {
+	if _, err := Flatten(map[string]interface{}{"a.b": 1}, "."); err == nil {
+		t.Error("Expected an error for a key holding the separator")
+	}
+	if _, err := Flatten(map[string]interface{}{"a": map[string]interface{}{"b": 1}}, ""); err == nil {
+		t.Error("Expected an error flattening a section without a separator")
+	}
+	flat, err := Flatten(map[string]interface{}{"a.b": 1, "c": []interface{}{}}, "")
+	if err != nil || !reflect.DeepEqual(flat, map[string]interface{}{"a.b": 1, "c": []interface{}{}}) {
+		t.Errorf("Expected a flat document to be kept, got %v (%v)", flat, err)
+	}
+}
+
+func TestUnflatten(t *testing.T) {
+	got, err := Unflatten(map[string]interface{}{
+		"DB__HOST":   "db",
+		"DB__PORT":   5432,
+		"HOSTS__0":   "a",
+		"HOSTS__1":   "b",
+		"ODD__1":     "x",
+		"ODD__2":     "y",
+		"PLAIN":      uint8(1),
+		"EMPTY__A":   "set",
+		"EMPTY":      map[string]interface{}{},
+		"NUMBERS__0": map[string]interface{}{},
+	}, "__")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"DB":      map[string]interface{}{"HOST": "db", "PORT": int64(5432)},
+		"HOSTS":   []interface{}{"a", "b"},
+		"ODD":     map[string]interface{}{"1": "x", "2": "y"},
+		"PLAIN":   int64(1),
+		"EMPTY":   map[string]interface{}{"A": "set"},
+		"NUMBERS": []map[string]interface{}{{}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	for _, flat := range []map[string]interface{}{
+		{"a": 1, "a.b": 2},
+		{"a.b": 1, "a.b.c": 2},
+	} {
+		if _, err := Unflatten(flat, "."); err == nil {
+			t.Errorf("Expected an error unflattening %v", flat)
+		}
+	}
+}
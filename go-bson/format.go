@@ -0,0 +1,124 @@
+package bulbason
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// Format returns src rewritten in the canonical layout, as written by
+// Encoder.EncodeAST with its default settings: four spaces per evolution
+// level, four-tilde Vine Whips, and single spaces around operators and inside
+// arrays and inline objects. Comments are kept, as are the digit separators of
+// numbers, multi-line strings, and blank lines between entries, runs of blank
+// lines being collapsed to one. Formatting a formatted document leaves it
+// unchanged. The options change the layout, such as KeepVines, or the keys,
+// such as RenameKeys.
+//
+// src must be a valid document; if it is not, the parse error is returned.
+func Format(src []byte, opts ...FormatOption) ([]byte, error) {
+	content := string(src)
+	doc, err := ParseAST(content, ParseComments())
+	if err != nil {
+		return nil, err
+	}
+	e := newEncodeState()
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.rename != nil {
+		if err := renameKeys(doc.Body, e.rename); err != nil {
+			return nil, err
+		}
+	}
+	e.source = strings.Split(content, "\n")
+	if err := e.writeDocument(doc); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// FormatOption changes the layout Format writes.
+type FormatOption func(*encodeState)
+
+// KeepVines keeps the Vine Whip of each key as written instead of making it
+// ~~~~>, so that values aligned by hand, as in
+//
+//	name ~~~~~~> "api"
+//	timeout ~~~> 30s
+//
+// stay aligned.
+func KeepVines() FormatOption {
+	return func(e *encodeState) {
+		e.vinePolicy = VineSource
+	}
+}
+
+// RenameKeys writes every key in convention, fixing the keys that KeyRules
+// with KeyNaming(convention) rejects. The paths of Copycat references are
+// renamed along with the keys they point at. Format fails if two different
+// keys of a section end up with the same name.
+func RenameKeys(convention NamingConvention) FormatOption {
+	return func(e *encodeState) {
+		e.rename = convention.Convert
+	}
+}
+
+// renameKeys renames the keys of body and of the sections and objects below
+// it with rename.
+func renameKeys(body []ast.Entry, rename func(string) string) error {
+	// renamed maps each new name in body to the key it was renamed from.
+	renamed := make(map[string]string)
+	check := func(key *ast.Ident) error {
+		name := rename(key.Name)
+		if old, ok := renamed[name]; ok && old != key.Name {
+			return fmt.Errorf("bulbason: line %d: cannot rename %q to %q, the name of %q", key.Loc.Start.Line, key.Name, name, old)
+		}
+		renamed[name] = key.Name
+		key.Name = name
+		return nil
+	}
+	for _, entry := range body {
+		switch n := entry.(type) {
+		case *ast.Section:
+			if err := check(n.Name); err != nil {
+				return err
+			}
+			if err := renameKeys(n.Body, rename); err != nil {
+				return err
+			}
+		case *ast.KeyValue:
+			if err := check(n.Key); err != nil {
+				return err
+			}
+			if err := renameValueKeys(n.Value, rename); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renameValueKeys renames the keys of the objects in v, and those in the
+// path of a Copycat reference, leaving its indexes as they are.
+func renameValueKeys(v ast.Value, rename func(string) string) error {
+	switch n := v.(type) {
+	case *ast.ObjectLit:
+		return renameKeys(n.Body, rename)
+	case *ast.ArrayLit:
+		for _, elem := range n.Elements {
+			if err := renameValueKeys(elem, rename); err != nil {
+				return err
+			}
+		}
+	case *ast.Reference:
+		segments := strings.Split(n.Path, ".")
+		for i, segment := range segments {
+			key, _, _ := strings.Cut(segment, "[")
+			segments[i] = rename(key) + segment[len(key):]
+		}
+		n.Path = strings.Join(segments, ".")
+	}
+	return nil
+}
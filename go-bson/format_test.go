@@ -0,0 +1,170 @@
+package bulbason
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	input := `BULBA!
+zZz top comment
+
+
+name ~> "Bulby"   zZz trailing
+level~~~~~~>5
+zZz[ block
+   comment ]zZz
+(o) stats (o)
+    hp ~~> 45
+
+    zZz about speed
+    speed ~> 0.5
+    (O) deep (O)
+        x ~> <|1,2,   3|>
+bio ~> """
+    Likes sun.
+    """
+moves ~> <|
+(o)
+    zZz first
+    power ~> 40
+
+(o)
+    power ~> 1_000
+|>
+obj ~> { a ~> 1,b ~> ` + "`raw`" + ` }
+
+zZz the end
+`
+	expected := `BULBA!
+zZz top comment
+
+name ~~~~> "Bulby" zZz trailing
+level ~~~~> 5
+zZz[ block
+   comment ]zZz
+(o) stats (o)
+    hp ~~~~> 45
+
+    zZz about speed
+    speed ~~~~> 0.5
+    (O) deep (O)
+        x ~~~~> <| 1, 2, 3 |>
+bio ~~~~> """
+    Likes sun.
+    """
+moves ~~~~> <|
+(o)
+    zZz first
+    power ~~~~> 40
+
+(o)
+    power ~~~~> 1_000
+|>
+obj ~~~~> { a ~~~~> 1, b ~~~~> ` + "`raw`" + ` }
+
+zZz the end
+`
+	out, err := Format([]byte(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	again, err := Format(out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(again) != string(out) {
+		t.Errorf("Formatting is not idempotent, got:\n%s", again)
+	}
+}
+
+func TestFormat_KeepVines(t *testing.T) {
+	input := `BULBA!
+name ~~~~~~>   "api"
+timeout ~~~> 30s
+(o) pool (o)
+    size ~~>  5
+    limits ~> { max ~~~> 10, min ~> 1 }
+`
+	expected := `BULBA!
+name ~~~~~~> "api"
+timeout ~~~> 30s
+(o) pool (o)
+    size ~~> 5
+    limits ~> { max ~~~> 10, min ~> 1 }
+`
+	out, err := Format([]byte(input), KeepVines())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+	again, err := Format(out, KeepVines())
+	if err != nil || string(again) != string(out) {
+		t.Errorf("Formatting is not idempotent, got:\n%s", again)
+	}
+
+	// Without the option, every Vine Whip is made canonical.
+	if out, err = Format([]byte(input)); err != nil || !strings.Contains(string(out), "name ~~~~> \"api\"\ntimeout ~~~~> 30s") {
+		t.Errorf("Expected canonical Vine Whips, got:\n%s", out)
+	}
+}
+
+func TestFormat_RenameKeys(t *testing.T) {
+	input := `BULBA!
+zZz Mixed styles creep in.
+KERNEL_FLAGS ~> "quiet"
+appName ~> "api"
+(o) HTTPServer (o)
+    maxConn ~> 3
+    hosts ~> <| { hostName ~> "a" } |>
+primary ~> Copycat HTTPServer.hosts[0].hostName
+`
+	expected := `BULBA!
+zZz Mixed styles creep in.
+kernel_flags ~~~~> "quiet"
+app_name ~~~~> "api"
+(o) http_server (o)
+    max_conn ~~~~> 3
+    hosts ~~~~> <| { host_name ~~~~> "a" } |>
+primary ~~~~> Copycat http_server.hosts[0].host_name
+`
+	out, err := Format([]byte(input), RenameKeys(SnakeCase))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+	if _, err := Parse(string(out), KeyRules(KeyNaming(SnakeCase))); err != nil {
+		t.Errorf("Expected the renamed keys to pass the rule, got %v", err)
+	}
+	m, _ := Parse(string(out))
+	if m["primary"] != "a" {
+		t.Errorf("Expected the reference to follow the rename, got %v", m["primary"])
+	}
+
+	out, err = Format([]byte(input), RenameKeys(KebabCase))
+	if err != nil || !strings.Contains(string(out), "(o) \"http-server\" (o)\n    \"max-conn\" ~~~~> 3") {
+		t.Errorf("Expected quoted kebab-case keys, got:\n%s (%v)", out, err)
+	}
+
+	// Two keys may not end up with the same name.
+	if _, err := Format([]byte("BULBA!\nappName ~> 1\napp_name ~> 2\n"), RenameKeys(SnakeCase)); err == nil || !strings.Contains(err.Error(), `line 3: cannot rename "app_name" to "app_name", the name of "appName"`) {
+		t.Errorf("Expected a clash, got %v", err)
+	}
+}
+
+func TestFormat_Error(t *testing.T) {
+	_, err := Format([]byte("BULBA!\nname ~> \"unclosed\n"))
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 {
+		t.Errorf("Expected a parse error on line 2, got %v", err)
+	}
+}
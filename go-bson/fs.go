@@ -0,0 +1,55 @@
+package bulbason
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// ParseFile parses the named file of fsys, which may be the file system of
+// the operating system (os.DirFS), an embed.FS holding configuration
+// compiled into the program, or any other fs.FS. Errors are prefixed with
+// the name of the file, while still matching ParseError with errors.As.
+//
+// Transform directives are resolved against fsys, relative to name, as with
+// the Includes option.
+func ParseFile(fsys fs.FS, name string, opts ...ParseOption) (map[string]interface{}, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]ParseOption{Includes(fsys, name)}, opts...)
+	doc, err := Parse(string(data), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return doc, nil
+}
+
+// ParseFS parses the files of fsys matching pattern, with the syntax of
+// fs.Glob, such as "conf.d/*.bson", and merges them in lexical order of their
+// names, each file overriding the ones before it as Merge does by default.
+// A numbered prefix, as in 10-defaults.bson and 20-production.bson, thus
+// decides the order. It returns an error if the pattern matches no file.
+//
+// Configuration spread over several file systems, such as defaults embedded
+// in the program and overrides on disk, is loaded by merging the results of
+// one ParseFS call per file system.
+func ParseFS(fsys fs.FS, pattern string, opts ...ParseOption) (map[string]interface{}, error) {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("bulbason: pattern %q matches no files", pattern)
+	}
+
+	result := make(map[string]interface{})
+	for _, name := range names {
+		doc, err := ParseFile(fsys, name, opts...)
+		if err != nil {
+			return nil, err
+		}
+		mergeSection(result, doc, MergeOptions{})
+	}
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package bulbason
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testFS = fstest.MapFS{
+	"config.bson": {Data: []byte("BULBA!\nname ~> \"app\"\n")},
+	"conf.d/10-defaults.bson": {Data: []byte(`BULBA!
+debug ~> NotVeryEffective
+(o) database (o)
+    host ~> "localhost"
+    port ~> 5432
+`)},
+	"conf.d/20-production.bson": {Data: []byte(`BULBA!
+(o) database (o)
+    host ~> "db.internal"
+`)},
+	"conf.d/README": {Data: []byte("not a document")},
+	"broken.bson":   {Data: []byte("BULBA!\nname ~> \n")},
+}
+
+func TestParseFile(t *testing.T) {
+	doc, err := ParseFile(testFS, "config.bson")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if doc["name"] != "app" {
+		t.Errorf("Expected app, got %v", doc["name"])
+	}
+
+	if _, err := ParseFile(testFS, "missing.bson"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+	_, err = ParseFile(testFS, "broken.bson")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !strings.HasPrefix(err.Error(), "broken.bson: ") {
+		t.Errorf("Expected a ParseError prefixed with the file name, got %v", err)
+	}
+	if _, err := ParseFile(testFS, "broken.bson", EmptyValues(EmptyValueNull)); err != nil {
+		t.Errorf("Expected the options to be applied, got %v", err)
+	}
+}
+
+func TestParseFS(t *testing.T) {
+	doc, err := ParseFS(testFS, "conf.d/*.bson")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"debug": false,
+		"database": map[string]interface{}{
+			"host": "db.internal",
+			"port": int64(5432),
+		},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, doc)
+	}
+
+	if _, err := ParseFS(testFS, "*.yaml"); err == nil || !strings.Contains(err.Error(), "matches no files") {
+		t.Errorf("Expected an error for no matches, got %v", err)
+	}
+	if _, err := ParseFS(testFS, "*.bson"); err == nil || !strings.HasPrefix(err.Error(), "broken.bson: ") {
+		t.Errorf("Expected the broken file to be reported, got %v", err)
+	}
+	if _, err := ParseFS(testFS, "["); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("Expected path.ErrBadPattern, got %v", err)
+	}
+}
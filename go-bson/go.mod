@@ -1,3 +1,3 @@
-module go-bson
+module github.com/kubabialy/BulbaSaur-Object-Notation/go-bson
 
 go 1.24.5
@@ -0,0 +1,91 @@
+package bulbason
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecodeHook converts a document value before it is decoded into a Go value
+// of type to, and returns the value to decode instead. A hook with nothing
+// to convert returns v unchanged. Hooks are called for every value, sections
+// and arrays included, before their members and elements, and for pointers
+// both for the pointer type and for the type it points to. MissingNo is not
+// passed to them, but a hook may return nil to decode MissingNo.
+type DecodeHook func(v interface{}, to reflect.Type) (interface{}, error)
+
+// StringToDurationHook returns a DecodeHook that parses strings decoded into a
+// time.Duration, such as "1h30m", with time.ParseDuration.
+func StringToDurationHook() DecodeHook {
+	return func(v interface{}, to reflect.Type) (interface{}, error) {
+		s, ok := v.(string)
+		if !ok || to != durationType {
+			return v, nil
+		}
+		return time.ParseDuration(s)
+	}
+}
+
+// StringToSliceHook returns a DecodeHook that splits strings decoded into a
+// slice, other than a []byte, on sep, so that "a,b,c" decodes into a
+// []string of three elements. The elements stay strings, and the empty string
+// gives an empty slice.
+func StringToSliceHook(sep string) DecodeHook {
+	return func(v interface{}, to reflect.Type) (interface{}, error) {
+		s, ok := v.(string)
+		if !ok || to.Kind() != reflect.Slice || to.Elem().Kind() == reflect.Uint8 {
+			return v, nil
+		}
+		elems := []interface{}{}
+		if s != "" {
+			for _, part := range strings.Split(s, sep) {
+				elems = append(elems, part)
+			}
+		}
+		return elems, nil
+	}
+}
+
+// WeaklyTypedHook returns a DecodeHook for documents migrated from formats
+// where every value is a string, such as environment variables. Strings
+// decoded into numbers are parsed as number literals, so "8080" decodes into
+// an int, and strings decoded into booleans with strconv.ParseBool, so "1",
+// "true" and "0" are accepted. Integers decoded into booleans are true unless
+// they are 0.
+func WeaklyTypedHook() DecodeHook {
+	return func(v interface{}, to reflect.Type) (interface{}, error) {
+		if to == durationType || to == numberType {
+			return v, nil
+		}
+		switch to.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64:
+			s, ok := v.(string)
+			if !ok {
+				return v, nil
+			}
+			n, err := parseNumber(strings.TrimSpace(s), LargeIntegerBig)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a number", s)
+			}
+			return n, nil
+		case reflect.Bool:
+			switch x := v.(type) {
+			case string:
+				b, err := strconv.ParseBool(strings.TrimSpace(x))
+				if err != nil {
+					return nil, fmt.Errorf("%q is not a boolean", x)
+				}
+				return b, nil
+			case int64:
+				return x != 0, nil
+			case uint64:
+				return x != 0, nil
+			}
+		}
+		return v, nil
+	}
+}
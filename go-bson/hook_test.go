@@ -0,0 +1,148 @@
+package bulbason
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type level int
+
+const (
+	levelDebug level = iota
+	levelInfo
+	levelError
+)
+
+var levelType = reflect.TypeOf(level(0))
+
+// levelHook decodes level names into a level.
+func levelHook(v interface{}, to reflect.Type) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok || to != levelType {
+		return v, nil
+	}
+	for i, name := range []string{"debug", "info", "error"} {
+		if s == name {
+			return int64(i), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown level %q", s)
+}
+
+func TestDecoder_UseHooks(t *testing.T) {
+	input := `BULBA!
+timeout ~> "1h30m"
+retry ~> 5s
+hosts ~> "a.example,b.example"
+ports ~> <| 80, 443 |>
+empty ~> ""
+level ~> "error"
+levels ~> "debug,info"
+`
+	var cfg struct {
+		Timeout time.Duration  `bson:"timeout"`
+		Retry   *time.Duration `bson:"retry"`
+		Hosts   []string       `bson:"hosts"`
+		Ports   []int          `bson:"ports"`
+		Empty   []string       `bson:"empty"`
+		Level   level          `bson:"level"`
+		Levels  []level        `bson:"levels"`
+	}
+	dec := NewDecoder(strings.NewReader(input))
+	dec.UseHooks(StringToDurationHook(), StringToSliceHook(","))
+	dec.UseHooks(levelHook)
+	if err := dec.Decode(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Timeout != 90*time.Minute || cfg.Retry == nil || *cfg.Retry != 5*time.Second {
+		t.Errorf("Unexpected durations %v and %v", cfg.Timeout, cfg.Retry)
+	}
+	if !reflect.DeepEqual(cfg.Hosts, []string{"a.example", "b.example"}) || !reflect.DeepEqual(cfg.Ports, []int{80, 443}) {
+		t.Errorf("Unexpected slices %v and %v", cfg.Hosts, cfg.Ports)
+	}
+	if cfg.Empty == nil || len(cfg.Empty) != 0 {
+		t.Errorf("Expected an empty slice, got %#v", cfg.Empty)
+	}
+	if cfg.Level != levelError || !reflect.DeepEqual(cfg.Levels, []level{levelDebug, levelInfo}) {
+		t.Errorf("Unexpected levels %v and %v", cfg.Level, cfg.Levels)
+	}
+
+	dec = NewDecoder(strings.NewReader("BULBA!\nlevel ~> \"loud\"\n"))
+	dec.UseHooks(levelHook)
+	err := dec.Decode(&cfg)
+	if err == nil || err.Error() != `bulbason: cannot decode "level": unknown level "loud"` {
+		t.Errorf("Expected the error of the hook, got %v", err)
+	}
+
+	dec = NewDecoder(strings.NewReader("BULBA!\ntimeout ~> \"soon\"\n"))
+	dec.UseHooks(StringToDurationHook())
+	if err := dec.Decode(&cfg); err == nil || !strings.Contains(err.Error(), `cannot decode "timeout"`) {
+		t.Errorf("Expected a duration error, got %v", err)
+	}
+}
+
+func TestConfig_UnmarshalHooks(t *testing.T) {
+	c := NewConfig()
+	if err := c.Set("timeout", "2m"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var cfg struct {
+		Timeout time.Duration `bson:"timeout"`
+	}
+	if err := c.Unmarshal(&cfg); err == nil {
+		t.Error("Expected a type error without hooks")
+	}
+	if err := c.Unmarshal(&cfg, StringToDurationHook()); err != nil || cfg.Timeout != 2*time.Minute {
+		t.Errorf("Expected 2m, got %v, %v", cfg.Timeout, err)
+	}
+}
+
+func TestWeaklyTypedHook(t *testing.T) {
+	input := `BULBA!
+port ~> "8080"
+ratio ~> " 0.5 "
+big ~> "18446744073709551615"
+debug ~> "1"
+verbose ~> 0
+enabled ~> "true"
+strict ~> SuperEffective
+name ~> "8080"
+`
+	var cfg struct {
+		Port    int     `bson:"port"`
+		Ratio   float64 `bson:"ratio"`
+		Big     uint64  `bson:"big"`
+		Debug   bool    `bson:"debug"`
+		Verbose *bool   `bson:"verbose"`
+		Enabled bool    `bson:"enabled"`
+		Strict  bool    `bson:"strict"`
+		Name    string  `bson:"name"`
+	}
+	dec := NewDecoder(strings.NewReader(input))
+	dec.UseHooks(WeaklyTypedHook())
+	if err := dec.Decode(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Port != 8080 || cfg.Ratio != 0.5 || cfg.Big != 1<<64-1 || cfg.Name != "8080" {
+		t.Errorf("Unexpected values %+v", cfg)
+	}
+	if !cfg.Debug || cfg.Verbose == nil || *cfg.Verbose || !cfg.Enabled || !cfg.Strict {
+		t.Errorf("Unexpected booleans %+v", cfg)
+	}
+
+	tests := []struct{ input, message string }{
+		{"BULBA!\nport ~> \"http\"\n", `cannot decode "port": "http" is not a number`},
+		{"BULBA!\ndebug ~> \"yes\"\n", `cannot decode "debug": "yes" is not a boolean`},
+		{"BULBA!\nport ~> \"1.5\"\n", `cannot decode number into int at "port"`},
+	}
+	for _, tt := range tests {
+		dec := NewDecoder(strings.NewReader(tt.input))
+		dec.UseHooks(WeaklyTypedHook())
+		if err := dec.Decode(&cfg); err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("Expected an error containing %q, got %v", tt.message, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package bulbason
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// ContentType is the media type of BSON documents in HTTP messages.
+const ContentType = "application/x-bulba"
+
+// DefaultMaxBodySize is the size limit, in bytes, DecodeRequest puts on
+// request bodies unless given a MaxInputSize option.
+const DefaultMaxBodySize = 1 << 20
+
+// RequestError is returned by DecodeRequest for a request it rejects.
+// StatusCode is the HTTP status the handler should respond with, and Err
+// the underlying error, such as a *ParseError.
+type RequestError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap exposes the underlying error to errors.Is and errors.As.
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeRequest decodes the BSON body of r into v, following the same rules
+// as Unmarshal, so that APIs can accept BSON payloads:
+//
+//	var req CreateRequest
+//	if err := bulbason.DecodeRequest(r, &req); err != nil {
+//		var reqErr *bulbason.RequestError
+//		if errors.As(err, &reqErr) {
+//			http.Error(w, err.Error(), reqErr.StatusCode)
+//		}
+//		return
+//	}
+//
+// The request must have the ContentType media type, or it is rejected with
+// 415 Unsupported Media Type. Bodies over DefaultMaxBodySize are rejected
+// with 413 Request Entity Too Large; a MaxInputSize option sets another
+// limit, and MaxInputSize(0) none. Invalid documents, and documents that do
+// not fit v, are rejected with 400 Bad Request. These errors are
+// *RequestErrors; any other error, such as the request's context being
+// canceled while the body is read, is returned as is.
+func DecodeRequest(r *http.Request, v interface{}, opts ...ParseOption) error {
+	header := r.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(header); err != nil || mediaType != ContentType {
+		return &RequestError{
+			StatusCode: http.StatusUnsupportedMediaType,
+			Err:        fmt.Errorf("bulbason: unsupported content type %q, expected %s", header, ContentType),
+		}
+	}
+
+	opts = append([]ParseOption{MaxInputSize(DefaultMaxBodySize)}, opts...)
+	if limit := newParseConfig(opts).maxInputSize; limit > 0 && r.ContentLength > int64(limit) {
+		return &RequestError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Err:        fmt.Errorf("bulbason: request body of %d bytes exceeds the limit of %d", r.ContentLength, limit),
+		}
+	}
+
+	err := NewDecoder(r.Body, opts...).DecodeContext(r.Context(), v)
+	var (
+		pe      *ParseError
+		list    ErrorList
+		typeErr *UnmarshalTypeError
+		maxErr  *http.MaxBytesError
+	)
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &pe) && pe.Code == CodeInputSize, errors.As(err, &maxErr):
+		return &RequestError{StatusCode: http.StatusRequestEntityTooLarge, Err: err}
+	case errors.As(err, &pe), errors.As(err, &list), errors.As(err, &typeErr):
+		return &RequestError{StatusCode: http.StatusBadRequest, Err: err}
+	}
+	return err
+}
+
+// WriteResponse writes v, encoded as by Marshal, as the body of a response
+// with the given status code and the ContentType media type. If v cannot be
+// encoded nothing is written, so the handler can still respond with an
+// error.
+func WriteResponse(w http.ResponseWriter, status int, v interface{}) error {
+	data, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
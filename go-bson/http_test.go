@@ -0,0 +1,97 @@
+package bulbason
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type httpPayload struct {
+	Name  string `bson:"name"`
+	Level int    `bson:"level"`
+}
+
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		opts        []ParseOption
+		status      int
+	}{
+		{"Valid", "application/x-bulba", "BULBA!\nname ~> \"Bulby\"\nlevel ~> 5\n", nil, 0},
+		{"Charset", "application/x-bulba; charset=utf-8", "BULBA!\nname ~> \"Bulby\"\nlevel ~> 5\n", nil, 0},
+		{"Missing Content Type", "", "BULBA!\n", nil, http.StatusUnsupportedMediaType},
+		{"JSON", "application/json", `{"name": "Bulby"}`, nil, http.StatusUnsupportedMediaType},
+		{"Invalid Document", "application/x-bulba", "name ~> \"Bulby\"\n", nil, http.StatusBadRequest},
+		{"Wrong Type", "application/x-bulba", "BULBA!\nlevel ~> \"five\"\n", nil, http.StatusBadRequest},
+		{"Too Large", "application/x-bulba", "BULBA!\nname ~> \"" + strings.Repeat("x", 100) + "\"\n", []ParseOption{MaxInputSize(64)}, http.StatusRequestEntityTooLarge},
+		{"No Limit", "application/x-bulba", "BULBA!\nname ~> \"" + strings.Repeat("x", DefaultMaxBodySize) + "\"\nlevel ~> 5\n", []ParseOption{MaxInputSize(0)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			var p httpPayload
+			err := DecodeRequest(r, &p, tt.opts...)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if p.Level != 5 {
+					t.Errorf("Expected level 5, got %d", p.Level)
+				}
+				return
+			}
+			var reqErr *RequestError
+			if !errors.As(err, &reqErr) || reqErr.StatusCode != tt.status {
+				t.Errorf("Expected a RequestError with status %d, got %v", tt.status, err)
+			}
+		})
+	}
+}
+
+func TestDecodeRequest_StreamedTooLarge(t *testing.T) {
+	// Without a Content-Length the limit is enforced while reading.
+	body := "BULBA!\nname ~> \"" + strings.Repeat("x", DefaultMaxBodySize) + "\"\n"
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.ContentLength = -1
+	r.Header.Set("Content-Type", ContentType)
+
+	var p httpPayload
+	err := DecodeRequest(r, &p)
+	var reqErr *RequestError
+	var pe *ParseError
+	if !errors.As(err, &reqErr) || reqErr.StatusCode != http.StatusRequestEntityTooLarge || !errors.As(err, &pe) || pe.Code != CodeInputSize {
+		t.Errorf("Expected a 413 RequestError wrapping CodeInputSize, got %v", err)
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := WriteResponse(w, http.StatusCreated, httpPayload{Name: "Bulby", Level: 5}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-bulba; charset=utf-8" {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	expected := "BULBA!\nname ~~~~> \"Bulby\"\nlevel ~~~~> 5\n"
+	if w.Body.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	if err := WriteResponse(w, http.StatusOK, 42); err == nil {
+		t.Errorf("Expected an error for a value that is not a section")
+	}
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Errorf("Expected nothing to be written, got %q", w.Body.String())
+	}
+}
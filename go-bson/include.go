@@ -0,0 +1,164 @@
+package bulbason
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// IncludeError is returned when a Transform directive cannot be resolved:
+// includes are not enabled, the file cannot be read or parsed, or it is
+// already being included.
+type IncludeError struct {
+	Path   string // The path as written in the directive
+	Line   int    // 1-based line of the directive
+	Column int    // 1-based column of the directive
+	Err    error  // The underlying problem
+}
+
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("bulbason: line %d: Transform %q: %v", e.Line, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error, so that a ParseError found in an
+// included file matches with errors.As.
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
+// errIncludesDisabled is the Err of an IncludeError for a directive found
+// without the Includes option.
+var errIncludesDisabled = errors.New("includes are not enabled, see the Includes option")
+
+// includeConfig is the state of the Includes option: where included files
+// are read from, and the chain of files being included, outermost first.
+type includeConfig struct {
+	fsys  fs.FS
+	name  string   // The file being parsed, "" if unknown
+	chain []string // The files including it, and the file itself
+}
+
+// resolveIncludes replaces the directives at the seed level of doc with the
+// entries of the files they include.
+func resolveIncludes(doc *ast.Document, cfg *parseConfig) error {
+	if !slices.ContainsFunc(doc.Body, isInclude) {
+		return nil
+	}
+
+	// A key may only be defined once across the document and the files it
+	// includes, so names are tracked when duplicates are an error. Keys of the
+	// document itself were already checked.
+	seen := make(map[[2]string]bool)
+	for _, entry := range doc.Body {
+		if !isInclude(entry) {
+			seen[entryID(entry)] = true
+		}
+	}
+
+	var body []ast.Entry
+	for _, entry := range doc.Body {
+		inc, ok := entry.(*ast.Include)
+		if !ok {
+			body = append(body, entry)
+			continue
+		}
+		included, err := includeFile(inc, cfg)
+		if err != nil {
+			return err
+		}
+		for _, e := range included.Body {
+			id := entryID(e)
+			if seen[id] && cfg.duplicateKeys == DuplicateError {
+				return includeError(inc, fmt.Errorf("key %q is already defined", id[0]))
+			}
+			seen[id] = true
+		}
+		body = append(body, included.Body...)
+	}
+	doc.Body = body
+	return nil
+}
+
+// includeFile parses the file included by inc, resolving its own includes.
+func includeFile(inc *ast.Include, cfg *parseConfig) (*ast.Document, error) {
+	if cfg.includes == nil {
+		return nil, includeError(inc, errIncludesDisabled)
+	}
+	name := path.Join(path.Dir(cfg.includes.name), inc.Path.Value)
+	if !fs.ValidPath(name) || path.IsAbs(inc.Path.Value) {
+		return nil, includeError(inc, errors.New("path is outside of the file system"))
+	}
+	chain := append(slices.Clip(cfg.includes.chain), name)
+	if slices.Contains(cfg.includes.chain, name) {
+		return nil, includeError(inc, fmt.Errorf("include cycle: %s", strings.Join(chain, " -> ")))
+	}
+
+	data, err := fs.ReadFile(cfg.includes.fsys, name)
+	if err != nil {
+		return nil, includeError(inc, err)
+	}
+	sub := *cfg
+	sub.includes = &includeConfig{fsys: cfg.includes.fsys, name: name, chain: chain}
+	// Diagnostics carry no file name, so those of an included file would be
+	// taken for ones of the document including it.
+	sub.diagnostics = nil
+	doc, err := parseAST(newStringLexer(string(data), &sub))
+	if err != nil {
+		return nil, includeError(inc, &fileError{name: name, err: err})
+	}
+	return doc, nil
+}
+
+// fileError is a problem found in an included file. Its message locates the
+// parse errors within that file.
+type fileError struct {
+	name string
+	err  error
+}
+
+func (e *fileError) Error() string {
+	var list ErrorList
+	switch err := e.err.(type) {
+	case *ParseError:
+		list = ErrorList{err}
+	case ErrorList:
+		list = err
+	default:
+		return e.name + ": " + e.err.Error()
+	}
+	msgs := make([]string, len(list))
+	for i, pe := range list {
+		msgs[i] = fmt.Sprintf("%s:%d:%d: %s", e.name, pe.Line, pe.Column, pe.Message)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *fileError) Unwrap() error {
+	return e.err
+}
+
+// includeError returns an IncludeError located at inc.
+func includeError(inc *ast.Include, err error) *IncludeError {
+	start := inc.Keyword.Start
+	return &IncludeError{Path: inc.Path.Value, Line: start.Line, Column: start.Column, Err: err}
+}
+
+// isInclude reports whether entry is a Transform directive.
+func isInclude(entry ast.Entry) bool {
+	_, ok := entry.(*ast.Include)
+	return ok
+}
+
+// checkIncludes returns an IncludeError for the first directive of doc, which
+// holds directives when it was parsed without the Includes option.
+func checkIncludes(doc *ast.Document) error {
+	if i := slices.IndexFunc(doc.Body, isInclude); i != -1 {
+		return includeError(doc.Body[i].(*ast.Include), errIncludesDisabled)
+	}
+	return nil
+}
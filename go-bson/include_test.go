@@ -0,0 +1,170 @@
+package bulbason
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+var includeFS = fstest.MapFS{
+	"app.bson": {Data: []byte(`BULBA!
+name ~> "app"
+Transform "shared/database.bson"
+debug ~> SuperEffective
+`)},
+	"shared/database.bson": {Data: []byte(`BULBA!
+Transform "pool.bson"
+(o) database (o)
+    host ~> "localhost"
+`)},
+	"shared/pool.bson": {Data: []byte(`BULBA!
+(o) pool (o)
+    max ~> 10
+`)},
+	"cycle/a.bson":       {Data: []byte("BULBA!\nTransform \"b.bson\"\n")},
+	"cycle/b.bson":       {Data: []byte("BULBA!\nTransform \"a.bson\"\n")},
+	"broken.bson":        {Data: []byte("BULBA!\nname ~> \"app\"\nTransform \"shared/broken.bson\"\n")},
+	"shared/broken.bson": {Data: []byte("BULBA!\n  port ~> 1\n")},
+	"escape.bson":        {Data: []byte("BULBA!\nTransform \"../secret.bson\"\n")},
+	"dup.bson":           {Data: []byte("BULBA!\nname ~> \"app\"\nTransform \"name.bson\"\n")},
+	"name.bson":          {Data: []byte("BULBA!\nname ~> \"included\"\n")},
+}
+
+func TestParseFile_Include(t *testing.T) {
+	doc, err := ParseFile(includeFS, "app.bson")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"name":     "app",
+		"pool":     map[string]interface{}{"max": int64(10)},
+		"database": map[string]interface{}{"host": "localhost"},
+		"debug":    true,
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected %v, got %v", expected, doc)
+	}
+}
+
+func TestParseAST_Include(t *testing.T) {
+	src := "BULBA!\nTransform \"shared/pool.bson\" zZz pool\n"
+
+	// Without the option the directive is kept.
+	doc, err := ParseAST(src, ParseComments())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	inc, ok := doc.Body[0].(*ast.Include)
+	if !ok {
+		t.Fatalf("Expected *ast.Include, got %T", doc.Body[0])
+	}
+	if inc.Path.Value != "shared/pool.bson" || inc.LineComment == nil {
+		t.Errorf("Unexpected include %+v", inc)
+	}
+	if span := inc.Span(); span.Start != (ast.Position{Line: 2, Column: 1}) || span.End != (ast.Position{Line: 2, Column: 28}) {
+		t.Errorf("Unexpected span %+v", span)
+	}
+
+	// With it the entries of the file take its place.
+	doc, err = ParseAST(src, Includes(includeFS, ""))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(doc.Body) != 1 || entryName(doc.Body[0]) != "pool" {
+		t.Errorf("Expected the pool section, got %v", doc.Body)
+	}
+}
+
+func TestFormat_Include(t *testing.T) {
+	src := "BULBA!\nzZz shared settings\nTransform \"shared/pool.bson\"\nname ~~> \"app\"\n"
+	out, err := Format([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nzZz shared settings\nTransform \"shared/pool.bson\"\nname ~~~~> \"app\"\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestParse_IncludeErrors(t *testing.T) {
+	var ie *IncludeError
+	_, err := Parse("BULBA!\nTransform \"shared/pool.bson\"\n")
+	if !errors.As(err, &ie) || ie.Err != errIncludesDisabled || ie.Line != 2 {
+		t.Errorf("Expected IncludeError for a disabled include, got %v", err)
+	}
+
+	_, err = ParseFile(includeFS, "cycle/a.bson")
+	if !errors.As(err, &ie) || !strings.Contains(err.Error(), "include cycle: cycle/a.bson -> cycle/b.bson -> cycle/a.bson") {
+		t.Errorf("Expected an include cycle, got %v", err)
+	}
+
+	_, err = ParseFile(includeFS, "escape.bson")
+	if !errors.As(err, &ie) || !strings.Contains(err.Error(), "outside of the file system") {
+		t.Errorf("Expected the path to be rejected, got %v", err)
+	}
+
+	_, err = Parse("BULBA!\nTransform \"missing.bson\"\n", Includes(includeFS, ""))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+
+	// A problem in an included file is located within it.
+	_, err = ParseFile(includeFS, "broken.bson")
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Code != CodeIndentation {
+		t.Errorf("Expected an indentation error, got %v", err)
+	}
+	if !errors.As(err, &ie) || ie.Line != 3 || !strings.Contains(err.Error(), "shared/broken.bson:2:3") {
+		t.Errorf("Expected the error to name the included file, got %v", err)
+	}
+}
+
+func TestParse_IncludeDuplicates(t *testing.T) {
+	doc, err := ParseFile(includeFS, "dup.bson")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if doc["name"] != "included" {
+		t.Errorf("Expected the last definition to win, got %v", doc["name"])
+	}
+
+	_, err = ParseFile(includeFS, "dup.bson", DuplicateKeys(DuplicateError))
+	var ie *IncludeError
+	if !errors.As(err, &ie) || !strings.Contains(err.Error(), `key "name" is already defined`) {
+		t.Errorf("Expected a duplicate key error, got %v", err)
+	}
+}
+
+func TestParse_IncludeSyntax(t *testing.T) {
+	tests := []string{
+		"BULBA!\n(o) s (o)\n    Transform \"a.bson\"\n",
+		"BULBA!\nTransform <| \"a.bson\" |>\n",
+		"BULBA!\nlist ~> <|\n(o)\nTransform \"a.bson\"\n|>\n",
+	}
+	for _, src := range tests {
+		_, err := ParseAST(src)
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Code != CodeSyntax {
+			t.Errorf("Expected a syntax error for %q, got %v", src, err)
+		}
+	}
+
+	// As on the right of a Vine Whip, the path must be quoted.
+	_, err := ParseAST("BULBA!\nTransform a.bson\n")
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Code != CodeType {
+		t.Errorf("Expected a type error, got %v", err)
+	}
+
+	// Transform is still a valid key.
+	doc, err := Parse("BULBA!\nTransform ~> \"a.bson\"\n")
+	if err != nil || doc["Transform"] != "a.bson" {
+		t.Errorf("Expected a key named Transform, got %v, %v", doc, err)
+	}
+}
@@ -0,0 +1,354 @@
+package bulbason
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// ToJSON converts a document to compact JSON, keeping the order of its
+// entries. Use json.Indent for a readable layout.
+//
+// Sections and objects become JSON objects and arrays become JSON arrays.
+// Timestamps, durations and byte strings, which JSON has no type for, become
+// strings holding their literal text, base64 in the case of byte strings. A
+// key without a value becomes null. When a key appears more than once, the
+// last value wins, as with Parse. Infinity and NaN cannot be converted.
+func ToJSON(doc *ast.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSONObject(&buf, doc.Body, ""); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSONObject writes the entries of a body at path as a JSON object.
+func writeJSONObject(buf *bytes.Buffer, body []ast.Entry, path string) error {
+	// Only the last of several entries with the same key is written.
+	last := make(map[string]int, len(body))
+	for i, entry := range body {
+		last[entryName(entry)] = i
+	}
+
+	buf.WriteByte('{')
+	written := 0
+	for i, entry := range body {
+		name := entryName(entry)
+		if last[name] != i {
+			continue
+		}
+		if written > 0 {
+			buf.WriteByte(',')
+		}
+		written++
+		writeJSONString(buf, name)
+		buf.WriteByte(':')
+
+		var err error
+		switch e := entry.(type) {
+		case *ast.Section:
+			if e.Forme != nil {
+				return formeError(e, joinPath(path, name), "JSON")
+			}
+			err = writeJSONObject(buf, e.Body, joinPath(path, name))
+		case *ast.KeyValue:
+			err = writeJSONValue(buf, e.Value, joinPath(path, name))
+		default:
+			err = fmt.Errorf("bulbason: cannot convert node of type %T to JSON", entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// writeJSONValue writes the value node at path as JSON.
+func writeJSONValue(buf *bytes.Buffer, v ast.Value, path string) error {
+	switch n := v.(type) {
+	case *ast.StringLit:
+		writeJSONString(buf, n.Value)
+	case *ast.NumberLit:
+		num, err := jsonNumber(n.Literal)
+		if err != nil {
+			return fmt.Errorf("bulbason: cannot convert %s to JSON: %w", path, err)
+		}
+		buf.WriteString(num)
+	case *ast.TimeLit:
+		writeJSONString(buf, n.Literal)
+	case *ast.DurationLit:
+		writeJSONString(buf, n.Literal)
+	case *ast.BytesLit:
+		writeJSONString(buf, n.Literal)
+	case *ast.BoolLit:
+		buf.WriteString(strconv.FormatBool(n.Value))
+	case *ast.NullLit, nil:
+		buf.WriteString("null")
+	case *ast.ArrayLit:
+		buf.WriteByte('[')
+		for i, elem := range n.Elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONValue(buf, elem, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case *ast.ObjectLit:
+		return writeJSONObject(buf, n.Body, path)
+	default:
+		return fmt.Errorf("bulbason: cannot convert node of type %T to JSON", v)
+	}
+	return nil
+}
+
+// writeJSONData writes v, a value as Parse returns it, at path as JSON,
+// converting it as writeJSONValue converts its node. Keys are written in
+// sorted order.
+func writeJSONData(buf *bytes.Buffer, v interface{}, path string) error {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, k)
+			buf.WriteByte(':')
+			if err := writeJSONData(buf, x[k], joinPath(path, k)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}, []map[string]interface{}:
+		arr, _ := asArray(x)
+		buf.WriteByte('[')
+		for i, elem := range arr {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONData(buf, elem, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		writeJSONString(buf, x)
+	case int64:
+		buf.WriteString(strconv.FormatInt(x, 10))
+	case uint64:
+		buf.WriteString(strconv.FormatUint(x, 10))
+	case *big.Int:
+		buf.WriteString(x.String())
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return fmt.Errorf("bulbason: cannot convert %s to JSON: %v has no JSON form", path, x)
+		}
+		b, _ := json.Marshal(x)
+		buf.Write(b)
+	case Number:
+		num, err := jsonNumber(string(x))
+		if err != nil {
+			return fmt.Errorf("bulbason: cannot convert %s to JSON: %w", path, err)
+		}
+		buf.WriteString(num)
+	case time.Time:
+		writeJSONString(buf, x.Format(time.RFC3339Nano))
+	case time.Duration:
+		writeJSONString(buf, x.String())
+	case []byte:
+		writeJSONString(buf, base64.StdEncoding.EncodeToString(x))
+	case bool:
+		buf.WriteString(strconv.FormatBool(x))
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("bulbason: cannot convert %s of type %T to JSON", path, v)
+	}
+	return nil
+}
+
+// jsonNumber returns a number literal in the form JSON allows. Integers keep
+// all their digits, however large.
+func jsonNumber(literal string) (string, error) {
+	if isNonFinite(literal) {
+		return "", fmt.Errorf("%s has no JSON form", literal)
+	}
+	if i, ok := new(big.Int).SetString(literal, 10); ok {
+		return i.String(), nil
+	}
+	f, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+// writeJSONString writes s as a JSON string. Unlike json.Marshal it leaves
+// <, > and & as they are.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode ends the value with a newline.
+	buf.Truncate(buf.Len() - 1)
+}
+
+// entryName returns the key of a section or key-value pair.
+func entryName(entry ast.Entry) string {
+	switch e := entry.(type) {
+	case *ast.Section:
+		return e.Name.Name
+	case *ast.KeyValue:
+		return e.Key.Name
+	}
+	return ""
+}
+
+// formeError is returned by the converters for the section of a profile at
+// path, which the other formats cannot express.
+func formeError(s *ast.Section, path, format string) error {
+	return fmt.Errorf("bulbason: cannot convert %s to %s, it belongs to the profile %q", path, format, s.Forme.Name)
+}
+
+// FromJSON converts a JSON object to a document, keeping the order of its
+// keys, ready to be written with Encoder.EncodeAST.
+//
+// Objects become sections and arrays become arrays. An array whose elements
+// are all objects becomes a multi-line array of sections; objects in any
+// other array become inline objects. Numbers keep the digits they were
+// written with. JSON that BSON has no form for, such as nested arrays, a
+// number outside the float64 range or a reserved key, is rejected with an
+// error naming its path. Nodes carry no positions.
+func FromJSON(data []byte) (*ast.Document, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := valueFromJSON(dec, "")
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(*ast.ObjectLit)
+	if !ok {
+		return nil, fmt.Errorf("bulbason: cannot convert JSON to a document, expected an object")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("bulbason: cannot convert JSON to a document, unexpected data after the object")
+	}
+	return &ast.Document{Body: sectionsFromObjects(obj.Body)}, nil
+}
+
+// valueFromJSON reads the JSON value at path. Objects are read as inline
+// objects, and only turned into sections once it is known where they sit.
+func valueFromJSON(dec *json.Decoder, path string) (ast.Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("bulbason: invalid JSON: %w", err)
+	}
+	switch t := tok.(type) {
+	case string:
+		return &ast.StringLit{Value: t}, nil
+	case json.Number:
+		if !isNumberText(t.String()) {
+			return nil, fmt.Errorf("bulbason: cannot convert %s to BSON, %s is not a valid number", path, t)
+		}
+		return &ast.NumberLit{Literal: t.String()}, nil
+	case bool:
+		return &ast.BoolLit{Value: t}, nil
+	case nil:
+		return &ast.NullLit{}, nil
+	case json.Delim:
+		if t == '[' {
+			arr := &ast.ArrayLit{}
+			for dec.More() {
+				elemPath := indexPath(path, len(arr.Elements))
+				elem, err := valueFromJSON(dec, elemPath)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := elem.(*ast.ArrayLit); ok {
+					return nil, fmt.Errorf("bulbason: cannot convert %s to BSON, arrays cannot be nested", elemPath)
+				}
+				arr.Elements = append(arr.Elements, elem)
+			}
+			// The closing ]
+			if _, err := dec.Token(); err != nil {
+				return nil, fmt.Errorf("bulbason: invalid JSON: %w", err)
+			}
+			return arr, nil
+		}
+
+		obj := &ast.ObjectLit{Inline: true}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, fmt.Errorf("bulbason: invalid JSON: %w", err)
+			}
+			key := tok.(string)
+			keyPath := joinPath(path, key)
+			if _, err := encodeKey(key); err != nil {
+				return nil, fmt.Errorf("bulbason: cannot convert %s to BSON, %q is not a valid key", keyPath, key)
+			}
+			value, err := valueFromJSON(dec, keyPath)
+			if err != nil {
+				return nil, err
+			}
+			obj.Body = append(obj.Body, &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: value})
+		}
+		// The closing }
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("bulbason: invalid JSON: %w", err)
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("bulbason: invalid JSON token %v", tok)
+}
+
+// sectionsFromObjects turns the objects of a document or section body into
+// sections, and arrays holding only objects into multi-line arrays.
+func sectionsFromObjects(body []ast.Entry) []ast.Entry {
+	for i, entry := range body {
+		kv := entry.(*ast.KeyValue)
+		switch v := kv.Value.(type) {
+		case *ast.ObjectLit:
+			body[i] = &ast.Section{Name: kv.Key, Body: sectionsFromObjects(v.Body)}
+		case *ast.ArrayLit:
+			if !onlyObjects(v.Elements) {
+				continue
+			}
+			v.Block = true
+			for _, elem := range v.Elements {
+				obj := elem.(*ast.ObjectLit)
+				obj.Inline = false
+				obj.Body = sectionsFromObjects(obj.Body)
+			}
+		}
+	}
+	return body
+}
+
+// onlyObjects reports whether values is not empty and holds only objects.
+func onlyObjects(values []ast.Value) bool {
+	for _, v := range values {
+		if _, ok := v.(*ast.ObjectLit); !ok {
+			return false
+		}
+	}
+	return len(values) > 0
+}
@@ -0,0 +1,138 @@
+package bulbason
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToJSON(t *testing.T) {
+	input := `BULBA!
+name ~~> "Bulby <3"
+level ~> 1_000
+ratio ~> 0.5
+big ~> 123456789012345678901234567890
+when ~> 2024-05-01T12:00:00Z
+wait ~> 1h30m
+data ~> 0b64"aGVsbG8="
+shiny ~> NotVeryEffective
+owner ~> MissingNo
+tags ~> <| "a", { x ~> 1 } |>
+(o) stats (o)
+    hp ~> 45
+    hp ~> 50
+moves ~~> <|
+(o)
+    power ~~> 40
+|>
+`
+	doc, err := ParseAST(input, LargeIntegers(LargeIntegerBig))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := ToJSON(doc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"name":"Bulby <3","level":1000,"ratio":0.5,"big":123456789012345678901234567890,` +
+		`"when":"2024-05-01T12:00:00Z","wait":"1h30m","data":"aGVsbG8=","shiny":false,"owner":null,` +
+		`"tags":["a",{"x":1}],"stats":{"hp":50},"moves":[{"power":40}]}`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	doc, _ = ParseAST("BULBA!\nhp ~> Eternatus\n")
+	if _, err := ToJSON(doc); err == nil || !strings.Contains(err.Error(), "hp") {
+		t.Errorf("Expected an error naming hp, got %v", err)
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	input := `{
+		"app_name": "Pokedex_API",
+		"port": 8080,
+		"ratio": 1.5e3,
+		"debug": true,
+		"owner": null,
+		"x-trace": "abc",
+		"tags": ["a", "b", {"c": 1}],
+		"empty": [],
+		"database": {"host": "127.0.0.1", "pool": {"max": 10}},
+		"servers": [{"host": "alpha", "limits": {"rps": 5}}, {"host": "beta"}]
+	}`
+	doc, err := FromJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+app_name ~~~~> "Pokedex_API"
+port ~~~~> 8080
+ratio ~~~~> 1.5e3
+debug ~~~~> SuperEffective
+owner ~~~~> MissingNo
+"x-trace" ~~~~> "abc"
+tags ~~~~> <| "a", "b", { c ~~~~> 1 } |>
+empty ~~~~> <| |>
+(o) database (o)
+    host ~~~~> "127.0.0.1"
+    (O) pool (O)
+        max ~~~~> 10
+servers ~~~~> <|
+(o)
+    host ~~~~> "alpha"
+    (O) limits (O)
+        rps ~~~~> 5
+(o)
+    host ~~~~> "beta"
+|>
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	// The document reads back as the same data, and converts back to JSON.
+	parsed, err := ParseAST(buf.String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := ToJSON(parsed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var want, got interface{}
+	json.Unmarshal([]byte(input), &want)
+	json.Unmarshal(out, &got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", want, got)
+	}
+}
+
+func TestFromJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+	}{
+		{"Not An Object", `[1, 2]`, "expected an object"},
+		{"Trailing Data", `{} {}`, "unexpected data"},
+		{"Invalid JSON", `{"a": }`, "invalid JSON"},
+		{"Nested Arrays", `{"a": {"b": [1, [2]]}}`, "a.b[1]"},
+		{"Number Range", `{"a": 1e400}`, "not a valid number"},
+		{"Reserved Key", `{"a": [{"Charizard": 1}]}`, `a[0].Charizard`},
+		{"Quote In Key", `{"my\"key": 1}`, "not a valid key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromJSON([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
@@ -1,11 +1,15 @@
-package main
+package bulbason
 
 import (
 	"bufio"
+	"context"
+	"encoding/base64"
 	"errors"
-	"fmt"
-	"regexp"
+	"io"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // TokenType represents the type of a token
@@ -13,201 +17,1142 @@ import (
 type TokenType int
 
 const (
-	TOKEN_HEADER        TokenType = iota // The "BULBA!" header
-	TOKEN_INDENT                  // Value holds the level (0, 1, 2, 3)
-	TOKEN_SECTION_OPEN            // (o), (O), (@) - Marks start of a section
-	TOKEN_SECTION_CLOSE           // (o), (O), (@) - Marks end of a section header
-	TOKEN_IDENTIFIER              // Keys (e.g., app_name, host)
-	TOKEN_VINE_WHIP               // The assignment operator ~~~~>
-	TOKEN_STRING                  // String literals "value"
-	TOKEN_NUMBER                  // Numeric values 123, 4.5
-	TOKEN_BOOL                    // Boolean values (SuperEffective, NotVeryEffective)
-	TOKEN_NULL                    // Null value (MissingNo)
-	TOKEN_ARRAY_START             // <|
-	TOKEN_ARRAY_END               // |>
-	TOKEN_COMMA                   // ,
-	TOKEN_EOF                     // End of File marker
+	TOKEN_HEADER        TokenType = iota // The "BULBA!" header, or a versioned one such as "BULBA!v2"
+	TOKEN_INDENT                         // Value holds the level (0, 1, 2, 3)
+	TOKEN_SECTION_OPEN                   // (o), (O), (@), (@@)... - Marks start of a section
+	TOKEN_SECTION_CLOSE                  // (o), (O), (@), (@@)... - Marks end of a section header
+	TOKEN_IDENTIFIER                     // Keys (e.g., app_name, host)
+	TOKEN_VINE_WHIP                      // The assignment operator ~~~~>
+	TOKEN_STRING                         // String literals "value"
+	TOKEN_NUMBER                         // Numeric values 123, 4.5
+	TOKEN_BOOL                           // Boolean values (SuperEffective, NotVeryEffective)
+	TOKEN_NULL                           // Null value (MissingNo)
+	TOKEN_ARRAY_START                    // <|
+	TOKEN_ARRAY_END                      // |>
+	TOKEN_COMMA                          // ,
+	TOKEN_EOF                            // End of File marker
+	TOKEN_COMMENT                        // zZz comment, only emitted with the ParseComments option
+	TOKEN_RAW_STRING                     // Raw string literals `value`
+	TOKEN_OBJECT_START                   // { of an inline object
+	TOKEN_OBJECT_END                     // } of an inline object
+	TOKEN_TIMESTAMP                      // RFC 3339 timestamps 2024-05-01T12:00:00Z
+	TOKEN_DURATION                       // Durations 30s, 1h30m
+	TOKEN_BYTES                          // Base64 byte strings 0b64"aGVsbG8="
+	TOKEN_TRANSFORM                      // Transform, the keyword of an include directive
+	TOKEN_REFERENCE                      // Copycat references, Literal holding the path
+	TOKEN_FORME                          // Profile of a section header, Literal holding its name
+	TOKEN_LITERAL                        // Value matched by a LiteralMatcher of a Dialect
 )
 
 type Token struct {
 	Type    TokenType
-	Literal string // The actual text content of the token
+	Literal string // The actual text content of the token; for INDENT, the whole source line
 	Line    int    // Line number for error reporting
+	Column  int    // 1-based column where the token starts
 	Level   int    // For INDENT and SECTION tokens, stores the nesting level
+
+	// For tokens spanning several lines, such as heredoc strings, or whose
+	// Literal is shorter than their source text, such as numbers with digit
+	// separators, the position of their last character. Zero otherwise.
+	EndLine   int
+	EndColumn int
 }
 
-// Lexer performs lexical analysis on the input string.
+// Lex performs lexical analysis on the input string.
 // It reads the input line by line and converts it into a slice of Tokens.
 // This separates the "what is this text?" logic from the "what does this structure mean?" logic.
-func Lex(content string) ([]Token, error) {
-	var tokens []Token
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	lineNum := 0
-	firstLine := true
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineNum++
-
-		// Header check: The very first line must be the specific cry.
-		if firstLine {
-			if line != "BULBA!" {
-				return nil, errors.New("Status: Fainted")
+// A Lexer hands out the same tokens one at a time.
+func Lex(content string, opts ...ParseOption) ([]Token, error) {
+	return lexInto(nil, newStringLexer(content, newParseConfig(opts)))
+}
+
+// bytesPerToken is roughly how many bytes of a typical document make up one
+// token. It is used to size the token slice up front.
+const bytesPerToken = 6
+
+// lexInto appends all the tokens of l to dst, which lets callers reuse a
+// buffer. If the length of the input is known, dst is grown to the expected
+// number of tokens before lexing starts.
+//
+// When errors are being collected, a bad line is dropped and lexing carries
+// on; the tokens are then returned together with an ErrorList.
+func lexInto(dst []Token, l *Lexer) ([]Token, error) {
+	tokens := dst
+	if l.size > l.read {
+		tokens = slices.Grow(tokens, (l.size-l.read)/bytesPerToken+1)
+	}
+	var errs ErrorList
+	for {
+		tok, err := l.Next()
+		if err != nil {
+			pe, ok := err.(*ParseError)
+			if !ok || !l.cfg.collectErrors {
+				return nil, err
 			}
-			tokens = append(tokens, Token{Type: TOKEN_HEADER, Literal: "BULBA!", Line: lineNum})
-			firstLine = false
+			errs = append(errs, pe)
 			continue
 		}
+		tokens = append(tokens, tok)
+		if tok.Type == TOKEN_EOF {
+			break
+		}
+	}
+
+	if len(errs) > 0 {
+		return tokens, errs
+	}
+	return tokens, nil
+}
+
+// Lexer reads tokens from a document one at a time, so that tools can walk
+// documents of any size while holding no more than a line of tokens.
+//
+// A line is only handed out once it is complete: the key of a heredoc comes
+// out when its closing quotes have been read, together with the content.
+type Lexer struct {
+	// Lines come from reader or, for input that is already in memory, are
+	// cut from rest. Token literals then share the memory of the input
+	// instead of copying each line.
+	reader *bufio.Reader
+	buf    []byte // The line being read from reader
+	rest   string
+	size   int // Length of the input if known, or 0
+
+	cfg       *parseConfig
+	base      *parseConfig // cfg before the options of a header's version
+	lineNum   int
+	firstLine bool
+
+	tokens []Token // Tokens of the current line
+	pos    int     // Next token of tokens to hand out
+	read   int     // Bytes of input consumed, line endings included
+	count  int     // Tokens handed out
+	done   bool    // The input is exhausted
+	err    error   // Read or context error, returned by every later call
+
+	// 'ctx', if set, is checked every few lines so that a long read can be
+	// abandoned.
+	ctx context.Context
+
+	// 'open' is the heredoc whose lines are currently being read, if any.
+	open *heredoc
+	// 'sleeping' is the block comment being read, if any.
+	sleeping *blockComment
 
-		// Handle Comments (Sleep Powder)
-		// We strip out comments before further processing.
-		if idx := strings.Index(line, "zZz"); idx != -1 {
-			line = line[:idx]
+	// 'stream' makes a BULBA! line after the first end the document, so
+	// that a Decoder can read several documents from one input. 'header'
+	// holds the line that ended the current document that way, and
+	// 'offset' is where in the input the next one starts.
+	stream bool
+	header string
+	offset int
+}
+
+// NewLexer returns a Lexer reading from r. Of the options, only
+// ParseComments, UseDialect, IndentWidth, ExpandTabs and the limits on the
+// input affect lexing.
+func NewLexer(r io.Reader, opts ...ParseOption) *Lexer {
+	return newLexer(r, newParseConfig(opts))
+}
+
+func newLexer(r io.Reader, cfg *parseConfig) *Lexer {
+	l := &Lexer{reader: bufio.NewReader(r), cfg: cfg, base: cfg, firstLine: true}
+	if lr, ok := r.(interface{ Len() int }); ok {
+		l.size = lr.Len()
+	}
+	return l
+}
+
+// newStringLexer returns a Lexer reading content.
+func newStringLexer(content string, cfg *parseConfig) *Lexer {
+	return &Lexer{rest: content, size: len(content), cfg: cfg, base: cfg, firstLine: true}
+}
+
+// readLine returns the next line of input without its line ending, following
+// the rules of bufio.ScanLines. It reports false at the end of the input or
+// on a read error, which is kept in l.err.
+//
+// Lines may be of any length. A line read from reader that is past the line
+// or input size limit is cut short once the limit is exceeded, so that it
+// is not held in memory whole only to be rejected.
+func (l *Lexer) readLine() (string, bool) {
+	if l.reader != nil {
+		return l.readLineFromReader()
+	}
+	if l.rest == "" {
+		return "", false
+	}
+	line := l.rest
+	if idx := strings.IndexByte(l.rest, '\n'); idx != -1 {
+		line, l.rest = l.rest[:idx], l.rest[idx+1:]
+	} else {
+		l.rest = ""
+	}
+	l.read = l.size - len(l.rest)
+	return strings.TrimSuffix(line, "\r"), true
+}
+
+func (l *Lexer) readLineFromReader() (string, bool) {
+	l.buf = l.buf[:0]
+	for {
+		chunk, err := l.reader.ReadSlice('\n')
+		l.buf = append(l.buf, chunk...)
+		l.read += len(chunk)
+		if err == bufio.ErrBufferFull {
+			// Room for the longest line allowed and a CRLF line ending.
+			if limit := l.cfg.maxLineLength; limit > 0 && len(l.buf) > limit+2 {
+				break
+			}
+			if limit := l.cfg.maxInputSize; limit > 0 && l.read-l.offset > limit {
+				break
+			}
+			continue
+		}
+		if err == io.EOF && len(l.buf) > 0 {
+			break
+		}
+		if err != nil {
+			if err != io.EOF {
+				l.err = err
+			}
+			return "", false
+		}
+		break
+	}
+	line := l.buf
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return string(line), true
+}
+
+// Next returns the next token. Once the input is exhausted it returns a
+// TOKEN_EOF token, and keeps doing so on every later call.
+//
+// An invalid line yields a *ParseError and none of its tokens. Lexing can
+// carry on past it by calling Next again. Any other error comes from reading
+// the input and is final.
+func (l *Lexer) Next() (Token, error) {
+	for {
+		if l.open == nil && l.sleeping == nil && l.pos < len(l.tokens) {
+			// A line is handed out whole or, past the token limit, not at all.
+			if limit := l.cfg.maxTokens; limit > 0 && l.pos == 0 && l.count+len(l.tokens) > limit {
+				return Token{}, l.stop(errorAt(CodeTokenCount, l.tokens[limit-l.count]).explain("more than %d tokens, the MaxTokens limit", limit), "")
+			}
+			tok := l.tokens[l.pos]
+			l.pos++
+			l.count++
+			return tok, nil
+		}
+		if l.err != nil {
+			return Token{}, l.err
+		}
+		if l.done {
+			return Token{Type: TOKEN_EOF, Line: l.lineNum, Column: 1}, nil
+		}
+		if l.open == nil && l.sleeping == nil {
+			l.tokens, l.pos = l.tokens[:0], 0
 		}
 
-		// Check for tabs (Poison Type)
-		// Tabs are strictly forbidden.
-		if strings.Contains(line, "\t") {
-			return nil, errors.New("Poison Type: Tab character detected")
+		if l.lineNum%linesPerContextCheck == 0 {
+			if err := l.contextErr(); err != nil {
+				l.err = err
+				return Token{}, err
+			}
 		}
 
-		// Trim right whitespace
-		line = strings.TrimRight(line, " \r\n")
-		if len(line) == 0 {
+		start := l.read
+		line, ok := l.readLine()
+		if !ok {
+			if l.err != nil {
+				return Token{}, l.err
+			}
+			l.done = true
+			if err := l.unclosed(); err != nil {
+				return Token{}, err
+			}
+			continue
+		}
+		l.lineNum++
+		if _, ok := headerVersion(line); ok && l.stream && !l.firstLine && l.open == nil && l.sleeping == nil {
+			l.done, l.header, l.offset = true, line, start
 			continue
 		}
+		if limit := l.cfg.maxInputSize; limit > 0 && l.read-l.offset > limit {
+			// Past the end of the line, the limit falls in its line ending.
+			col := min(limit-(start-l.offset), len(line)) + 1
+			return Token{}, l.stop(newParseError(CodeInputSize, l.lineNum, col).explain("document larger than %d bytes, the MaxInputSize limit", limit), line)
+		}
+		if limit := l.cfg.maxLineLength; limit > 0 && len(line) > limit {
+			return Token{}, l.stop(newParseError(CodeLineLength, l.lineNum, limit+1).explain("line of %d bytes, longer than the MaxLineLength limit of %d", len(line), limit), line)
+		}
 
-		// Count Indentation (Solar Beam Rule)
-		// We count spaces to determine the indentation level.
-		indentCount := 0
-		for _, char := range line {
-			if char == ' ' {
-				indentCount++
-			} else {
-				break
+		lineStart := len(l.tokens)
+		err := l.lexLine(line)
+		l.firstLine = false
+		if err != nil {
+			// Attach the source line so the error can point at it.
+			var pe *ParseError
+			if errors.As(err, &pe) && pe.Snippet == "" {
+				pe.Snippet = line
 			}
+			// Forget whatever the bad line produced before failing.
+			l.tokens = l.tokens[:lineStart]
+			return Token{}, err
 		}
+	}
+}
 
-		if indentCount%4 != 0 {
-			return nil, errors.New(ErrIndentation)
+// nextDocument moves a stream Lexer on to the next document, skipping
+// whatever is left of the current one. It reports false when there is no
+// next document, or returns the read or context error that ended the input.
+// A header of a version the options do not know fails with its ParseError,
+// and the next call moves on to the document after it. The limits on the
+// size of the input and the number of tokens apply to each document in turn.
+func (l *Lexer) nextDocument() (bool, error) {
+	for !l.done {
+		tok, err := l.Next()
+		if _, ok := err.(*ParseError); err != nil && !ok {
+			return false, err
+		}
+		if tok.Type == TOKEN_EOF {
+			break
+		}
+	}
+	if l.err != nil {
+		return false, l.err
+	}
+	if l.header == "" {
+		return false, nil
+	}
+	// The header was read as the end of the last document; it is lexed as
+	// the start of this one.
+	header := l.header
+	l.tokens, l.pos, l.count = l.tokens[:0], 0, 0
+	l.done, l.header, l.firstLine = false, "", true
+	err := l.lexLine(header)
+	l.firstLine = false
+	if err != nil {
+		var pe *ParseError
+		if errors.As(err, &pe) {
+			pe.Snippet = header
 		}
-		level := indentCount / 4
-		// Emit an INDENT token so the parser knows the nesting level of this line.
-		tokens = append(tokens, Token{Type: TOKEN_INDENT, Level: level, Line: lineNum})
+		return false, err
+	}
+	return true, nil
+}
 
-		trimmedLine := strings.TrimSpace(line)
+// linesPerContextCheck is how many lines the Lexer reads between checks of
+// its context.
+const linesPerContextCheck = 64
 
-		// Tokenize the rest of the line
-		err := tokenizeLine(&tokens, trimmedLine, lineNum)
-		if err != nil {
-			return nil, err
+// contextErr returns the error of the Lexer's context, or nil if it has none
+// or the context is not done.
+func (l *Lexer) contextErr() error {
+	if l.ctx == nil {
+		return nil
+	}
+	return l.ctx.Err()
+}
+
+// stop ends lexing because of a limit, dropping whatever has not been handed
+// out yet, and returns pe with its snippet set to line.
+func (l *Lexer) stop(pe *ParseError, line string) *ParseError {
+	pe.Snippet = line
+	l.done = true
+	l.tokens, l.pos = l.tokens[:0], 0
+	l.open, l.sleeping = nil, nil
+	return pe
+}
+
+// lexLine feeds a source line to the open heredoc or block comment, if there
+// is one, or tokenizes it.
+func (l *Lexer) lexLine(line string) error {
+	lineNum, lineStart := l.lineNum, len(l.tokens)
+	if l.cfg.expandTabs {
+		width := l.cfg.tabWidth
+		if width <= 0 {
+			width = l.cfg.indent()
 		}
+		line = expandIndent(line, width)
+	}
+	if l.firstLine {
+		// The first line of a fragment is code, unless it is the header.
+		if _, ok := headerVersion(line); !ok && l.base.fragment {
+			l.firstLine = false
+		} else if err := l.useVersion(line, lineNum); err != nil {
+			return err
+		}
+	}
+	if l.cfg.diagnostics != nil && l.open == nil {
+		// Run once the line is lexed, whether it is valid or not.
+		defer func() {
+			diagnoseLine(line, lineNum, l.tokens[min(lineStart, len(l.tokens)):], l.cfg)
+		}()
+	}
+	switch {
+	case l.open != nil:
+		// Heredoc lines are raw text, so they bypass normal tokenizing.
+		done, err := l.open.feed(l.tokens, line, lineNum)
+		if done {
+			l.open = nil
+		}
+		return err
+	case l.sleeping != nil:
+		done, err := l.sleeping.feed(&l.tokens, line, lineNum, 1, l.cfg)
+		if done {
+			l.sleeping = nil
+		}
+		return err
 	}
 
-	tokens = append(tokens, Token{Type: TOKEN_EOF, Line: lineNum})
-	return tokens, nil
+	if idx := blockCommentIndex(line, l.firstLine); idx != -1 {
+		// The code before the comment is lexed as a line of its own. The
+		// comment is opened even if the code is bad, so that its lines are
+		// not taken for code.
+		codeErr := lexLine(&l.tokens, line[:idx], lineNum, l.firstLine, l.cfg)
+		comment := &blockComment{token: Token{Type: TOKEN_COMMENT, Line: lineNum, Column: idx + 1}, source: line}
+		done, err := comment.feed(&l.tokens, line[idx:], lineNum, idx+1, l.cfg)
+		if !done {
+			l.sleeping = comment
+		}
+		if codeErr != nil {
+			return codeErr
+		}
+		if done && err == nil {
+			l.open = openHeredoc(l.tokens, lineStart, line)
+		}
+		return err
+	}
+
+	if err := lexLine(&l.tokens, line, lineNum, l.firstLine, l.cfg); err != nil {
+		return err
+	}
+	l.open = openHeredoc(l.tokens, lineStart, line)
+	return nil
 }
 
-// tokenizeLine processes a single line after indentation has been handled.
-func tokenizeLine(tokens *[]Token, line string, lineNum int) error {
-	// Check for Section Headers (Evolution Stages)
-	// We look for patterns like (o) key (o)
-	if strings.HasPrefix(line, "(o) ") && strings.HasSuffix(line, " (o)") {
-		*tokens = append(*tokens, Token{Type: TOKEN_SECTION_OPEN, Level: 1, Line: lineNum})
-		key := line[4 : len(line)-4]
-		*tokens = append(*tokens, Token{Type: TOKEN_IDENTIFIER, Literal: key, Line: lineNum})
-		*tokens = append(*tokens, Token{Type: TOKEN_SECTION_CLOSE, Level: 1, Line: lineNum})
+// headerVersion returns the version of a header line: 1 for BULBA!, and n
+// for BULBA!vn, n being a positive integer written without leading zeros.
+// It reports false if line is not a header.
+func headerVersion(line string) (int, bool) {
+	if line == "BULBA!" {
+		return 1, true
+	}
+	digits, ok := strings.CutPrefix(line, "BULBA!v")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 1 || strconv.Itoa(n) != digits {
+		return 0, false
+	}
+	return n, true
+}
+
+// useVersion sets the options the document starting with header, on line
+// lineNum, is read with: those of the Lexer, and then those registered for
+// the version of the header, which must be known. A line that is not a
+// header is left for lexLine to reject.
+func (l *Lexer) useVersion(header string, lineNum int) error {
+	l.cfg = l.base
+	version, ok := headerVersion(header)
+	if !ok {
 		return nil
 	}
-	if strings.HasPrefix(line, "(O) ") && strings.HasSuffix(line, " (O)") {
-		*tokens = append(*tokens, Token{Type: TOKEN_SECTION_OPEN, Level: 2, Line: lineNum})
-		key := line[4 : len(line)-4]
-		*tokens = append(*tokens, Token{Type: TOKEN_IDENTIFIER, Literal: key, Line: lineNum})
-		*tokens = append(*tokens, Token{Type: TOKEN_SECTION_CLOSE, Level: 2, Line: lineNum})
+	opts, known := l.base.versions[version]
+	if !known && version != 1 {
+		return newParseError(CodeVersion, lineNum, len("BULBA!")+1).explain("version %d of the format is not known, see the Versions option", version)
+	}
+	if len(opts) == 0 {
 		return nil
 	}
-	if strings.HasPrefix(line, "(@) ") && strings.HasSuffix(line, " (@)") {
-		*tokens = append(*tokens, Token{Type: TOKEN_SECTION_OPEN, Level: 3, Line: lineNum})
-		key := line[4 : len(line)-4]
-		*tokens = append(*tokens, Token{Type: TOKEN_IDENTIFIER, Literal: key, Line: lineNum})
-		*tokens = append(*tokens, Token{Type: TOKEN_SECTION_CLOSE, Level: 3, Line: lineNum})
+	cfg := *l.base
+	cfg.keyRules = slices.Clip(cfg.keyRules)
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	l.cfg = &cfg
+	return nil
+}
+
+// expandIndent replaces the tabs in the indentation of line with spaces up to
+// the next multiple of width columns, for the ExpandTabs option.
+func expandIndent(line string, width int) string {
+	end := len(line) - len(strings.TrimLeft(line, " \t"))
+	if !strings.Contains(line[:end], "\t") {
+		return line
+	}
+	var b strings.Builder
+	for _, c := range line[:end] {
+		if c == '\t' {
+			b.WriteString(strings.Repeat(" ", width-b.Len()%width))
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(line[end:])
+	return b.String()
+}
+
+// unclosed reports a heredoc or block comment that is still open when the
+// input ends.
+func (l *Lexer) unclosed() error {
+	var pe *ParseError
+	switch {
+	case l.open != nil:
+		tok := l.tokens[l.open.index]
+		pe = newParseError(CodeSyntax, tok.Line, tok.Column).explain(`heredoc never closed with """`)
+		pe.Snippet = l.open.source
+	case l.sleeping != nil:
+		pe = newParseError(CodeSyntax, l.sleeping.token.Line, l.sleeping.token.Column).explain("block comment never closed with %s", blockCommentClose)
+		pe.Snippet = l.sleeping.source
+	default:
 		return nil
 	}
+	l.open, l.sleeping = nil, nil
+	return pe
+}
+
+// heredoc collects the lines of a multi-line string until its closing quotes.
+//
+// A heredoc is opened by a value of exactly three double quotes and closed by
+// a line holding only three double quotes. The indentation of the closing
+// line is removed from every line of the content:
+//
+//	query ~~> """
+//	    SELECT *
+//	    FROM pokedex
+//	    """
+type heredoc struct {
+	index  int      // Position of the STRING token that receives the content
+	source string   // The line that opened the heredoc, for error snippets
+	lines  []string // Raw content lines read so far
+}
+
+// openHeredoc checks whether the tokens produced for the line starting at
+// lineStart end with a heredoc opener, and returns its state if they do.
+func openHeredoc(tokens []Token, lineStart int, source string) *heredoc {
+	for i := lineStart + 1; i < len(tokens); i++ {
+		// Only the value at the end of a key line can open a heredoc, not an
+		// array element or a member of an inline object.
+		// The lexer reads `"""` as a string holding a single quote.
+		if tokens[i].Type == TOKEN_STRING && tokens[i].Literal == "\"" && tokens[i-1].Type == TOKEN_VINE_WHIP &&
+			(i+1 == len(tokens) || tokens[i+1].Type == TOKEN_COMMENT) {
+			return &heredoc{index: i, source: source}
+		}
+	}
+	return nil
+}
+
+// feed adds a line to the heredoc. It reports whether the line closed it, in
+// which case the content is stored in the heredoc's STRING token.
+func (h *heredoc) feed(tokens []Token, line string, lineNum int) (bool, error) {
+	line = strings.TrimRight(line, "\r")
+	if idx := strings.Index(line, "\t"); idx != -1 {
+		return false, newParseError(CodeTab, lineNum, idx+1)
+	}
+	if strings.TrimSpace(line) != "\"\"\"" {
+		h.lines = append(h.lines, line)
+		return false, nil
+	}
+
+	indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+	content := make([]string, len(h.lines))
+	for i, l := range h.lines {
+		if !strings.HasPrefix(l, indent) && strings.TrimSpace(l) == "" {
+			continue
+		}
+		if !strings.HasPrefix(l, indent) {
+			pe := newParseError(CodeIndentation, lineNum-len(h.lines)+i, 1).explain(`heredoc line indented less than its closing """`)
+			pe.Snippet = l
+			return true, pe
+		}
+		content[i] = l[len(indent):]
+	}
+
+	tok := &tokens[h.index]
+	tok.Literal = strings.Join(content, "\n")
+	tok.EndLine = lineNum
+	tok.EndColumn = len(indent) + 3
+	return true, nil
+}
+
+// Markers of the comment forms. A line comment runs from commentMarker to the
+// end of the line. A block comment runs from blockCommentOpen to
+// blockCommentClose and may span several lines:
+//
+//	zZz[ Hypnosis puts
+//	     several lines to sleep ]zZz
+const (
+	commentMarker     = "zZz"
+	blockCommentOpen  = "zZz["
+	blockCommentClose = "]zZz"
+)
+
+// commentIndex returns the index of the comment marker that starts a comment
+// on line, or -1 if there is none. A marker inside a double-quoted or raw
+// string is part of the string. As tokenizeValue takes a value from its
+// opening quote to the quote it ends with, a quote only closes a string where
+// a string can end: before the end of the line, a comment, or the comma, |>,
+// }, Vine Whip or section marker following it. Any other quote is part of the
+// string.
+func commentIndex(line string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote && closesString(line[i+1:]) {
+				quote = 0
+			}
+		case strings.HasPrefix(line[i:], `"""`):
+			// A heredoc opener, not the start of a string.
+			i += 2
+		case c == '"' || c == '`':
+			quote = c
+		case strings.HasPrefix(line[i:], commentMarker):
+			return i
+		}
+	}
+	return -1
+}
+
+// closesString reports whether a quote followed by rest can close a string.
+func closesString(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t")
+	if rest == "" || strings.HasPrefix(rest, commentMarker) {
+		return true
+	}
+	switch rest[0] {
+	case ',', '}', '~', '(':
+		return true
+	}
+	return strings.HasPrefix(rest, "|>")
+}
+
+// blockCommentIndex returns the index at which a block comment starts on
+// line, or -1 if the line has none.
+func blockCommentIndex(line string, firstLine bool) int {
+	if firstLine {
+		return -1
+	}
+	idx := commentIndex(line)
+	if idx == -1 || !strings.HasPrefix(line[idx:], blockCommentOpen) {
+		return -1
+	}
+	return idx
+}
+
+// blockComment collects the lines of a block comment until it is closed.
+type blockComment struct {
+	token  Token    // The COMMENT token that receives the text
+	source string   // The line that opened the comment, for error snippets
+	lines  []string // Text read so far
+}
+
+// feed adds text, which starts at column col of a source line, to the block
+// comment. It reports whether the text closed the comment, in which case the
+// COMMENT token is emitted if comments are being kept. Nothing but spaces may
+// follow the closing marker.
+func (b *blockComment) feed(tokens *[]Token, text string, lineNum int, col int, cfg *parseConfig) (bool, error) {
+	from := 0
+	if len(b.lines) == 0 {
+		from = len(blockCommentOpen)
+	}
+	idx := strings.Index(text[from:], blockCommentClose)
+	if idx == -1 {
+		b.lines = append(b.lines, strings.TrimRight(text, " \r"))
+		return false, nil
+	}
+	end := from + idx + len(blockCommentClose)
+	if rest := strings.TrimRight(text[end:], " \r"); rest != "" {
+		return true, newParseError(CodeSyntax, lineNum, col+end+len(text[end:])-len(strings.TrimLeft(text[end:], " "))).explain("text after the end of a block comment")
+	}
+	if cfg.parseComments {
+		tok := b.token
+		tok.Literal = strings.Join(append(b.lines, text[:end]), "\n")
+		tok.EndLine, tok.EndColumn = lineNum, col+end-1
+		*tokens = append(*tokens, tok)
+	}
+	return true, nil
+}
+
+// lexLine tokenizes a single source line.
+func lexLine(tokens *[]Token, line string, lineNum int, firstLine bool, cfg *parseConfig) error {
+	source := line
+
+	// Header check: The very first line must be the specific cry.
+	if firstLine {
+		if _, ok := headerVersion(line); !ok {
+			return newParseError(CodeHeader, lineNum, 1)
+		}
+		*tokens = append(*tokens, Token{Type: TOKEN_HEADER, Literal: line, Line: lineNum, Column: 1})
+		return nil
+	}
+
+	// Handle Comments (Sleep Powder)
+	// We strip out comments before further processing, keeping them aside
+	// as a token if the caller wants to preserve them.
+	var comment *Token
+	if idx := commentIndex(line); idx != -1 {
+		if cfg.parseComments {
+			comment = &Token{Type: TOKEN_COMMENT, Literal: strings.TrimRight(line[idx:], " \t\r"), Line: lineNum, Column: idx + 1}
+		}
+		line = line[:idx]
+	}
+
+	// Check for tabs (Poison Type)
+	// Tabs are strictly forbidden, but for those of the indentation that
+	// ExpandTabs replaced with spaces.
+	if idx := strings.Index(line, "\t"); idx != -1 {
+		return newParseError(CodeTab, lineNum, idx+1)
+	}
+
+	// Trim right whitespace
+	line = strings.TrimRight(line, " \r\n")
+	if len(line) == 0 {
+		if comment != nil {
+			*tokens = append(*tokens, *comment)
+		}
+		return nil
+	}
+
+	// Count Indentation (Solar Beam Rule)
+	// We count spaces to determine the indentation level.
+	indentCount := 0
+	for _, char := range line {
+		if char == ' ' {
+			indentCount++
+		} else {
+			break
+		}
+	}
+
+	if indentCount%cfg.indent() != 0 {
+		return newParseError(CodeIndentation, lineNum, indentCount+1).explain("indentation must be a multiple of %d spaces, got %d", cfg.indent(), indentCount)
+	}
+	level := indentCount / cfg.indent()
+	// Emit an INDENT token so the parser knows the nesting level of this line.
+	// It carries the source line so that parser errors can quote it.
+	*tokens = append(*tokens, Token{Type: TOKEN_INDENT, Literal: source, Level: level, Line: lineNum, Column: 1})
+
+	trimmedLine := strings.TrimSpace(line)
+
+	// Tokenize the rest of the line
+	if err := tokenizeLine(tokens, trimmedLine, lineNum, indentCount+1, cfg); err != nil {
+		return err
+	}
+	if comment != nil {
+		*tokens = append(*tokens, *comment)
+	}
+	return nil
+}
+
+// tokenizeLine processes a single line after indentation has been handled.
+// col is the 1-based column at which line starts in the source.
+func tokenizeLine(tokens *[]Token, line string, lineNum int, col int, cfg *parseConfig) error {
+	// Check for Array Block Elements and Ends
+	// Inside a multi-line array each element starts with a bare marker and
+	// the array is closed by a lone "|>".
+	if level := markerLevel(line); level > 0 {
+		*tokens = append(*tokens, Token{Type: TOKEN_SECTION_OPEN, Level: level, Line: lineNum, Column: col})
+		return nil
+	}
+	if line == "|>" {
+		*tokens = append(*tokens, Token{Type: TOKEN_ARRAY_END, Line: lineNum, Column: col})
+		return nil
+	}
+
+	// Check for Section Headers (Evolution Stages)
+	// We look for patterns like (o) key (o), optionally followed by the
+	// profile the section belongs to, as in (o) key (o) Forme prod.
+	header, forme, hasForme := cutForme(line)
+	if marker, _, ok := strings.Cut(header, " "); ok {
+		if level := markerLevel(marker); level > 0 && len(header) > 2*len(marker)+2 && strings.HasSuffix(header, " "+marker) {
+			tokenizeSection(tokens, header, level, lineNum, col)
+			if hasForme {
+				*tokens = append(*tokens, Token{Type: TOKEN_FORME, Literal: forme, Line: lineNum, Column: col + len(line) - len(forme)})
+			}
+			return nil
+		}
+	}
 
 	// Check for Key-Value Pairs
-	// Regex: key ~~~~> value
-	re := regexp.MustCompile(`^([a-zA-Z0-9_]+)\s*(~{1,}>)\s*(.*)$`)
-	matches := re.FindStringSubmatch(line)
-	if matches != nil {
-		key := matches[1]
-		// vine := matches[2]
-		valStr := matches[3]
+	if ok, err := tokenizeKeyValue(tokens, line, lineNum, col, cfg); ok {
+		return err
+	}
 
-		*tokens = append(*tokens, Token{Type: TOKEN_IDENTIFIER, Literal: key, Line: lineNum})
-		*tokens = append(*tokens, Token{Type: TOKEN_VINE_WHIP, Line: lineNum})
+	// Check for Transform Directives
+	// "Transform" followed by a quoted path includes another file. A key
+	// named Transform was handled above, as it is followed by a Vine Whip.
+	if rest, ok := strings.CutPrefix(line, "Transform "); ok {
+		*tokens = append(*tokens, Token{Type: TOKEN_TRANSFORM, Literal: "Transform", Line: lineNum, Column: col})
+		return tokenizeValue(tokens, rest, lineNum, col+len("Transform "), cfg)
+	}
+
+	return newParseError(CodeSyntax, lineNum, col).explain("expected a key-value pair such as key ~> value, or a section header")
+}
 
-		return tokenizeValue(tokens, valStr, lineNum)
+// cutForme splits a line ending in " Forme name" into what comes before and
+// the name. It reports false, returning the line whole, if there is no such
+// ending.
+func cutForme(line string) (string, string, bool) {
+	i := strings.LastIndex(line, " Forme ")
+	if i == -1 {
+		return line, "", false
+	}
+	name := line[i+len(" Forme "):]
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return r > 0x7f || !isKeyChar(byte(r)) }) != -1 {
+		return line, "", false
+	}
+	return strings.TrimRight(line[:i], " "), name, true
+}
+
+// assignment locates the parts of a key-value line.
+type assignment struct {
+	key       string
+	quoted    bool // The key is written between double quotes
+	keyEnd    int  // Offset just past the key, closing quote excluded
+	vineStart int
+	vineEnd   int
+	valStart  int
+}
+
+// scanAssignment splits text of the form `key ~~~~> value` or
+// `"my-key" ~~~~> value`. It reports false if text is not an assignment.
+func scanAssignment(text string) (assignment, bool) {
+	var a assignment
+	i := 0
+	if len(text) > 0 && text[0] == '"' {
+		// A quoted key holds anything but quotes, and at least one character.
+		end := strings.IndexByte(text[1:], '"')
+		if end < 1 {
+			return a, false
+		}
+		a.key, a.quoted, a.keyEnd = text[1:end+1], true, end+1
+		i = end + 2
+	} else {
+		for i < len(text) && isKeyChar(text[i]) {
+			i++
+		}
+		if i == 0 {
+			return a, false
+		}
+		a.key, a.keyEnd = text[:i], i
 	}
 
-	return errors.New(ErrSyntax)
+	i = skipSpace(text, i)
+	a.vineStart = i
+	for i < len(text) && text[i] == '~' {
+		i++
+	}
+	if i == a.vineStart || i == len(text) || text[i] != '>' {
+		return a, false
+	}
+	a.vineEnd = i + 1
+	a.valStart = skipSpace(text, a.vineEnd)
+	return a, true
+}
+
+// isKeyChar reports whether c may appear in an unquoted key.
+func isKeyChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || isDigit(c)
+}
+
+// skipSpace returns the offset of the first non-space byte of s at or after i.
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// tokenizeKeyValue emits the tokens for an assignment starting at col. It
+// reports whether text is an assignment at all.
+func tokenizeKeyValue(tokens *[]Token, text string, lineNum int, col int, cfg *parseConfig) (bool, error) {
+	a, ok := scanAssignment(text)
+	if !ok {
+		return false, nil
+	}
+	keyToken := Token{Type: TOKEN_IDENTIFIER, Literal: a.key, Line: lineNum, Column: col}
+	if a.quoted {
+		// The closing quote directly follows the key.
+		keyToken.EndLine, keyToken.EndColumn = lineNum, col+a.keyEnd
+	}
+
+	*tokens = append(*tokens, keyToken)
+	*tokens = append(*tokens, Token{Type: TOKEN_VINE_WHIP, Literal: text[a.vineStart:a.vineEnd], Line: lineNum, Column: col + a.vineStart})
+
+	return true, tokenizeValue(tokens, text[a.valStart:], lineNum, col+a.valStart, cfg)
+}
+
+// tokenizeSection emits the tokens for a section header such as "(o) key (o)".
+func tokenizeSection(tokens *[]Token, line string, level int, lineNum int, col int) {
+	width := len(sectionMarker(level))
+	*tokens = append(*tokens, Token{Type: TOKEN_SECTION_OPEN, Level: level, Line: lineNum, Column: col})
+	key := line[width+1 : len(line)-width-1]
+	keyToken := Token{Type: TOKEN_IDENTIFIER, Literal: key, Line: lineNum, Column: col + width + 1}
+	if len(key) > 2 && key[0] == '"' && key[len(key)-1] == '"' && !strings.Contains(key[1:len(key)-1], "\"") {
+		keyToken.Literal = key[1 : len(key)-1]
+		keyToken.EndLine, keyToken.EndColumn = lineNum, keyToken.Column+len(key)-1
+	}
+	*tokens = append(*tokens, keyToken)
+	*tokens = append(*tokens, Token{Type: TOKEN_SECTION_CLOSE, Level: level, Line: lineNum, Column: col + len(line) - width})
+}
+
+// sectionMarker returns the evolution marker for a section at level, which
+// must be at least 1. Past the Venusaur bulb "(@)" the bulb keeps growing:
+// "(@@)" for level 4, "(@@@)" for level 5 and so on.
+func sectionMarker(level int) string {
+	switch level {
+	case 1:
+		return "(o)"
+	case 2:
+		return "(O)"
+	}
+	return "(" + strings.Repeat("@", level-2) + ")"
+}
+
+// markerLevel returns the level of the evolution marker s, or 0 if s is not
+// a marker.
+func markerLevel(s string) int {
+	switch s {
+	case "(o)":
+		return 1
+	case "(O)":
+		return 2
+	}
+	if len(s) < 3 || s[0] != '(' || s[len(s)-1] != ')' || strings.Trim(s[1:len(s)-1], "@") != "" {
+		return 0
+	}
+	return len(s)
 }
 
 // tokenizeValue parses the value part of a key-value pair.
-func tokenizeValue(tokens *[]Token, valStr string, lineNum int) error {
+// col is the 1-based column at which valStr starts in the source.
+func tokenizeValue(tokens *[]Token, valStr string, lineNum int, col int, cfg *parseConfig) error {
+	col += len(valStr) - len(strings.TrimLeft(valStr, " "))
 	valStr = strings.TrimSpace(valStr)
 	if valStr == "" {
 		return nil
 	}
 
 	// String Literal
-	if strings.HasPrefix(valStr, "\"") && strings.HasSuffix(valStr, "\"") {
-		*tokens = append(*tokens, Token{Type: TOKEN_STRING, Literal: valStr[1 : len(valStr)-1], Line: lineNum})
+	if len(valStr) >= 2 && strings.HasPrefix(valStr, "\"") && strings.HasSuffix(valStr, "\"") {
+		*tokens = append(*tokens, Token{Type: TOKEN_STRING, Literal: valStr[1 : len(valStr)-1], Line: lineNum, Column: col})
+		return nil
+	}
+
+	// Raw String Literal: everything between the backticks is taken as is
+	if len(valStr) >= 2 && strings.HasPrefix(valStr, "`") && strings.HasSuffix(valStr, "`") {
+		*tokens = append(*tokens, Token{Type: TOKEN_RAW_STRING, Literal: valStr[1 : len(valStr)-1], Line: lineNum, Column: col})
 		return nil
 	}
 
 	// Boolean: SuperEffective (True)
 	if valStr == "SuperEffective" {
-		*tokens = append(*tokens, Token{Type: TOKEN_BOOL, Literal: "true", Line: lineNum})
+		*tokens = append(*tokens, Token{Type: TOKEN_BOOL, Literal: "true", Line: lineNum, Column: col})
 		return nil
 	}
 	// Boolean: NotVeryEffective (False)
 	if valStr == "NotVeryEffective" {
-		*tokens = append(*tokens, Token{Type: TOKEN_BOOL, Literal: "false", Line: lineNum})
+		*tokens = append(*tokens, Token{Type: TOKEN_BOOL, Literal: "false", Line: lineNum, Column: col})
 		return nil
 	}
 
 	// Null: MissingNo
 	if valStr == "MissingNo" {
-		*tokens = append(*tokens, Token{Type: TOKEN_NULL, Line: lineNum})
+		*tokens = append(*tokens, Token{Type: TOKEN_NULL, Line: lineNum, Column: col})
+		return nil
+	}
+
+	// The spellings a Dialect adds. Their token ends where the text does,
+	// not where the standard spelling would.
+	if d := cfg.dialect; d != nil {
+		end := col + len(valStr) - 1
+		switch {
+		case slices.Contains(d.True, valStr):
+			*tokens = append(*tokens, Token{Type: TOKEN_BOOL, Literal: "true", Line: lineNum, Column: col, EndLine: lineNum, EndColumn: end})
+			return nil
+		case slices.Contains(d.False, valStr):
+			*tokens = append(*tokens, Token{Type: TOKEN_BOOL, Literal: "false", Line: lineNum, Column: col, EndLine: lineNum, EndColumn: end})
+			return nil
+		case slices.Contains(d.Null, valStr):
+			*tokens = append(*tokens, Token{Type: TOKEN_NULL, Line: lineNum, Column: col, EndLine: lineNum, EndColumn: end})
+			return nil
+		}
+	}
+
+	// Reference: Copycat followed by the path of another value
+	if path, ok := strings.CutPrefix(valStr, "Copycat "); ok {
+		*tokens = append(*tokens, Token{Type: TOKEN_REFERENCE, Literal: strings.TrimLeft(path, " "), Line: lineNum, Column: col,
+			EndLine: lineNum, EndColumn: col + len(valStr) - 1})
+		return nil
+	}
+
+	// Array Block: a lone <| opens a multi-line array of sections
+	if valStr == "<|" {
+		*tokens = append(*tokens, Token{Type: TOKEN_ARRAY_START, Line: lineNum, Column: col})
 		return nil
 	}
 
-	// Array: <| ... |>
-	if strings.HasPrefix(valStr, "<|") && strings.HasSuffix(valStr, "|>") {
-		*tokens = append(*tokens, Token{Type: TOKEN_ARRAY_START, Line: lineNum})
-		inner := strings.TrimSpace(valStr[2 : len(valStr)-2])
-		if inner != "" {
-			parts := strings.Split(inner, ",")
-			for i, p := range parts {
+	// Array: <| ... |>, where "<|>" is too short to be both
+	if len(valStr) >= 4 && strings.HasPrefix(valStr, "<|") && strings.HasSuffix(valStr, "|>") {
+		*tokens = append(*tokens, Token{Type: TOKEN_ARRAY_START, Line: lineNum, Column: col})
+		inner := valStr[2 : len(valStr)-2]
+		if strings.TrimSpace(inner) != "" {
+			// offset tracks where each element starts so errors can point at it.
+			offset := 2
+			for i, p := range splitElements(inner) {
 				if i > 0 {
-					*tokens = append(*tokens, Token{Type: TOKEN_COMMA, Line: lineNum})
+					*tokens = append(*tokens, Token{Type: TOKEN_COMMA, Line: lineNum, Column: col + offset - 1})
 				}
 				// Recursive call for array elements
-				if err := tokenizeValue(tokens, strings.TrimSpace(p), lineNum); err != nil {
+				if err := tokenizeValue(tokens, p, lineNum, col+offset, cfg); err != nil {
+					return err
+				}
+				offset += len(p) + 1
+			}
+		}
+		*tokens = append(*tokens, Token{Type: TOKEN_ARRAY_END, Line: lineNum, Column: col + len(valStr) - 2})
+		return nil
+	}
+
+	// Inline Object: { key ~> value, ... }
+	if strings.HasPrefix(valStr, "{") && strings.HasSuffix(valStr, "}") {
+		*tokens = append(*tokens, Token{Type: TOKEN_OBJECT_START, Line: lineNum, Column: col})
+		inner := valStr[1 : len(valStr)-1]
+		if strings.TrimSpace(inner) != "" {
+			offset := 1
+			for i, p := range splitElements(inner) {
+				if i > 0 {
+					*tokens = append(*tokens, Token{Type: TOKEN_COMMA, Line: lineNum, Column: col + offset - 1})
+				}
+				memberCol := col + offset + len(p) - len(strings.TrimLeft(p, " "))
+				ok, err := tokenizeKeyValue(tokens, strings.TrimSpace(p), lineNum, memberCol, cfg)
+				if err != nil {
 					return err
 				}
+				if !ok {
+					return newParseError(CodeSyntax, lineNum, memberCol).explain("inline object member %q is not a key-value pair", strings.TrimSpace(p))
+				}
+				offset += len(p) + 1
 			}
 		}
-		*tokens = append(*tokens, Token{Type: TOKEN_ARRAY_END, Line: lineNum})
+		*tokens = append(*tokens, Token{Type: TOKEN_OBJECT_END, Line: lineNum, Column: col + len(valStr) - 1})
 		return nil
 	}
 
+	// Bytes: 0b64"..." holding standard base64, checked before numbers
+	if strings.HasPrefix(valStr, "0b64\"") && strings.HasSuffix(valStr, "\"") && len(valStr) >= 6 {
+		literal := valStr[5 : len(valStr)-1]
+		if _, err := base64.StdEncoding.DecodeString(literal); err != nil {
+			return newParseError(CodeType, lineNum, col).explain("bytes literal is not valid base64")
+		}
+		*tokens = append(*tokens, Token{Type: TOKEN_BYTES, Literal: literal, Line: lineNum, Column: col})
+		return nil
+	}
+
+	// Timestamp: RFC 3339, checked before numbers since it starts with digits.
+	// Anything without the dash after the year is skipped up front, as a
+	// failed time.Parse is costly.
+	if len(valStr) > len("2006-01-02") && valStr[4] == '-' {
+		if _, err := time.Parse(time.RFC3339Nano, valStr); err == nil {
+			*tokens = append(*tokens, Token{Type: TOKEN_TIMESTAMP, Literal: valStr, Line: lineNum, Column: col})
+			return nil
+		}
+	}
+
+	// Duration: 30s, 1h30m. A unit is required, so a plain 0 stays a number.
+	if last := valStr[len(valStr)-1]; last < '0' || last > '9' {
+		if _, err := time.ParseDuration(valStr); err == nil {
+			*tokens = append(*tokens, Token{Type: TOKEN_DURATION, Literal: valStr, Line: lineNum, Column: col})
+			return nil
+		}
+	}
+
 	// Number (Int/Float)
+	// Infinity and NaN have themed literals of their own.
+	if isNonFinite(valStr) {
+		*tokens = append(*tokens, Token{Type: TOKEN_NUMBER, Literal: valStr, Line: lineNum, Column: col})
+		return nil
+	}
+	// Digit separators are dropped here so that later stages only ever see
+	// plain numbers: 1_000_000 becomes 1000000.
+	if strings.Contains(valStr, "_") {
+		for i := 0; i < len(valStr); i++ {
+			if valStr[i] == '_' && (i == 0 || i == len(valStr)-1 || !isDigit(valStr[i-1]) || !isDigit(valStr[i+1])) {
+				return newParseError(CodeType, lineNum, col+i).explain("digit separator _ must stand between two digits")
+			}
+		}
+		literal := strings.ReplaceAll(valStr, "_", "")
+		if isNumberText(literal) {
+			*tokens = append(*tokens, Token{Type: TOKEN_NUMBER, Literal: literal, Line: lineNum, Column: col,
+				EndLine: lineNum, EndColumn: col + len(valStr) - 1})
+			return nil
+		}
+		return newParseError(CodeType, lineNum, col).explain("%q is not a number", valStr)
+	}
 	// Simple check: if it looks like a number
-	if _, err := fmt.Sscan(valStr, new(float64)); err == nil {
-		*tokens = append(*tokens, Token{Type: TOKEN_NUMBER, Literal: valStr, Line: lineNum})
+	if isNumberText(valStr) {
+		*tokens = append(*tokens, Token{Type: TOKEN_NUMBER, Literal: valStr, Line: lineNum, Column: col})
+		return nil
+	}
+
+	// Literals of a Dialect come last, so that they never change the
+	// meaning of a standard document.
+	if _, ok := cfg.dialect.match(valStr); ok {
+		*tokens = append(*tokens, Token{Type: TOKEN_LITERAL, Literal: valStr, Line: lineNum, Column: col})
 		return nil
 	}
 
-	return errors.New(ErrType)
+	return newParseError(CodeType, lineNum, col).explain("%q is not a value; strings need quotes, booleans are SuperEffective and NotVeryEffective, and null is MissingNo", valStr)
+}
+
+// isNumberText reports whether s looks like a decimal number. Go's parser
+// also reads forms such as Inf or hex floats, which are not BSON numbers.
+func isNumberText(s string) bool {
+	if strings.Trim(s, "0123456789+-.eE") != "" {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// isDigit reports whether c is an ASCII digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// splitElements splits the inside of an inline array or object on the commas
+// between its elements. Commas inside string literals, quoted or raw, and
+// inside nested arrays and objects belong to that element. A quote ends a
+// string only where commentIndex would end it.
+func splitElements(inner string) []string {
+	var parts []string
+	var quote byte // The delimiter of the string being scanned, or 0
+	depth, start := 0, 0
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case quote != 0:
+			if c == quote && closesString(inner[i+1:]) {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == '{' || c == '<' && strings.HasPrefix(inner[i:], "<|"):
+			depth++
+		case c == '}' || c == '|' && strings.HasPrefix(inner[i:], "|>"):
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, inner[start:])
 }
@@ -0,0 +1,112 @@
+package bulbason
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// largeConfig returns a document with n sections of typical entries.
+func largeConfig(n int) string {
+	var sb strings.Builder
+	sb.WriteString("BULBA!\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "(o) service_%d (o)\n", i)
+		fmt.Fprintf(&sb, "    name ~~~~> \"service-%d\" zZz display name\n", i)
+		sb.WriteString("    port ~~~~> 8080\n")
+		sb.WriteString("    ratio ~~> 0.75\n")
+		sb.WriteString("    enabled ~~> SuperEffective\n")
+		sb.WriteString("    \"x-trace.id\" ~~> \"abc\"\n")
+		sb.WriteString("    tags ~~> <| \"a\", \"b\", \"c\" |>\n")
+		sb.WriteString("    (O) limits (O)\n")
+		sb.WriteString("        rps ~~> 1_000\n")
+		sb.WriteString("        burst ~~> MissingNo\n")
+	}
+	return sb.String()
+}
+
+func TestScanAssignment(t *testing.T) {
+	tests := []struct {
+		text   string
+		ok     bool
+		key    string
+		vine   string
+		value  string
+		quoted bool
+	}{
+		{`host ~~~~> "localhost"`, true, "host", "~~~~>", `"localhost"`, false},
+		{`port~>8080`, true, "port", "~>", "8080", false},
+		{`"my-key.example.com"   ~~>  1`, true, "my-key.example.com", "~~>", "1", true},
+		{`empty ~~>`, true, "empty", "~~>", "", false},
+		{`arrow ~~> ~~> x`, true, "arrow", "~~>", "~~> x", false},
+		{`my-key ~~> 1`, false, "", "", "", false},
+		{`"" ~~> 1`, false, "", "", "", false},
+		{`"open ~~> 1`, false, "", "", "", false},
+		{`key > 1`, false, "", "", "", false},
+		{`key ~~ 1`, false, "", "", "", false},
+		{`key ~~`, false, "", "", "", false},
+		{`key`, false, "", "", "", false},
+		{``, false, "", "", "", false},
+	}
+	for _, tt := range tests {
+		a, ok := scanAssignment(tt.text)
+		if ok != tt.ok {
+			t.Errorf("scanAssignment(%q): expected ok %v, got %v", tt.text, tt.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		vine, value := tt.text[a.vineStart:a.vineEnd], tt.text[a.valStart:]
+		if a.key != tt.key || vine != tt.vine || value != tt.value || a.quoted != tt.quoted {
+			t.Errorf("scanAssignment(%q): got key %q, vine %q, value %q, quoted %v", tt.text, a.key, vine, value, a.quoted)
+		}
+	}
+}
+
+func BenchmarkLex(b *testing.B) {
+	input := largeConfig(1000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Lex(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLex_StringMatchesReader(t *testing.T) {
+	inputs := []string{
+		"BULBA!\r\nkey ~> 1\r\n(o) s (o)\r\n    a ~> \"x\"\r\n",
+		"BULBA!\nkey ~> 1",
+		"BULBA!\n\n\nkey ~> 1\n\n",
+		"",
+	}
+	for _, input := range inputs {
+		fromString, stringErr := Lex(input)
+		fromReader, readerErr := lexInto(nil, newLexer(strings.NewReader(input), newParseConfig(nil)))
+		if fmt.Sprint(stringErr) != fmt.Sprint(readerErr) || !reflect.DeepEqual(fromString, fromReader) {
+			t.Errorf("Lex(%q) differs between string and reader:\n%+v %v\n%+v %v", input, fromString, stringErr, fromReader, readerErr)
+		}
+	}
+}
+
+// FuzzLex checks that lexing a document from a string and from a stream
+// gives the same tokens and errors.
+func FuzzLex(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed, false)
+	}
+	f.Fuzz(func(t *testing.T, input string, comments bool) {
+		var opts []ParseOption
+		if comments {
+			opts = append(opts, ParseComments(), CollectErrors())
+		}
+		fromString, stringErr := Lex(input, opts...)
+		fromReader, readerErr := lexInto(nil, newLexer(strings.NewReader(input), newParseConfig(opts)))
+		if !reflect.DeepEqual(stringErr, readerErr) || !reflect.DeepEqual(fromString, fromReader) {
+			t.Fatalf("Lex differs between string and reader:\n%+v %v\n%+v %v", fromString, stringErr, fromReader, readerErr)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package bulbason
+
+import (
+	"math/big"
+	"reflect"
+)
+
+// MergeStrategy decides how sections present in both documents are merged.
+type MergeStrategy int
+
+const (
+	// MergeDeep merges sections key by key, at every level, so an overlay
+	// only needs the keys it changes. This is the default.
+	MergeDeep MergeStrategy = iota
+	// MergeShallow replaces each top-level key of the base with the overlay's
+	// value as a whole, sections included.
+	MergeShallow
+)
+
+// ArrayStrategy decides how arrays present in both documents are merged.
+type ArrayStrategy int
+
+const (
+	// ArrayReplace keeps the overlay's array. This is the default.
+	ArrayReplace ArrayStrategy = iota
+	// ArrayAppend appends the overlay's elements to the base's.
+	ArrayAppend
+	// ArrayUnion appends the overlay's elements that the base's array does not
+	// already hold, keeping the base's order.
+	ArrayUnion
+)
+
+// MergeOptions configures Merge. The zero value merges sections deeply and
+// lets the overlay's arrays replace the base's.
+type MergeOptions struct {
+	Sections MergeStrategy
+	Arrays   ArrayStrategy
+}
+
+// Merge layers overlay over base, two documents as returned by Parse, and
+// returns the result, typically to apply environment overrides to defaults.
+//
+// Keys only in one document are kept. When both hold a key, the overlay wins,
+// MissingNo included, except where both values are sections, which are merged
+// as opts.Sections says, or both are arrays, which are merged as opts.Arrays
+// says. The result shares nothing with base or overlay, so either can be
+// changed afterwards without affecting it.
+func Merge(base, overlay map[string]interface{}, opts MergeOptions) map[string]interface{} {
+	result := copyValue(base).(map[string]interface{})
+	if result == nil {
+		result = make(map[string]interface{}, len(overlay))
+	}
+	mergeSection(result, overlay, opts)
+	return result
+}
+
+// mergeSection merges overlay into dst, which belongs to the result.
+func mergeSection(dst, overlay map[string]interface{}, opts MergeOptions) {
+	for k, v := range overlay {
+		switch existing := dst[k].(type) {
+		case map[string]interface{}:
+			if section, ok := v.(map[string]interface{}); ok && opts.Sections == MergeDeep {
+				mergeSection(existing, section, opts)
+				continue
+			}
+		case []interface{}, []map[string]interface{}:
+			// A replaced array is copied below, keeping the overlay's type.
+			if arr, ok := asArray(v); ok && opts.Arrays != ArrayReplace {
+				base, _ := asArray(existing)
+				merged := mergeArrays(base, arr, opts.Arrays)
+				// Arrays of sections stay typed as Parse returns them.
+				if _, ok := v.([]map[string]interface{}); ok {
+					dst[k] = restoreSections(merged)
+				} else {
+					dst[k] = merged
+				}
+				continue
+			}
+		}
+		dst[k] = copyValue(v)
+	}
+}
+
+// mergeArrays merges the overlay's array into the base's, which belongs to
+// the result.
+func mergeArrays(base, overlay []interface{}, strategy ArrayStrategy) []interface{} {
+	switch strategy {
+	case ArrayAppend:
+		for _, v := range overlay {
+			base = append(base, copyValue(v))
+		}
+		return base
+	case ArrayUnion:
+		for _, v := range overlay {
+			if !containsValue(base, v) {
+				base = append(base, copyValue(v))
+			}
+		}
+		return base
+	}
+	return copyValue(overlay).([]interface{})
+}
+
+// containsValue reports whether arr holds a value equal to v.
+func containsValue(arr []interface{}, v interface{}) bool {
+	for _, elem := range arr {
+		if reflect.DeepEqual(elem, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyValue returns a deep copy of a parsed value. Only sections, arrays,
+// byte strings and big integers need copying; every other value is
+// immutable.
+func copyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if x == nil {
+			return x
+		}
+		m := make(map[string]interface{}, len(x))
+		for k, elem := range x {
+			m[k] = copyValue(elem)
+		}
+		return m
+	case []interface{}:
+		if x == nil {
+			return x
+		}
+		arr := make([]interface{}, len(x))
+		for i, elem := range x {
+			arr[i] = copyValue(elem)
+		}
+		return arr
+	case []map[string]interface{}:
+		if x == nil {
+			return x
+		}
+		arr := make([]map[string]interface{}, len(x))
+		for i, elem := range x {
+			arr[i] = copyValue(elem).(map[string]interface{})
+		}
+		return arr
+	case []byte:
+		if x == nil {
+			return x
+		}
+		return append([]byte{}, x...)
+	case *big.Int:
+		if x == nil {
+			return x
+		}
+		return new(big.Int).Set(x)
+	}
+	return v
+}
@@ -0,0 +1,159 @@
+package bulbason
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	base, err := Parse(`BULBA!
+name ~> "app"
+tags ~> <| "a", "b" |>
+(o) database (o)
+    host ~> "localhost"
+    port ~> 5432
+    (O) pool (O)
+        size ~> 10
+        idle ~> 30
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	overlay, err := Parse(`BULBA!
+tags ~> <| "b", "c" |>
+debug ~> MissingNo
+(o) database (o)
+    host ~> "db.internal"
+    (O) pool (O)
+        size ~> 50
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     MergeOptions
+		expected map[string]interface{}
+	}{
+		{
+			name: "Deep Merge",
+			opts: MergeOptions{},
+			expected: map[string]interface{}{
+				"name":  "app",
+				"tags":  []interface{}{"b", "c"},
+				"debug": nil,
+				"database": map[string]interface{}{
+					"host": "db.internal",
+					"port": int64(5432),
+					"pool": map[string]interface{}{"size": int64(50), "idle": int64(30)},
+				},
+			},
+		},
+		{
+			name: "Shallow Replace",
+			opts: MergeOptions{Sections: MergeShallow},
+			expected: map[string]interface{}{
+				"name":  "app",
+				"tags":  []interface{}{"b", "c"},
+				"debug": nil,
+				"database": map[string]interface{}{
+					"host": "db.internal",
+					"pool": map[string]interface{}{"size": int64(50)},
+				},
+			},
+		},
+		{
+			name: "Append Arrays",
+			opts: MergeOptions{Arrays: ArrayAppend},
+			expected: map[string]interface{}{
+				"name":  "app",
+				"tags":  []interface{}{"a", "b", "b", "c"},
+				"debug": nil,
+				"database": map[string]interface{}{
+					"host": "db.internal",
+					"port": int64(5432),
+					"pool": map[string]interface{}{"size": int64(50), "idle": int64(30)},
+				},
+			},
+		},
+		{
+			name: "Union Arrays",
+			opts: MergeOptions{Arrays: ArrayUnion},
+			expected: map[string]interface{}{
+				"name":  "app",
+				"tags":  []interface{}{"a", "b", "c"},
+				"debug": nil,
+				"database": map[string]interface{}{
+					"host": "db.internal",
+					"port": int64(5432),
+					"pool": map[string]interface{}{"size": int64(50), "idle": int64(30)},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Merge(base, overlay, tt.opts)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected:\n%v\nGot:\n%v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestMerge_DoesNotShare(t *testing.T) {
+	base := map[string]interface{}{
+		"tags": []interface{}{"a"},
+		"db":   map[string]interface{}{"host": "localhost"},
+	}
+	overlay := map[string]interface{}{
+		"tags": []interface{}{"b"},
+		"db":   map[string]interface{}{"port": int64(1)},
+		"new":  map[string]interface{}{"x": int64(1)},
+	}
+	result := Merge(base, overlay, MergeOptions{Arrays: ArrayAppend})
+	result["tags"].([]interface{})[0] = "changed"
+	result["db"].(map[string]interface{})["host"] = "changed"
+	result["new"].(map[string]interface{})["x"] = "changed"
+
+	if base["tags"].([]interface{})[0] != "a" || base["db"].(map[string]interface{})["host"] != "localhost" {
+		t.Errorf("Changing the result changed the base: %v", base)
+	}
+	if overlay["new"].(map[string]interface{})["x"] != int64(1) {
+		t.Errorf("Changing the result changed the overlay: %v", overlay)
+	}
+
+	if result := Merge(nil, overlay, MergeOptions{}); !reflect.DeepEqual(result, overlay) {
+		t.Errorf("Expected the overlay, got %v", result)
+	}
+}
+
+func TestMerge_ArrayOfSections(t *testing.T) {
+	base := map[string]interface{}{
+		"servers": []map[string]interface{}{{"host": "a"}},
+	}
+	overlay := map[string]interface{}{
+		"servers": []map[string]interface{}{{"host": "b"}},
+	}
+
+	result := Merge(base, overlay, MergeOptions{Arrays: ArrayAppend})
+	expected := map[string]interface{}{
+		"servers": []map[string]interface{}{{"host": "a"}, {"host": "b"}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, result)
+	}
+
+	result["servers"].([]map[string]interface{})[0]["host"] = "changed"
+	if base["servers"].([]map[string]interface{})[0]["host"] != "a" {
+		t.Errorf("Changing the result changed the base: %v", base)
+	}
+
+	result = Merge(base, overlay, MergeOptions{})
+	result["servers"].([]map[string]interface{})[0]["host"] = "changed"
+	if overlay["servers"].([]map[string]interface{})[0]["host"] != "b" {
+		t.Errorf("Changing the result changed the overlay: %v", overlay)
+	}
+}
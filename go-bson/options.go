@@ -0,0 +1,522 @@
+package bulbason
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseOption configures how a document is lexed and parsed.
+type ParseOption func(*parseConfig)
+
+// parseConfig holds the settings assembled from a list of ParseOptions.
+type parseConfig struct {
+	collectErrors bool
+	parseComments bool
+	duplicateKeys DuplicateKeyPolicy
+	maxDepth      int
+	largeIntegers LargeIntegerPolicy
+	useNumber     bool
+	strictFloats  bool
+	emptyValues   EmptyValuePolicy
+	includes      *includeConfig // nil unless Transform directives are resolved
+	profile       string
+	dialect       *Dialect
+	keyRules      []KeyRule
+	builtinKey    KeyRule // The Charizard ban unless replaced, nil for none
+	indentWidth   int     // Spaces per evolution level, zero meaning 4
+	expandTabs    bool
+	tabWidth      int  // Columns between tab stops, zero meaning indentWidth
+	fragment      bool // The header is optional, for ParseFragment
+	versions      VersionRegistry
+	diagnostics   func(Diagnostic)
+
+	// Limits for untrusted input, zero meaning no limit.
+	maxInputSize   int
+	maxLineLength  int
+	maxArrayLength int
+	maxTokens      int
+}
+
+// newParseConfig applies opts on top of the default settings.
+func newParseConfig(opts []ParseOption) *parseConfig {
+	cfg := &parseConfig{builtinKey: CharizardBan()}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// CollectErrors makes parsing continue past syntax and indentation errors.
+// Every offending line is skipped and, if any were found, an ErrorList with
+// all of them is returned instead of the first ParseError.
+func CollectErrors() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.collectErrors = true
+	}
+}
+
+// ParseComments keeps zZz comments instead of discarding them. The lexer
+// emits them as TOKEN_COMMENT tokens and ParseAST attaches each one to the
+// entry that follows it, or to the end of its line for inline comments.
+// It has no effect on the maps returned by Parse.
+func ParseComments() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.parseComments = true
+	}
+}
+
+// DuplicateKeyPolicy decides what happens when a key appears more than once
+// in the same section.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateLastWins keeps the value of the last occurrence. This is the default.
+	DuplicateLastWins DuplicateKeyPolicy = iota
+	// DuplicateFirstWins keeps the value of the first occurrence.
+	DuplicateFirstWins
+	// DuplicateError rejects the document with a ParseError located at the
+	// repeated key.
+	DuplicateError
+)
+
+// DuplicateKeys sets the policy for keys that appear more than once in the
+// same section. Sections count as keys too, so a section and a value with
+// the same name are also duplicates.
+func DuplicateKeys(policy DuplicateKeyPolicy) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.duplicateKeys = policy
+	}
+}
+
+// MaxDepth limits how deeply sections may be nested. A section or array
+// element whose evolution level exceeds depth is rejected with a ParseError
+// carrying CodeMaxDepth. A depth of zero, the default, means no limit.
+func MaxDepth(depth int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxDepth = depth
+	}
+}
+
+// IndentWidth sets how many spaces make one evolution level, for teams that
+// indent by 2 instead of the 4 of the spec, which remains the default. A line
+// indented by a number of spaces that is not a multiple of width fails with
+// CodeIndentation.
+func IndentWidth(width int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.indentWidth = width
+	}
+}
+
+// ExpandTabs makes the lexer accept tabs in the indentation of a line, which
+// are otherwise rejected with CodeTab, by replacing each with spaces up to
+// the next multiple of width columns. A width of zero stands for the indent
+// width. Tabs after the indentation are still rejected, and columns in
+// errors count the spaces the tabs were replaced with.
+func ExpandTabs(width int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.expandTabs = true
+		cfg.tabWidth = width
+	}
+}
+
+// VersionRegistry maps the versions of the header, as in BULBA!v2, to the
+// options documents of that version are read with, so that a format can
+// change behavior, such as its Dialect, from one version to the next:
+//
+//	versions := bulbason.VersionRegistry{
+//	    2: {bulbason.UseDialect(shiny), bulbason.IndentWidth(2)},
+//	}
+//	config, err := bulbason.Parse(content, bulbason.Versions(versions))
+//
+// A plain BULBA! header is version 1, which is always known; BULBA!v1 is
+// the same header.
+type VersionRegistry map[int][]ParseOption
+
+// Versions makes the parser accept headers of the versions registered in
+// reg, reading each document with the options given for its version on top
+// of the others. A header of any other version fails with a ParseError
+// carrying CodeVersion. Without this option only version 1 is known.
+func Versions(reg VersionRegistry) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.versions = reg
+	}
+}
+
+// indent returns the number of spaces per evolution level.
+func (cfg *parseConfig) indent() int {
+	if cfg.indentWidth > 0 {
+		return cfg.indentWidth
+	}
+	return defaultIndentWidth
+}
+
+// LargeIntegerPolicy decides what happens to integer literals that do not fit
+// in an int64.
+type LargeIntegerPolicy int
+
+const (
+	// LargeIntegerError rejects the document with a ParseError carrying
+	// CodeOverflow. This is the default.
+	LargeIntegerError LargeIntegerPolicy = iota
+	// LargeIntegerUint64 parses positive integers up to math.MaxUint64 as
+	// uint64. Anything beyond that is still an error.
+	LargeIntegerUint64
+	// LargeIntegerBig parses integers outside the int64 range as *big.Int.
+	LargeIntegerBig
+)
+
+// LargeIntegers sets the policy for integer literals outside the int64 range.
+// Integers that fit are always parsed as int64.
+func LargeIntegers(policy LargeIntegerPolicy) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.largeIntegers = policy
+	}
+}
+
+// UseNumber makes numbers evaluate to a Number holding their literal instead
+// of an int64 or float64, leaving the choice of precision to the caller.
+// Integers of any size are accepted, so LargeIntegers has no effect.
+func UseNumber() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.useNumber = true
+	}
+}
+
+// StrictFloats rejects the infinity and NaN literals Eternatus, -Eternatus
+// and Unown with a ParseError carrying CodeType, for documents that must only
+// hold finite numbers.
+func StrictFloats() ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.strictFloats = true
+	}
+}
+
+// EmptyValuePolicy decides what happens to a key with nothing after its Vine
+// Whip, as in "key ~~>".
+type EmptyValuePolicy int
+
+const (
+	// EmptyValueError rejects the document with a ParseError carrying
+	// CodeSyntax, located at the Vine Whip. This is the default.
+	EmptyValueError EmptyValuePolicy = iota
+	// EmptyValueNull treats the key as if it were assigned MissingNo.
+	EmptyValueNull
+	// EmptyValueString treats the key as if it were assigned "".
+	EmptyValueString
+)
+
+// EmptyValues sets the policy for keys without a value. When they are
+// accepted, ParseAST leaves the Value of their KeyValue nil.
+func EmptyValues(policy EmptyValuePolicy) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.emptyValues = policy
+	}
+}
+
+// Includes resolves Transform directives, reading the included files from
+// fsys. name is the path within fsys of the document being parsed, against
+// whose directory relative paths are resolved; it may be "" for a document
+// that does not come from fsys, whose paths are then relative to the root
+// of fsys. ParseFile enables includes on its own.
+//
+// With includes enabled, Parse and ParseAST splice the entries of each
+// included file in place of its directive, so the tree holds no *ast.Include
+// nodes, and the positions of spliced nodes are within their own file.
+// Without them, ParseAST keeps the directives, for tools such as formatters
+// that work on a single file, and Parse fails with an IncludeError.
+func Includes(fsys fs.FS, name string) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.includes = &includeConfig{fsys: fsys, name: name}
+		if name != "" {
+			cfg.includes.chain = []string{name}
+		}
+	}
+}
+
+// Profile selects the active profile, so that one file can serve several
+// environments. The sections tagged with it, such as
+// "(o) database (o) Forme prod" for the profile "prod", are merged over the
+// untagged sections of the same name, as Merge does by default: their
+// sections are merged key by key and their other values replace the base's.
+// Sections tagged with other profiles are left out. Without a profile, every
+// tagged section is left out.
+func Profile(name string) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.profile = name
+	}
+}
+
+// Dialect extends the literals of the format, so that an organization can
+// add spellings of its own without forking the lexer:
+//
+//	bulbason.Parse(content, bulbason.UseDialect(bulbason.Dialect{
+//	    True:  []string{"Shiny"},
+//	    False: []string{"NotShiny"},
+//	}))
+//
+// The standard literals keep their meaning: the spellings and matchers of a
+// dialect only apply to values that would otherwise be rejected. Documents
+// using them can only be read with the same dialect, and Marshal writes the
+// standard spellings.
+type Dialect struct {
+	True  []string // Extra spellings of SuperEffective
+	False []string // Extra spellings of NotVeryEffective
+	Null  []string // Extra spellings of MissingNo
+
+	// Matchers are tried in turn on a value that no literal matches.
+	Matchers []LiteralMatcher
+}
+
+// LiteralMatcher recognizes the literals of a value type of its own. It is
+// given the text of a value, trimmed of spaces, and returns the value it
+// stands for and true, or false if the text is not one of its literals. The
+// value is stored as it is by Parse, and by Unmarshal into a destination of
+// its own type or an interface.
+//
+// A matcher may be called more than once for the same text, and must return
+// the same result each time.
+type LiteralMatcher func(text string) (interface{}, bool)
+
+// match returns the value the first matcher of d recognizes in text.
+func (d *Dialect) match(text string) (interface{}, bool) {
+	if d == nil {
+		return nil, false
+	}
+	for _, m := range d.Matchers {
+		if v, ok := m(text); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// UseDialect makes the lexer and parser accept the literals of d as well as
+// the standard ones.
+func UseDialect(d Dialect) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.dialect = &d
+	}
+}
+
+// KeyRule checks a key of a document, given without its quotes, and returns
+// an error describing why the key is not allowed, or nil.
+type KeyRule func(key string) error
+
+// KeyRules makes the parser check every key, of sections and values alike,
+// against rules, in turn, after the built-in rule. A key that a rule rejects
+// fails with a ParseError carrying CodeKeyRule, whose message ends with the
+// error of the rule.
+func KeyRules(rules ...KeyRule) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.keyRules = append(cfg.keyRules, rules...)
+	}
+}
+
+// BuiltinKeyRule replaces the built-in rule, which the parser checks every
+// key against before the KeyRules and which is CharizardBan by default. A key
+// it rejects fails with CodeReservedKey and the message of the spec, as
+// Charizard does, with the error of the rule as the Detail. A nil rule lifts
+// the ban, for documents from readers that do not enforce it.
+func BuiltinKeyRule(rule KeyRule) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.builtinKey = rule
+	}
+}
+
+// CharizardBan returns the KeyRule of the spec, rejecting the key Charizard,
+// which burns the bulb. It is the built-in rule unless BuiltinKeyRule
+// replaces it; a replacement that extends the ban can call it first.
+func CharizardBan() KeyRule {
+	return func(key string) error {
+		if key == "Charizard" {
+			return errCharizardKey
+		}
+		return nil
+	}
+}
+
+// errCharizardKey is the error of CharizardBan.
+var errCharizardKey = errors.New(`"Charizard" cannot be used as a key`)
+
+// ReservedKeys returns a KeyRule rejecting the keys in words, such as those
+// a deployment keeps for itself.
+func ReservedKeys(words ...string) KeyRule {
+	return func(key string) error {
+		if slices.Contains(words, key) {
+			return fmt.Errorf("key %q is reserved", key)
+		}
+		return nil
+	}
+}
+
+// NamingConvention is a way of writing keys made of several words.
+type NamingConvention int
+
+const (
+	// SnakeCase keys are lower case words joined by underscores, as in
+	// max_connections. This is the convention of the spec's examples.
+	SnakeCase NamingConvention = iota
+	// CamelCase keys start with a lower case letter and capitalize the
+	// words after the first, as in maxConnections.
+	CamelCase
+	// PascalCase keys capitalize every word, as in MaxConnections.
+	PascalCase
+	// KebabCase keys are lower case words joined by hyphens, as in
+	// "max-connections". Such keys are quoted in a document.
+	KebabCase
+)
+
+// namingPatterns holds the keys each NamingConvention allows.
+var namingPatterns = map[NamingConvention]*regexp.Regexp{
+	SnakeCase:  regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`),
+	CamelCase:  regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`),
+	PascalCase: regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`),
+	KebabCase:  regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)*$`),
+}
+
+func (c NamingConvention) String() string {
+	switch c {
+	case SnakeCase:
+		return "snake_case"
+	case CamelCase:
+		return "camelCase"
+	case PascalCase:
+		return "PascalCase"
+	case KebabCase:
+		return "kebab-case"
+	}
+	return fmt.Sprintf("NamingConvention(%d)", int(c))
+}
+
+// Convert returns key written in convention c, as in max_connections for
+// maxConnections under SnakeCase. Words are split at underscores, hyphens,
+// spaces and changes of case, with a run of capitals such as HTTP kept as a
+// word. A key without any letter or digit is returned as it is.
+func (c NamingConvention) Convert(key string) string {
+	words := splitWords(key)
+	if len(words) == 0 {
+		return key
+	}
+	switch c {
+	case SnakeCase:
+		return strings.ToLower(strings.Join(words, "_"))
+	case KebabCase:
+		return strings.ToLower(strings.Join(words, "-"))
+	case CamelCase, PascalCase:
+		var b strings.Builder
+		for i, w := range words {
+			if i == 0 && c == CamelCase {
+				b.WriteString(strings.ToLower(w))
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(w)
+			b.WriteRune(unicode.ToUpper(r))
+			b.WriteString(strings.ToLower(w[size:]))
+		}
+		return b.String()
+	}
+	return key
+}
+
+// splitWords splits key into the words Convert joins.
+func splitWords(key string) []string {
+	var words []string
+	runes := []rune(key)
+	start := -1
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				words = append(words, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		// A capital starts a word after a lower case letter or digit, and
+		// ends a run of capitals when a lower case letter follows it, as
+		// the S of HTTPServer does.
+		if start >= 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			if !unicode.IsUpper(prev) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// KeyNaming returns a KeyRule rejecting the keys that do not follow
+// convention.
+func KeyNaming(convention NamingConvention) KeyRule {
+	pattern := namingPatterns[convention]
+	return func(key string) error {
+		if pattern == nil || !pattern.MatchString(key) {
+			return fmt.Errorf("key %q is not %s", key, convention)
+		}
+		return nil
+	}
+}
+
+// KeyPattern returns a KeyRule rejecting the keys that re does not match.
+func KeyPattern(re *regexp.Regexp) KeyRule {
+	return func(key string) error {
+		if !re.MatchString(key) {
+			return fmt.Errorf("key %q does not match %s", key, re)
+		}
+		return nil
+	}
+}
+
+// The options below guard against untrusted documents exhausting memory.
+// Each fails with a ParseError carrying a code of its own, and a limit of
+// zero, the default, means no limit. The lexer stops at the first limit it
+// hits, even with CollectErrors. See also MaxDepth.
+
+// MaxInputSize limits the size of the document in bytes, line endings
+// included. A larger document is rejected with CodeInputSize, located at the
+// first byte past the limit, as soon as that byte is read.
+func MaxInputSize(bytes int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxInputSize = bytes
+	}
+}
+
+// MaxLineLength limits the length of each line in bytes, line ending
+// excluded. A longer line is rejected with CodeLineLength, located at its
+// first byte past the limit. When reading from an io.Reader, this also
+// bounds the memory held for a line; without it, lines may be of any length.
+func MaxLineLength(bytes int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxLineLength = bytes
+	}
+}
+
+// MaxArrayLength limits the number of elements in each array, inline or
+// multi-line. The first element past the limit is rejected with
+// CodeArrayLength.
+func MaxArrayLength(n int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxArrayLength = n
+	}
+}
+
+// MaxTokens limits the number of tokens in the document, the final
+// TOKEN_EOF aside. The first token past the limit is rejected with
+// CodeTokenCount.
+func MaxTokens(n int) ParseOption {
+	return func(cfg *parseConfig) {
+		cfg.maxTokens = n
+	}
+}
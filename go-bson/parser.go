@@ -1,253 +1,966 @@
-package main
+package bulbason
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
-)
+	"sync"
 
-// Error constants as defined in the spec
-const (
-	ErrSyntax      = "It hurt itself in its confusion!"
-	ErrIndentation = "The attack missed!"
-	ErrType        = "Target is immune!"
-	ErrBadges      = "Not enough badges!"
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
 )
 
 // Parse parses the BSON content and returns the data map.
 // It follows procedural programming principles by breaking down the task into steps
 // executed sequentially within the function or helper functions.
-//
-// Procedural Programming Concept: State Management
-// Unlike the functional approach which passes state through recursion,
-// here we maintain mutable state (stack, currentLevel, i) within the function scope.
-func Parse(content string) (map[string]interface{}, error) {
+func Parse(content string, opts ...ParseOption) (map[string]interface{}, error) {
+	return parseMap(newStringLexer(content, newParseConfig(opts)))
+}
+
+// ParseAST parses the BSON content and returns its syntax tree.
+// Unlike Parse it keeps the structure and position of every node, which is
+// what tools such as linters and formatters need.
+func ParseAST(content string, opts ...ParseOption) (*ast.Document, error) {
+	return parseAST(newStringLexer(content, newParseConfig(opts)))
+}
+
+// ParseContext is like Parse, but gives up with ctx.Err() once ctx is done.
+// The context is checked every few lines while lexing and between the steps
+// of parsing, so a server can abandon a slow parse when its request times out.
+func ParseContext(ctx context.Context, content string, opts ...ParseOption) (map[string]interface{}, error) {
+	l := newStringLexer(content, newParseConfig(opts))
+	l.ctx = ctx
+	return parseMap(l)
+}
+
+// ParseValue parses a single literal, such as the one an Unmarshaler
+// receives, and returns its value in the form Parse gives it: "db" as a
+// string, 42 as an int64, { port ~> 5432 } as a map[string]interface{} and so
+// on. The options apply as they do to Parse, such as UseNumber.
+func ParseValue(data []byte, opts ...ParseOption) (interface{}, error) {
+	literal := strings.TrimSpace(string(data))
+	if literal == "" || strings.ContainsAny(literal, "\r\n") {
+		return nil, fmt.Errorf("bulbason: invalid value %q, expected a single literal", literal)
+	}
+	m, err := Parse("BULBA!\nv ~> "+literal+"\n", opts...)
+	if err != nil {
+		return nil, fmt.Errorf("bulbason: invalid value %q: %w", literal, err)
+	}
+	return m["v"], nil
+}
+
+// ParseFragment is like Parse, but for the body of a document without its
+// BULBA! header, such as a snippet stored in a database or a template. A
+// fragment may still start with the header, and an empty one is an empty
+// document. Lines are numbered from the start of the fragment.
+func ParseFragment(content string, opts ...ParseOption) (map[string]interface{}, error) {
+	cfg := newParseConfig(opts)
+	cfg.fragment = true
+	return parseMap(newStringLexer(content, cfg))
+}
+
+// parseMap parses the document read by l into the data map.
+func parseMap(l *Lexer) (map[string]interface{}, error) {
+	doc, err := parseAST(l)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.contextErr(); err != nil {
+		return nil, err
+	}
+
+	// Step 3: Evaluation
+	// Finally we flatten the tree into plain Go values.
+	return documentToMap(doc, l.cfg)
+}
+
+// parseAST runs lexing and parsing over the document read by l.
+func parseAST(l *Lexer) (*ast.Document, error) {
 	// Step 1: Lexical Analysis
 	// We first convert the raw string into a stream of tokens.
-	tokens, err := Lex(content)
+	tokens, lexErr := lexInto(nil, l)
+	if lexErr == nil {
+		lexErr = l.contextErr()
+	}
+	return parseLexed(tokens, lexErr, l.cfg)
+}
+
+// parseLexed runs the remaining steps over the tokens and error returned by
+// the lexer.
+func parseLexed(tokens []Token, lexErr error, cfg *parseConfig) (*ast.Document, error) {
+	if lexErr != nil && (!cfg.collectErrors || !isErrorList(lexErr)) {
+		return nil, lexErr
+	}
+
+	// Step 2: Parsing
+	doc, parseErr := parseTokens(tokens, cfg)
+
+	// In collection mode both steps may have found problems; report them together.
+	if lexErr != nil || parseErr != nil {
+		return nil, mergeErrors(lexErr, parseErr)
+	}
+	return doc, nil
+}
+
+// Parser parses documents with a fixed set of options. Unlike the Parse
+// function it keeps its token buffers between documents, which saves
+// allocations when many documents are parsed. A Parser is safe for
+// concurrent use.
+type Parser struct {
+	cfg     *parseConfig
+	buffers sync.Pool // Token slices, as *[]Token
+}
+
+// NewParser returns a Parser that applies opts to every document.
+func NewParser(opts ...ParseOption) *Parser {
+	return &Parser{
+		cfg:     newParseConfig(opts),
+		buffers: sync.Pool{New: func() interface{} { return new([]Token) }},
+	}
+}
+
+// Parse parses the BSON content and returns the data map, like the Parse
+// function.
+func (p *Parser) Parse(content string) (map[string]interface{}, error) {
+	doc, cfg, err := p.parseAST(content)
 	if err != nil {
 		return nil, err
 	}
+	return documentToMap(doc, cfg)
+}
 
-	// Step 2: Parsing
-	// We use a stack-based approach to handle nested structures (sections).
-	// 'result' is the root map.
-	result := make(map[string]interface{})
-	// 'stack' keeps track of the current path in the object hierarchy.
-	stack := []map[string]interface{}{result}
-	currentLevel := 0
+// ParseAST parses the BSON content and returns its syntax tree, like the
+// ParseAST function.
+func (p *Parser) ParseAST(content string) (*ast.Document, error) {
+	doc, _, err := p.parseAST(content)
+	return doc, err
+}
 
-	i := 0
-	for i < len(tokens) {
-		token := tokens[i]
+// parseAST parses content into its syntax tree, and returns the options it
+// was read with, those of its version included.
+func (p *Parser) parseAST(content string) (*ast.Document, *parseConfig, error) {
+	buf := p.buffers.Get().(*[]Token)
+	l := newStringLexer(content, p.cfg)
+	tokens, lexErr := lexInto((*buf)[:0], l)
+	doc, err := parseLexed(tokens, lexErr, l.cfg)
 
-		if token.Type == TOKEN_EOF {
-			break
+	// The tree does not refer to the tokens, so they can be recycled. They
+	// are cleared first so the pool does not keep the document alive. The
+	// lexer drops its tokens when it fails, but may have written to buf.
+	if tokens == nil {
+		tokens = *buf
+	}
+	clear(tokens[:cap(tokens)])
+	*buf = tokens[:0]
+	p.buffers.Put(buf)
+	return doc, l.cfg, err
+}
+
+// parseTokens builds the syntax tree from a token stream produced by the lexer.
+func parseTokens(tokens []Token, cfg *parseConfig) (*ast.Document, error) {
+	doc, err := buildDocument(tokens, cfg)
+	if err == nil && cfg.duplicateKeys == DuplicateError {
+		err = checkDuplicates(doc.Body, cfg, nil)
+	}
+	if doc != nil && cfg.diagnostics != nil && cfg.duplicateKeys != DuplicateError {
+		diagnoseShadowedKeys(doc.Body, cfg)
+	}
+	if doc != nil && len(cfg.keyRules) > 0 {
+		if ruleErr := checkKeyRules(doc.Body, cfg); ruleErr != nil {
+			err = mergeErrors(err, ruleErr)
+		}
+	}
+	if err != nil {
+		attachSnippet(err, tokens)
+		return nil, err
+	}
+	if cfg.includes != nil {
+		if err := resolveIncludes(doc, cfg); err != nil {
+			return nil, err
 		}
+	}
+	return doc, nil
+}
 
-		if token.Type == TOKEN_HEADER {
-			i++
+// checkDuplicates reports keys that appear more than once in the same body,
+// recursing into sections. In collection mode every duplicate is appended to
+// errs and the list is returned; otherwise the first one is returned.
+func checkDuplicates(body []ast.Entry, cfg *parseConfig, errs ErrorList) error {
+	seen := make(map[[2]string]bool)
+	for _, entry := range body {
+		var key *ast.Ident
+		switch e := entry.(type) {
+		case *ast.Section:
+			key = e.Name
+			if err := checkDuplicates(e.Body, cfg, nil); err != nil {
+				if !cfg.collectErrors {
+					return err
+				}
+				errs = append(errs, err.(ErrorList)...)
+			}
+		case *ast.KeyValue:
+			key = e.Key
+			if err := checkValueDuplicates(e.Value, cfg); err != nil {
+				if !cfg.collectErrors {
+					return err
+				}
+				errs = append(errs, err.(ErrorList)...)
+			}
+		case *ast.Include:
+			// Checked against the included entries once they are resolved.
 			continue
 		}
 
-		// We look for INDENT tokens to determine structure
-		if token.Type == TOKEN_INDENT {
-			indentToken := token
-			i++ // Consume INDENT
+		id := entryID(entry)
+		if seen[id] {
+			err := newParseError(CodeDuplicateKey, key.Loc.Start.Line, key.Loc.Start.Column).explain("key %q already set in this section", key.Name)
+			if !cfg.collectErrors {
+				return err
+			}
+			errs = append(errs, err)
+		}
+		seen[id] = true
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
-			// Check what follows
-			if i >= len(tokens) {
-				break
+// checkKeyRules checks every key of body, and of the sections and objects
+// below it, against the KeyRules of cfg. In collection mode every rejected
+// key is reported in an ErrorList; otherwise the first one is returned.
+func checkKeyRules(body []ast.Entry, cfg *parseConfig) error {
+	var errs ErrorList
+	check := func(key *ast.Ident) {
+		for _, rule := range cfg.keyRules {
+			if err := rule(key.Name); err != nil {
+				pe := newParseError(CodeKeyRule, key.Loc.Start.Line, key.Loc.Start.Column).explain("%v", err)
+				pe.Message += ": " + err.Error()
+				pe.Err = err
+				errs = append(errs, pe)
+				return
+			}
+		}
+	}
+	var checkBody func(body []ast.Entry)
+	var checkValue func(v ast.Value)
+	checkBody = func(body []ast.Entry) {
+		for _, entry := range body {
+			switch n := entry.(type) {
+			case *ast.Section:
+				check(n.Name)
+				checkBody(n.Body)
+			case *ast.KeyValue:
+				check(n.Key)
+				checkValue(n.Value)
+			}
+		}
+	}
+	checkValue = func(v ast.Value) {
+		switch n := v.(type) {
+		case *ast.ObjectLit:
+			checkBody(n.Body)
+		case *ast.ArrayLit:
+			for _, elem := range n.Elements {
+				checkValue(elem)
 			}
-			nextToken := tokens[i]
+		}
+	}
+	checkBody(body)
 
-			// Check indentation level logic
-			expectedLevel := indentToken.Level
+	if len(errs) == 0 {
+		return nil
+	}
+	if !cfg.collectErrors {
+		return errs[0]
+	}
+	return errs
+}
 
-			// Handle Section Header (Evolution)
-			if nextToken.Type == TOKEN_SECTION_OPEN {
-				headerLevel := nextToken.Level
+// entryID identifies an entry among the others of its body. A profile's
+// section is merged over the base section of the same name, so it is told
+// apart by its profile.
+func entryID(entry ast.Entry) [2]string {
+	if s, ok := entry.(*ast.Section); ok && s.Forme != nil {
+		return [2]string{s.Name.Name, s.Forme.Name}
+	}
+	return [2]string{entryName(entry)}
+}
 
-				// Validate hierarchy (Evolution must be sequential)
-				if expectedLevel != headerLevel-1 {
-					return nil, errors.New(ErrIndentation)
-				}
-				// Ensure we have enough badges (parent sections) to evolve
-				if len(stack) < headerLevel {
-					return nil, errors.New(ErrBadges)
+// checkValueDuplicates runs checkDuplicates over the objects held by a value,
+// directly or as array elements.
+func checkValueDuplicates(v ast.Value, cfg *parseConfig) error {
+	var errs ErrorList
+	switch n := v.(type) {
+	case *ast.ObjectLit:
+		return checkDuplicates(n.Body, cfg, nil)
+	case *ast.ArrayLit:
+		for _, elem := range n.Elements {
+			if err := checkValueDuplicates(elem, cfg); err != nil {
+				if !cfg.collectErrors {
+					return err
 				}
+				errs = append(errs, err.(ErrorList)...)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
-				// Consume SECTION_OPEN
-				i++
-				if i >= len(tokens) || tokens[i].Type != TOKEN_IDENTIFIER {
-					return nil, errors.New(ErrSyntax)
-				}
-				keyToken := tokens[i]
-				if err := validateKey(keyToken.Literal); err != nil {
-					return nil, err
-				}
-				i++ // Consume IDENTIFIER
+// buildDocument walks the token stream and assembles the syntax tree.
+func buildDocument(tokens []Token, cfg *parseConfig) (*ast.Document, error) {
+	b := newTreeBuilder(cfg)
+	b.tokens = tokens
+	for b.i < len(tokens) && tokens[b.i].Type != TOKEN_EOF {
+		if err := b.step(); err != nil {
+			return nil, err
+		}
+	}
+	return b.finish()
+}
 
-				if i >= len(tokens) || tokens[i].Type != TOKEN_SECTION_CLOSE {
-					return nil, errors.New(ErrSyntax)
-				}
-				i++ // Consume SECTION_CLOSE
-
-				// Pop stack to the correct parent level
-				// This handles dedenting implicitly by resizing the stack
-				stack = stack[:headerLevel]
-
-				// Create new section and add to parent
-				newSection := make(map[string]interface{})
-				parent := stack[len(stack)-1]
-				parent[keyToken.Literal] = newSection
-				// Push new section to stack as the current context
-				stack = append(stack, newSection)
-				currentLevel = headerLevel
-				continue
+// treeBuilder assembles the syntax tree from tokens, one source line at a
+// time.
+//
+// Procedural Programming Concept: State Management
+// Unlike the functional approach which passes state through recursion,
+// here we maintain mutable state (stack, currentLevel, i) in the builder.
+type treeBuilder struct {
+	cfg *parseConfig
+	// 'doc' is the root of the tree.
+	doc *ast.Document
+	// 'stack' keeps track of the current path in the hierarchy. Each element
+	// is the body that new entries at that level are appended to.
+	stack        []*[]ast.Entry
+	currentLevel int
+	// 'errs' gathers every problem when the caller asked for all of them.
+	errs ErrorList
+	// 'pending' holds comment lines waiting for the entry they describe.
+	pending []*ast.Comment
+	// 'blocks' holds the multi-line arrays that are still open, innermost last.
+	blocks []*openBlock
+
+	// The tokens being parsed and the position of the next one. They may
+	// hold the whole document or only its current line.
+	tokens []Token
+	i      int
+}
+
+func newTreeBuilder(cfg *parseConfig) *treeBuilder {
+	// We use a stack-based approach to handle nested structures (sections).
+	doc := &ast.Document{}
+	return &treeBuilder{cfg: cfg, doc: doc, stack: []*[]ast.Entry{&doc.Body}}
+}
+
+// step handles the token at b.i, together with the rest of its line if it
+// starts one. Errors are only returned when they are not being collected.
+func (b *treeBuilder) step() error {
+	token := b.tokens[b.i]
+
+	switch token.Type {
+	case TOKEN_HEADER:
+		b.doc.Header = ast.Span{Start: tokenStart(token), End: tokenEnd(token)}
+		b.doc.Version, _ = headerVersion(token.Literal)
+		b.i++
+	case TOKEN_COMMENT:
+		// A comment on a line of its own belongs to whatever comes next.
+		b.pending = append(b.pending, commentFrom(token))
+		b.i++
+	case TOKEN_INDENT:
+		// We look for INDENT tokens to determine structure
+		if err := b.parseLine(); err != nil {
+			var pe *ParseError
+			if !b.cfg.collectErrors || !errors.As(err, &pe) {
+				return err
 			}
+			b.errs = append(b.errs, pe)
+			// Skip the rest of the offending line and carry on with the next one.
+			for b.i < len(b.tokens) && b.tokens[b.i].Type != TOKEN_INDENT && b.tokens[b.i].Type != TOKEN_EOF && b.tokens[b.i].Line == token.Line {
+				b.i++
+			}
+		}
+	default:
+		b.i++
+	}
+	return nil
+}
 
-			// Handle Key-Value Assignment
-			if nextToken.Type == TOKEN_IDENTIFIER {
-				// Check indentation for KV
-				// If we are dedenting (going back up levels), we adjust the stack.
-				if expectedLevel != currentLevel {
-					if expectedLevel < currentLevel {
-						stack = stack[:expectedLevel+1]
-						currentLevel = expectedLevel
-					} else {
-						// Cannot indent deeper without a section header
-						return nil, errors.New(ErrIndentation)
-					}
-				}
+// finish checks the state left at the end of the document and returns the
+// tree.
+func (b *treeBuilder) finish() (*ast.Document, error) {
+	// Every multi-line array must have been closed.
+	for _, block := range b.blocks {
+		err := errorAt(CodeSyntax, block.start).explain("multi-line array never closed with |>")
+		if !b.cfg.collectErrors {
+			return nil, err
+		}
+		b.errs = append(b.errs, err)
+	}
 
-				keyToken := nextToken
-				if err := validateKey(keyToken.Literal); err != nil {
-					return nil, err
-				}
-				i++ // Consume IDENTIFIER
+	if len(b.errs) > 0 {
+		return nil, b.errs
+	}
+	b.doc.Comments = b.pending
+	return b.doc, nil
+}
 
-				if i >= len(tokens) || tokens[i].Type != TOKEN_VINE_WHIP {
-					return nil, errors.New(ErrSyntax)
-				}
-				i++ // Consume VINE_WHIP
+// innermostBlock returns the array block the current line belongs to, if any.
+func (b *treeBuilder) innermostBlock() *openBlock {
+	if len(b.blocks) == 0 {
+		return nil
+	}
+	return b.blocks[len(b.blocks)-1]
+}
 
-				// Parse Value
-				// We delegate value parsing to a helper function.
-				val, nextIdx, err := parseValueFromTokens(tokens, i)
-				if err != nil {
-					return nil, err
-				}
-				i = nextIdx
+// insideBlock checks that an entry at the given indentation level is
+// nested inside an element of the innermost open array block.
+func (b *treeBuilder) insideBlock(level int, tok Token) error {
+	block := b.innermostBlock()
+	if block == nil {
+		return nil
+	}
+	if level <= block.level || len(block.array.Elements) == 0 {
+		return errorAt(CodeSyntax, tok)
+	}
+	return nil
+}
 
-				// Add key-value pair to the current map on top of the stack
-				currentMap := stack[len(stack)-1]
-				currentMap[keyToken.Literal] = val
-				continue
+// lineComment consumes the comment at the end of the current line, if any.
+func (b *treeBuilder) lineComment(line int) *ast.Comment {
+	if b.i < len(b.tokens) && b.tokens[b.i].Type == TOKEN_COMMENT && b.tokens[b.i].Line == line {
+		b.i++
+		return commentFrom(b.tokens[b.i-1])
+	}
+	return nil
+}
+
+// addEntry appends an entry to the body on top of the stack, handing it the
+// pending comments.
+func (b *treeBuilder) addEntry(entry ast.Entry) {
+	currentBody := b.stack[len(b.stack)-1]
+	*currentBody = append(*currentBody, entry)
+	b.pending = nil
+}
+
+// parseLine handles one source line, starting at its INDENT token.
+func (b *treeBuilder) parseLine() error {
+	tokens := b.tokens
+	indentToken := tokens[b.i]
+	b.i++ // Consume INDENT
+
+	// Check what follows
+	if b.i >= len(tokens) {
+		return nil
+	}
+	nextToken := tokens[b.i]
+
+	// Check indentation level logic
+	expectedLevel := indentToken.Level
+
+	// Handle Array Block End
+	// A lone "|>" closes the innermost multi-line array.
+	if nextToken.Type == TOKEN_ARRAY_END {
+		block := b.innermostBlock()
+		if block == nil || expectedLevel != block.level {
+			return errorAt(CodeSyntax, nextToken)
+		}
+		b.i++ // Consume ARRAY_END
+		block.array.Loc.End = tokenEnd(nextToken)
+		b.blocks = b.blocks[:len(b.blocks)-1]
+		b.stack = b.stack[:block.level+1]
+		b.currentLevel = block.level
+		b.lineComment(nextToken.Line)
+		return nil
+	}
+
+	// Handle Array Block Element
+	// A bare evolution marker such as "(o)" starts the next element of the
+	// innermost multi-line array. Its entries are indented one level deeper.
+	if nextToken.Type == TOKEN_SECTION_OPEN && (b.i+1 >= len(tokens) || tokens[b.i+1].Type != TOKEN_IDENTIFIER) {
+		block := b.innermostBlock()
+		if block == nil || expectedLevel != block.level {
+			return errorAt(CodeSyntax, nextToken)
+		}
+		if nextToken.Level != block.level+1 {
+			return errorAt(CodeIndentation, nextToken).explain("array element marker must be %s, got %s", sectionMarker(block.level+1), sectionMarker(nextToken.Level))
+		}
+		if b.cfg.maxDepth > 0 && nextToken.Level > b.cfg.maxDepth {
+			return errorAt(CodeMaxDepth, nextToken).explain("nested %d levels deep, more than the MaxDepth limit of %d", nextToken.Level, b.cfg.maxDepth)
+		}
+		if b.cfg.maxArrayLength > 0 && block.count >= b.cfg.maxArrayLength {
+			return errorAt(CodeArrayLength, nextToken).explain("array of more than %d elements, the MaxArrayLength limit", b.cfg.maxArrayLength)
+		}
+		block.count++
+		b.i++ // Consume SECTION_OPEN
+
+		element := &ast.ObjectLit{
+			Marker:   ast.Span{Start: tokenStart(nextToken), End: tokenEnd(nextToken)},
+			Comments: b.pending,
+		}
+		b.pending = nil
+		b.lineComment(nextToken.Line)
+		block.array.Elements = append(block.array.Elements, element)
+		b.stack = append(b.stack[:block.level+1], &element.Body)
+		b.currentLevel = block.level + 1
+		return nil
+	}
+
+	// Handle Section Header (Evolution)
+	if nextToken.Type == TOKEN_SECTION_OPEN {
+		headerLevel := nextToken.Level
+
+		// Validate hierarchy (Evolution must be sequential)
+		if expectedLevel != headerLevel-1 {
+			return errorAt(CodeIndentation, nextToken).explain("a %s section must be indented by %d spaces, got %d", sectionMarker(headerLevel), (headerLevel-1)*b.cfg.indent(), expectedLevel*b.cfg.indent())
+		}
+		// Ensure we have enough badges (parent sections) to evolve, and
+		// that the evolution stays within the allowed depth
+		if len(b.stack) < headerLevel {
+			return errorAt(CodeBadges, nextToken).explain("a %s section must be inside a %s section", sectionMarker(headerLevel), sectionMarker(headerLevel-1))
+		}
+		if b.cfg.maxDepth > 0 && headerLevel > b.cfg.maxDepth {
+			return errorAt(CodeMaxDepth, nextToken).explain("nested %d levels deep, more than the MaxDepth limit of %d", headerLevel, b.cfg.maxDepth)
+		}
+		// Inside an array block a section must belong to one of its elements
+		if err := b.insideBlock(expectedLevel, nextToken); err != nil {
+			return err
+		}
+
+		// Consume SECTION_OPEN
+		b.i++
+		if b.i >= len(tokens) || tokens[b.i].Type != TOKEN_IDENTIFIER {
+			return errorAt(CodeSyntax, nextToken)
+		}
+		keyToken := tokens[b.i]
+		if err := checkBuiltinKey(keyToken, b.cfg); err != nil {
+			return err
+		}
+		b.i++ // Consume IDENTIFIER
+
+		if b.i >= len(tokens) || tokens[b.i].Type != TOKEN_SECTION_CLOSE {
+			return errorAt(CodeSyntax, keyToken)
+		}
+		closeToken := tokens[b.i]
+		b.i++ // Consume SECTION_CLOSE
+		headerEnd := tokenEnd(closeToken)
+		var forme *ast.Ident
+		if b.i < len(tokens) && tokens[b.i].Type == TOKEN_FORME {
+			forme = identFrom(tokens[b.i])
+			headerEnd = tokenEnd(tokens[b.i])
+			b.i++ // Consume FORME
+		}
+
+		// Pop stack to the correct parent level
+		// This handles dedenting implicitly by resizing the stack
+		b.stack = b.stack[:headerLevel]
+
+		// Create new section and add to parent
+		newSection := &ast.Section{
+			Level:       headerLevel,
+			Name:        identFrom(keyToken),
+			Forme:       forme,
+			Header:      ast.Span{Start: tokenStart(nextToken), End: headerEnd},
+			Comments:    b.pending,
+			LineComment: b.lineComment(closeToken.Line),
+		}
+		b.addEntry(newSection)
+		// Push new section to stack as the current context
+		b.stack = append(b.stack, &newSection.Body)
+		b.currentLevel = headerLevel
+		return nil
+	}
+
+	// Handle Key-Value Assignment
+	if nextToken.Type == TOKEN_IDENTIFIER {
+		// Inside an array block a key must belong to one of its elements
+		if err := b.insideBlock(expectedLevel, nextToken); err != nil {
+			return err
+		}
+
+		// Check indentation for KV
+		// If we are dedenting (going back up levels), we adjust the stack.
+		if expectedLevel != b.currentLevel {
+			if expectedLevel < b.currentLevel {
+				b.stack = b.stack[:expectedLevel+1]
+				b.currentLevel = expectedLevel
+			} else {
+				// Cannot indent deeper without a section header
+				return errorAt(CodeIndentation, indentToken).explain("key indented by %d spaces, but its section only allows %d", expectedLevel*b.cfg.indent(), b.currentLevel*b.cfg.indent())
 			}
+		}
+
+		keyToken := nextToken
+		if err := checkBuiltinKey(keyToken, b.cfg); err != nil {
+			return err
+		}
+		b.i++ // Consume IDENTIFIER
 
-			return nil, errors.New(ErrSyntax)
+		if b.i >= len(tokens) || tokens[b.i].Type != TOKEN_VINE_WHIP {
+			return errorAt(CodeSyntax, keyToken)
 		}
+		vineToken := tokens[b.i]
+		b.i++ // Consume VINE_WHIP
 
-		i++
+		// Handle Empty Value
+		// Nothing but a comment may follow the vine on its line.
+		if b.i >= len(tokens) || tokens[b.i].Type == TOKEN_EOF || tokens[b.i].Type == TOKEN_COMMENT || tokens[b.i].Line != vineToken.Line {
+			if b.cfg.emptyValues == EmptyValueError {
+				return errorAt(CodeSyntax, vineToken).explain("missing value after %s, use MissingNo for no value", vineToken.Literal)
+			}
+			b.addEntry(&ast.KeyValue{
+				Key:         identFrom(keyToken),
+				Vine:        ast.Span{Start: tokenStart(vineToken), End: tokenEnd(vineToken)},
+				Tildes:      vineTildes(vineToken),
+				Comments:    b.pending,
+				LineComment: b.lineComment(keyToken.Line),
+			})
+			return nil
+		}
+
+		// Handle Array Block Start
+		// A "<|" that ends the line opens a multi-line array whose elements
+		// follow on the next lines, up to a matching "|>".
+		if tokens[b.i].Type == TOKEN_ARRAY_START &&
+			(b.i+1 == len(tokens) || tokens[b.i+1].Line != tokens[b.i].Line || tokens[b.i+1].Type == TOKEN_COMMENT) {
+			startToken := tokens[b.i]
+			b.i++ // Consume ARRAY_START
+
+			array := &ast.ArrayLit{Block: true, Loc: ast.Span{Start: tokenStart(startToken), End: tokenEnd(startToken)}}
+			b.addEntry(&ast.KeyValue{
+				Key:         identFrom(keyToken),
+				Vine:        ast.Span{Start: tokenStart(vineToken), End: tokenEnd(vineToken)},
+				Tildes:      vineTildes(vineToken),
+				Value:       array,
+				Comments:    b.pending,
+				LineComment: b.lineComment(startToken.Line),
+			})
+			b.blocks = append(b.blocks, &openBlock{level: expectedLevel, array: array, start: startToken})
+			return nil
+		}
+
+		// Parse Value
+		// We delegate value parsing to a helper function.
+		val, nextIdx, err := parseValueFromTokens(tokens, b.i, b.cfg)
+		if err != nil {
+			return err
+		}
+		b.i = nextIdx
+
+		// Add key-value pair to the current body on top of the stack
+		b.addEntry(&ast.KeyValue{
+			Key:         identFrom(keyToken),
+			Vine:        ast.Span{Start: tokenStart(vineToken), End: tokenEnd(vineToken)},
+			Tildes:      vineTildes(vineToken),
+			Value:       val,
+			Comments:    b.pending,
+			LineComment: b.lineComment(keyToken.Line),
+		})
+		return nil
 	}
 
-	return result, nil
+	// Handle Transform Directive
+	// An include stands for seed level entries, so it must be written at
+	// seed level itself, outside of any array block.
+	if nextToken.Type == TOKEN_TRANSFORM {
+		if expectedLevel != 0 || b.innermostBlock() != nil {
+			return errorAt(CodeSyntax, nextToken).explain("Transform must be at seed level, outside of any section")
+		}
+		b.i++ // Consume TRANSFORM
+		if b.i >= len(tokens) || tokens[b.i].Type != TOKEN_STRING || tokens[b.i].Line != nextToken.Line {
+			return errorAt(CodeSyntax, nextToken)
+		}
+		pathToken := tokens[b.i]
+		b.i++ // Consume STRING
+		if b.i < len(tokens) && tokens[b.i].Line == pathToken.Line && tokens[b.i].Type != TOKEN_COMMENT && tokens[b.i].Type != TOKEN_EOF {
+			return errorAt(CodeSyntax, tokens[b.i])
+		}
+
+		b.stack = b.stack[:1]
+		b.currentLevel = 0
+		b.addEntry(&ast.Include{
+			Keyword:     ast.Span{Start: tokenStart(nextToken), End: tokenEnd(nextToken)},
+			Path:        &ast.StringLit{Value: pathToken.Literal, Loc: ast.Span{Start: tokenStart(pathToken), End: tokenEnd(pathToken)}},
+			Comments:    b.pending,
+			LineComment: b.lineComment(pathToken.Line),
+		})
+		return nil
+	}
+
+	return errorAt(CodeSyntax, nextToken)
+}
+
+// openBlock tracks a multi-line array while its elements are being parsed.
+type openBlock struct {
+	level int // Indentation level of the key that owns the array
+	array *ast.ArrayLit
+	count int   // Number of elements so far
+	start Token // The "<|" token, for reporting an unclosed array
 }
 
 // parseValueFromTokens parses a value starting at startIdx.
-// It returns the parsed value, the next index, and any error.
-func parseValueFromTokens(tokens []Token, startIdx int) (interface{}, int, error) {
+// It returns the value node, the next index, and any error.
+func parseValueFromTokens(tokens []Token, startIdx int, cfg *parseConfig) (ast.Value, int, error) {
 	if startIdx >= len(tokens) {
-		return nil, startIdx, errors.New(ErrSyntax)
+		return nil, startIdx, errorAt(CodeSyntax, tokens[len(tokens)-1])
 	}
 	token := tokens[startIdx]
+	loc := ast.Span{Start: tokenStart(token), End: tokenEnd(token)}
 
 	switch token.Type {
 	case TOKEN_STRING:
-		return token.Literal, startIdx + 1, nil
+		return &ast.StringLit{Value: token.Literal, Loc: loc}, startIdx + 1, nil
+	case TOKEN_RAW_STRING:
+		return &ast.StringLit{Value: token.Literal, Raw: true, Loc: loc}, startIdx + 1, nil
 	case TOKEN_NUMBER:
-		if i, err := strconv.Atoi(token.Literal); err == nil {
-			return i, startIdx + 1, nil
+		// Numbers are checked here so that a tree that parsed is always valid.
+		if cfg.strictFloats && isNonFinite(token.Literal) {
+			return nil, startIdx, errorAt(CodeType, token).explain("%s is not allowed with the StrictFloats option", token.Literal)
 		}
-		if f, err := strconv.ParseFloat(token.Literal, 64); err == nil {
-			return f, startIdx + 1, nil
+		// With UseNumber the caller converts the literal, so any range is fine.
+		if _, err := parseNumber(token.Literal, cfg.largeIntegers); err != nil {
+			if err != errIntegerRange {
+				return nil, startIdx, errorAt(CodeType, token).explain("%q is not a number", token.Literal)
+			}
+			if !cfg.useNumber {
+				return nil, startIdx, errorAt(CodeOverflow, token).explain("integer %s does not fit in an int64, see the LargeIntegers option", token.Literal)
+			}
 		}
-		return nil, startIdx, errors.New(ErrType)
+		return &ast.NumberLit{Literal: token.Literal, Loc: loc}, startIdx + 1, nil
+	case TOKEN_TIMESTAMP:
+		return &ast.TimeLit{Literal: token.Literal, Loc: loc}, startIdx + 1, nil
+	case TOKEN_DURATION:
+		return &ast.DurationLit{Literal: token.Literal, Loc: loc}, startIdx + 1, nil
+	case TOKEN_BYTES:
+		return &ast.BytesLit{Literal: token.Literal, Loc: loc}, startIdx + 1, nil
 	case TOKEN_BOOL:
-		return token.Literal == "true", startIdx + 1, nil
+		return &ast.BoolLit{Value: token.Literal == "true", Loc: loc}, startIdx + 1, nil
 	case TOKEN_NULL:
-		return nil, startIdx + 1, nil
+		return &ast.NullLit{Loc: loc}, startIdx + 1, nil
+	case TOKEN_LITERAL:
+		return &ast.DialectLit{Literal: token.Literal, Loc: loc}, startIdx + 1, nil
+	case TOKEN_REFERENCE:
+		if _, err := parsePath(token.Literal); err != nil {
+			return nil, startIdx, errorAt(CodeSyntax, token)
+		}
+		return &ast.Reference{Path: token.Literal, Loc: loc}, startIdx + 1, nil
 	case TOKEN_ARRAY_START:
-		var arr []interface{}
+		arr := &ast.ArrayLit{}
 		curr := startIdx + 1
 		for curr < len(tokens) {
 			if tokens[curr].Type == TOKEN_ARRAY_END {
+				arr.Loc = ast.Span{Start: loc.Start, End: tokenEnd(tokens[curr])}
 				return arr, curr + 1, nil
 			}
 			if tokens[curr].Type == TOKEN_COMMA {
 				curr++
 				continue
 			}
+			if cfg.maxArrayLength > 0 && len(arr.Elements) >= cfg.maxArrayLength {
+				return nil, curr, errorAt(CodeArrayLength, tokens[curr])
+			}
 			// Recursive call for array elements
-			val, next, err := parseValueFromTokens(tokens, curr)
+			val, next, err := parseValueFromTokens(tokens, curr, cfg)
 			if err != nil {
 				return nil, curr, err
 			}
-			arr = append(arr, val)
+			arr.Elements = append(arr.Elements, val)
 			curr = next
 		}
-		return nil, curr, errors.New(ErrSyntax)
+		return nil, curr, errorAt(CodeSyntax, token)
+	case TOKEN_OBJECT_START:
+		obj := &ast.ObjectLit{Marker: loc, Inline: true}
+		curr := startIdx + 1
+		for curr < len(tokens) {
+			if tokens[curr].Type == TOKEN_OBJECT_END {
+				obj.Close = ast.Span{Start: tokenStart(tokens[curr]), End: tokenEnd(tokens[curr])}
+				return obj, curr + 1, nil
+			}
+			if tokens[curr].Type == TOKEN_COMMA {
+				curr++
+				continue
+			}
+			keyToken := tokens[curr]
+			if keyToken.Type != TOKEN_IDENTIFIER {
+				return nil, curr, errorAt(CodeSyntax, keyToken)
+			}
+			if err := checkBuiltinKey(keyToken, cfg); err != nil {
+				return nil, curr, err
+			}
+			curr++ // Consume IDENTIFIER
+			if curr >= len(tokens) || tokens[curr].Type != TOKEN_VINE_WHIP {
+				return nil, curr, errorAt(CodeSyntax, keyToken)
+			}
+			vineToken := tokens[curr]
+			curr++ // Consume VINE_WHIP
+
+			var val ast.Value
+			next := curr
+			if curr < len(tokens) && (tokens[curr].Type == TOKEN_COMMA || tokens[curr].Type == TOKEN_OBJECT_END) {
+				if cfg.emptyValues == EmptyValueError {
+					return nil, curr, errorAt(CodeSyntax, vineToken)
+				}
+			} else {
+				var err error
+				val, next, err = parseValueFromTokens(tokens, curr, cfg)
+				if err != nil {
+					return nil, curr, err
+				}
+			}
+			obj.Body = append(obj.Body, &ast.KeyValue{
+				Key:    identFrom(keyToken),
+				Vine:   ast.Span{Start: tokenStart(vineToken), End: tokenEnd(vineToken)},
+				Tildes: vineTildes(vineToken),
+				Value:  val,
+			})
+			curr = next
+		}
+		return nil, curr, errorAt(CodeSyntax, token)
 	default:
-		return nil, startIdx, errors.New(ErrType)
+		return nil, startIdx, errorAt(CodeType, token)
 	}
 }
 
-// validateKey checks key constraints.
-func validateKey(key string) error {
-	if key == "Charizard" {
-		return errors.New("It burns the bulb")
-	}
-	return nil
-}
+// Themed literals for the float64 values that cannot be written with digits.
+const (
+	literalInf    = "Eternatus"
+	literalNegInf = "-Eternatus"
+	literalNaN    = "Unown"
+)
 
-// PrintAST prints the AST in a human-readable format.
-// It traverses the map recursively.
-func PrintAST(ast map[string]interface{}) {
-	printNode(ast, 0)
+// isNonFinite reports whether literal is one of the themed infinity or NaN
+// literals.
+func isNonFinite(literal string) bool {
+	return literal == literalInf || literal == literalNegInf || literal == literalNaN
 }
 
-func printNode(node interface{}, level int) {
-	indent := strings.Repeat("  ", level)
-	switch v := node.(type) {
-	case map[string]interface{}:
-		for key, val := range v {
-			fmt.Printf("%s%s: ", indent, key)
-			switch val.(type) {
-			case map[string]interface{}, []interface{}:
-				fmt.Println()
-				printNode(val, level+1)
-			default:
-				printNode(val, 0)
+// errIntegerRange is returned by parseNumber for an integer literal that the
+// LargeIntegerPolicy does not allow.
+var errIntegerRange = errors.New("integer out of range")
+
+// parseNumber converts a number literal to an int64, or a float64 if it is
+// not a whole number. Integers outside the int64 range are handled according
+// to policy.
+func parseNumber(literal string, policy LargeIntegerPolicy) (interface{}, error) {
+	switch literal {
+	case literalInf:
+		return math.Inf(1), nil
+	case literalNegInf:
+		return math.Inf(-1), nil
+	case literalNaN:
+		return math.NaN(), nil
+	}
+	i, err := strconv.ParseInt(literal, 10, 64)
+	if err == nil {
+		return i, nil
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		switch policy {
+		case LargeIntegerUint64:
+			if u, err := strconv.ParseUint(literal, 10, 64); err == nil {
+				return u, nil
 			}
-		}
-	case []interface{}:
-		for _, val := range v {
-			fmt.Printf("%s- ", indent)
-			switch val.(type) {
-			case map[string]interface{}, []interface{}:
-				fmt.Println()
-				printNode(val, level+1)
-			default:
-				printNode(val, 0)
+		case LargeIntegerBig:
+			if b, ok := new(big.Int).SetString(literal, 10); ok {
+				return b, nil
 			}
 		}
-	default:
-		if level == 0 {
-			fmt.Printf("%v\n", v)
+		return nil, errIntegerRange
+	}
+	return strconv.ParseFloat(literal, 64)
+}
+
+// commentFrom creates a comment node from a COMMENT token.
+func commentFrom(tok Token) *ast.Comment {
+	return &ast.Comment{Text: tok.Literal, Loc: ast.Span{Start: tokenStart(tok), End: tokenEnd(tok)}}
+}
+
+// vineTildes returns the number of tildes in a VINE_WHIP token.
+func vineTildes(tok Token) int {
+	return strings.Count(tok.Literal, "~")
+}
+
+// identFrom creates an identifier node from an IDENTIFIER token.
+func identFrom(tok Token) *ast.Ident {
+	return &ast.Ident{Name: tok.Literal, Loc: ast.Span{Start: tokenStart(tok), End: tokenEnd(tok)}}
+}
+
+// tokenStart returns the position of the first character of tok.
+func tokenStart(tok Token) ast.Position {
+	return ast.Position{Line: tok.Line, Column: tok.Column}
+}
+
+// tokenEnd returns the position of the last character of tok.
+func tokenEnd(tok Token) ast.Position {
+	if tok.EndLine != 0 {
+		return ast.Position{Line: tok.EndLine, Column: tok.EndColumn}
+	}
+	var width int
+	switch tok.Type {
+	case TOKEN_STRING, TOKEN_RAW_STRING:
+		width = len(tok.Literal) + 2 // The quotes are not part of the literal
+	case TOKEN_BYTES:
+		width = len(tok.Literal) + len(`0b64""`)
+	case TOKEN_BOOL:
+		if tok.Literal == "true" {
+			width = len("SuperEffective")
 		} else {
-			fmt.Printf("%s%v\n", indent, v)
+			width = len("NotVeryEffective")
 		}
+	case TOKEN_NULL:
+		width = len("MissingNo")
+	case TOKEN_SECTION_OPEN, TOKEN_SECTION_CLOSE:
+		width = len(sectionMarker(tok.Level))
+	case TOKEN_ARRAY_START, TOKEN_ARRAY_END:
+		width = 2
+	case TOKEN_OBJECT_START, TOKEN_OBJECT_END:
+		width = 1
+	default:
+		width = len(tok.Literal)
+	}
+	if width == 0 {
+		width = 1
+	}
+	return ast.Position{Line: tok.Line, Column: tok.Column + width - 1}
+}
+
+// attachSnippet fills in the source line of a ParseError raised by the parser,
+// using the INDENT token that opened the offending line.
+func attachSnippet(err error, tokens []Token) {
+	if list, ok := err.(ErrorList); ok {
+		for _, pe := range list {
+			attachSnippet(pe, tokens)
+		}
+		return
+	}
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Snippet != "" {
+		return
 	}
+	for _, tok := range tokens {
+		if tok.Type == TOKEN_INDENT && tok.Line == pe.Line {
+			pe.Snippet = tok.Literal
+			return
+		}
+	}
+}
+
+// checkBuiltinKey checks the key in tok against the built-in rule of cfg, the
+// Charizard ban of the spec unless BuiltinKeyRule replaced it.
+func checkBuiltinKey(tok Token, cfg *parseConfig) error {
+	if cfg.builtinKey == nil {
+		return nil
+	}
+	if err := cfg.builtinKey(tok.Literal); err != nil {
+		pe := errorAt(CodeReservedKey, tok).explain("%v", err)
+		pe.Err = err
+		return pe
+	}
+	return nil
 }
@@ -1,8 +1,17 @@
-package main
+package bulbason
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestParse_Valid(t *testing.T) {
@@ -37,7 +46,7 @@ whitelist ~~~~> <| "Prof_Oak", "Mom" |>
 		"database": map[string]interface{}{
 			"host": "127.0.0.1",
 			"pool": map[string]interface{}{
-				"max_connections": 100,
+				"max_connections": int64(100),
 				"KERNEL_FLAGS": map[string]interface{}{
 					"panic_on_fail": true,
 				},
@@ -128,3 +137,1040 @@ name ~> "Bulby"`
 	// Just verify it doesn't panic
 	PrintAST(result)
 }
+
+func TestParse_DuplicateKeys(t *testing.T) {
+	input := `BULBA!
+host ~> "first"
+(o) db (o)
+    port ~> 1
+    port ~> 2
+host ~> "second"
+`
+	tests := []struct {
+		name     string
+		policy   DuplicateKeyPolicy
+		expected map[string]interface{}
+	}{
+		{"Last Wins", DuplicateLastWins, map[string]interface{}{"host": "second", "db": map[string]interface{}{"port": int64(2)}}},
+		{"First Wins", DuplicateFirstWins, map[string]interface{}{"host": "first", "db": map[string]interface{}{"port": int64(1)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Parse(input, DuplicateKeys(tt.policy))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		result, err := Parse(input)
+		if err != nil || result["host"] != "second" {
+			t.Errorf("Expected the last value by default, got %v (%v)", result, err)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := Parse(input, DuplicateKeys(DuplicateError))
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("Expected a *ParseError, got %v", err)
+		}
+		if pe.Code != CodeDuplicateKey || pe.Line != 5 || pe.Column != 5 || pe.Snippet != "    port ~> 2" {
+			t.Errorf("Unexpected error %+v", pe)
+		}
+	})
+
+	t.Run("Error Collected", func(t *testing.T) {
+		_, err := Parse(input, DuplicateKeys(DuplicateError), CollectErrors())
+		list, ok := err.(ErrorList)
+		if !ok || len(list) != 2 || list[0].Line != 5 || list[1].Line != 6 {
+			t.Errorf("Expected duplicates on lines 5 and 6, got %v", err)
+		}
+	})
+}
+
+func TestParse_KeyRules(t *testing.T) {
+	errInternal := errors.New("keys starting with x_ are internal")
+	internal := func(key string) error {
+		if strings.HasPrefix(key, "x_") {
+			return errInternal
+		}
+		return nil
+	}
+	tests := []struct {
+		name   string
+		input  string
+		rules  []KeyRule
+		code   ErrorCode
+		line   int
+		column int
+		want   string
+	}{
+		{"Valid", "BULBA!\nmax_connections ~> 1\n(o) db_pool (o)\n    size ~> 2\n", []KeyRule{KeyNaming(SnakeCase), internal}, "", 0, 0, ""},
+		{"Custom", "BULBA!\np ~> { x_id ~> 1 }\n", []KeyRule{internal}, CodeKeyRule, 2, 8, "It burns the bulb: keys starting with x_ are internal"},
+		{"Reserved", "BULBA!\n(o) admin (o)\n", []KeyRule{ReservedKeys("admin", "root")}, CodeKeyRule, 2, 5, `It burns the bulb: key "admin" is reserved`},
+		{"Snake", "BULBA!\nmaxConnections ~> 1\n", []KeyRule{KeyNaming(SnakeCase)}, CodeKeyRule, 2, 1, `It burns the bulb: key "maxConnections" is not snake_case`},
+		{"Camel", "BULBA!\nmaxConnections ~> 1\nport_number ~> 2\n", []KeyRule{KeyNaming(CamelCase)}, CodeKeyRule, 3, 1, `key "port_number" is not camelCase`},
+		{"Pascal", "BULBA!\nPort ~> 1\nport ~> 2\n", []KeyRule{KeyNaming(PascalCase)}, CodeKeyRule, 3, 1, `key "port" is not PascalCase`},
+		{"Kebab", "BULBA!\n\"max-size\" ~> 1\nmax_size ~> 2\n", []KeyRule{KeyNaming(KebabCase)}, CodeKeyRule, 3, 1, `key "max_size" is not kebab-case`},
+		{"Pattern", "BULBA!\nab ~> 1\nabc ~> 2\n", []KeyRule{KeyPattern(regexp.MustCompile(`^.{1,2}$`))}, CodeKeyRule, 3, 1, `key "abc" does not match ^.{1,2}$`},
+		// The ban of the spec comes first, with its own code.
+		{"Charizard", "BULBA!\nCharizard ~> 1\n", []KeyRule{internal}, CodeReservedKey, 2, 1, ErrCharizard},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input, KeyRules(tt.rules...))
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Code != tt.code || pe.Line != tt.line || pe.Column != tt.column || !strings.HasSuffix(pe.Message, tt.want) {
+			t.Errorf("%s: expected %s %q at %d:%d, got %#v", tt.name, tt.code, tt.want, tt.line, tt.column, err)
+		}
+	}
+
+	if _, err := Parse("BULBA!\nx_id ~> 1\n", KeyRules(internal)); !errors.Is(err, errInternal) {
+		t.Errorf("Expected the error of the rule, got %v", err)
+	}
+	// A rejected section still holds its keys, which are checked in turn.
+	_, err := Parse("BULBA!\nx_a ~> 1\n(o) x_s (o)\n    ok ~> 2\n    x_b ~> 3\n", KeyRules(internal), CollectErrors())
+	if list, ok := err.(ErrorList); !ok || len(list) != 3 || list[0].Line != 2 || list[1].Line != 3 || list[2].Line != 5 {
+		t.Errorf("Expected errors on lines 2, 3 and 5, got %v", err)
+	}
+}
+
+func TestParse_BuiltinKeyRule(t *testing.T) {
+	noAdmin := ReservedKeys("admin")
+	noAdminNorCharizard := func(key string) error {
+		if err := CharizardBan()(key); err != nil {
+			return err
+		}
+		return noAdmin(key)
+	}
+	tests := []struct {
+		name   string
+		input  string
+		opts   []ParseOption
+		code   ErrorCode
+		line   int
+		column int
+		detail string
+	}{
+		{"Default", "BULBA!\n(o) Charizard (o)\n", nil, CodeReservedKey, 2, 5, `"Charizard" cannot be used as a key`},
+		{"Lifted", "BULBA!\n(o) Charizard (o)\n    Charizard ~> { Charizard ~> 1 }\n", []ParseOption{BuiltinKeyRule(nil)}, "", 0, 0, ""},
+		{"Replaced", "BULBA!\nCharizard ~> 1\n(o) admin (o)\n", []ParseOption{BuiltinKeyRule(noAdmin)}, CodeReservedKey, 3, 5, `key "admin" is reserved`},
+		{"Extended", "BULBA!\np ~> { admin ~> 1 }\n", []ParseOption{BuiltinKeyRule(noAdminNorCharizard)}, CodeReservedKey, 2, 8, `key "admin" is reserved`},
+		{"Extended Charizard", "BULBA!\nCharizard ~> 1\n", []ParseOption{BuiltinKeyRule(noAdminNorCharizard)}, CodeReservedKey, 2, 1, `"Charizard" cannot be used as a key`},
+		// Section names go through the built-in rule first, then the KeyRules.
+		{"Section KeyRules", "BULBA!\n(o) dbPool (o)\n", []ParseOption{BuiltinKeyRule(noAdmin), KeyRules(KeyNaming(SnakeCase))}, CodeKeyRule, 2, 5, `key "dbPool" is not snake_case`},
+		{"Section Both", "BULBA!\n(o) admin (o)\n", []ParseOption{BuiltinKeyRule(noAdmin), KeyRules(ReservedKeys("admin"))}, CodeReservedKey, 2, 5, `key "admin" is reserved`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input, tt.opts...)
+		if tt.code == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Code != tt.code || pe.Line != tt.line || pe.Column != tt.column || pe.Detail != tt.detail {
+			t.Errorf("%s: expected %s %q at %d:%d, got %#v", tt.name, tt.code, tt.detail, tt.line, tt.column, err)
+			continue
+		}
+		if pe.Code == CodeReservedKey && (pe.Message != ErrCharizard || !errors.Is(err, ErrCharizardError)) {
+			t.Errorf("%s: expected the message of the spec, got %q", tt.name, pe.Message)
+		}
+	}
+}
+
+func TestNamingConvention_Convert(t *testing.T) {
+	tests := []struct {
+		key                         string
+		snake, camel, pascal, kebab string
+	}{
+		{"app_name", "app_name", "appName", "AppName", "app-name"},
+		{"KERNEL_FLAGS", "kernel_flags", "kernelFlags", "KernelFlags", "kernel-flags"},
+		{"maxConnections", "max_connections", "maxConnections", "MaxConnections", "max-connections"},
+		{"HTTPServer", "http_server", "httpServer", "HttpServer", "http-server"},
+		{"retry-after 2", "retry_after_2", "retryAfter2", "RetryAfter2", "retry-after-2"},
+		{"v2Api", "v2_api", "v2Api", "V2Api", "v2-api"},
+		{"__", "__", "__", "__", "__"},
+	}
+	for _, tt := range tests {
+		for c, want := range map[NamingConvention]string{SnakeCase: tt.snake, CamelCase: tt.camel, PascalCase: tt.pascal, KebabCase: tt.kebab} {
+			if got := c.Convert(tt.key); got != want {
+				t.Errorf("%s.Convert(%q) = %q, want %q", c, tt.key, got, want)
+			}
+		}
+	}
+}
+
+func TestParse_ArrayOfObjects(t *testing.T) {
+	input := `BULBA!
+servers ~~~~> <|
+(o)
+    host ~~~~> "10.0.0.1"
+    port ~~~~> 8080
+(o)
+    host ~~~~> "10.0.0.2"
+    (O) tls (O)
+        enabled ~~~~> SuperEffective
+    port ~~~~> 8081
+|>
+(o) network (o)
+    routes ~~> <| zZz One per gateway
+    (O)
+        via ~~> "gw1"
+    (O)
+        via ~~> "gw2"
+    |>
+    mtu ~~> 1500
+name ~~> "Bulby"
+`
+	expected := map[string]interface{}{
+		"servers": []map[string]interface{}{
+			{"host": "10.0.0.1", "port": int64(8080)},
+			{"host": "10.0.0.2", "port": int64(8081), "tls": map[string]interface{}{"enabled": true}},
+		},
+		"network": map[string]interface{}{
+			"routes": []map[string]interface{}{{"via": "gw1"}, {"via": "gw2"}},
+			"mtu":    int64(1500),
+		},
+		"name": "Bulby",
+	}
+
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, result)
+	}
+}
+
+func TestParse_ArrayOfObjectsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		code  ErrorCode
+		line  int
+	}{
+		{"Unclosed", "BULBA!\nservers ~> <|\n(o)\n    host ~> \"a\"\n", CodeSyntax, 2},
+		{"Stray Close", "BULBA!\nkey ~> 1\n|>\n", CodeSyntax, 3},
+		{"Element Outside Array", "BULBA!\n(o)\n    host ~> \"a\"\n", CodeSyntax, 2},
+		{"Key Before Element", "BULBA!\nservers ~> <|\n    host ~> \"a\"\n|>\n", CodeSyntax, 3},
+		{"Key Outside Element", "BULBA!\nservers ~> <|\n(o)\n    host ~> \"a\"\nport ~> 1\n|>\n", CodeSyntax, 5},
+		{"Wrong Marker", "BULBA!\nservers ~> <|\n(O)\n    host ~> \"a\"\n|>\n", CodeIndentation, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			pe, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Expected a *ParseError, got %v", err)
+			}
+			if pe.Code != tt.code || pe.Line != tt.line {
+				t.Errorf("Expected %s on line %d, got %s on line %d", tt.code, tt.line, pe.Code, pe.Line)
+			}
+		})
+	}
+}
+
+func TestParseFragment(t *testing.T) {
+	tests := []struct {
+		name, input string
+		expected    map[string]interface{}
+	}{
+		{"Body", "name ~> \"api\"\n(o) db (o)\n    port ~> 5432\n", map[string]interface{}{"name": "api", "db": map[string]interface{}{"port": int64(5432)}}},
+		{"Comment first", "zZz A stored snippet\nport ~> 80", map[string]interface{}{"port": int64(80)}},
+		{"With the header", "BULBA!\nport ~> 80\n", map[string]interface{}{"port": int64(80)}},
+		{"Empty", "", map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		got, err := ParseFragment(tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+
+	// Lines count from the start of the fragment.
+	var pe *ParseError
+	if _, err := ParseFragment("a ~> 1\nb ~> \"open\n"); !errors.As(err, &pe) || pe.Line != 2 || pe.Snippet != "b ~> \"open" {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+	if _, err := ParseFragment("a ~> 1\nBULBA!\n"); !errors.As(err, &pe) || pe.Line != 2 {
+		t.Errorf("Expected the header to be rejected after the first line, got %v", err)
+	}
+}
+
+func TestParse_Versions(t *testing.T) {
+	versions := VersionRegistry{
+		2: {UseDialect(Dialect{True: []string{"Shiny"}})},
+		3: {IndentWidth(2)},
+	}
+	tests := []struct {
+		name, input string
+		opts        []ParseOption
+		expected    map[string]interface{}
+		code        ErrorCode
+	}{
+		{"Plain", "BULBA!\nok ~> SuperEffective\n", nil, map[string]interface{}{"ok": true}, ""},
+		{"Version 1", "BULBA!v1\nok ~> SuperEffective\n", nil, map[string]interface{}{"ok": true}, ""},
+		{"Registered", "BULBA!v2\nok ~> Shiny\n", []ParseOption{Versions(versions)}, map[string]interface{}{"ok": true}, ""},
+		{"Other registered", "BULBA!v3\n(o) s (o)\n  k ~> 1\n", []ParseOption{Versions(versions)}, map[string]interface{}{"s": map[string]interface{}{"k": int64(1)}}, ""},
+		{"Options of another version", "BULBA!\nok ~> Shiny\n", []ParseOption{Versions(versions)}, nil, CodeType},
+		{"Unknown", "BULBA!v4\nok ~> 1\n", []ParseOption{Versions(versions)}, nil, CodeVersion},
+		{"Not registered", "BULBA!v2\nok ~> 1\n", nil, nil, CodeVersion},
+		{"Leading zero", "BULBA!v02\n", []ParseOption{Versions(versions)}, nil, CodeHeader},
+		{"Zero", "BULBA!v0\n", nil, nil, CodeHeader},
+		{"Not a number", "BULBA!vx\n", nil, nil, CodeHeader},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input, tt.opts...)
+		if tt.code == "" {
+			if err != nil || !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%s: expected %v, got %v (%v)", tt.name, tt.expected, got, err)
+			}
+			continue
+		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Code != tt.code {
+			t.Errorf("%s: expected %s, got %v", tt.name, tt.code, err)
+		}
+	}
+
+	var pe *ParseError
+	if _, err := Parse("BULBA!v9\n"); !errors.As(err, &pe) || pe.Message != ErrHeader || pe.Line != 1 || pe.Column != 7 || pe.Snippet != "BULBA!v9" {
+		t.Errorf("Expected a version error at 1:7, got %#v", err)
+	}
+
+	// The options of one version do not stay with a Parser.
+	p := NewParser(Versions(versions))
+	if _, err := p.Parse("BULBA!v2\nok ~> Shiny\n"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := p.Parse("BULBA!\nok ~> Shiny\n"); !errors.As(err, &pe) || pe.Code != CodeType {
+		t.Errorf("Expected a type error without the version, got %v", err)
+	}
+
+	// The version is kept in the syntax tree, and by Format.
+	doc, err := ParseAST("BULBA!v2\nok ~> Shiny\n", Versions(versions))
+	if err != nil || doc.Version != 2 || doc.Header.End.Column != 8 {
+		t.Errorf("Expected version 2, got %+v (%v)", doc, err)
+	}
+	if out, err := Format([]byte("BULBA!v2\nok ~> 1\n")); err == nil || !errors.As(err, &pe) || pe.Code != CodeVersion {
+		t.Errorf("Expected Format to reject an unknown version, got %s (%v)", out, err)
+	}
+}
+
+func TestParse_IndentWidth(t *testing.T) {
+	input := "BULBA!\n(o) database (o)\n  host ~> \"db\"\n  (O) pool (O)\n    size ~> 5\n"
+	got, err := Parse(input, IndentWidth(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"database": map[string]interface{}{"host": "db", "pool": map[string]interface{}{"size": int64(5)}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// The default stays 4, and other widths are rejected.
+	var pe *ParseError
+	if _, err := Parse(input); !errors.As(err, &pe) || pe.Code != CodeIndentation || pe.Line != 3 {
+		t.Errorf("Expected an indentation error on line 3, got %v", err)
+	}
+	if _, err := Parse("BULBA!\n(o) s (o)\n   k ~> 1\n", IndentWidth(2)); !errors.As(err, &pe) || pe.Code != CodeIndentation || pe.Column != 4 {
+		t.Errorf("Expected an indentation error at column 4, got %v", err)
+	}
+}
+
+func TestParse_ExpandTabs(t *testing.T) {
+	input := "BULBA!\n(o) database (o)\n\thost ~> \"db\"\n\t(O) pool (O)\n\t  \tsize ~> 5\n\tquery ~> \"\"\"\n\t\tSELECT 1\n\t\"\"\"\n"
+	got, err := Parse(input, ExpandTabs(0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"database": map[string]interface{}{
+			"host":  "db",
+			"pool":  map[string]interface{}{"size": int64(5)},
+			"query": "    SELECT 1",
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got, err := Parse("BULBA!\n(o) s (o)\n\tk ~> 1\n", ExpandTabs(2), IndentWidth(2)); err != nil || got["s"].(map[string]interface{})["k"] != int64(1) {
+		t.Errorf("Expected tabs of width 2 to indent by one level, got %v (%v)", got, err)
+	}
+
+	tests := []struct {
+		name, input  string
+		opts         []ParseOption
+		code         ErrorCode
+		line, column int
+	}{
+		{"Default", "BULBA!\n(o) s (o)\n\tk ~> 1\n", nil, CodeTab, 3, 1},
+		{"After the indentation", "BULBA!\n(o) s (o)\n\tk ~>\t1\n", []ParseOption{ExpandTabs(4)}, CodeTab, 3, 9},
+		{"Width", "BULBA!\n(o) s (o)\n\tk ~> 1\n", []ParseOption{ExpandTabs(8)}, CodeIndentation, 3, 1},
+	}
+	for _, tt := range tests {
+		var pe *ParseError
+		if _, err := Parse(tt.input, tt.opts...); !errors.As(err, &pe) || pe.Code != tt.code || pe.Line != tt.line || pe.Column != tt.column {
+			t.Errorf("%s: expected %s at %d:%d, got %v", tt.name, tt.code, tt.line, tt.column, err)
+		}
+	}
+}
+
+func TestParse_Heredoc(t *testing.T) {
+	input := `BULBA!
+(o) db (o)
+    query ~~> """ zZz Not part of the query
+        SELECT *
+          FROM pokedex zZz still text
+
+        WHERE type = "grass"
+        """
+    name ~~> "Bulby"
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "SELECT *\n  FROM pokedex zZz still text\n\nWHERE type = \"grass\""
+	db := result["db"].(map[string]interface{})
+	if db["query"] != expected {
+		t.Errorf("Expected %q, got %q", expected, db["query"])
+	}
+	if db["name"] != "Bulby" {
+		t.Errorf("Expected parsing to resume after the heredoc, got %v", db)
+	}
+}
+
+func TestParse_HeredocErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		code  ErrorCode
+		line  int
+	}{
+		{"Unclosed", "BULBA!\nkey ~> \"\"\"\n    text\n", CodeSyntax, 2},
+		{"Under Indented", "BULBA!\nkey ~> \"\"\"\n  text\n    \"\"\"\n", CodeIndentation, 3},
+		{"Tab", "BULBA!\nkey ~> \"\"\"\n    \ttext\n    \"\"\"\n", CodeTab, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			pe, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Expected a *ParseError, got %v", err)
+			}
+			if pe.Code != tt.code || pe.Line != tt.line {
+				t.Errorf("Expected %s on line %d, got %s on line %d", tt.code, tt.line, pe.Code, pe.Line)
+			}
+		})
+	}
+}
+
+func TestParse_ArrayStringsWithCommas(t *testing.T) {
+	input := `BULBA!
+moves ~~> <| "Tackle, Growl", "Vine Whip", 5 |>
+`
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []interface{}{"Tackle, Growl", "Vine Whip", int64(5)}
+	if !reflect.DeepEqual(result["moves"], expected) {
+		t.Errorf("Expected %v, got %v", expected, result["moves"])
+	}
+
+	// A quote ends an element only where a string can end.
+	result, err = Parse("BULBA!\nquotes ~~> <| \"a\"b\", \"c\" |>\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = []interface{}{"a\"b", "c"}
+	if !reflect.DeepEqual(result["quotes"], expected) {
+		t.Errorf("Expected %v, got %v", expected, result["quotes"])
+	}
+
+	_, err = Parse("BULBA!\nmoves ~~> <| \"Tackle, Growl |>\n")
+	if pe, ok := err.(*ParseError); !ok || pe.Code != CodeType {
+		t.Errorf("Expected a type error for an unterminated string, got %v", err)
+	}
+}
+
+func TestParse_RawStrings(t *testing.T) {
+	input := "BULBA!\n" +
+		"path ~~> `C:\\Users\\Ash\\\"Team\"`\n" +
+		"pattern ~~> `^\\d+,\\s*$`\n" +
+		"mixed ~~> <| `a,\"b`, \"c\" |>\n"
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"path":    `C:\Users\Ash\"Team"`,
+		"pattern": `^\d+,\s*$`,
+		"mixed":   []interface{}{`a,"b`, "c"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParse_InlineObjects(t *testing.T) {
+	input := `BULBA!
+point ~~> { x ~> 1, y ~> 2 }
+(o) sprite (o)
+    frame ~~> { size ~> { w ~> 16, h ~> 16 }, tags ~> <| "idle", "walk" |>, name ~> "a, b" }
+empty ~~> { }
+path ~~> <| { x ~> 0 }, { x ~> 1 } |>
+`
+	expected := map[string]interface{}{
+		"point": map[string]interface{}{"x": int64(1), "y": int64(2)},
+		"sprite": map[string]interface{}{
+			"frame": map[string]interface{}{
+				"size": map[string]interface{}{"w": int64(16), "h": int64(16)},
+				"tags": []interface{}{"idle", "walk"},
+				"name": "a, b",
+			},
+		},
+		"empty": map[string]interface{}{},
+		"path": []interface{}{
+			map[string]interface{}{"x": int64(0)},
+			map[string]interface{}{"x": int64(1)},
+		},
+	}
+
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, result)
+	}
+}
+
+func TestParse_InlineObjectErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		code   ErrorCode
+		column int
+		opts   []ParseOption
+	}{
+		{"Missing Vine", "BULBA!\np ~> { x ~> 1, y 2 }\n", CodeSyntax, 16, nil},
+		{"Charizard", "BULBA!\np ~> { Charizard ~> 1 }\n", CodeReservedKey, 8, nil},
+		{"Bad Value", "BULBA!\np ~> { x ~> Pikachu }\n", CodeType, 13, nil},
+		{"Duplicate", "BULBA!\np ~> { x ~> 1, x ~> 2 }\n", CodeDuplicateKey, 16, []ParseOption{DuplicateKeys(DuplicateError)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input, tt.opts...)
+			pe, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Expected a *ParseError, got %v", err)
+			}
+			if pe.Code != tt.code || pe.Line != 2 || pe.Column != tt.column {
+				t.Errorf("Expected %s at 2:%d, got %s at %d:%d", tt.code, tt.column, pe.Code, pe.Line, pe.Column)
+			}
+		})
+	}
+}
+
+func TestParse_DeepNesting(t *testing.T) {
+	input := `BULBA!
+(o) a (o)
+    (O) b (O)
+        (@) c (@)
+            (@@) d (@@)
+                depth ~> 4
+                items ~> <|
+                (@@@)
+                    depth ~> 5
+                |>
+`
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": map[string]interface{}{
+			"d": map[string]interface{}{
+				"depth": int64(4),
+				"items": []map[string]interface{}{{"depth": int64(5)}},
+			},
+		}}},
+	}
+
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, result)
+	}
+
+	tests := []struct {
+		name  string
+		depth int
+		line  int
+	}{
+		{"Section", 3, 5},
+		{"Array Element", 4, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(input, MaxDepth(tt.depth))
+			pe, ok := err.(*ParseError)
+			if !ok || pe.Code != CodeMaxDepth || pe.Line != tt.line || !errors.Is(err, ErrBadgesError) {
+				t.Errorf("Expected %s on line %d, got %v", CodeMaxDepth, tt.line, err)
+			}
+		})
+	}
+}
+
+func TestParse_Timestamps(t *testing.T) {
+	result, err := Parse("BULBA!\nborn ~~> 1996-02-27T09:00:00+09:00\nnot_a_date ~~> 1996-02-27\n")
+	if err == nil {
+		t.Fatalf("Expected a date without a time to be rejected, got %v", result)
+	}
+
+	result, err = Parse("BULBA!\nborn ~~> 1996-02-27T09:00:00+09:00\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	born, ok := result["born"].(time.Time)
+	if !ok {
+		t.Fatalf("Expected a time.Time, got %T", result["born"])
+	}
+	if want := time.Date(1996, 2, 27, 0, 0, 0, 0, time.UTC); !born.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, born)
+	}
+}
+
+func TestParse_NumberFormats(t *testing.T) {
+	input := `BULBA!
+population ~~> 1_000_000
+ratio ~~> 3.141_592
+big ~~> 1.5e6
+tiny ~~> 2E-3
+neg ~~> -1_024
+`
+	expected := map[string]interface{}{
+		"population": int64(1000000),
+		"ratio":      3.141592,
+		"big":        1.5e6,
+		"tiny":       0.002,
+		"neg":        int64(-1024),
+	}
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	for _, bad := range []string{"_1", "1_", "1__0", "1._5", "1_e5"} {
+		_, err := Parse("BULBA!\nn ~~> " + bad + "\n")
+		if pe, ok := err.(*ParseError); !ok || pe.Code != CodeType {
+			t.Errorf("Expected a type error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestParse_LargeIntegers(t *testing.T) {
+	input := "BULBA!\nid ~~> 9223372036854775807\nbig ~~> 18446744073709551615\n"
+
+	_, err := Parse(input)
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Code != CodeOverflow || pe.Line != 3 || pe.Column != 9 {
+		t.Fatalf("Expected an overflow error at 3:9, got %v", err)
+	}
+
+	result, err := Parse(input, LargeIntegers(LargeIntegerUint64))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result["id"] != int64(math.MaxInt64) || result["big"] != uint64(math.MaxUint64) {
+		t.Errorf("Unexpected values %v", result)
+	}
+
+	_, err = Parse("BULBA!\nbig ~~> -9223372036854775809\n", LargeIntegers(LargeIntegerUint64))
+	if pe, ok := err.(*ParseError); !ok || pe.Code != CodeOverflow {
+		t.Errorf("Expected an overflow error for a large negative number, got %v", err)
+	}
+
+	result, err = Parse("BULBA!\nbig ~~> -123456789012345678901234567890\n", LargeIntegers(LargeIntegerBig))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	if b, ok := result["big"].(*big.Int); !ok || b.Cmp(want) != 0 {
+		t.Errorf("Expected %v, got %v", want, result["big"])
+	}
+}
+
+func TestParse_NonFiniteFloats(t *testing.T) {
+	input := "BULBA!\nupper ~~> Eternatus\nlower ~~> -Eternatus\nunknown ~~> Unown\n"
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !math.IsInf(result["upper"].(float64), 1) || !math.IsInf(result["lower"].(float64), -1) || !math.IsNaN(result["unknown"].(float64)) {
+		t.Errorf("Unexpected values %v", result)
+	}
+
+	_, err = Parse(input, StrictFloats())
+	if pe, ok := err.(*ParseError); !ok || pe.Code != CodeType || pe.Line != 2 {
+		t.Errorf("Expected a type error on line 2, got %v", err)
+	}
+
+	// Go's own spellings are not BSON numbers.
+	for _, bad := range []string{"Inf", "-Inf", "NaN", "infinity", "0x1p4"} {
+		_, err := Parse("BULBA!\nn ~~> " + bad + "\n")
+		if pe, ok := err.(*ParseError); !ok || pe.Code != CodeType {
+			t.Errorf("Expected a type error for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestParse_QuotedKeys(t *testing.T) {
+	input := `BULBA!
+"my-key.example.com" ~~> 1
+"with spaces"~> "ok"
+(o) "db.primary" (o)
+    "max-conns" ~~> 10
+    Charizard_ok ~~> { "a-b" ~> 2 }
+`
+	expected := map[string]interface{}{
+		"my-key.example.com": int64(1),
+		"with spaces":        "ok",
+		"db.primary": map[string]interface{}{
+			"max-conns":    int64(10),
+			"Charizard_ok": map[string]interface{}{"a-b": int64(2)},
+		},
+	}
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	_, err = Parse("BULBA!\n\"Charizard\" ~~> 1\n")
+	if pe, ok := err.(*ParseError); !ok || pe.Code != CodeReservedKey {
+		t.Errorf("Expected a quoted Charizard to be rejected, got %v", err)
+	}
+	_, err = Parse("BULBA!\n\"\" ~~> 1\n")
+	if pe, ok := err.(*ParseError); !ok || pe.Code != CodeSyntax {
+		t.Errorf("Expected an empty quoted key to be rejected, got %v", err)
+	}
+}
+
+func TestParse_EmptyValues(t *testing.T) {
+	input := `BULBA!
+name ~~>
+(o) stats (o)
+    hp ~~> zZz not rolled yet
+    moves ~~> { first ~> 1, second ~> }
+`
+	tests := []struct {
+		name     string
+		policy   EmptyValuePolicy
+		expected interface{}
+	}{
+		{"Null", EmptyValueNull, nil},
+		{"String", EmptyValueString, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := map[string]interface{}{
+				"name": tt.expected,
+				"stats": map[string]interface{}{
+					"hp":    tt.expected,
+					"moves": map[string]interface{}{"first": int64(1), "second": tt.expected},
+				},
+			}
+			result, err := Parse(input, EmptyValues(tt.policy))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("Expected %v, got %v", expected, result)
+			}
+		})
+	}
+
+	errTests := []struct {
+		input  string
+		column int
+	}{
+		{"BULBA!\nname ~~>\n", 6},
+		{"BULBA!\nname ~~>\nnext ~> 1\n", 6},
+		{"BULBA!\nname ~> { a ~> }\n", 13},
+	}
+	for _, tt := range errTests {
+		_, err := Parse(tt.input)
+		pe, ok := err.(*ParseError)
+		if !ok || pe.Code != CodeSyntax || pe.Line != 2 || pe.Column != tt.column {
+			t.Errorf("Parse(%q): expected a syntax error at 2:%d, got %v", tt.input, tt.column, err)
+		}
+	}
+}
+
+func TestParse_BlockComments(t *testing.T) {
+	input := "BULBA!\n" +
+		"zZz[ Hypnosis\n" +
+		"   puts these lines to sleep ]zZz\n" +
+		"name ~~> \"Bulby zZz sleepy\" zZz a real comment\n" +
+		"raw ~~> `a zZz b`\n" +
+		"said ~~> \"x \"y zZz\" z\" zZz quotes inside the string\n" +
+		"list ~~> <| \"x zZz\", \"y\" |> zZz[ inline ]zZz\n" +
+		"\"k zZz\" ~> 1\n" +
+		"(o) stats (o) zZz[ spans\n" +
+		"\tseveral lines ]zZz\n" +
+		"    hp ~~> 45\n"
+	expected := map[string]interface{}{
+		"name":  "Bulby zZz sleepy",
+		"raw":   "a zZz b",
+		"said":  "x \"y zZz\" z",
+		"list":  []interface{}{"x zZz", "y"},
+		"k zZz": int64(1),
+		"stats": map[string]interface{}{"hp": int64(45)},
+	}
+	result, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	errTests := []struct {
+		name   string
+		input  string
+		line   int
+		column int
+	}{
+		{"Unclosed", "BULBA!\nkey ~> 1\n    zZz[ never\nwakes up\n", 3, 5},
+		{"Text After Close", "BULBA!\nzZz[ a\nb ]zZz key ~> 1\n", 3, 8},
+		{"Text After Single Line", "BULBA!\nzZz[ a ]zZz key ~> 1\n", 2, 13},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			pe, ok := err.(*ParseError)
+			if !ok || pe.Code != CodeSyntax || pe.Line != tt.line || pe.Column != tt.column {
+				t.Errorf("Expected a syntax error at %d:%d, got %v", tt.line, tt.column, err)
+			}
+		})
+	}
+}
+
+func TestParser(t *testing.T) {
+	p := NewParser(DuplicateKeys(DuplicateError))
+
+	// The buffers of one document must not leak into the next, nor must a
+	// failed document break the parser.
+	inputs := []struct {
+		input    string
+		expected map[string]interface{}
+		code     ErrorCode
+	}{
+		{"BULBA!\na ~> 1\nb ~> <| 1, 2 |>\n", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(1), int64(2)}}, ""},
+		{"BULBA!\n  a ~> 1\n", nil, CodeIndentation},
+		{"BULBA!\na ~> 1\na ~> 2\n", nil, CodeDuplicateKey},
+		{"BULBA!\nc ~> \"x\"\n", map[string]interface{}{"c": "x"}, ""},
+	}
+	for i, tt := range inputs {
+		result, err := p.Parse(tt.input)
+		if tt.code != "" {
+			if pe, ok := err.(*ParseError); !ok || pe.Code != tt.code {
+				t.Errorf("Document %d: expected a %s error, got %v", i, tt.code, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Document %d: unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Document %d: expected %v, got %v", i, tt.expected, result)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := p.ParseAST(largeConfig(5)); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkParse(b *testing.B) {
+	input := largeConfig(1000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParser_Parse(b *testing.B) {
+	input := largeConfig(1000)
+	p := NewParser()
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParse_Limits(t *testing.T) {
+	input := `BULBA!
+name ~~> "Bulby"
+tags ~~> <| "a", "b", "c" |>
+moves ~~> <|
+(o)
+    power ~~> 40
+(o)
+    power ~~> 90
+|>
+`
+	// A document within every limit parses as usual.
+	if _, err := Parse(input, MaxInputSize(len(input)), MaxLineLength(28), MaxArrayLength(3), MaxTokens(33), MaxDepth(1)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		opt    ParseOption
+		code   ErrorCode
+		line   int
+		column int
+	}{
+		{"Input Size", MaxInputSize(20), CodeInputSize, 2, 14},
+		{"Input Size In Line Ending", MaxInputSize(6), CodeInputSize, 1, 7},
+		{"Line Length", MaxLineLength(20), CodeLineLength, 3, 21},
+		{"Inline Array Length", MaxArrayLength(2), CodeArrayLength, 3, 23},
+		{"Token Count", MaxTokens(10), CodeTokenCount, 3, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, collect := range []bool{false, true} {
+				opts := []ParseOption{tt.opt}
+				if collect {
+					opts = append(opts, CollectErrors())
+				}
+				_, err := Parse(input, opts...)
+				var pe *ParseError
+				if list, ok := err.(ErrorList); ok && len(list) == 1 {
+					pe = list[0]
+				} else {
+					pe, _ = err.(*ParseError)
+				}
+				if pe == nil || pe.Code != tt.code || pe.Line != tt.line || pe.Column != tt.column || pe.Message != ErrBadges {
+					t.Errorf("Expected %s at %d:%d, got %#v", tt.code, tt.line, tt.column, err)
+				}
+			}
+		})
+	}
+
+	// Elements of a multi-line array count against the same limit.
+	block := "BULBA!\nmoves ~~> <|\n(o)\n    power ~~> 40\n(o)\n    power ~~> 90\n|>\n"
+	_, err := Parse(block, MaxArrayLength(1))
+	if pe, ok := err.(*ParseError); !ok || pe.Code != CodeArrayLength || pe.Line != 5 || pe.Column != 1 {
+		t.Errorf("Expected array_length at 5:1, got %v", err)
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	input := "BULBA!\nname ~~> \"Bulby\"\n"
+	result, err := ParseContext(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := map[string]interface{}{"name": "Bulby"}; !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if _, err := ParseContext(ctx, input); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+// fuzzSeeds are the documents the fuzz targets start from. More can be
+// added under testdata/fuzz.
+var fuzzSeeds = []string{
+	largeConfig(2),
+	"BULBA!\nname ~~> \"Bulby\" zZz note\nlevel ~> -1_000\nratio ~> 1.5e3\nhp ~> Infinity\n",
+	"BULBA!\nwhen ~> 2024-05-01T12:00:00Z\nwait ~> 1h30m\ndata ~> 0b64\"aGVsbG8=\"\n",
+	"BULBA!\ntags ~> <| \"a, b\", `raw`, { x ~> 1, y ~> <| |> } |>\nempty ~>\n",
+	"BULBA!\nmoves ~~> <|\n(o)\n    power ~~> 40\n(o)\n    power ~~> 90\n|>\n",
+	"BULBA!\n(o) a (o)\n    (O) b (O)\n        (@) c (@)\n            (@@) d (@@)\n                k ~> 1\n",
+	"BULBA!\ntext ~> \"\"\"\n    line one\n      line two\n    \"\"\"\n",
+	"BULBA!\nzZz[ block\n  comment ]zZz\n\"odd key\" ~> 1\n",
+	"BULBA!\r\n(o) (o)\r\na ~> <|>\r\n",
+}
+
+// FuzzParse checks that no input makes the parser panic or return an error
+// other than a *ParseError or ErrorList, and that reading the document from
+// a stream gives the same result as parsing it from a string.
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		result, err := Parse(input)
+		switch err.(type) {
+		case nil, *ParseError:
+		default:
+			t.Fatalf("Unexpected error type %T: %v", err, err)
+		}
+
+		var decoded map[string]interface{}
+		decodeErr := NewDecoder(strings.NewReader(input)).Decode(&decoded)
+		if fmt.Sprint(err) != fmt.Sprint(decodeErr) {
+			t.Fatalf("Parse and Decode disagree: %v, %v", err, decodeErr)
+		}
+		if err == nil && fmt.Sprint(result) != fmt.Sprint(decoded) {
+			t.Fatalf("Parse and Decode disagree:\n%v\n%v", result, decoded)
+		}
+
+		_, err = ParseAST(input, CollectErrors(), ParseComments())
+		switch err.(type) {
+		case nil, *ParseError, ErrorList:
+		default:
+			t.Fatalf("Unexpected error type %T with CollectErrors: %v", err, err)
+		}
+	})
+}
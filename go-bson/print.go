@@ -0,0 +1,125 @@
+package bulbason
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PrintFormat selects how Fprint writes a parsed document.
+type PrintFormat int
+
+const (
+	// PrintTree writes one key per line, indented by two spaces per level,
+	// with array elements marked by dashes. This is the default.
+	PrintTree PrintFormat = iota
+	// PrintJSON writes indented JSON, converting values as ToJSON does.
+	PrintJSON
+	// PrintCompact writes the document on a single line, as an NDBulba
+	// record.
+	PrintCompact
+)
+
+func (f PrintFormat) String() string {
+	switch f {
+	case PrintTree:
+		return "tree"
+	case PrintJSON:
+		return "json"
+	case PrintCompact:
+		return "compact"
+	default:
+		return fmt.Sprintf("PrintFormat(%d)", int(f))
+	}
+}
+
+// Fprint writes a document, as returned by Parse, to w in the given format,
+// for debugging output in servers and expected output in tests. Keys are
+// written in sorted order, so that the output of a document is always the
+// same. Fprint returns an error if the document cannot be written in the
+// format, such as a NaN in JSON or a multi-line string in a record, or if w
+// returns one.
+func Fprint(w io.Writer, tree map[string]interface{}, format PrintFormat) error {
+	var buf bytes.Buffer
+	switch format {
+	case PrintTree:
+		printNode(&buf, tree, 0)
+	case PrintJSON:
+		var data bytes.Buffer
+		if err := writeJSONData(&data, tree, ""); err != nil {
+			return err
+		}
+		if err := json.Indent(&buf, data.Bytes(), "", "  "); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+	case PrintCompact:
+		record, err := MarshalRecord(tree)
+		if err != nil {
+			return err
+		}
+		buf.Write(record)
+		buf.WriteByte('\n')
+	default:
+		return fmt.Errorf("bulbason: unknown print format %v", format)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// PrintAST prints the AST in a human-readable format.
+// It traverses the map recursively.
+//
+// It writes to standard output in the PrintTree format; Fprint writes to any
+// io.Writer, in other formats too.
+func PrintAST(tree map[string]interface{}) {
+	Fprint(os.Stdout, tree, PrintTree)
+}
+
+func printNode(buf *bytes.Buffer, node interface{}, level int) {
+	indent := strings.Repeat("  ", level)
+	switch v := node.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(buf, "%s%s: ", indent, key)
+			printChild(buf, v[key], level)
+		}
+	case []map[string]interface{}:
+		for _, val := range v {
+			fmt.Fprintf(buf, "%s-\n", indent)
+			printNode(buf, val, level+1)
+		}
+	case []interface{}:
+		for _, val := range v {
+			fmt.Fprintf(buf, "%s- ", indent)
+			printChild(buf, val, level)
+		}
+	default:
+		if level == 0 {
+			fmt.Fprintf(buf, "%v\n", v)
+		} else {
+			fmt.Fprintf(buf, "%s%v\n", indent, v)
+		}
+	}
+}
+
+// printChild prints a value following its key or dash at level: on the same
+// line if it is a scalar, or on the lines below, one level deeper, if not.
+func printChild(buf *bytes.Buffer, val interface{}, level int) {
+	switch val.(type) {
+	case map[string]interface{}, []interface{}, []map[string]interface{}:
+		buf.WriteByte('\n')
+		printNode(buf, val, level+1)
+	default:
+		printNode(buf, val, 0)
+	}
+}
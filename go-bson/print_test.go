@@ -0,0 +1,102 @@
+package bulbason
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestFprint(t *testing.T) {
+	doc, err := Parse(`BULBA!
+name ~> "Bulby"
+tags ~> <| "grass", <| 1, 2 |> |>
+since ~> 2024-05-01T12:00:00Z
+(o) database (o)
+    host ~> "localhost"
+    port ~> 5432
+servers ~> <|
+(o)
+    host ~> "a"
+|>
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		format   PrintFormat
+		expected string
+	}{
+		{PrintTree, `database: 
+  host: localhost
+  port: 5432
+name: Bulby
+servers: 
+  -
+    host: a
+since: 2024-05-01 12:00:00 +0000 UTC
+tags: 
+  - grass
+  - 
+    - 1
+    - 2
+`},
+		{PrintJSON, `{
+  "database": {
+    "host": "localhost",
+    "port": 5432
+  },
+  "name": "Bulby",
+  "servers": [
+    {
+      "host": "a"
+    }
+  ],
+  "since": "2024-05-01T12:00:00Z",
+  "tags": [
+    "grass",
+    [
+      1,
+      2
+    ]
+  ]
+}
+`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Fprint(&buf, doc, tt.format); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.format, err)
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%v: expected:\n%s\ngot:\n%s", tt.format, tt.expected, buf.String())
+		}
+	}
+
+	// Records cannot hold nested arrays, which Marshal does not write.
+	delete(doc, "tags")
+	var buf bytes.Buffer
+	if err := Fprint(&buf, doc, PrintCompact); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `{ database ~> { host ~> "localhost", port ~> 5432 }, name ~> "Bulby", servers ~> <| { host ~> "a" } |>, since ~> 2024-05-01T12:00:00Z }` + "\n"
+	if buf.String() != want {
+		t.Errorf("compact: expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestFprint_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Fprint(&buf, map[string]interface{}{"ratio": math.NaN()}, PrintJSON); err == nil {
+		t.Error("Expected an error printing NaN as JSON")
+	}
+	if err := Fprint(&buf, map[string]interface{}{"text": "two\nlines"}, PrintCompact); err == nil {
+		t.Error("Expected an error printing a multi-line string as a record")
+	}
+	if err := Fprint(&buf, nil, PrintFormat(9)); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written on errors, got %q", buf.String())
+	}
+}
@@ -0,0 +1,147 @@
+package bulbason
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+const profileInput = `BULBA!
+(o) database (o)
+    host ~> "localhost"
+    pool ~> 5
+    (O) tls (O)
+        enabled ~> NotVeryEffective
+        cert ~> "dev.pem"
+(o) database (o) Forme prod
+    host ~> "db.internal"
+    (O) tls (O)
+        enabled ~> SuperEffective
+(o) database (o) Forme staging
+    host ~> "db.staging"
+(o) metrics (o) Forme prod
+    endpoint ~> "https://metrics.internal"
+`
+
+func TestParse_Profile(t *testing.T) {
+	doc, err := Parse(profileInput, Profile("prod"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"database": map[string]interface{}{
+			"host": "db.internal",
+			"pool": int64(5),
+			"tls":  map[string]interface{}{"enabled": true, "cert": "dev.pem"},
+		},
+		"metrics": map[string]interface{}{"endpoint": "https://metrics.internal"},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected %v, got %v", expected, doc)
+	}
+
+	doc, err = Parse(profileInput, Profile("staging"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if host := doc["database"].(map[string]interface{})["host"]; host != "db.staging" {
+		t.Errorf("Expected the staging host, got %v", host)
+	}
+	if _, ok := doc["metrics"]; ok {
+		t.Error("Expected the prod metrics to be left out")
+	}
+}
+
+func TestParse_NoProfile(t *testing.T) {
+	for _, opts := range [][]ParseOption{nil, {Profile("dev")}} {
+		doc, err := Parse(profileInput, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		database := doc["database"].(map[string]interface{})
+		if database["host"] != "localhost" {
+			t.Errorf("Expected the base host, got %v", database["host"])
+		}
+		if _, ok := doc["metrics"]; ok {
+			t.Error("Expected the profile sections to be left out")
+		}
+	}
+}
+
+func TestParse_ProfileNested(t *testing.T) {
+	input := `BULBA!
+(o) server (o)
+    (O) limits (O)
+        rate ~> 10
+    (O) limits (O) Forme prod
+        rate ~> 1000
+`
+	doc, err := Parse(input, Profile("prod"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"server": map[string]interface{}{"limits": map[string]interface{}{"rate": int64(1000)}}}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected %v, got %v", expected, doc)
+	}
+}
+
+func TestParse_ProfileDuplicates(t *testing.T) {
+	if _, err := Parse(profileInput, DuplicateKeys(DuplicateError)); err != nil {
+		t.Errorf("Expected profile sections not to be duplicates, got %v", err)
+	}
+
+	input := "BULBA!\n(o) db (o) Forme prod\n    a ~> 1\n(o) db (o) Forme prod\n    b ~> 2\n"
+	_, err := Parse(input, DuplicateKeys(DuplicateError))
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Code != CodeDuplicateKey || pe.Line != 4 {
+		t.Errorf("Expected a duplicate key error on line 4, got %v", err)
+	}
+}
+
+func TestParseAST_Profile(t *testing.T) {
+	doc, err := ParseAST("BULBA!\n(o) database (o) Forme prod\n    host ~> \"db\"\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s := doc.Body[0].(*ast.Section)
+	if s.Forme == nil || s.Forme.Name != "prod" {
+		t.Fatalf("Expected the prod profile, got %+v", s.Forme)
+	}
+	if s.Forme.Loc.Start != (ast.Position{Line: 2, Column: 24}) {
+		t.Errorf("Unexpected profile position %+v", s.Forme.Loc)
+	}
+	if s.Header.End != (ast.Position{Line: 2, Column: 27}) {
+		t.Errorf("Unexpected header span %+v", s.Header)
+	}
+
+	// Without a valid name after it, Forme is not a profile.
+	if _, err := ParseAST("BULBA!\n(o) database (o) Forme\n"); err == nil {
+		t.Error("Expected an error for a missing profile name")
+	}
+}
+
+func TestFormat_Profile(t *testing.T) {
+	out, err := Format([]byte("BULBA!\n(o) database (o)   Forme prod\n    host ~> \"db\"\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\n(o) database (o) Forme prod\n    host ~~~~> \"db\"\n"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+}
+
+func TestToJSON_Profile(t *testing.T) {
+	doc, err := ParseAST(profileInput)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = ToJSON(doc)
+	if err == nil || !strings.Contains(err.Error(), "belongs to the profile") {
+		t.Errorf("Expected a profile error, got %v", err)
+	}
+}
@@ -0,0 +1,474 @@
+package bulbason
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// Query is a compiled query expression, selecting any number of values from
+// a document. A query is a dotted path of keys, each of which may be followed
+// by brackets:
+//
+//	database.pool.size          the value at a path
+//	servers[2].host             an array element, counted from 0
+//	servers[-1].host            an array element, counted from the end
+//	servers[*].port             every element of an array
+//	database.*                  every value of a section
+//	servers[?port >= 8080].host the elements of an array matching a filter
+//	servers[?tls]               the elements holding a key
+//
+// A filter compares a key of each element, itself a section, with a BSON
+// literal such as "eu-west", 8080, SuperEffective or MissingNo, using ==, !=,
+// <, <=, > or >=. The key may be a dotted path, such as tls.enabled. Numbers
+// compare by value, whatever their type, and strings, timestamps and durations
+// compare in their natural order. Elements whose key is missing or of another
+// type never match an ordering comparison.
+//
+// A Query is safe for concurrent use.
+type Query struct {
+	expr  string
+	steps []queryStep
+}
+
+// queryStepKind is the kind of a step in a query.
+type queryStepKind int
+
+const (
+	stepKey      queryStepKind = iota // a section key
+	stepAnyKey                        // every value of a section
+	stepIndex                         // an array element
+	stepAnyIndex                      // every element of an array
+	stepFilter                        // the array elements matching a filter
+)
+
+// queryStep is a single step of a query, selecting values from those
+// selected by the previous step.
+type queryStep struct {
+	kind   queryStepKind
+	key    string
+	index  int
+	filter *queryFilter
+}
+
+// queryFilter selects the array elements whose value at path compares with
+// value as op says. Without op it selects the elements holding path.
+type queryFilter struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+// queryOps lists the filter operators, two-character ones first so that <=
+// is not read as <.
+var queryOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// CompileQuery parses a query expression. It returns an error if the
+// expression is malformed.
+func CompileQuery(expr string) (*Query, error) {
+	q := &Query{expr: expr}
+	rest := expr
+	for {
+		var key string
+		key, rest = cutQueryKey(rest)
+		switch key {
+		case "":
+			return nil, fmt.Errorf("bulbason: query %q: empty key", expr)
+		case "*":
+			q.steps = append(q.steps, queryStep{kind: stepAnyKey})
+		default:
+			q.steps = append(q.steps, queryStep{kind: stepKey, key: key})
+		}
+
+		for strings.HasPrefix(rest, "[") {
+			end := closingBracket(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("bulbason: query %q: missing ]", expr)
+			}
+			step, err := parseQueryBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("bulbason: query %q: %v", expr, err)
+			}
+			q.steps = append(q.steps, step)
+			rest = rest[end+1:]
+		}
+
+		if rest == "" {
+			return q, nil
+		}
+		if rest[0] != '.' {
+			return nil, fmt.Errorf("bulbason: query %q: unexpected %q", expr, rest)
+		}
+		rest = rest[1:]
+	}
+}
+
+// MustCompileQuery is like CompileQuery but panics if the expression is
+// malformed. It simplifies the initialisation of global queries.
+func MustCompileQuery(expr string) *Query {
+	q, err := CompileQuery(expr)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the expression the query was compiled from.
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Query returns the values selected by the query expression expr, in
+// document order for arrays and sorted by key for sections. A path leading
+// nowhere selects nothing, so the result is empty rather than an error.
+func (d Document) Query(expr string) ([]interface{}, error) {
+	q, err := CompileQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	return q.Eval(d), nil
+}
+
+// Eval returns the values the query selects from a document as returned by
+// Parse, in document order for arrays and sorted by key for sections.
+func (q *Query) Eval(doc map[string]interface{}) []interface{} {
+	values := []interface{}{doc}
+	for _, step := range q.steps {
+		var next []interface{}
+		for _, v := range values {
+			next = step.eval(next, v)
+		}
+		values = next
+	}
+	return values
+}
+
+// eval appends the values the step selects from v to out.
+func (s queryStep) eval(out []interface{}, v interface{}) []interface{} {
+	if s.kind == stepKey || s.kind == stepAnyKey {
+		section, ok := v.(map[string]interface{})
+		if !ok {
+			return out
+		}
+		if s.kind == stepKey {
+			if elem, ok := section[s.key]; ok {
+				out = append(out, elem)
+			}
+			return out
+		}
+		keys := make([]string, 0, len(section))
+		for k := range section {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			out = append(out, section[k])
+		}
+		return out
+	}
+
+	arr, ok := asArray(v)
+	if !ok {
+		return out
+	}
+	switch s.kind {
+	case stepIndex:
+		if i, ok := resolveIndex(s.index, len(arr)); ok {
+			out = append(out, arr[i])
+		}
+	case stepAnyIndex:
+		out = append(out, arr...)
+	case stepFilter:
+		for _, elem := range arr {
+			if s.filter.match(elem) {
+				out = append(out, elem)
+			}
+		}
+	}
+	return out
+}
+
+// EvalAST returns the values the query selects from a syntax tree, in source
+// order. Sections are returned as objects, and when a key appears more than
+// once the last value wins, as with Parse. Unlike Eval it keeps the position
+// and literal text of every value, for tools that print or edit them.
+func (q *Query) EvalAST(doc *ast.Document) []ast.Value {
+	values := []ast.Value{&ast.ObjectLit{Body: doc.Body}}
+	cfg := newParseConfig(nil)
+	for _, step := range q.steps {
+		var next []ast.Value
+		for _, v := range values {
+			next = step.evalAST(next, v, cfg)
+		}
+		values = next
+	}
+	return values
+}
+
+// evalAST appends the values the step selects from v to out.
+func (s queryStep) evalAST(out []ast.Value, v ast.Value, cfg *parseConfig) []ast.Value {
+	if s.kind == stepKey || s.kind == stepAnyKey {
+		obj, ok := v.(*ast.ObjectLit)
+		if !ok {
+			return out
+		}
+		if s.kind == stepKey {
+			if elem := lastEntry(obj.Body, s.key); elem != nil {
+				out = append(out, elem)
+			}
+			return out
+		}
+		seen := make(map[string]bool)
+		for _, entry := range obj.Body {
+			name := entryName(entry)
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, lastEntry(obj.Body, name))
+			}
+		}
+		return out
+	}
+
+	arr, ok := v.(*ast.ArrayLit)
+	if !ok {
+		return out
+	}
+	switch s.kind {
+	case stepIndex:
+		if i, ok := resolveIndex(s.index, len(arr.Elements)); ok {
+			out = append(out, arr.Elements[i])
+		}
+	case stepAnyIndex:
+		out = append(out, arr.Elements...)
+	case stepFilter:
+		for _, elem := range arr.Elements {
+			if s.filter.match(evaluate(elem, cfg)) {
+				out = append(out, elem)
+			}
+		}
+	}
+	return out
+}
+
+// lastEntry returns the value of the last entry of body with the given key,
+// sections being returned as objects, or nil if there is none.
+func lastEntry(body []ast.Entry, key string) ast.Value {
+	var v ast.Value
+	for _, entry := range body {
+		switch e := entry.(type) {
+		case *ast.Section:
+			if e.Name.Name == key && e.Forme == nil {
+				v = &ast.ObjectLit{Body: e.Body}
+			}
+		case *ast.KeyValue:
+			if e.Key.Name == key {
+				v = e.Value
+				if v == nil {
+					v = &ast.NullLit{}
+				}
+			}
+		}
+	}
+	return v
+}
+
+// resolveIndex returns the position in an array of length n of index i,
+// counted from the end when negative, and whether the array holds it.
+func resolveIndex(i, n int) (int, bool) {
+	if i < 0 {
+		i += n
+	}
+	return i, i >= 0 && i < n
+}
+
+// match reports whether an array element passes the filter.
+func (f *queryFilter) match(elem interface{}) bool {
+	v := elem
+	for _, key := range f.path {
+		section, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if v, ok = section[key]; !ok {
+			return false
+		}
+	}
+
+	switch f.op {
+	case "":
+		return true
+	case "==":
+		return queryEqual(v, f.value)
+	case "!=":
+		return !queryEqual(v, f.value)
+	}
+	c, ok := compareQueryValues(v, f.value)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// queryEqual reports whether two values are equal, numbers being compared by
+// value whatever their type.
+func queryEqual(a, b interface{}) bool {
+	if c, ok := compareQueryValues(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareQueryValues compares two values of an ordered kind, returning -1, 0
+// or +1, and false if they are not both numbers, strings, timestamps or
+// durations. NaN is not ordered, so it compares with nothing.
+func compareQueryValues(a, b interface{}) (int, bool) {
+	if x, ok := queryNumber(a); ok {
+		y, ok := queryNumber(b)
+		if !ok {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	case time.Duration:
+		if y, ok := b.(time.Duration); ok {
+			return cmp.Compare(x, y), true
+		}
+	}
+	return 0, false
+}
+
+// queryNumber returns v widened to a big.Float, so that numbers of different
+// types compare by value, and false if it is not a number or is NaN.
+func queryNumber(v interface{}) (*big.Float, bool) {
+	switch x := v.(type) {
+	case int64:
+		return new(big.Float).SetInt64(x), true
+	case uint64:
+		return new(big.Float).SetUint64(x), true
+	case *big.Int:
+		return new(big.Float).SetInt(x), true
+	case float64:
+		if math.IsNaN(x) {
+			return nil, false
+		}
+		return big.NewFloat(x), true
+	case Number:
+		if i, ok := new(big.Int).SetString(string(x), 0); ok {
+			return queryNumber(i)
+		}
+		if f, err := x.Float64(); err == nil {
+			return queryNumber(f)
+		}
+	}
+	return nil, false
+}
+
+// cutQueryKey returns the key at the start of a query and the rest of it,
+// from the following dot or bracket.
+func cutQueryKey(s string) (string, string) {
+	i := strings.IndexAny(s, ".[")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// closingBracket returns the index of the bracket closing the one s starts
+// with, skipping brackets inside quoted strings, or -1 if there is none.
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseQueryBracket parses the inside of a pair of brackets: an index, a
+// wildcard or a filter.
+func parseQueryBracket(s string) (queryStep, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "*":
+		return queryStep{kind: stepAnyIndex}, nil
+	case strings.HasPrefix(s, "?"):
+		filter, err := parseQueryFilter(strings.TrimSpace(s[1:]))
+		if err != nil {
+			return queryStep{}, err
+		}
+		return queryStep{kind: stepFilter, filter: filter}, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return queryStep{}, fmt.Errorf("invalid index %q", s)
+	}
+	return queryStep{kind: stepIndex, index: i}, nil
+}
+
+// parseQueryFilter parses a filter such as port >= 8080 or tls.enabled.
+func parseQueryFilter(s string) (*queryFilter, error) {
+	f := &queryFilter{}
+	key := s
+	if i := strings.IndexAny(s, "=!<>"); i >= 0 {
+		key = s[:i]
+		for _, op := range queryOps {
+			if strings.HasPrefix(s[i:], op) {
+				f.op = op
+				break
+			}
+		}
+		if f.op == "" {
+			return nil, fmt.Errorf("invalid operator in filter %q", s)
+		}
+		literal := strings.TrimSpace(s[i+len(f.op):])
+		m, err := Parse("BULBA!\nv ~> " + literal + "\n")
+		if literal == "" || err != nil {
+			return nil, fmt.Errorf("invalid value %q in filter %q", literal, s)
+		}
+		f.value = m["v"]
+	}
+
+	for _, k := range strings.Split(strings.TrimSpace(key), ".") {
+		if k == "" {
+			return nil, fmt.Errorf("empty key in filter %q", s)
+		}
+		f.path = append(f.path, k)
+	}
+	return f, nil
+}
@@ -0,0 +1,126 @@
+package bulbason
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+const queryInput = `BULBA!
+name ~> "Bulby"
+(o) database (o)
+    host ~> "localhost"
+    port ~> 5432
+servers ~> <|
+(o)
+    host ~> "10.0.0.1"
+    port ~> 8080
+    region ~> "eu-west"
+    (O) tls (O)
+        enabled ~> SuperEffective
+(o)
+    host ~> "10.0.0.2"
+    port ~> 9090.5
+    region ~> "us-east"
+(o)
+    host ~> "10.0.0.3"
+    port ~> 7000
+    region ~> "eu-west"
+|>
+`
+
+func TestQuery_Eval(t *testing.T) {
+	m, err := Parse(queryInput)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	doc := Document(m)
+
+	tests := []struct {
+		expr     string
+		expected []interface{}
+	}{
+		{"name", []interface{}{"Bulby"}},
+		{"database.port", []interface{}{int64(5432)}},
+		{"database.*", []interface{}{"localhost", int64(5432)}},
+		{"servers[1].host", []interface{}{"10.0.0.2"}},
+		{"servers[-1].host", []interface{}{"10.0.0.3"}},
+		{"servers[*].port", []interface{}{int64(8080), 9090.5, int64(7000)}},
+		{`servers[?region == "eu-west"].host`, []interface{}{"10.0.0.1", "10.0.0.3"}},
+		{`servers[?region != "eu-west"].host`, []interface{}{"10.0.0.2"}},
+		{"servers[?port >= 8080].host", []interface{}{"10.0.0.1", "10.0.0.2"}},
+		{"servers[?port < 8080.0].host", []interface{}{"10.0.0.3"}},
+		{"servers[?tls].host", []interface{}{"10.0.0.1"}},
+		{"servers[?tls.enabled == SuperEffective].port", []interface{}{int64(8080)}},
+		{`servers[?host == "10.0.0.2"][0]`, nil},
+		{"servers[3].host", nil},
+		{"database.missing", nil},
+		{"name.first", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			values, err := doc.Query(tt.expr)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, values)
+			}
+		})
+	}
+}
+
+func TestQuery_EvalAST(t *testing.T) {
+	doc, err := ParseAST(queryInput)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	values := MustCompileQuery("servers[?port > 7000].host").EvalAST(doc)
+	var hosts []string
+	for _, v := range values {
+		hosts = append(hosts, v.(*ast.StringLit).Value)
+	}
+	if expected := []string{"10.0.0.1", "10.0.0.2"}; !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("Expected %v, got %v", expected, hosts)
+	}
+
+	values = MustCompileQuery("database.*").EvalAST(doc)
+	if len(values) != 2 || values[0].(*ast.StringLit).Value != "localhost" || values[1].(*ast.NumberLit).Literal != "5432" {
+		t.Errorf("Expected the values of database in source order, got %#v", values)
+	}
+	if span := values[1].Span(); span.Start.Line != 5 {
+		t.Errorf("Expected the port on line 5, got %d", span.Start.Line)
+	}
+}
+
+func TestCompileQuery_Errors(t *testing.T) {
+	tests := []struct {
+		expr string
+		msg  string
+	}{
+		{"", "empty key"},
+		{"database..host", "empty key"},
+		{"servers[1", "missing ]"},
+		{"servers[x]", `invalid index "x"`},
+		{"servers[0]x", `unexpected "x"`},
+		{"servers[?port = 1]", "invalid operator"},
+		{"servers[?port == ]", "invalid value"},
+		{"servers[?port == nope]", "invalid value"},
+		{"servers[? == 1]", "empty key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := CompileQuery(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected an error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+
+	if q := MustCompileQuery(`servers[?region == "a]b"]`); q.String() != `servers[?region == "a]b"]` {
+		t.Errorf("Expected the expression back, got %q", q.String())
+	}
+}
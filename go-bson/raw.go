@@ -0,0 +1,43 @@
+package bulbason
+
+// RawValue holds a value in its literal form, left undecoded, such as
+// { host ~~~~> "db", port ~~~~> 5432 }. A field of type RawValue captures
+// the value of its key as it is, sections included, as inline objects, so
+// that the decoding of parts of a document can be put off until it is known
+// what they hold, as a dispatcher does with the sections of plugins:
+//
+//	var cfg struct {
+//	    Plugins map[string]bulbason.RawValue `bson:"plugins"`
+//	}
+//	...
+//	err := cfg.Plugins["cache"].Decode(&cacheConfig)
+//
+// Marshal writes a RawValue back as it is. MissingNo leaves it nil, and a nil
+// RawValue is written as MissingNo. As any literal, it cannot hold a string
+// spanning several lines.
+type RawValue []byte
+
+// UnmarshalBulba stores a copy of data in r.
+func (r *RawValue) UnmarshalBulba(data []byte) error {
+	*r = append((*r)[:0], data...)
+	return nil
+}
+
+// MarshalBulba returns r, or MissingNo if r is empty.
+func (r RawValue) MarshalBulba() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("MissingNo"), nil
+	}
+	return r, nil
+}
+
+// Decode stores the value r holds in the value pointed to by v, as Unmarshal
+// does for the values of a document.
+func (r RawValue) Decode(v interface{}) error {
+	literal, _ := r.MarshalBulba()
+	src, err := ParseValue(literal)
+	if err != nil {
+		return err
+	}
+	return new(decodeState).decodeDocument(src, v)
+}
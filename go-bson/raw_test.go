@@ -0,0 +1,83 @@
+package bulbason
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRawValue(t *testing.T) {
+	input := `BULBA!
+name ~> "app"
+(o) plugins (o)
+    (O) cache (O)
+        size ~> 128
+        (@) eviction (@)
+            policy ~> "lru"
+    (O) auth (O)
+        providers ~> <| "github", "google" |>
+    enabled ~> SuperEffective
+`
+	var cfg struct {
+		Name    string              `bson:"name"`
+		Plugins map[string]RawValue `bson:"plugins"`
+	}
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := string(cfg.Plugins["enabled"]); got != "SuperEffective" {
+		t.Errorf("Expected the literal SuperEffective, got %q", got)
+	}
+
+	var cache struct {
+		Size     int `bson:"size"`
+		Eviction struct {
+			Policy string `bson:"policy"`
+		} `bson:"eviction"`
+	}
+	if err := cfg.Plugins["cache"].Decode(&cache); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cache.Size != 128 || cache.Eviction.Policy != "lru" {
+		t.Errorf("Unexpected cache settings %+v", cache)
+	}
+	var auth map[string][]string
+	if err := cfg.Plugins["auth"].Decode(&auth); err != nil || !reflect.DeepEqual(auth["providers"], []string{"github", "google"}) {
+		t.Errorf("Unexpected auth settings %v, %v", auth, err)
+	}
+
+	var wrong struct {
+		Size string `bson:"size"`
+	}
+	var typeErr *UnmarshalTypeError
+	if err := cfg.Plugins["cache"].Decode(&wrong); !errors.As(err, &typeErr) || typeErr.Path != "size" {
+		t.Errorf("Expected a type error at size, got %v", err)
+	}
+
+	// The captured values are written back as they are.
+	out, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(out), `cache ~~~~> { eviction ~~~~> { policy ~~~~> "lru" }, size ~~~~> 128 }`) {
+		t.Errorf("Expected the cache section inline, got:\n%s", out)
+	}
+}
+
+func TestRawValue_MissingNo(t *testing.T) {
+	var cfg struct {
+		Extra RawValue `bson:"extra"`
+	}
+	if err := Unmarshal([]byte("BULBA!\nextra ~> MissingNo\n"), &cfg); err != nil || cfg.Extra != nil {
+		t.Errorf("Expected a nil RawValue, got %q, %v", cfg.Extra, err)
+	}
+	out, err := Marshal(cfg)
+	if err != nil || string(out) != "BULBA!\nextra ~~~~> MissingNo\n" {
+		t.Errorf("Unexpected result %q, %v", out, err)
+	}
+	var s *string
+	if err := cfg.Extra.Decode(&s); err != nil || s != nil {
+		t.Errorf("Expected MissingNo to decode to nil, got %v, %v", s, err)
+	}
+}
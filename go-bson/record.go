@@ -0,0 +1,128 @@
+package bulbason
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Records are the line-delimited form of BSON, NDBulba: each line of the
+// input holds one inline object and nothing else, without a header.
+//
+//	{ level ~> "info", msg ~> "caught", species ~> "bulbasaur" }
+//	{ level ~> "warn", msg ~> "fled", turns ~> 3 }
+//
+// Appending a record never touches the ones before it, which suits logs and
+// other append-only data. As any inline value, a record cannot hold a string
+// spanning several lines.
+
+// recordPrefix is put before a record to parse it as the value of a document.
+const recordPrefix = "v ~> "
+
+// MarshalRecord returns the record encoding of v, a struct or a map with
+// string keys, as a single line without its line ending. Values are encoded
+// as Marshal encodes them, with the shortest Vine Whip.
+func MarshalRecord(v interface{}) ([]byte, error) {
+	rv := indirect(reflect.ValueOf(v))
+	if !isSection(rv) {
+		return nil, fmt.Errorf("bulbason: cannot marshal %T as a record, expected a struct or a map with string keys", v)
+	}
+	e := newEncodeState()
+	e.vine = "~>"
+	literal, err := e.encodeValue(rv, false)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(literal), nil
+}
+
+// UnmarshalRecord parses a single record and stores it in the value pointed
+// to by v, following the same rules as Unmarshal.
+func UnmarshalRecord(data []byte, v interface{}) error {
+	src, err := parseRecord(strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), 1)
+	if err != nil {
+		return err
+	}
+	return new(decodeState).decodeDocument(src, v)
+}
+
+// parseRecord parses the record on line lineNum of its input. Parse errors
+// are located in the record.
+func parseRecord(line string, lineNum int) (map[string]interface{}, error) {
+	if strings.ContainsAny(line, "\r\n") {
+		return nil, fmt.Errorf("bulbason: line %d: a record is a single line", lineNum)
+	}
+	m, err := Parse("BULBA!\n" + recordPrefix + line + "\n")
+	if err != nil {
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			return nil, fmt.Errorf("bulbason: line %d: %w", lineNum, err)
+		}
+		pe.Line, pe.Column, pe.Snippet = lineNum, max(pe.Column-len(recordPrefix), 1), line
+		return nil, pe
+	}
+	record, ok := m["v"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bulbason: line %d: expected a record, an inline object such as { key ~> 1 }", lineNum)
+	}
+	return record, nil
+}
+
+// RecordWriter writes records to an output stream, one line each.
+type RecordWriter struct {
+	w io.Writer
+}
+
+// NewRecordWriter returns a new record writer that writes to w.
+func NewRecordWriter(w io.Writer) *RecordWriter {
+	return &RecordWriter{w: w}
+}
+
+// Write writes the record encoding of v, followed by a line ending, in a
+// single call to the underlying writer.
+func (rw *RecordWriter) Write(v interface{}) error {
+	b, err := MarshalRecord(v)
+	if err != nil {
+		return err
+	}
+	_, err = rw.w.Write(append(b, '\n'))
+	return err
+}
+
+// RecordReader reads records from an input stream, one line each. Blank
+// lines are skipped.
+type RecordReader struct {
+	r       *bufio.Reader
+	lineNum int
+}
+
+// NewRecordReader returns a new record reader that reads from r.
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{r: bufio.NewReader(r)}
+}
+
+// Read reads the next record and stores it in the value pointed to by v,
+// following the same rules as Unmarshal. It returns io.EOF when the input
+// holds no more records. A record that cannot be parsed does not end the
+// stream: the next call moves on to the line after it.
+func (rr *RecordReader) Read(v interface{}) error {
+	for {
+		line, err := rr.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return err
+		}
+		rr.lineNum++
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		src, err := parseRecord(line, rr.lineNum)
+		if err != nil {
+			return err
+		}
+		return new(decodeState).decodeDocument(src, v)
+	}
+}
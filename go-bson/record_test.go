@@ -0,0 +1,100 @@
+package bulbason
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type logRecord struct {
+	Level string        `bson:"level"`
+	Msg   string        `bson:"msg"`
+	Tags  []string      `bson:"tags,omitempty"`
+	Took  time.Duration `bson:"took"`
+}
+
+func TestRecordWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewRecordWriter(&buf)
+	records := []logRecord{
+		{Level: "info", Msg: "caught", Tags: []string{"wild"}, Took: 3 * time.Second},
+		{Level: "warn", Msg: `it said "bulba"`},
+	}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	expected := `{ level ~> "info", msg ~> "caught", tags ~> <| "wild" |>, took ~> 3s }` + "\n" +
+		"{ level ~> \"warn\", msg ~> `it said \"bulba\"`, took ~> 0s }\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	r := NewRecordReader(&buf)
+	for i := range records {
+		var got logRecord
+		if err := r.Read(&got); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, records[i]) {
+			t.Errorf("Expected %+v, got %+v", records[i], got)
+		}
+	}
+	if err := r.Read(new(logRecord)); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+
+	for _, bad := range []interface{}{5, logRecord{Msg: "two\nlines"}} {
+		if err := w.Write(bad); err == nil {
+			t.Errorf("Expected an error for %#v", bad)
+		}
+	}
+}
+
+func TestRecordReader(t *testing.T) {
+	input := "{ level ~> \"info\" }\r\n\n   \n{ level ~> }\n\"just a string\"\n{ level ~> \"warn\" }"
+	r := NewRecordReader(strings.NewReader(input))
+	var rec map[string]interface{}
+	if err := r.Read(&rec); err != nil || rec["level"] != "info" {
+		t.Errorf("Expected the first record, got %v and %v", rec, err)
+	}
+
+	// Bad records are located in the input, and reading carries on past them.
+	var pe *ParseError
+	if err := r.Read(&rec); !errors.As(err, &pe) || pe.Line != 4 || pe.Snippet != "{ level ~> }" {
+		t.Errorf("Expected a parse error on line 4, got %v", err)
+	}
+	if err := r.Read(&rec); err == nil || !strings.Contains(err.Error(), "line 5: expected a record") {
+		t.Errorf("Expected a record error on line 5, got %v", err)
+	}
+	rec = nil
+	if err := r.Read(&rec); err != nil || rec["level"] != "warn" {
+		t.Errorf("Expected the last record, got %v and %v", rec, err)
+	}
+	if err := r.Read(&rec); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestMarshalRecord(t *testing.T) {
+	out, err := MarshalRecord(map[string]interface{}{"b": 2, "a": map[string]interface{}{"x": nil}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "{ a ~> { x ~> MissingNo }, b ~> 2 }"; string(out) != expected {
+		t.Errorf("Expected %s, got %s", expected, out)
+	}
+
+	var rec logRecord
+	if err := UnmarshalRecord([]byte("{ level ~> \"info\", took ~> 1m }\n"), &rec); err != nil || rec.Level != "info" || rec.Took != time.Minute {
+		t.Errorf("Unexpected result %+v, %v", rec, err)
+	}
+	if err := UnmarshalRecord([]byte("{ a ~> 1 }\n{ b ~> 2 }"), &rec); err == nil {
+		t.Error("Expected an error for two records")
+	}
+}
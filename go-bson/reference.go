@@ -0,0 +1,143 @@
+package bulbason
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// reference stands for a Copycat reference in the data map until it is
+// resolved.
+type reference struct {
+	node *ast.Reference
+}
+
+// referenceResolver replaces the references of a data map with copies of
+// the values they refer to.
+type referenceResolver struct {
+	root map[string]interface{}
+	cfg  *parseConfig
+	// 'active' holds the references being resolved, outermost first, so that
+	// one referring back to itself is caught.
+	active []*reference
+	// 'errs' gathers every problem when the caller asked for all of them,
+	// and 'failed' the references they were reported for.
+	errs   ErrorList
+	failed map[*reference]bool
+}
+
+// resolveReferences resolves the references held anywhere in doc. A
+// reference to a missing value, or to a value holding the reference itself,
+// is reported as a ParseError carrying CodeReference.
+func resolveReferences(doc map[string]interface{}, cfg *parseConfig) error {
+	r := &referenceResolver{root: doc, cfg: cfg, failed: make(map[*reference]bool)}
+	if _, err := r.resolve(doc); err != nil {
+		return err
+	}
+	if len(r.errs) > 0 {
+		return mergeErrors(r.errs)
+	}
+	return nil
+}
+
+// resolve returns v with its references resolved. Sections and arrays are
+// updated in place.
+func (r *referenceResolver) resolve(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case *reference:
+		return r.deref(x)
+	case map[string]interface{}:
+		// Sorted, so that the first error reported does not depend on the
+		// order of the map.
+		for _, key := range slices.Sorted(maps.Keys(x)) {
+			resolved, err := r.resolve(x[key])
+			if err != nil {
+				return nil, err
+			}
+			x[key] = resolved
+		}
+	case []interface{}:
+		for i, elem := range x {
+			resolved, err := r.resolve(elem)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = resolved
+		}
+	case []map[string]interface{}:
+		for _, elem := range x {
+			if _, err := r.resolve(elem); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// deref returns a copy of the value ref refers to, with its own references
+// resolved. In collection mode an error is recorded and the value is nil.
+func (r *referenceResolver) deref(ref *reference) (interface{}, error) {
+	if slices.Contains(r.active, ref) {
+		return nil, r.fail(ref, "Copycat %s refers to itself", ref.node.Path)
+	}
+	r.active = append(r.active, ref)
+	defer func() { r.active = r.active[:len(r.active)-1] }()
+
+	// The parser has already checked the path.
+	steps, _ := parsePath(ref.node.Path)
+	v, err := lookupPath(r.root, steps, ref.node.Path, func(v interface{}) (interface{}, error) {
+		if inner, ok := v.(*reference); ok {
+			return r.deref(inner)
+		}
+		return v, nil
+	})
+	if _, ok := err.(*PathError); ok {
+		return nil, r.fail(ref, "Copycat %s refers to a value that does not exist", ref.node.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v, err = r.resolve(v); err != nil {
+		return nil, err
+	}
+	return copyValue(v), nil
+}
+
+// fail returns the error for a reference that cannot be resolved, explained
+// by format and args, or records it and returns nil in collection mode.
+func (r *referenceResolver) fail(ref *reference, format string, args ...interface{}) error {
+	start := ref.node.Loc.Start
+	err := newParseError(CodeReference, start.Line, start.Column).explain(format, args...)
+	if !r.cfg.collectErrors {
+		return err
+	}
+	if !r.failed[ref] {
+		r.failed[ref] = true
+		r.errs = append(r.errs, err)
+	}
+	return nil
+}
+
+// firstReference returns the first reference held by v, if any.
+func firstReference(v ast.Value) *ast.Reference {
+	switch n := v.(type) {
+	case *ast.Reference:
+		return n
+	case *ast.ArrayLit:
+		for _, elem := range n.Elements {
+			if ref := firstReference(elem); ref != nil {
+				return ref
+			}
+		}
+	case *ast.ObjectLit:
+		for _, entry := range n.Body {
+			if kv, ok := entry.(*ast.KeyValue); ok {
+				if ref := firstReference(kv.Value); ref != nil {
+					return ref
+				}
+			}
+		}
+	}
+	return nil
+}
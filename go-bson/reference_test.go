@@ -0,0 +1,141 @@
+package bulbason
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+func TestParse_References(t *testing.T) {
+	input := `BULBA!
+(o) defaults (o)
+    timeout ~> 30s
+    (O) credentials (O)
+        user ~> "pikachu"
+        password ~> "thunder"
+(o) database (o)
+    timeout ~> Copycat defaults.timeout
+    credentials ~> Copycat defaults.credentials
+(o) cache (o)
+    credentials ~> Copycat database.credentials
+    timeouts ~> <| Copycat defaults.timeout, 1m |>
+    primary ~> { host ~> Copycat servers[0].host }
+servers ~> <|
+(o)
+    host ~> "alpha"
+|>
+`
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	credentials := map[string]interface{}{"user": "pikachu", "password": "thunder"}
+	database := doc["database"].(map[string]interface{})
+	if database["timeout"] != 30*time.Second {
+		t.Errorf("Expected 30s, got %v", database["timeout"])
+	}
+	if !reflect.DeepEqual(database["credentials"], credentials) {
+		t.Errorf("Expected %v, got %v", credentials, database["credentials"])
+	}
+	cache := doc["cache"].(map[string]interface{})
+	if !reflect.DeepEqual(cache["credentials"], credentials) {
+		t.Errorf("Expected %v, got %v", credentials, cache["credentials"])
+	}
+	if expected := []interface{}{30 * time.Second, time.Minute}; !reflect.DeepEqual(cache["timeouts"], expected) {
+		t.Errorf("Expected %v, got %v", expected, cache["timeouts"])
+	}
+	if expected := map[string]interface{}{"host": "alpha"}; !reflect.DeepEqual(cache["primary"], expected) {
+		t.Errorf("Expected %v, got %v", expected, cache["primary"])
+	}
+
+	// Every reference holds a copy of its own.
+	database["credentials"].(map[string]interface{})["user"] = "raichu"
+	if cache["credentials"].(map[string]interface{})["user"] != "pikachu" {
+		t.Error("Expected the copies to be independent")
+	}
+}
+
+func TestParse_ReferenceThroughReference(t *testing.T) {
+	doc, err := Parse("BULBA!\nalias ~> Copycat base\nport ~> Copycat alias.port\n(o) base (o)\n    port ~> 80\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if doc["port"] != int64(80) {
+		t.Errorf("Expected 80, got %v", doc["port"])
+	}
+}
+
+func TestParse_ReferenceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		code   ErrorCode
+		line   int
+		column int
+	}{
+		{"missing", "BULBA!\na ~> 1\nb ~> Copycat c\n", CodeReference, 3, 6},
+		{"cycle", "BULBA!\na ~> Copycat b\nb ~> Copycat a\n", CodeReference, 2, 6},
+		{"itself", "BULBA!\n(o) s (o)\n    x ~> Copycat s\n", CodeReference, 3, 10},
+		{"not a section", "BULBA!\na ~> 1\nb ~> Copycat a.x\n", CodeReference, 3, 6},
+		{"bad path", "BULBA!\nb ~> Copycat a..x\n", CodeSyntax, 2, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Expected a ParseError, got %v", err)
+			}
+			if pe.Code != tt.code || pe.Line != tt.line || pe.Column != tt.column {
+				t.Errorf("Expected %s at %d:%d, got %s at %d:%d", tt.code, tt.line, tt.column, pe.Code, pe.Line, pe.Column)
+			}
+		})
+	}
+}
+
+func TestParse_ReferenceCollectErrors(t *testing.T) {
+	_, err := Parse("BULBA!\na ~> Copycat x\nb ~> Copycat y\nc ~> Copycat a\n", CollectErrors())
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("Expected an ErrorList, got %v", err)
+	}
+	if len(list) != 2 || list[0].Line != 2 || list[1].Line != 3 {
+		t.Errorf("Expected errors on lines 2 and 3, got %v", list)
+	}
+}
+
+func TestParseAST_Reference(t *testing.T) {
+	doc, err := ParseAST("BULBA!\nport ~> Copycat base.port\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ref, ok := doc.Body[0].(*ast.KeyValue).Value.(*ast.Reference)
+	if !ok {
+		t.Fatalf("Expected *ast.Reference, got %T", doc.Body[0].(*ast.KeyValue).Value)
+	}
+	expected := ast.Span{Start: ast.Position{Line: 2, Column: 9}, End: ast.Position{Line: 2, Column: 25}}
+	if ref.Path != "base.port" || ref.Span() != expected {
+		t.Errorf("Unexpected reference %+v", ref)
+	}
+
+	out, err := Format([]byte("BULBA!\nport ~> Copycat base.port\nlist ~> <|Copycat a,  Copycat b|>\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "BULBA!\nport ~~~~> Copycat base.port\nlist ~~~~> <| Copycat a, Copycat b |>\n"; string(out) != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, out)
+	}
+}
+
+func TestParse_ReferenceToInclude(t *testing.T) {
+	doc, err := Parse("BULBA!\nTransform \"shared/pool.bson\"\nmax ~> Copycat pool.max\n", Includes(includeFS, ""))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if doc["max"] != int64(10) {
+		t.Errorf("Expected 10, got %v", doc["max"])
+	}
+}
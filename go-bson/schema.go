@@ -0,0 +1,345 @@
+package bulbason
+
+import (
+	"encoding"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// SchemaOf returns a schema document describing the struct type of v, which
+// may be a struct, a pointer to one, or a nil pointer such as (*Config)(nil).
+// Written with Encoder.EncodeAST, it can be published for the people editing
+// the configuration, or given to bulbagen to generate the structs back.
+//
+// The schema has the shape of the documents the struct decodes: each value
+// names the type of its key, one of "string", "int", "float", "bool",
+// "timestamp", "duration", "bytes" or "any", prefixed by "[]" for an array of
+// them, nested structs become sections, and a slice of structs becomes a
+// multi-line array holding a single section describing its elements. Keys
+// come from the bson tags, as with Marshal, and a type ends in "!" when its
+// field is tagged with the required option, as in `bson:"port,required"`.
+// Types implementing encoding.TextUnmarshaler are described as "string". Maps,
+// whose keys cannot be known in advance, and types implementing Unmarshaler,
+// which read values of their own, are described as "any".
+// Channels, functions and recursive types have no schema and give an error.
+func SchemaOf(v interface{}) (*ast.Document, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || t == timeType || t == bigIntType {
+		return nil, fmt.Errorf("bulbason: cannot describe %T, expected a struct", v)
+	}
+	body, err := schemaBody(t, "", map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Document{Body: body}, nil
+}
+
+// schemaBody returns the schema entries for the fields of struct type t at
+// path. visiting holds the structs being described, to catch recursion.
+func schemaBody(t reflect.Type, path string, visiting map[reflect.Type]bool) ([]ast.Entry, error) {
+	if visiting[t] {
+		return nil, fmt.Errorf("bulbason: cannot describe %s, type %s is recursive", path, t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	var body []ast.Entry
+	for _, f := range typeFields(t) {
+		if f.remain {
+			// The keys it holds cannot be known in advance.
+			continue
+		}
+		sf := t.FieldByIndex(f.index)
+		fieldPath := joinPath(path, f.name)
+		key := &ast.Ident{Name: f.name}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if isStructType(ft) {
+			sub, err := schemaBody(ft, fieldPath, visiting)
+			if err != nil {
+				return nil, err
+			}
+			body = append(body, &ast.Section{Name: key, Body: sub})
+			continue
+		}
+
+		value, err := schemaValue(ft, fieldPath, visiting)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := value.(*ast.StringLit); ok && hasTagOption(sf.Tag.Get("bson"), "required") {
+			s.Value += "!"
+		}
+		body = append(body, &ast.KeyValue{Key: key, Value: value})
+	}
+	return body, nil
+}
+
+// schemaValue returns the schema value describing type t at path: a type
+// name, or a multi-line array for a slice of structs.
+func schemaValue(t reflect.Type, path string, visiting map[reflect.Type]bool) (ast.Value, error) {
+	name, elem := "", t
+	for {
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Slice && elem.Kind() != reflect.Array || elem.Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		name += "[]"
+		elem = elem.Elem()
+	}
+
+	if isStructType(elem) {
+		if name != "[]" {
+			return nil, fmt.Errorf("bulbason: cannot describe %s, only a single level of arrays can hold structs", path)
+		}
+		body, err := schemaBody(elem, path+"[]", visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ArrayLit{Block: true, Elements: []ast.Value{&ast.ObjectLit{Body: body}}}, nil
+	}
+
+	typeName, err := schemaTypeName(elem)
+	if err != nil {
+		return nil, fmt.Errorf("bulbason: cannot describe %s, %v", path, err)
+	}
+	return &ast.StringLit{Value: name + typeName}, nil
+}
+
+// schemaTypeName returns the schema name of a type that is neither a struct
+// nor an array.
+func schemaTypeName(t reflect.Type) (string, error) {
+	if isUnmarshalerType(t) {
+		return "any", nil
+	}
+	switch t {
+	case timeType:
+		return "timestamp", nil
+	case durationType:
+		return "duration", nil
+	case bigIntType:
+		return "int", nil
+	case numberType:
+		return "float", nil
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return "string", nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string", nil
+	case reflect.Bool:
+		return "bool", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int", nil
+	case reflect.Float32, reflect.Float64:
+		return "float", nil
+	case reflect.Slice, reflect.Array:
+		// Only byte slices get here.
+		return "bytes", nil
+	case reflect.Interface, reflect.Map:
+		return "any", nil
+	}
+	return "", fmt.Errorf("type %s has no schema", t)
+}
+
+// isStructType reports whether t is described as a section.
+func isStructType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && t != bigIntType &&
+		!isUnmarshalerType(t) && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+var (
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isUnmarshalerType reports whether t decodes its own values.
+func isUnmarshalerType(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(unmarshalerType)
+}
+
+// SchemaError is returned by ValidateSchema for a value that does not match
+// its schema.
+type SchemaError struct {
+	Path    string // Path of the value, e.g. "database.port"
+	Message string // What is wrong, e.g. "expected int, found string"
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("bulbason: %s: %s", e.Path, e.Message)
+}
+
+// ValidateSchema checks a document as returned by Parse against a schema, in
+// the format SchemaOf writes and bulbagen reads. Each key of the schema that
+// the document holds must have a value of its type, and keys marked as
+// required must be present and not MissingNo. Keys the schema does not
+// mention are allowed, as Unmarshal ignores them.
+//
+// The first mismatch, in schema order, is returned as a *SchemaError. A
+// malformed schema, such as one naming an unknown type, gives a plain error.
+func ValidateSchema(doc map[string]interface{}, schema *ast.Document) error {
+	return validateSection(doc, schema.Body, "")
+}
+
+// validateSection checks the section at path against the entries of a
+// schema section.
+func validateSection(section map[string]interface{}, body []ast.Entry, path string) error {
+	for _, entry := range body {
+		switch e := entry.(type) {
+		case *ast.Section:
+			if err := validateValue(section, e.Name.Name, &ast.ObjectLit{Body: e.Body}, path); err != nil {
+				return err
+			}
+		case *ast.KeyValue:
+			if err := validateValue(section, e.Key.Name, e.Value, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateValue checks the value of key in section, at path, against its
+// schema.
+func validateValue(section map[string]interface{}, key string, schema ast.Value, path string) error {
+	path = joinPath(path, key)
+	v, present := section[key]
+
+	switch s := schema.(type) {
+	case *ast.StringLit:
+		name, required := strings.CutSuffix(s.Value, "!")
+		if !isSchemaType(name) {
+			return fmt.Errorf("bulbason: invalid schema at %s: unknown type %q", path, name)
+		}
+		if !present || v == nil {
+			if required {
+				return &SchemaError{Path: path, Message: "required key is missing"}
+			}
+			return nil
+		}
+		return checkSchemaType(v, name, path)
+	case *ast.ObjectLit:
+		if !present || v == nil {
+			return nil
+		}
+		sub, ok := v.(map[string]interface{})
+		if !ok {
+			return &SchemaError{Path: path, Message: "expected a section, found " + schemaValueName(v)}
+		}
+		return validateSection(sub, s.Body, path)
+	case *ast.ArrayLit:
+		var obj *ast.ObjectLit
+		if len(s.Elements) == 1 {
+			obj, _ = s.Elements[0].(*ast.ObjectLit)
+		}
+		if obj == nil {
+			return fmt.Errorf("bulbason: invalid schema at %s: an array of sections must hold a single section describing its elements", path)
+		}
+		if !present || v == nil {
+			return nil
+		}
+		arr, ok := asArray(v)
+		if !ok {
+			return &SchemaError{Path: path, Message: "expected an array of sections, found " + schemaValueName(v)}
+		}
+		for i, elem := range arr {
+			sub, ok := elem.(map[string]interface{})
+			if !ok {
+				return &SchemaError{Path: indexPath(path, i), Message: "expected a section, found " + schemaValueName(elem)}
+			}
+			if err := validateSection(sub, obj.Body, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("bulbason: invalid schema at %s: expected a type name such as \"string\"", path)
+}
+
+// isSchemaType reports whether name is a schema type, such as "[]int".
+func isSchemaType(name string) bool {
+	name = strings.TrimLeft(name, "[]")
+	switch name {
+	case "string", "int", "float", "bool", "timestamp", "duration", "bytes", "any":
+		return true
+	}
+	return false
+}
+
+// checkSchemaType checks that v, at path, is of the schema type name.
+func checkSchemaType(v interface{}, name, path string) error {
+	if elem, ok := strings.CutPrefix(name, "[]"); ok {
+		arr, ok := asArray(v)
+		if !ok {
+			return &SchemaError{Path: path, Message: fmt.Sprintf("expected %s, found %s", name, schemaValueName(v))}
+		}
+		for i, e := range arr {
+			if e == nil {
+				continue
+			}
+			if err := checkSchemaType(e, elem, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var ok bool
+	switch name {
+	case "string":
+		_, ok = v.(string)
+	case "int":
+		switch n := v.(type) {
+		case int64, uint64, *big.Int:
+			ok = true
+		case Number:
+			_, ok = new(big.Int).SetString(string(n), 0)
+		}
+	case "float":
+		switch v.(type) {
+		case int64, uint64, *big.Int, float64, Number:
+			ok = true
+		}
+	case "bool":
+		_, ok = v.(bool)
+	case "timestamp":
+		_, ok = v.(time.Time)
+	case "duration":
+		_, ok = v.(time.Duration)
+	case "bytes":
+		_, ok = v.([]byte)
+	case "any":
+		ok = true
+	}
+	if !ok {
+		return &SchemaError{Path: path, Message: fmt.Sprintf("expected %s, found %s", name, schemaValueName(v))}
+	}
+	return nil
+}
+
+// schemaValueName describes a parsed value in schema terms, telling floats
+// from integers.
+func schemaValueName(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "float"
+	case int64, uint64, *big.Int:
+		return "int"
+	}
+	return describeValue(v)
+}
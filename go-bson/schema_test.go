@@ -0,0 +1,185 @@
+package bulbason
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaServer struct {
+	Host string `bson:"host,required"`
+	Port uint16 `bson:"port"`
+}
+
+type schemaConfig struct {
+	Name     string         `bson:"name,required"`
+	Tags     []string       `bson:"tags"`
+	Grid     [][]float32    `bson:"grid"`
+	Started  time.Time      `bson:"started"`
+	Timeout  *time.Duration `bson:"timeout"`
+	Key      []byte         `bson:"key"`
+	Big      *big.Int       `bson:"big"`
+	Ratio    Number         `bson:"ratio"`
+	Extra    map[string]int `bson:"extra"`
+	Anything interface{}    `bson:"anything"`
+	Version  version        `bson:"version"`
+	Addr     netip.Addr     `bson:"addr"`
+	Ignored  string         `bson:"-"`
+	internal string
+	Database struct {
+		Host string `bson:"host"`
+		Pool *struct {
+			Size int `bson:"size,required"`
+		} `bson:"pool"`
+	} `bson:"database"`
+	Servers []*schemaServer `bson:"servers"`
+	Enabled bool
+}
+
+func TestSchemaOf(t *testing.T) {
+	for _, v := range []interface{}{schemaConfig{}, &schemaConfig{}, (*schemaConfig)(nil)} {
+		doc, err := SchemaOf(v)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).EncodeAST(doc); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := `BULBA!
+name ~~~~> "string!"
+tags ~~~~> "[]string"
+grid ~~~~> "[][]float"
+started ~~~~> "timestamp"
+timeout ~~~~> "duration"
+key ~~~~> "bytes"
+big ~~~~> "int"
+ratio ~~~~> "float"
+extra ~~~~> "any"
+anything ~~~~> "any"
+version ~~~~> "any"
+addr ~~~~> "string"
+(o) database (o)
+    host ~~~~> "string"
+    (O) pool (O)
+        size ~~~~> "int!"
+servers ~~~~> <|
+(o)
+    host ~~~~> "string!"
+    port ~~~~> "int"
+|>
+Enabled ~~~~> "bool"
+`
+		if buf.String() != expected {
+			t.Fatalf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+		}
+	}
+}
+
+type schemaNode struct {
+	Children []schemaNode `bson:"children"`
+}
+
+func TestSchemaOf_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		msg  string
+	}{
+		{"Not A Struct", map[string]int{}, "cannot describe map[string]int, expected a struct"},
+		{"Nil", nil, "cannot describe <nil>, expected a struct"},
+		{"Recursive", schemaNode{}, "cannot describe children[], type bulbason.schemaNode is recursive"},
+		{"Channel", struct {
+			C chan int `bson:"c"`
+		}{}, "cannot describe c, type chan int has no schema"},
+		{"Nested Struct Arrays", struct {
+			S [][]schemaServer `bson:"s"`
+		}{}, "cannot describe s, only a single level of arrays can hold structs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SchemaOf(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema, err := SchemaOf(schemaConfig{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	valid := `BULBA!
+name ~> "app"
+tags ~> <| "a", "b" |>
+grid ~> <| <| 1, 2.5 |>, <| 3 |> |>
+started ~> 2024-01-01T00:00:00Z
+timeout ~> 30s
+unknown ~> "allowed"
+(o) database (o)
+    host ~> "localhost"
+    (O) pool (O)
+        size ~> 10
+servers ~> <|
+(o)
+    host ~> "10.0.0.1"
+    port ~> 8080
+|>
+`
+
+	tests := []struct {
+		name    string
+		replace [2]string
+		path    string
+		msg     string
+	}{
+		{"Valid", [2]string{}, "", ""},
+		{"Wrong Type", [2]string{`timeout ~> 30s`, `timeout ~> "30s"`}, "timeout", "expected duration, found string"},
+		{"Float For Int", [2]string{`size ~> 10`, `size ~> 10.5`}, "database.pool.size", "expected int, found float"},
+		{"Array Element", [2]string{`<| "a", "b" |>`, `<| "a", 2 |>`}, "tags[1]", "expected string, found int"},
+		{"Nested Array", [2]string{`<| 3 |>`, `<| "x" |>`}, "grid[1][0]", "expected float, found string"},
+		{"Required Missing", [2]string{`name ~> "app"`, ``}, "name", "required key is missing"},
+		{"Required MissingNo", [2]string{`name ~> "app"`, `name ~> MissingNo`}, "name", "required key is missing"},
+		{"Required In Array", [2]string{`    host ~> "10.0.0.1"`, ``}, "servers[0].host", "required key is missing"},
+		{"Not A Section", [2]string{`(o) database (o)
+    host ~> "localhost"
+    (O) pool (O)
+        size ~> 10`, `database ~> 1`}, "database", "expected a section, found int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(strings.Replace(valid, tt.replace[0], tt.replace[1], 1))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			err = ValidateSchema(doc, schema)
+			if tt.msg == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			var schemaErr *SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("Expected a SchemaError, got %v", err)
+			}
+			if schemaErr.Path != tt.path || schemaErr.Message != tt.msg {
+				t.Errorf("Expected %q at %q, got %q at %q", tt.msg, tt.path, schemaErr.Message, schemaErr.Path)
+			}
+		})
+	}
+
+	bad, err := ParseAST("BULBA!\nport ~> \"integer\"\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := ValidateSchema(map[string]interface{}{}, bad); err == nil || !strings.Contains(err.Error(), `invalid schema at port: unknown type "integer"`) {
+		t.Errorf("Expected an invalid schema error, got %v", err)
+	}
+}
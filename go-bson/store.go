@@ -0,0 +1,84 @@
+package bulbason
+
+import "sync"
+
+// Store holds a Document that concurrent goroutines, such as the handlers of
+// an HTTP server, read and change safely. Reads share a lock and changes take
+// it alone, so a handler never sees a document halfway through a change.
+//
+// Values go in and out of a Store as copies, so that a section or array read
+// from it is never changed under the reader, and one set in it is not changed
+// by the caller afterwards. Follow keeps a Store up to date with a Watcher:
+//
+//	w, err := bulbason.NewWatcher("config.bson", bulbason.WatchOptions{})
+//	if err != nil {
+//		return err
+//	}
+//	defer w.Close()
+//	store := bulbason.NewStore(nil)
+//	store.Follow(w)
+//	...
+//	port := store.Snapshot().GetIntOr("server.port", 8080)
+type Store struct {
+	mu  sync.RWMutex
+	doc Document
+}
+
+// NewStore returns a Store holding a copy of doc, which may be nil for an
+// empty document.
+func NewStore(doc Document) *Store {
+	s := &Store{}
+	s.Replace(doc)
+	return s
+}
+
+// Get returns a copy of the value at path, as Document.Get does.
+func (s *Store) Get(path string) (interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, err := s.doc.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	return copyValue(v), nil
+}
+
+// Set sets the value at path to a copy of value, as Document.Set does.
+func (s *Store) Set(path string, value interface{}) error {
+	value = copyValue(value)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.doc.Set(path, value)
+}
+
+// Snapshot returns a copy of the whole document, for reading several values
+// that must belong to the same version of it.
+func (s *Store) Snapshot() Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.doc.Clone()
+}
+
+// Replace replaces the whole document with a copy of doc.
+func (s *Store) Replace(doc Document) {
+	doc = doc.Clone()
+	if doc == nil {
+		doc = Document{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.doc = doc
+}
+
+// Follow replaces the document with the current one of w, and then with each
+// new version w sends on its Updates channel, until w is closed. Values set
+// in the meantime are lost when the next version arrives. Follow receives from
+// Updates itself, so the caller must not.
+func (s *Store) Follow(w *Watcher) {
+	s.Replace(w.Current())
+	go func() {
+		for doc := range w.Updates() {
+			s.Replace(doc)
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+package bulbason
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(parseDocument(t))
+
+	servers, err := s.Get("servers")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	servers.([]map[string]interface{})[0]["host"] = "changed"
+	if host, _ := s.Get("servers[0].host"); host != "10.0.0.1" {
+		t.Errorf("Expected the value read to be a copy, got %v", host)
+	}
+
+	pool := map[string]interface{}{"size": int64(1)}
+	if err := s.Set("database.pool", pool); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pool["size"] = int64(2)
+	snap := s.Snapshot()
+	if n := snap.GetIntOr("database.pool.size", 0); n != 1 {
+		t.Errorf("Expected the value set to be a copy, got %d", n)
+	}
+	snap["name"] = "changed"
+	if name, _ := s.Get("name"); name != "Bulby" {
+		t.Errorf("Expected the snapshot to be a copy, got %v", name)
+	}
+	if _, err := s.Get("missing"); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+	if NewStore(nil).Set("a.b", 1) != nil {
+		t.Error("Expected an empty store to accept values")
+	}
+}
+
+func TestStore_Concurrent(t *testing.T) {
+	s := NewStore(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := "worker" + strconv.Itoa(i)
+				if err := s.Set(key+".count", j); err != nil {
+					t.Error(err)
+					return
+				}
+				s.Get(key)
+				s.Snapshot()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := s.Snapshot().GetIntOr("worker7.count", 0); n != 99 {
+		t.Errorf("Expected 99, got %d", n)
+	}
+}
+
+func TestStore_Follow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.bson")
+	start := time.Now().Add(-time.Hour)
+	writeConfig(t, path, "BULBA!\nport ~> 8080\n", start)
+	w, err := NewWatcher(path, WatchOptions{Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	s := NewStore(nil)
+	s.Follow(w)
+	if port, _ := s.Get("port"); port != int64(8080) {
+		t.Fatalf("Expected 8080, got %v", port)
+	}
+
+	writeConfig(t, path, "BULBA!\nport ~> 9090\n", start.Add(time.Second))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if port, _ := s.Get("port"); port == int64(9090) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the update")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
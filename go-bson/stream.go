@@ -0,0 +1,269 @@
+package bulbason
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// Decoder reads and decodes BSON documents from an input stream.
+//
+// The stream may hold several documents, each starting with its own BULBA!
+// header line. Decode returns them one at a time, and io.EOF once there are
+// no more.
+type Decoder struct {
+	r     io.Reader
+	cfg   *parseConfig
+	lexer *Lexer // Reads the stream, once the first document is decoded
+
+	disallowUnknownFields bool
+	caseInsensitiveKeys   bool
+	hooks                 []DecodeHook
+}
+
+// NewDecoder returns a new decoder that reads from r.
+// The options control how the document is parsed, as they do for Parse.
+func NewDecoder(r io.Reader, opts ...ParseOption) *Decoder {
+	return &Decoder{r: r, cfg: newParseConfig(opts)}
+}
+
+// Decode reads the next document from its input and stores it in the value
+// pointed to by v, following the same rules as Unmarshal. It returns io.EOF
+// when the input holds no more documents, and straight away for an empty
+// input.
+//
+// A document that cannot be decoded does not end the stream: the next call
+// moves on to the document after it. Line numbers in errors count from the
+// start of the stream.
+//
+// The input is lexed line by line as it is read, so the raw document is
+// never loaded into memory as a single string.
+func (d *Decoder) Decode(v interface{}) error {
+	l, err := d.next()
+	if err != nil {
+		return err
+	}
+	l.ctx = nil
+	return d.decode(l, v)
+}
+
+// DecodeContext is like Decode, but gives up with ctx.Err() once ctx is done.
+// The context is checked every few lines as the input is read. A Read call
+// that blocks is not interrupted; to bound it, close the underlying reader.
+// Once given up, the decoder returns the same error on every later call.
+func (d *Decoder) DecodeContext(ctx context.Context, v interface{}) error {
+	l, err := d.next()
+	if err != nil {
+		return err
+	}
+	l.ctx = ctx
+	return d.decode(l, v)
+}
+
+// next returns the lexer positioned at the start of the next document, or
+// io.EOF if there is none.
+func (d *Decoder) next() (*Lexer, error) {
+	if d.lexer == nil {
+		d.lexer = newLexer(d.r, d.cfg)
+		d.lexer.stream = true
+		if _, err := d.lexer.reader.Peek(1); err == io.EOF {
+			d.lexer.done = true
+			return nil, io.EOF
+		}
+		return d.lexer, nil
+	}
+	ok, err := d.lexer.nextDocument()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, io.EOF
+	}
+	return d.lexer, nil
+}
+
+// DisallowUnknownFields makes the decoder fail with an UnknownFieldError,
+// locating the key, when the document holds a key that no field of the
+// destination struct matches. A misspelt key is then caught when the
+// configuration is loaded instead of being silently ignored, and the error
+// suggests the field it likely stands for. Keys decoded into maps or
+// interfaces are not affected.
+func (d *Decoder) DisallowUnknownFields() {
+	d.disallowUnknownFields = true
+}
+
+// CaseInsensitiveKeys makes the decoder match document keys to struct fields
+// regardless of case, as encoding/json does, so that a Host key fills a
+// field named host. A key matching the name exactly is preferred; a field
+// that several keys match up to case, such as HOST and Host, is an error. Types
+// implementing Unmarshaler or ValueUnmarshaler match keys themselves.
+func (d *Decoder) CaseInsensitiveKeys() {
+	d.caseInsensitiveKeys = true
+}
+
+// UseHooks adds hooks that convert values before they are decoded, such as
+// StringToDurationHook. They run in the order they were added, each one
+// receiving the value returned by the one before.
+func (d *Decoder) UseHooks(hooks ...DecodeHook) {
+	d.hooks = append(d.hooks, hooks...)
+}
+
+// decode parses the document read by l and stores it in v.
+func (d *Decoder) decode(l *Lexer, v interface{}) error {
+	state := &decodeState{disallowUnknownFields: d.disallowUnknownFields, caseInsensitiveKeys: d.caseInsensitiveKeys, hooks: d.hooks}
+	return state.decodeFrom(l, v)
+}
+
+// Encoder writes BSON documents to an output stream.
+type Encoder struct {
+	w           io.Writer
+	indentWidth int
+	vineLength  int
+	vinePolicy  VinePolicy
+	quoteStyle  QuoteStyle
+	arrayWrap   int
+	keyOrder    func(a, b string) int
+}
+
+// NewEncoder returns a new encoder that writes to w.
+// It uses the same layout as Marshal until configured otherwise.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, indentWidth: defaultIndentWidth, vineLength: defaultVineLength}
+}
+
+// SetIndent sets the number of spaces used for each evolution level, which
+// must be at least 1. The spec asks for 4; documents written with another
+// width parse back with the IndentWidth option set to the same width.
+func (enc *Encoder) SetIndent(width int) {
+	enc.indentWidth = width
+}
+
+// SetVineLength sets the number of tildes in each Vine Whip, e.g. 2 for "~~>".
+func (enc *Encoder) SetVineLength(n int) {
+	enc.vineLength = n
+}
+
+// VinePolicy decides the length of the Vine Whips an Encoder writes.
+type VinePolicy int
+
+const (
+	// VineFixed gives every Vine Whip the length set by SetVineLength. This
+	// is the default.
+	VineFixed VinePolicy = iota
+	// VineAligned lengthens the Vine Whips of shorter keys so that the
+	// values of a section start in the same column. The Vine Whip of the
+	// widest key has the length set by SetVineLength.
+	VineAligned
+	// VineSource keeps the Vine Whip of each key as written, as recorded in
+	// the Tildes of its syntax tree node, so that columns aligned by hand
+	// stay aligned. Keys not parsed from a document, and the values given
+	// to Encode, get the length set by SetVineLength.
+	VineSource
+)
+
+// SetVinePolicy sets how the length of Vine Whips is chosen.
+func (enc *Encoder) SetVinePolicy(policy VinePolicy) {
+	enc.vinePolicy = policy
+}
+
+// QuoteStyle decides the quotes an Encoder writes strings between.
+type QuoteStyle int
+
+const (
+	// QuoteDouble writes strings between double quotes, and those holding
+	// a double quote but no backtick as raw strings. This is the default.
+	QuoteDouble QuoteStyle = iota
+	// QuoteRaw writes strings as raw strings, between backticks, and those
+	// holding a backtick between double quotes.
+	QuoteRaw
+)
+
+// SetQuoteStyle sets the quotes strings are written between. It applies to
+// Encode; EncodeAST keeps the quotes of the document.
+func (enc *Encoder) SetQuoteStyle(style QuoteStyle) {
+	enc.quoteStyle = style
+}
+
+// SetArrayWrap sets the widest line, in columns, on which an array of
+// sections is written inline, as in servers ~~~~> <| { port ~~~~> 80 } |>.
+// Longer arrays are wrapped into a multi-line array, one element per marker.
+// Zero, the default, wraps every array of sections. Arrays of other values
+// always fit on one line, as the format requires. It applies to Encode;
+// EncodeAST keeps the layout of the document.
+func (enc *Encoder) SetArrayWrap(width int) {
+	enc.arrayWrap = width
+}
+
+// SetKeyOrder sets the order in which the keys of sections and objects are
+// written, so that generated files diff cleanly. cmp compares two keys as
+// strings.Compare does, which gives lexicographic order, and ties keep
+// their source order. A nil cmp, the default, keeps the source order: the
+// order of the fields of structs, of the entries of a syntax tree and of the
+// members of an ObjectWriter. Map keys, which have no order of their own,
+// are then sorted lexicographically.
+//
+// Whatever the order, the key-value pairs of a section given to Encode are
+// written before its sections.
+func (enc *Encoder) SetKeyOrder(cmp func(a, b string) int) {
+	enc.keyOrder = cmp
+}
+
+// Encode writes the BSON encoding of v to the stream, following the same
+// rules as Marshal.
+func (enc *Encoder) Encode(v interface{}) error {
+	rv := indirect(reflect.ValueOf(v))
+	if !isSection(rv) {
+		return fmt.Errorf("bulbason: cannot marshal %T, expected a struct or a map with string keys", v)
+	}
+
+	e, err := enc.newState()
+	if err != nil {
+		return err
+	}
+	if err := e.marshal(rv); err != nil {
+		return err
+	}
+	_, err = enc.w.Write(e.buf.Bytes())
+	return err
+}
+
+// EncodeAST writes a syntax tree to the stream. Entries keep their order and
+// any comments recorded by the ParseComments option are written back, which
+// makes it possible to rewrite a document without losing its documentation.
+func (enc *Encoder) EncodeAST(doc *ast.Document) error {
+	e, err := enc.newState()
+	if err != nil {
+		return err
+	}
+	if err := e.writeDocument(doc); err != nil {
+		return err
+	}
+	_, err = enc.w.Write(e.buf.Bytes())
+	return err
+}
+
+// newState prepares an encodeState with the encoder's layout settings.
+func (enc *Encoder) newState() (*encodeState, error) {
+	if enc.indentWidth < 1 {
+		return nil, fmt.Errorf("bulbason: invalid indent width %d, an evolution level needs at least one space", enc.indentWidth)
+	}
+	if enc.vineLength < 1 {
+		return nil, fmt.Errorf("bulbason: invalid vine length %d, a Vine Whip needs at least one tilde", enc.vineLength)
+	}
+	if enc.arrayWrap < 0 {
+		return nil, fmt.Errorf("bulbason: invalid array wrap width %d", enc.arrayWrap)
+	}
+
+	e := newEncodeState()
+	e.indent = strings.Repeat(" ", enc.indentWidth)
+	e.vine = strings.Repeat("~", enc.vineLength) + ">"
+	e.keyOrder = enc.keyOrder
+	e.vinePolicy = enc.vinePolicy
+	e.quoteStyle = enc.quoteStyle
+	e.arrayWrap = enc.arrayWrap
+	return e, nil
+}
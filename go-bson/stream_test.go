@@ -0,0 +1,693 @@
+package bulbason
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoder_Decode(t *testing.T) {
+	input := `BULBA!
+app_name ~> "Pokedex_API"
+(o) database (o)
+    host ~~~~> "127.0.0.1"
+`
+	var cfg testConfig
+	if err := NewDecoder(strings.NewReader(input)).Decode(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.AppName != "Pokedex_API" || cfg.Database.Host != "127.0.0.1" {
+		t.Errorf("Unexpected result: %+v", cfg)
+	}
+}
+
+func TestDecoder_DecodeMap(t *testing.T) {
+	var doc map[string]interface{}
+	if err := NewDecoder(strings.NewReader("BULBA!\nlevel ~> 5\n")).Decode(&doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"level": int64(5)}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected %v, got %v", expected, doc)
+	}
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	var doc map[string]interface{}
+	err := NewDecoder(strings.NewReader("NOT_BULBA!\n")).Decode(&doc)
+	if err == nil || !contains(err.Error(), ErrHeader) {
+		t.Errorf("Expected error containing %q, got %v", ErrHeader, err)
+	}
+}
+
+func TestDecoder_Stream(t *testing.T) {
+	input := `BULBA!
+name ~> "bulbasaur"
+BULBA!
+name ~> 5
+BULBA!
+name ~> """
+    BULBA!
+    """
+zZz[
+BULBA!
+]zZz
+`
+	d := NewDecoder(strings.NewReader(input))
+	var docs []map[string]interface{}
+	var errs []error
+	for {
+		var doc map[string]interface{}
+		err := d.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		docs, errs = append(docs, doc), append(errs, err)
+	}
+	expected := []map[string]interface{}{
+		{"name": "bulbasaur"},
+		{"name": int64(5)},
+		{"name": "BULBA!"},
+	}
+	if !reflect.DeepEqual(docs, expected) || errs[0] != nil || errs[1] != nil || errs[2] != nil {
+		t.Errorf("Expected %v, got %v and %v", expected, docs, errs)
+	}
+	if err := d.Decode(new(map[string]interface{})); err != io.EOF {
+		t.Errorf("Expected io.EOF again, got %v", err)
+	}
+
+	// A bad document is reported, and the one after it decoded all the same.
+	d = NewDecoder(strings.NewReader("BULBA!\nlevel 5\nBULBA!\nlevel ~> 6\n"))
+	var doc map[string]interface{}
+	var pe *ParseError
+	if err := d.Decode(&doc); !errors.As(err, &pe) || pe.Line != 2 {
+		t.Errorf("Expected an error at line 2, got %v", err)
+	}
+	if err := d.Decode(&doc); err != nil || doc["level"] != int64(6) {
+		t.Errorf("Expected the second document, got %v and %v", doc, err)
+	}
+	if err := d.Decode(&doc); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+
+	if err := NewDecoder(strings.NewReader("")).Decode(&doc); err != io.EOF {
+		t.Errorf("Expected io.EOF for an empty input, got %v", err)
+	}
+}
+
+func TestDecoder_StreamVersions(t *testing.T) {
+	input := "BULBA!v2\nok ~> Shiny\nBULBA!v3\nok ~> 1\nBULBA!\nok ~> SuperEffective\nBULBA!\nok ~> Shiny\n"
+	d := NewDecoder(strings.NewReader(input), Versions(VersionRegistry{2: {UseDialect(Dialect{True: []string{"Shiny"}})}}))
+	var doc map[string]interface{}
+	if err := d.Decode(&doc); err != nil || doc["ok"] != true {
+		t.Errorf("Expected the first document, got %v (%v)", doc, err)
+	}
+	var pe *ParseError
+	if err := d.Decode(&doc); !errors.As(err, &pe) || pe.Code != CodeVersion || pe.Line != 3 || pe.Snippet != "BULBA!v3" {
+		t.Errorf("Expected a version error on line 3, got %v", err)
+	}
+	if err := d.Decode(&doc); err != nil || doc["ok"] != true {
+		t.Errorf("Expected the third document, got %v (%v)", doc, err)
+	}
+	// Each document is read with the options of its own version.
+	if err := d.Decode(&doc); !errors.As(err, &pe) || pe.Code != CodeType || pe.Line != 8 {
+		t.Errorf("Expected a type error on line 8, got %v", err)
+	}
+	if err := d.Decode(&doc); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestDecoder_StreamLimits(t *testing.T) {
+	// The limits apply to each document, not the whole stream.
+	doc := "BULBA!\nlevel ~> 5\n"
+	d := NewDecoder(strings.NewReader(strings.Repeat(doc, 10)), MaxInputSize(len(doc)), MaxTokens(8))
+	for i := 0; i < 10; i++ {
+		if err := d.Decode(new(map[string]interface{})); err != nil {
+			t.Fatalf("Unexpected error in document %d: %v", i, err)
+		}
+	}
+	if err := d.Decode(new(map[string]interface{})); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestDecoder_LongLines(t *testing.T) {
+	// A single-line array much longer than a bufio.Scanner allows by default.
+	elems := strings.Repeat(`"bulbasaur", `, 20000)
+	input := "BULBA!\ndex ~~> <| " + elems + "\"ivysaur\" |>\nlevel ~> 5\n"
+	var doc map[string]interface{}
+	if err := NewDecoder(strings.NewReader(input)).Decode(&doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dex, ok := doc["dex"].([]interface{}); !ok || len(dex) != 20001 || doc["level"] != int64(5) {
+		t.Errorf("Unexpected result for a %d byte line", len(input))
+	}
+
+	// Past the configured limit, the line is rejected without reading it whole.
+	r := strings.NewReader(input)
+	err := NewDecoder(r, MaxLineLength(1000)).Decode(&doc)
+	if pe, ok := err.(*ParseError); !ok || pe.Code != CodeLineLength || pe.Line != 2 || pe.Column != 1001 {
+		t.Errorf("Expected line_length at 2:1001, got %v", err)
+	}
+	if r.Len() == 0 {
+		t.Error("Expected the rest of the line to be left unread")
+	}
+}
+
+// cancelingReader cancels a context once the first chunk of its input has
+// been read.
+type cancelingReader struct {
+	r      *strings.Reader
+	cancel context.CancelFunc
+}
+
+func (c *cancelingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p[:min(len(p), 64)])
+	c.cancel()
+	return n, err
+}
+
+func TestDecoder_DecodeContext(t *testing.T) {
+	input := "BULBA!\n" + strings.Repeat("level ~> 5\n", 500)
+	var doc map[string]interface{}
+	if err := NewDecoder(strings.NewReader(input)).DecodeContext(context.Background(), &doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The context is done while the document is being read.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &cancelingReader{r: strings.NewReader(input), cancel: cancel}
+	doc = nil
+	err := NewDecoder(r, CollectErrors()).DecodeContext(ctx, &doc)
+	if !errors.Is(err, context.Canceled) || doc != nil {
+		t.Errorf("Expected %v and no document, got %v and %v", context.Canceled, err, doc)
+	}
+	if r.r.Len() == 0 {
+		t.Error("Expected the rest of the input to be left unread")
+	}
+}
+
+func TestDecoder_DisallowUnknownFields(t *testing.T) {
+	type server struct {
+		Host string `bson:"host"`
+	}
+	type config struct {
+		Name     string                 `bson:"name"`
+		Database struct{ Host string }  `bson:"database"`
+		Base     struct{ Host string }  `bson:"base"`
+		Servers  []server               `bson:"servers"`
+		Extra    map[string]interface{} `bson:"extra"`
+	}
+	tests := []struct {
+		name, input, path string
+		line, column      int
+	}{
+		{"top level", "BULBA!\nnmae ~> \"app\"\nname ~> \"app\"\n", "nmae", 2, 1},
+		{"section", "BULBA!\n(o) database (o)\n    Host ~> \"db\"\n    Port ~> 5432\n", "database.Port", 4, 5},
+		{"first in the document", "BULBA!\nzz ~> 1\n(o) database (o)\n    Hots ~> \"db\"\naa ~> 2\n", "zz", 2, 1},
+		{"array of sections", "BULBA!\nservers ~> <|\n(o)\n    host ~> \"a\"\n(o)\n    hots ~> \"b\"\n|>\n", "servers[1].hots", 6, 5},
+		{"inline object", "BULBA!\nservers ~> <| { host ~> \"a\", port ~> 1 } |>\n", "servers[0].port", 2, 30},
+		{"copied", "BULBA!\n(o) base (o)\n    Port ~> 1\ndatabase ~> Copycat base\n", "database.Port", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config
+			dec := NewDecoder(strings.NewReader(tt.input))
+			dec.DisallowUnknownFields()
+			err := dec.Decode(&cfg)
+			var ufe *UnknownFieldError
+			if !errors.As(err, &ufe) {
+				t.Fatalf("Expected an UnknownFieldError, got %v", err)
+			}
+			if ufe.Path != tt.path || ufe.Line != tt.line || ufe.Column != tt.column {
+				t.Errorf("Expected %s at %d:%d, got %s at %d:%d", tt.path, tt.line, tt.column, ufe.Path, ufe.Line, ufe.Column)
+			}
+		})
+	}
+
+	// Maps take any key, and without the option unknown keys are ignored.
+	input := "BULBA!\nnmae ~> 1\n(o) extra (o)\n    anything ~> 1\n"
+	var cfg config
+	if err := NewDecoder(strings.NewReader(input)).Decode(&cfg); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	dec := NewDecoder(strings.NewReader(input))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err == nil || err.Error() != `bulbason: line 2: unknown key "nmae", did you mean "name"?` {
+		t.Errorf("Expected the unknown key nmae, got %v", err)
+	}
+}
+
+func TestDecoder_UnknownFieldSuggestion(t *testing.T) {
+	type config struct {
+		MaxConnections int    `bson:"max_connections"`
+		MinConnections int    `bson:"min_connections"`
+		Host           string `bson:"host"`
+		ID             int    `bson:"id"`
+	}
+	tests := []struct {
+		input, suggestion string
+	}{
+		{"BULBA!\nmax_conections ~> 10\n", "max_connections"},
+		{"BULBA!\nmin_connection ~> 1\n", "min_connections"},
+		{"BULBA!\nhots ~> \"db\"\n", "host"},
+		{"BULBA!\nHost ~> \"db\"\n", "host"},
+		{"BULBA!\nidd ~> 1\n", "id"},
+		// A field already set is not what a typo was meant to be.
+		{"BULBA!\nhost ~> \"db\"\nhots ~> \"db\"\n", ""},
+		// Nor is a field too far from the key.
+		{"BULBA!\ntimeout ~> 1\n", ""},
+		{"BULBA!\nx ~> 1\n", ""},
+	}
+	for _, tt := range tests {
+		dec := NewDecoder(strings.NewReader(tt.input))
+		dec.DisallowUnknownFields()
+		var cfg config
+		var ufe *UnknownFieldError
+		if err := dec.Decode(&cfg); !errors.As(err, &ufe) {
+			t.Errorf("%q: expected an UnknownFieldError, got %v", tt.input, err)
+			continue
+		}
+		if ufe.Suggestion != tt.suggestion {
+			t.Errorf("%q: expected the suggestion %q, got %q", tt.input, tt.suggestion, ufe.Suggestion)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"host", "", 4},
+		{"host", "host", 0},
+		{"hots", "host", 2},
+		{"kitten", "sitting", 3},
+		{"max_conections", "max_connections", 1},
+		{"pokémon", "pokemon", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDecoder_CaseInsensitiveKeys(t *testing.T) {
+	type config struct {
+		Host     string `bson:"host"`
+		Port     int    `bson:"port,max=65535"`
+		Database struct {
+			Name string
+		} `bson:"database"`
+		Rest map[string]interface{} `bson:",remain"`
+	}
+	decode := func(input string, v interface{}, unknown bool) error {
+		dec := NewDecoder(strings.NewReader(input))
+		dec.CaseInsensitiveKeys()
+		if unknown {
+			dec.DisallowUnknownFields()
+		}
+		return dec.Decode(v)
+	}
+
+	input := "BULBA!\nHost ~> \"db\"\nPORT ~> 5432\n(o) Database (o)\n    name ~> \"pokedex\"\nextra ~> 1\n"
+	var cfg config
+	if err := decode(input, &cfg, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Host != "db" || cfg.Port != 5432 || cfg.Database.Name != "pokedex" || !reflect.DeepEqual(cfg.Rest, map[string]interface{}{"extra": int64(1)}) {
+		t.Errorf("Unexpected result %+v", cfg)
+	}
+
+	// Without the option, the keys are left for the remain field.
+	var strict config
+	if err := NewDecoder(strings.NewReader(input)).Decode(&strict); err != nil || strict.Host != "" || len(strict.Rest) != 4 {
+		t.Errorf("Expected the keys to stay unmatched, got %+v (%v)", strict, err)
+	}
+
+	// An exact match wins over the others.
+	var exact struct {
+		Host string `bson:"host"`
+	}
+	if err := decode("BULBA!\nHOST ~> \"a\"\nhost ~> \"b\"\n", &exact, false); err != nil || exact.Host != "b" {
+		t.Errorf("Expected the exact key to win, got %q (%v)", exact.Host, err)
+	}
+	err := decode("BULBA!\nHOST ~> \"a\"\nHost ~> \"b\"\n", &exact, false)
+	if err == nil || err.Error() != `bulbason: cannot decode "host": several keys match the field: ["HOST" "Host"]` {
+		t.Errorf("Expected an error for ambiguous keys, got %v", err)
+	}
+
+	// Keys matched up to case are known, and errors name them as written.
+	err = decode("BULBA!\nHost ~> \"db\"\nPORT ~> 70000\n(o) database (o)\n    NAME ~> \"x\"\n", &struct {
+		Host     string `bson:"host"`
+		Port     int    `bson:"port,max=65535"`
+		Database struct {
+			Name string
+		} `bson:"database"`
+	}{}, true)
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 1 || verrs[0].Path != "PORT" || verrs[0].Line != 3 {
+		t.Errorf("Expected a validation error at PORT on line 3, got %v", err)
+	}
+}
+
+func TestEncoder_Encode(t *testing.T) {
+	doc := map[string]interface{}{
+		"name": "Bulby",
+		"stats": map[string]interface{}{
+			"level": int64(5),
+		},
+	}
+
+	var sb strings.Builder
+	enc := NewEncoder(&sb)
+	enc.SetVineLength(2)
+	if err := enc.Encode(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `BULBA!
+name ~~> "Bulby"
+(o) stats (o)
+    level ~~> 5
+`
+	if sb.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, sb.String())
+	}
+
+	result, err := Parse(sb.String())
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	if !reflect.DeepEqual(result, doc) {
+		t.Errorf("Expected %v, got %v", doc, result)
+	}
+}
+
+func TestEncoder_SetIndent(t *testing.T) {
+	var sb strings.Builder
+	enc := NewEncoder(&sb)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]interface{}{"stats": map[string]interface{}{"level": int64(5)}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "BULBA!\n(o) stats (o)\n  level ~~~~> 5\n"
+	if sb.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, sb.String())
+	}
+	if _, err := Parse(sb.String(), IndentWidth(2)); err != nil {
+		t.Errorf("Expected the output to parse with IndentWidth(2), got %v", err)
+	}
+
+	for _, width := range []int{0, -1} {
+		enc.SetIndent(width)
+		if err := enc.Encode(map[string]interface{}{}); err == nil {
+			t.Errorf("Expected an error for an indent width of %d, got nil", width)
+		}
+	}
+}
+
+func TestEncoder_SetKeyOrder(t *testing.T) {
+	type pool struct {
+		Size int    `bson:"size"`
+		Mode string `bson:"mode"`
+	}
+	type config struct {
+		Zone    string                 `bson:"zone"`
+		App     string                 `bson:"app"`
+		Pool    pool                   `bson:"pool"`
+		Limits  map[string]interface{} `bson:"limits"`
+		Backend codecPool              `bson:"backend"`
+	}
+	cfg := config{Zone: "eu", App: "api", Pool: pool{Size: 5, Mode: "lru"}, Limits: map[string]interface{}{"rps": 10, "burst": 20}, Backend: codecPool{Size: 1}}
+
+	tests := []struct {
+		name     string
+		cmp      func(a, b string) int
+		expected string
+	}{
+		{"source", nil, `BULBA!
+zone ~~~~> "eu"
+app ~~~~> "api"
+(o) pool (o)
+    size ~~~~> 5
+    mode ~~~~> "lru"
+(o) limits (o)
+    burst ~~~~> 20
+    rps ~~~~> 10
+(o) backend (o)
+    size ~~~~> 1
+    timeout ~~~~> 0s
+`},
+		{"lexicographic", strings.Compare, `BULBA!
+app ~~~~> "api"
+zone ~~~~> "eu"
+(o) backend (o)
+    size ~~~~> 1
+    timeout ~~~~> 0s
+(o) limits (o)
+    burst ~~~~> 20
+    rps ~~~~> 10
+(o) pool (o)
+    mode ~~~~> "lru"
+    size ~~~~> 5
+`},
+		{"reverse", func(a, b string) int { return strings.Compare(b, a) }, `BULBA!
+zone ~~~~> "eu"
+app ~~~~> "api"
+(o) pool (o)
+    size ~~~~> 5
+    mode ~~~~> "lru"
+(o) limits (o)
+    rps ~~~~> 10
+    burst ~~~~> 20
+(o) backend (o)
+    timeout ~~~~> 0s
+    size ~~~~> 1
+`},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		enc := NewEncoder(&sb)
+		enc.SetKeyOrder(tt.cmp)
+		if err := enc.Encode(cfg); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if sb.String() != tt.expected {
+			t.Errorf("%s: expected:\n%s\nGot:\n%s", tt.name, tt.expected, sb.String())
+		}
+	}
+
+	// Syntax trees and inline objects are ordered too, includes first.
+	doc, err := ParseAST("BULBA!\nb ~> { y ~> 1, x ~> 2 }\nTransform \"base.bson\"\n(o) c (o)\n    k ~> 1\na ~> 3\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var sb strings.Builder
+	enc := NewEncoder(&sb)
+	enc.SetKeyOrder(strings.Compare)
+	if err := enc.EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\nTransform \"base.bson\"\na ~~~~> 3\nb ~~~~> { x ~~~~> 2, y ~~~~> 1 }\n(o) c (o)\n    k ~~~~> 1\n"
+	if sb.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, sb.String())
+	}
+}
+
+func TestEncoder_Styling(t *testing.T) {
+	doc := map[string]interface{}{
+		"name":    "Bulby",
+		"dex_num": int64(1),
+		"moves":   []interface{}{"Tackle, Growl", `C:\Vine`},
+		"notes":   "line one\nline two",
+		"servers": []map[string]interface{}{{"port": int64(80)}, {"port": int64(81)}},
+		"pools":   []map[string]interface{}{{"name": "a pool name that will not fit!"}},
+		"stats":   map[string]interface{}{"hp": int64(45), "speed": int64(45)},
+	}
+	var sb strings.Builder
+	enc := NewEncoder(&sb)
+	enc.SetVineLength(2)
+	enc.SetVinePolicy(VineAligned)
+	enc.SetQuoteStyle(QuoteRaw)
+	enc.SetArrayWrap(60)
+	if err := enc.Encode(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\n" +
+		"dex_num ~~> 1\n" +
+		"moves ~~~~> <| `Tackle, Growl`, `C:\\Vine` |>\n" +
+		"name ~~~~~> `Bulby`\n" +
+		"notes ~~~~> \"\"\"\n" +
+		"    line one\n" +
+		"    line two\n" +
+		"    \"\"\"\n" +
+		"pools ~~~~> <|\n" +
+		"(o)\n" +
+		"    name ~~> `a pool name that will not fit!`\n" +
+		"|>\n" +
+		"servers ~~> <| { port ~~> 80 }, { port ~~> 81 } |>\n" +
+		"(o) stats (o)\n" +
+		"    hp ~~~~~> 45\n" +
+		"    speed ~~> 45\n"
+	if sb.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, sb.String())
+	}
+
+	result, err := Parse(sb.String())
+	if err != nil {
+		t.Fatalf("Output does not parse: %v", err)
+	}
+	// The array written inline reads back as an array of inline objects.
+	doc["servers"] = []interface{}{map[string]interface{}{"port": int64(80)}, map[string]interface{}{"port": int64(81)}}
+	if !reflect.DeepEqual(result, doc) {
+		t.Errorf("Expected %v, got %v", doc, result)
+	}
+
+	// Syntax trees are aligned too, but keep their quotes.
+	tree, err := ParseAST("BULBA!\na ~> \"x\"\nlonger ~> 1\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sb.Reset()
+	if err := enc.EncodeAST(tree); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "BULBA!\na ~~~~~~~> \"x\"\nlonger ~~> 1\n"; sb.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, sb.String())
+	}
+
+	enc.SetArrayWrap(-1)
+	if err := enc.Encode(doc); err == nil {
+		t.Error("Expected an error for a negative array wrap width")
+	}
+}
+
+func TestEncoder_InvalidVine(t *testing.T) {
+	enc := NewEncoder(&strings.Builder{})
+	enc.SetVineLength(0)
+	if err := enc.Encode(map[string]interface{}{}); err == nil {
+		t.Error("Expected an error for an empty Vine Whip, got nil")
+	}
+}
+
+func TestEncoder_EncodeAST(t *testing.T) {
+	input := `BULBA!
+zZz Basic Configuration
+version ~~~~> 1.50 zZz Keep the trailing zero
+zZz Level 1
+(o) database (o)
+    zZz Connection
+    host ~~~~> "127.0.0.1"
+    (O) pool (O)
+        size ~~~~> <| 1, 2 |>
+    port ~~~~> 5432
+    limits ~~~~> { max ~~~~> 10, ports ~~~~> <| 1, 2 |>, inner ~~~~> { } }
+    replicas ~~~~> <| zZz Read only
+    zZz Primary replica
+    (O)
+        host ~~~~> "10.0.0.2"
+    (O)
+        host ~~~~> "10.0.0.3"
+    |>
+name ~~~~> "Bulby"
+zZz The end
+`
+	doc, err := ParseAST(input, ParseComments())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := NewEncoder(&sb).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sb.String() != input {
+		t.Errorf("Expected:\n%s\nGot:\n%s", input, sb.String())
+	}
+}
+
+func TestEncoder_EncodeASTRawString(t *testing.T) {
+	input := "BULBA!\ndir ~~~~> `C:\\data`\nname ~~~~> \"Bulby\"\n"
+	doc, err := ParseAST(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := NewEncoder(&sb).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sb.String() != input {
+		t.Errorf("Expected:\n%s\nGot:\n%s", input, sb.String())
+	}
+}
+
+func TestLexer_Next(t *testing.T) {
+	input := `BULBA!
+name ~~> "Bulby"
+query ~~> """
+    SELECT *
+    """
+(o) stats (o)
+    hp ~~> 45
+`
+	expected, err := Lex(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	l := NewLexer(strings.NewReader(input))
+	var tokens []Token
+	for {
+		tok, err := l.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tokens = append(tokens, tok)
+		if tok.Type == TOKEN_EOF {
+			break
+		}
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, tokens)
+	}
+
+	// The end of the input is sticky.
+	if tok, err := l.Next(); err != nil || tok.Type != TOKEN_EOF {
+		t.Errorf("Expected another EOF token, got %+v and %v", tok, err)
+	}
+}
+
+func TestLexer_NextAfterError(t *testing.T) {
+	l := NewLexer(strings.NewReader("BULBA!\n  bad ~> 1\ngood ~> 2\n"))
+	var types []TokenType
+	var errs int
+	for {
+		tok, err := l.Next()
+		if err != nil {
+			if pe, ok := err.(*ParseError); !ok || pe.Code != CodeIndentation || pe.Line != 2 {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			errs++
+			continue
+		}
+		types = append(types, tok.Type)
+		if tok.Type == TOKEN_EOF {
+			break
+		}
+	}
+
+	expected := []TokenType{TOKEN_HEADER, TOKEN_INDENT, TOKEN_IDENTIFIER, TOKEN_VINE_WHIP, TOKEN_NUMBER, TOKEN_EOF}
+	if errs != 1 || !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected one error and %v, got %d and %v", expected, errs, types)
+	}
+}
@@ -0,0 +1,783 @@
+package bulbason
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// ToTOML converts a document to TOML.
+//
+// Sections become tables and multi-line arrays become arrays of tables. TOML
+// wants the plain values of a table before its sub-tables, so within each
+// section the values come first, in their original order, followed by the
+// sections. Other arrays and inline objects are written inline. Durations and
+// byte strings, which TOML has no type for, become strings, base64 in the
+// case of byte strings. TOML has no null either: keys whose value is
+// MissingNo are left out, and MissingNo inside an array is an error. When a
+// key appears more than once, the last value wins, as with Parse.
+func ToTOML(doc *ast.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeTOMLTable(&buf, doc.Body, ""); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeTOMLTable writes the values of a body, then its sub-tables. path is
+// the dotted TOML path of the table, with keys already quoted as needed.
+func writeTOMLTable(buf *bytes.Buffer, body []ast.Entry, path string) error {
+	last := make(map[string]int, len(body))
+	for i, entry := range body {
+		last[entryName(entry)] = i
+	}
+
+	// Tables are the entries TOML writes under a header of their own.
+	var tables []ast.Entry
+	for i, entry := range body {
+		name := entryName(entry)
+		if last[name] != i {
+			continue
+		}
+		kv, ok := entry.(*ast.KeyValue)
+		if !ok || isTOMLTable(kv.Value) {
+			tables = append(tables, entry)
+			continue
+		}
+		if _, null := kv.Value.(*ast.NullLit); null || kv.Value == nil {
+			continue
+		}
+		value, err := tomlValue(kv.Value, joinTOMLPath(path, name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "%s = %s\n", tomlKey(name), value)
+	}
+
+	for _, entry := range tables {
+		name := entryName(entry)
+		tablePath := joinTOMLPath(path, name)
+		var err error
+		switch e := entry.(type) {
+		case *ast.Section:
+			if e.Forme != nil {
+				return formeError(e, joinPath(path, name), "TOML")
+			}
+			err = writeTOMLHeader(buf, "["+tablePath+"]", e.Body, tablePath)
+		case *ast.KeyValue:
+			switch v := e.Value.(type) {
+			case *ast.ObjectLit:
+				err = writeTOMLHeader(buf, "["+tablePath+"]", v.Body, tablePath)
+			case *ast.ArrayLit:
+				for _, elem := range v.Elements {
+					if err = writeTOMLHeader(buf, "[["+tablePath+"]]", elem.(*ast.ObjectLit).Body, tablePath); err != nil {
+						break
+					}
+				}
+			}
+		default:
+			err = fmt.Errorf("bulbason: cannot convert node of type %T to TOML", entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTOMLHeader writes a table header and the table's content, with a
+// blank line before the header unless it starts the output.
+func writeTOMLHeader(buf *bytes.Buffer, header string, body []ast.Entry, path string) error {
+	if buf.Len() > 0 {
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(header + "\n")
+	return writeTOMLTable(buf, body, path)
+}
+
+// isTOMLTable reports whether the value of a key is written as a table or
+// an array of tables.
+func isTOMLTable(v ast.Value) bool {
+	switch n := v.(type) {
+	case *ast.ObjectLit:
+		return true
+	case *ast.ArrayLit:
+		return n.Block || onlyObjects(n.Elements)
+	}
+	return false
+}
+
+// tomlValue returns the inline TOML form of a value at path.
+func tomlValue(v ast.Value, path string) (string, error) {
+	switch n := v.(type) {
+	case *ast.StringLit:
+		return tomlString(n.Value), nil
+	case *ast.NumberLit:
+		switch n.Literal {
+		case literalInf:
+			return "inf", nil
+		case literalNegInf:
+			return "-inf", nil
+		case literalNaN:
+			return "nan", nil
+		}
+		num, err := parseNumber(n.Literal, LargeIntegerError)
+		if err != nil {
+			return "", fmt.Errorf("bulbason: cannot convert %s to TOML, %s is out of the range of a TOML integer", path, n.Literal)
+		}
+		if f, ok := num.(float64); ok {
+			return encodeFloat(f)
+		}
+		return n.Literal, nil
+	case *ast.TimeLit:
+		return n.Literal, nil
+	case *ast.DurationLit:
+		return tomlString(n.Literal), nil
+	case *ast.BytesLit:
+		return tomlString(n.Literal), nil
+	case *ast.BoolLit:
+		return strconv.FormatBool(n.Value), nil
+	case *ast.NullLit, nil:
+		return "", fmt.Errorf("bulbason: cannot convert %s to TOML, TOML has no null", path)
+	case *ast.ArrayLit:
+		parts := make([]string, len(n.Elements))
+		for i, elem := range n.Elements {
+			s, err := tomlValue(elem, indexPath(path, i))
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case *ast.ObjectLit:
+		parts := make([]string, 0, len(n.Body))
+		for _, entry := range n.Body {
+			kv, ok := entry.(*ast.KeyValue)
+			if !ok {
+				return "", fmt.Errorf("bulbason: cannot convert sections inside inline objects to TOML")
+			}
+			if _, null := kv.Value.(*ast.NullLit); null || kv.Value == nil {
+				continue
+			}
+			s, err := tomlValue(kv.Value, joinTOMLPath(path, kv.Key.Name))
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, tomlKey(kv.Key.Name)+" = "+s)
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("bulbason: cannot convert %s of type %T to TOML", path, v)
+}
+
+// tomlString returns s as a TOML string: a multi-line literal string if it
+// spans several lines and can be written that way, a basic string otherwise.
+func tomlString(s string) string {
+	if strings.Contains(s, "\n") && !strings.Contains(s, "'''") && !strings.HasSuffix(s, "'") && !strings.ContainsAny(s, "\r\x7f") {
+		literal := true
+		for _, r := range s {
+			if r < ' ' && r != '\n' && r != '\t' {
+				literal = false
+			}
+		}
+		if literal {
+			// A line break right after the opening quotes is dropped.
+			return "'''\n" + s + "'''"
+		}
+	}
+	return tomlBasicString(s)
+}
+
+// tomlBasicString returns s as a TOML basic string, between double quotes.
+func tomlBasicString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// tomlKey returns key as a bare key if it can be written as one, and quoted
+// otherwise.
+func tomlKey(key string) string {
+	for _, r := range key {
+		if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return tomlBasicString(key)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
+
+// joinTOMLPath adds a key to a dotted TOML path.
+func joinTOMLPath(path, key string) string {
+	if path == "" {
+		return tomlKey(key)
+	}
+	return path + "." + tomlKey(key)
+}
+
+// FromTOML converts a TOML document to a document, keeping the order in
+// which keys and tables first appear, ready to be written with
+// Encoder.EncodeAST.
+//
+// Tables become sections and arrays of tables become multi-line arrays.
+// Dotted keys and inline tables become sections too, except inside arrays,
+// where inline tables become inline objects. Offset date-times become
+// timestamps. Local dates and times, which BSON has no type for, become
+// strings. Hex, octal and binary integers are written in decimal. Nested
+// arrays, integers outside the int64 range and keys BSON cannot hold are
+// rejected with an error naming the line.
+func FromTOML(data []byte) (*ast.Document, error) {
+	root := &ast.ObjectLit{Inline: true}
+	p := &tomlParser{
+		s:       strings.ReplaceAll(string(data), "\r\n", "\n"),
+		root:    root,
+		table:   root,
+		defined: make(map[*ast.ObjectLit]bool),
+		arrays:  make(map[*ast.ArrayLit]bool),
+	}
+	if err := p.document(); err != nil {
+		return nil, err
+	}
+	return &ast.Document{Body: sectionsFromObjects(root.Body)}, nil
+}
+
+// tomlParser reads a TOML document. Tables are read in the inline form of
+// FromJSON, objects being *ast.ObjectLit throughout.
+type tomlParser struct {
+	s string
+	i int
+
+	root  *ast.ObjectLit
+	table *ast.ObjectLit // The table of the last header
+
+	// Tables that have been given a header or values of their own, and
+	// arrays made with [[ ]] headers, which later headers may add to.
+	defined map[*ast.ObjectLit]bool
+	arrays  map[*ast.ArrayLit]bool
+}
+
+// errorf returns an error located at the current position.
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.s[:p.i], "\n") + 1
+	return fmt.Errorf("bulbason: cannot convert TOML line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// document reads the whole input.
+func (p *tomlParser) document() error {
+	for {
+		p.skipBlank()
+		if p.i == len(p.s) {
+			return nil
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(p.s[p.i:], "[["):
+			p.i += 2
+			err = p.header(true)
+		case p.s[p.i] == '[':
+			p.i++
+			err = p.header(false)
+		default:
+			err = p.keyValue(p.table)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// header reads a table header after its opening bracket or brackets.
+func (p *tomlParser) header(array bool) error {
+	keys, err := p.keys()
+	if err != nil {
+		return err
+	}
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	p.skipSpace()
+	if !strings.HasPrefix(p.s[p.i:], closing) {
+		return p.errorf("expected %s after the table name", closing)
+	}
+
+	parent, err := p.descend(p.root, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	key := keys[len(keys)-1]
+	kv := findKey(parent, key)
+	if array {
+		if kv == nil {
+			kv = &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: &ast.ArrayLit{}}
+			parent.Body = append(parent.Body, kv)
+			p.arrays[kv.Value.(*ast.ArrayLit)] = true
+		}
+		arr, ok := kv.Value.(*ast.ArrayLit)
+		if !ok || !p.arrays[arr] {
+			return p.errorf("%s is already defined and is not an array of tables", strings.Join(keys, "."))
+		}
+		p.table = &ast.ObjectLit{Inline: true}
+		arr.Elements = append(arr.Elements, p.table)
+	} else {
+		if kv == nil {
+			kv = &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: &ast.ObjectLit{Inline: true}}
+			parent.Body = append(parent.Body, kv)
+		}
+		obj, ok := kv.Value.(*ast.ObjectLit)
+		if !ok || p.defined[obj] {
+			return p.errorf("%s is already defined", strings.Join(keys, "."))
+		}
+		p.table = obj
+	}
+	p.defined[p.table] = true
+	p.i += len(closing)
+	return nil
+}
+
+// descend follows keys down from table, creating the tables that do not exist
+// yet. A key naming an array of tables leads to its last table.
+func (p *tomlParser) descend(table *ast.ObjectLit, keys []string) (*ast.ObjectLit, error) {
+	for _, key := range keys {
+		kv := findKey(table, key)
+		if kv == nil {
+			kv = &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: &ast.ObjectLit{Inline: true}}
+			table.Body = append(table.Body, kv)
+		}
+		switch v := kv.Value.(type) {
+		case *ast.ObjectLit:
+			table = v
+		case *ast.ArrayLit:
+			if !p.arrays[v] {
+				return nil, p.errorf("%s is not a table", key)
+			}
+			table = v.Elements[len(v.Elements)-1].(*ast.ObjectLit)
+		default:
+			return nil, p.errorf("%s is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// keyValue reads a key-value pair into table.
+func (p *tomlParser) keyValue(table *ast.ObjectLit) error {
+	keys, err := p.keys()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.i == len(p.s) || p.s[p.i] != '=' {
+		return p.errorf("expected = after %s", strings.Join(keys, "."))
+	}
+	p.i++
+	p.skipSpace()
+
+	parent, err := p.descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	key := keys[len(keys)-1]
+	if findKey(parent, key) != nil {
+		return p.errorf("%s is already defined", strings.Join(keys, "."))
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	if obj, ok := value.(*ast.ObjectLit); ok {
+		// Inline tables are complete; no header may add to them.
+		p.defined[obj] = true
+	}
+	parent.Body = append(parent.Body, &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: value})
+	return nil
+}
+
+// keys reads a key, which may be dotted.
+func (p *tomlParser) keys() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		var key string
+		switch {
+		case p.i < len(p.s) && (p.s[p.i] == '"' || p.s[p.i] == '\''):
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.i
+			for p.i < len(p.s) && isTOMLBareKeyChar(p.s[p.i]) {
+				p.i++
+			}
+			if p.i == start {
+				return nil, p.errorf("expected a key")
+			}
+			key = p.s[start:p.i]
+		}
+		if _, err := encodeKey(key); err != nil {
+			return nil, p.errorf("%q is not a valid key", key)
+		}
+		keys = append(keys, key)
+		p.skipSpace()
+		if p.i == len(p.s) || p.s[p.i] != '.' {
+			return keys, nil
+		}
+		p.i++
+	}
+}
+
+// value reads a value.
+func (p *tomlParser) value() (ast.Value, error) {
+	if p.i == len(p.s) {
+		return nil, p.errorf("expected a value")
+	}
+	switch p.s[p.i] {
+	case '"', '\'':
+		s, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.StringLit{Value: s}, nil
+	case '[':
+		p.i++
+		arr := &ast.ArrayLit{}
+		for {
+			p.skipBlank()
+			if p.i < len(p.s) && p.s[p.i] == ']' {
+				p.i++
+				return arr, nil
+			}
+			elem, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := elem.(*ast.ArrayLit); ok {
+				return nil, p.errorf("arrays cannot be nested")
+			}
+			arr.Elements = append(arr.Elements, elem)
+			p.skipBlank()
+			switch {
+			case p.i < len(p.s) && p.s[p.i] == ',':
+				p.i++
+			case p.i == len(p.s) || p.s[p.i] != ']':
+				return nil, p.errorf("expected , or ] in array")
+			}
+		}
+	case '{':
+		p.i++
+		obj := &ast.ObjectLit{Inline: true}
+		p.skipSpace()
+		if p.i < len(p.s) && p.s[p.i] == '}' {
+			p.i++
+			return obj, nil
+		}
+		for {
+			if err := p.keyValue(obj); err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			switch {
+			case p.i < len(p.s) && p.s[p.i] == ',':
+				p.i++
+			case p.i < len(p.s) && p.s[p.i] == '}':
+				p.i++
+				return obj, nil
+			default:
+				return nil, p.errorf("expected , or } in inline table, which must fit on one line")
+			}
+		}
+	}
+
+	start := p.i
+	for p.i < len(p.s) && !strings.ContainsRune(" \t\n,]}#", rune(p.s[p.i])) {
+		p.i++
+	}
+	// A date and a time may be separated by a space.
+	if p.i-start == 10 && p.i+1 < len(p.s) && p.s[p.i] == ' ' && isDigit(p.s[p.i+1]) && p.s[start+4] == '-' {
+		p.i++
+		for p.i < len(p.s) && !strings.ContainsRune(" \t\n,]}#", rune(p.s[p.i])) {
+			p.i++
+		}
+	}
+	text := p.s[start:p.i]
+	if v, ok := resolveTOMLScalar(text); ok {
+		return v, nil
+	}
+	p.i = start
+	return nil, p.errorf("invalid value %q", text)
+}
+
+// resolveTOMLScalar converts a bare TOML value: a boolean, number or date.
+func resolveTOMLScalar(s string) (ast.Value, bool) {
+	switch s {
+	case "true":
+		return &ast.BoolLit{Value: true}, true
+	case "false":
+		return &ast.BoolLit{Value: false}, true
+	case "inf", "+inf":
+		return &ast.NumberLit{Literal: literalInf}, true
+	case "-inf":
+		return &ast.NumberLit{Literal: literalNegInf}, true
+	case "nan", "+nan", "-nan":
+		return &ast.NumberLit{Literal: literalNaN}, true
+	}
+
+	if len(s) > 2 && s[0] == '0' && strings.ContainsRune("xob", rune(s[1])) {
+		i, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return nil, false
+		}
+		return &ast.NumberLit{Literal: strconv.FormatInt(i, 10)}, true
+	}
+	if literal, ok := tomlNumber(s); ok {
+		return &ast.NumberLit{Literal: literal}, true
+	}
+
+	// Offset date-times are timestamps. Local dates and times have no BSON
+	// type and are kept as strings.
+	normalized := strings.ToUpper(strings.Replace(s, " ", "T", 1))
+	if _, err := time.Parse(time.RFC3339Nano, normalized); err == nil {
+		return &ast.TimeLit{Literal: normalized}, true
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02", "15:04:05.999999999"} {
+		if _, err := time.Parse(layout, normalized); err == nil {
+			return &ast.StringLit{Value: s}, true
+		}
+	}
+	return nil, false
+}
+
+// tomlNumber returns the BSON literal of a decimal TOML integer or float.
+func tomlNumber(s string) (string, bool) {
+	if strings.Trim(s, "0123456789+-._eE") != "" {
+		return "", false
+	}
+	// Underscores must sit between digits.
+	for i := 0; i < len(s); i++ {
+		if s[i] == '_' && (i == 0 || i == len(s)-1 || !isDigit(s[i-1]) || !isDigit(s[i+1])) {
+			return "", false
+		}
+	}
+	literal := strings.TrimPrefix(strings.ReplaceAll(s, "_", ""), "+")
+	// Leading zeros, and a dot without digits on both sides, are not allowed.
+	digits := strings.TrimPrefix(literal, "-")
+	if len(digits) > 1 && digits[0] == '0' && isDigit(digits[1]) {
+		return "", false
+	}
+	if dot := strings.IndexByte(digits, '.'); dot != -1 && (dot == 0 || dot == len(digits)-1 || !isDigit(digits[dot+1])) {
+		return "", false
+	}
+	if !isNumberText(literal) {
+		return "", false
+	}
+	// Integers are 64-bit, and floats must fit a float64.
+	var err error
+	if strings.ContainsAny(literal, ".eE") {
+		_, err = strconv.ParseFloat(literal, 64)
+	} else {
+		_, err = strconv.ParseInt(literal, 10, 64)
+	}
+	return literal, err == nil
+}
+
+// str reads a basic, literal or multi-line string.
+func (p *tomlParser) str() (string, error) {
+	q := p.s[p.i]
+	delim := string(q)
+	if strings.HasPrefix(p.s[p.i:], strings.Repeat(delim, 3)) {
+		return p.multiLineString(q)
+	}
+	p.i++
+	var sb strings.Builder
+	for {
+		if p.i == len(p.s) || p.s[p.i] == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.s[p.i]
+		switch {
+		case c == q:
+			p.i++
+			return sb.String(), nil
+		case c == '\\' && q == '"':
+			if err := p.escape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			p.i++
+		}
+	}
+}
+
+// multiLineString reads a string between triple quotes.
+func (p *tomlParser) multiLineString(q byte) (string, error) {
+	closing := strings.Repeat(string(q), 3)
+	p.i += 3
+	// A line break right after the opening quotes is dropped.
+	if p.i < len(p.s) && p.s[p.i] == '\n' {
+		p.i++
+	}
+	var sb strings.Builder
+	for {
+		if p.i == len(p.s) {
+			return "", p.errorf("unterminated multi-line string")
+		}
+		if strings.HasPrefix(p.s[p.i:], closing) {
+			// Up to two more quotes belong to the content.
+			end := p.i + 3
+			for n := 0; n < 2 && end < len(p.s) && p.s[end] == q; n++ {
+				end++
+			}
+			sb.WriteString(p.s[p.i : end-3])
+			p.i = end
+			return sb.String(), nil
+		}
+		c := p.s[p.i]
+		if c == '\\' && q == '"' {
+			// A backslash at the end of a line trims the line break and
+			// the whitespace that follows.
+			rest := strings.TrimLeft(p.s[p.i+1:], " \t")
+			if strings.HasPrefix(rest, "\n") {
+				p.i = len(p.s) - len(strings.TrimLeft(rest, " \t\n"))
+				continue
+			}
+			if err := p.escape(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		sb.WriteByte(c)
+		p.i++
+	}
+}
+
+// escape reads an escape sequence in a basic string.
+func (p *tomlParser) escape(sb *strings.Builder) error {
+	if p.i+1 >= len(p.s) {
+		return p.errorf("unterminated string")
+	}
+	c := p.s[p.i+1]
+	p.i += 2
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'e':
+		sb.WriteByte(0x1b)
+	case '"', '\\':
+		sb.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.i+n > len(p.s) {
+			return p.errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(p.s[p.i:p.i+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return p.errorf("invalid unicode escape")
+		}
+		sb.WriteRune(rune(r))
+		p.i += n
+	default:
+		p.i -= 2
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// skipSpace skips spaces and tabs.
+func (p *tomlParser) skipSpace() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+// skipBlank skips whitespace, line breaks and comments.
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpace()
+		switch {
+		case p.i < len(p.s) && p.s[p.i] == '\n':
+			p.i++
+		case p.i < len(p.s) && p.s[p.i] == '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine checks that nothing but a comment follows on the current line.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if p.i < len(p.s) && p.s[p.i] == '#' {
+		for p.i < len(p.s) && p.s[p.i] != '\n' {
+			p.i++
+		}
+	}
+	if p.i < len(p.s) && p.s[p.i] != '\n' {
+		return p.errorf("unexpected %q at the end of the line", p.s[p.i:p.i+1])
+	}
+	return nil
+}
+
+// isTOMLBareKeyChar reports whether c may appear in a bare key.
+func isTOMLBareKeyChar(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c)
+}
+
+// findKey returns the key-value pair of obj with the given key, or nil.
+func findKey(obj *ast.ObjectLit, key string) *ast.KeyValue {
+	for _, entry := range obj.Body {
+		if kv, ok := entry.(*ast.KeyValue); ok && kv.Key.Name == key {
+			return kv
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package bulbason
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToTOML(t *testing.T) {
+	input := `BULBA!
+name ~~> "Bulby"
+(o) stats (o)
+    hp ~> 45
+    (O) "x-meta" (O)
+        tags ~> <| "a", { x ~> 1, y ~> MissingNo } |>
+    speed ~> 0.5
+when ~> 2024-05-01T12:00:00Z
+wait ~> 1h30m
+owner ~> MissingNo
+bio ~> """
+    Likes sun.
+    Naps a lot.
+    """
+moves ~~> <|
+(o)
+    power ~~> 40
+    (O) meta (O)
+        pp ~~> 25
+(o)
+    power ~~> 1e3
+|>
+shiny ~> NotVeryEffective
+`
+	doc, err := ParseAST(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := ToTOML(doc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `name = "Bulby"
+when = 2024-05-01T12:00:00Z
+wait = "1h30m"
+bio = '''
+Likes sun.
+Naps a lot.'''
+shiny = false
+
+[stats]
+hp = 45
+speed = 0.5
+
+[stats.x-meta]
+tags = ["a", { x = 1 }]
+
+[[moves]]
+power = 40
+
+[moves.meta]
+pp = 25
+
+[[moves]]
+power = 1000.0
+`
+	if string(out) != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	// The TOML converts back to the same data, MissingNo and durations aside.
+	back, err := FromTOML(out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(back); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want, _ := Parse(input)
+	got, err := Parse(buf.String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, buf.String())
+	}
+	delete(want, "owner")
+	want["wait"] = "1h30m"
+	delete(want["stats"].(map[string]interface{})["x-meta"].(map[string]interface{})["tags"].([]interface{})[1].(map[string]interface{}), "y")
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", want, got)
+	}
+
+	doc, _ = ParseAST("BULBA!\ntags ~> <| 1, MissingNo |>\n")
+	if _, err := ToTOML(doc); err == nil || !strings.Contains(err.Error(), "tags[1]") {
+		t.Errorf("Expected an error naming tags[1], got %v", err)
+	}
+}
+
+func TestFromTOML(t *testing.T) {
+	input := `# Cargo-style manifest
+title = "TOML \"Example\"" # trailing comment
+port = 8_080
+mask = 0xff
+ratio = +1.5e-3
+debug = true
+created = 1979-05-27 07:32:00z
+birthday = 1979-05-27
+path = 'C:\Users\bulby'
+site."google.com" = true
+ports = [
+  80,  # http
+  443,
+]
+points = [{ x = 1, y = 2 }, { x = 3 }]
+text = """
+one \
+  two
+three"""
+
+[package]
+name = "bulby"
+
+[dependencies.serde]
+version = "1.0"
+
+[[bin]]
+name = "first"
+
+[[bin]]
+name = "second"
+
+[bin.extra]
+flag = false
+
+[package.metadata]
+docs = true
+`
+	doc, err := FromTOML([]byte(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "BULBA!\n" +
+		"title ~~~~> `TOML \"Example\"`\n" +
+		`port ~~~~> 8080
+mask ~~~~> 255
+ratio ~~~~> 1.5e-3
+debug ~~~~> SuperEffective
+created ~~~~> 1979-05-27T07:32:00Z
+birthday ~~~~> "1979-05-27"
+path ~~~~> "C:\Users\bulby"
+(o) site (o)
+    "google.com" ~~~~> SuperEffective
+ports ~~~~> <| 80, 443 |>
+points ~~~~> <|
+(o)
+    x ~~~~> 1
+    y ~~~~> 2
+(o)
+    x ~~~~> 3
+|>
+text ~~~~> """
+    one two
+    three
+    """
+(o) package (o)
+    name ~~~~> "bulby"
+    (O) metadata (O)
+        docs ~~~~> SuperEffective
+(o) dependencies (o)
+    (O) serde (O)
+        version ~~~~> "1.0"
+bin ~~~~> <|
+(o)
+    name ~~~~> "first"
+(o)
+    name ~~~~> "second"
+    (O) extra (O)
+        flag ~~~~> NotVeryEffective
+|>
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestFromTOML_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+	}{
+		{"Nested Arrays", "a = 1\nb = [1, [2]]\n", "line 2: arrays cannot be nested"},
+		{"Duplicate Key", "a = 1\na = 2\n", "line 2: a is already defined"},
+		{"Duplicate Table", "[a]\n[b]\n[a]\n", "line 3: a is already defined"},
+		{"Table Over Value", "a = 1\n[a.b]\n", "line 2: a is not a table"},
+		{"Array Of Tables Over Array", "a = [1]\n[[a]]\n", "line 2: a is already defined and is not an array of tables"},
+		{"Invalid Value", "a = yes\n", `line 1: invalid value "yes"`},
+		{"Leading Zero", "a = 012\n", "invalid value"},
+		{"Integer Overflow", "a = 9223372036854775808\n", "invalid value"},
+		{"Unterminated String", "a = \"one\nb = 2\n", "line 1: unterminated string"},
+		{"Missing Equals", "a 1\n", "expected = after a"},
+		{"Trailing Text", "a = 1 2\n", "line 1: unexpected \"2\""},
+		{"Reserved Key", "[x]\nCharizard = 1\n", `line 2: "Charizard" is not a valid key`},
+		{"Unclosed Array", "a = [1, 2\n", "expected , or ]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromTOML([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package bulbason
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError reports a value that breaks a validation option of the
+// struct field it was decoded into.
+type ValidationError struct {
+	Path    string // Dotted path of the key, e.g. "server.port"
+	Line    int    // 1-based position of the key, 0 if it cannot be located
+	Column  int
+	Message string // What is wrong, e.g. "70000 is more than the maximum 65535"
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("bulbason: %s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("bulbason: line %d: %s: %s", e.Line, e.Path, e.Message)
+}
+
+// ValidationErrors is returned by Unmarshal and Decoder.Decode when values
+// break the validation options of their fields. It holds every such value,
+// in the order they were decoded.
+type ValidationErrors []*ValidationError
+
+func (l ValidationErrors) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap exposes the individual errors to errors.Is and errors.As.
+func (l ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, e := range l {
+		errs[i] = e
+	}
+	return errs
+}
+
+// fieldRules holds the validation options of a struct field:
+//
+//   - min and max bound numbers and durations, such as min=1 or max=1h, and
+//     the length of strings, slices, arrays and maps;
+//   - enum lists the values allowed, separated by |, as in
+//     enum=debug|info|warn;
+//   - regex is a regular expression strings must match. As the default
+//     option does, it runs to the end of the tag, so it may hold commas.
+//
+// enum and regex apply to each element of a slice or array.
+type fieldRules struct {
+	min, max       string
+	hasMin, hasMax bool
+	enum           []string
+	regex          *regexp.Regexp
+	err            error // Set when an option cannot be used
+}
+
+// parseRules returns the validation options of a `bson` struct tag, or nil
+// if it has none.
+func parseRules(tag string) *fieldRules {
+	r := &fieldRules{}
+	r.min, r.hasMin = tagValue(tag, "min")
+	r.max, r.hasMax = tagValue(tag, "max")
+	enum, hasEnum := tagValue(tag, "enum")
+	if hasEnum {
+		r.enum = strings.Split(enum, "|")
+	}
+	pattern, hasRegex := tagValue(tag, "regex")
+	if hasRegex {
+		r.regex, r.err = regexp.Compile(pattern)
+	}
+	if !r.hasMin && !r.hasMax && !hasEnum && !hasRegex {
+		return nil
+	}
+	return r
+}
+
+// check returns what is wrong with v, or "" if it passes every option.
+func (r *fieldRules) check(v reflect.Value) string {
+	if r.err != nil {
+		return fmt.Sprintf("invalid validation option: %v", r.err)
+	}
+	if !v.IsValid() {
+		// Nil pointers have nothing to check; required is for that.
+		return ""
+	}
+	if msg := r.checkBounds(v); msg != "" {
+		return msg
+	}
+	if isList(v) {
+		for i := 0; i < v.Len(); i++ {
+			if msg := r.checkElement(indirect(v.Index(i))); msg != "" {
+				return fmt.Sprintf("element %d: %s", i, msg)
+			}
+		}
+		return ""
+	}
+	return r.checkElement(v)
+}
+
+// checkBounds checks v against the min and max options.
+func (r *fieldRules) checkBounds(v reflect.Value) string {
+	if !r.hasMin && !r.hasMax {
+		return ""
+	}
+	var what string
+	var value, min, max float64
+	var err error
+	switch {
+	case v.Type() == durationType:
+		what = time.Duration(v.Int()).String()
+		value = float64(v.Int())
+		min, max, err = parseBounds(r, func(s string) (float64, error) {
+			d, err := time.ParseDuration(s)
+			return float64(d), err
+		})
+	case v.Kind() == reflect.String || isList(v) || v.Kind() == reflect.Map:
+		n := v.Len()
+		if v.Kind() == reflect.String {
+			n = utf8.RuneCountInString(v.String())
+		}
+		what = fmt.Sprintf("length %d", n)
+		value = float64(n)
+		min, max, err = parseBounds(r, func(s string) (float64, error) {
+			n, err := strconv.Atoi(s)
+			return float64(n), err
+		})
+	default:
+		n, ok := numberValue(v)
+		if !ok {
+			return fmt.Sprintf("min and max do not apply to %s", v.Type())
+		}
+		what = fmt.Sprint(v.Interface())
+		value = n
+		min, max, err = parseBounds(r, func(s string) (float64, error) {
+			return strconv.ParseFloat(s, 64)
+		})
+	}
+	switch {
+	case err != nil:
+		return fmt.Sprintf("invalid validation option: %v", err)
+	case r.hasMin && value < min:
+		return fmt.Sprintf("%s is less than the minimum %s", what, r.min)
+	case r.hasMax && value > max:
+		return fmt.Sprintf("%s is more than the maximum %s", what, r.max)
+	}
+	return ""
+}
+
+// parseBounds parses the min and max options of r with parse.
+func parseBounds(r *fieldRules, parse func(string) (float64, error)) (float64, float64, error) {
+	var min, max float64
+	var err error
+	if r.hasMin {
+		if min, err = parse(r.min); err != nil {
+			return 0, 0, fmt.Errorf("min=%s", r.min)
+		}
+	}
+	if r.hasMax {
+		if max, err = parse(r.max); err != nil {
+			return 0, 0, fmt.Errorf("max=%s", r.max)
+		}
+	}
+	return min, max, nil
+}
+
+// checkElement checks a single value against the enum and regex options.
+func (r *fieldRules) checkElement(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if r.enum != nil {
+		text := fmt.Sprint(v.Interface())
+		if !slices.Contains(r.enum, text) {
+			return fmt.Sprintf("%q is not one of %s", text, strings.Join(r.enum, ", "))
+		}
+	}
+	if r.regex != nil {
+		if v.Kind() != reflect.String {
+			return fmt.Sprintf("regex does not apply to %s", v.Type())
+		}
+		if !r.regex.MatchString(v.String()) {
+			return fmt.Sprintf("%q does not match %s", v.String(), r.regex)
+		}
+	}
+	return ""
+}
+
+// isList reports whether v is a slice or array other than bytes.
+func isList(v reflect.Value) bool {
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+// numberValue returns the value of a number of any Go type as a float64.
+func numberValue(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,122 @@
+package bulbason
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type validatedConfig struct {
+	Level   string        `bson:"level,enum=debug|info|warn"`
+	Port    int           `bson:"port,min=1,max=65535"`
+	Ratio   *float64      `bson:"ratio,min=0,max=1"`
+	Name    string        `bson:"name,min=3,regex=^[a-z]{1,8}$"`
+	Tags    []string      `bson:"tags,max=2,enum=a|b|c"`
+	Timeout time.Duration `bson:"timeout,max=1m"`
+	Server  struct {
+		Mode int `bson:"mode,enum=1|2"`
+	} `bson:"server"`
+}
+
+func TestUnmarshal_Validation(t *testing.T) {
+	valid := `BULBA!
+level ~> "info"
+port ~> 8080
+ratio ~> 0.5
+name ~> "bulba"
+tags ~> <| "a", "c" |>
+timeout ~> 30s
+(o) server (o)
+    mode ~> 2
+`
+	var cfg validatedConfig
+	if err := Unmarshal([]byte(valid), &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	invalid := `BULBA!
+level ~> "loud"
+port ~> 70000
+ratio ~> -1.0
+name ~> "Bu"
+tags ~> <| "a", "d" |>
+timeout ~> 2m
+(o) server (o)
+    mode ~> 3
+`
+	err := Unmarshal([]byte(invalid), &cfg)
+	var list ValidationErrors
+	if !errors.As(err, &list) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	expected := []string{
+		`bulbason: line 2: level: "loud" is not one of debug, info, warn`,
+		`bulbason: line 3: port: 70000 is more than the maximum 65535`,
+		`bulbason: line 4: ratio: -1 is less than the minimum 0`,
+		`bulbason: line 5: name: length 2 is less than the minimum 3`,
+		`bulbason: line 6: tags: element 1: "d" is not one of a, b, c`,
+		`bulbason: line 7: timeout: 2m0s is more than the maximum 1m`,
+		`bulbason: line 9: server.mode: "3" is not one of 1, 2`,
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), err)
+	}
+	for i, e := range list {
+		if e.Error() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], e.Error())
+		}
+	}
+	if list[1].Path != "port" || list[1].Line != 3 || list[1].Column != 1 {
+		t.Errorf("Unexpected location %+v", list[1])
+	}
+
+	// The values are decoded all the same.
+	if cfg.Port != 70000 {
+		t.Errorf("Expected the port to be decoded, got %d", cfg.Port)
+	}
+}
+
+func TestUnmarshal_ValidationRegex(t *testing.T) {
+	var cfg validatedConfig
+	err := Unmarshal([]byte("BULBA!\nname ~> \"bulbasaur\"\n"), &cfg)
+	if err == nil || !strings.Contains(err.Error(), `"bulbasaur" does not match ^[a-z]{1,8}$`) {
+		t.Errorf("Expected a regex error, got %v", err)
+	}
+
+	var bad struct {
+		Port  int    `bson:"port,min=low"`
+		Name  string `bson:"name,regex=[a-"`
+		Ratio bool   `bson:"ratio,max=1"`
+	}
+	err = Unmarshal([]byte("BULBA!\nport ~> 1\nname ~> \"a\"\nratio ~> SuperEffective\n"), &bad)
+	var list ValidationErrors
+	if !errors.As(err, &list) || len(list) != 3 {
+		t.Fatalf("Expected three errors, got %v", err)
+	}
+	for _, e := range list {
+		if !strings.Contains(e.Message, "invalid validation option") && !strings.Contains(e.Message, "do not apply") {
+			t.Errorf("Expected an invalid option, got %v", e)
+		}
+	}
+}
+
+func TestTagValue(t *testing.T) {
+	tag := `port,omitempty,min=1,regex=^\d{1,5}$,default=80`
+	tests := []struct{ opt, value string }{
+		{"min", "1"},
+		{"regex", `^\d{1,5}$`},
+		{"default", "80"},
+	}
+	for _, tt := range tests {
+		if value, ok := tagValue(tag, tt.opt); !ok || value != tt.value {
+			t.Errorf("Expected %s=%s, got %q, %v", tt.opt, tt.value, value, ok)
+		}
+	}
+	if _, ok := tagValue(tag, "max"); ok {
+		t.Error("Expected no max option")
+	}
+	if name, opts := parseTag(tag); name != "port" || opts != "omitempty,min=1" {
+		t.Errorf("Unexpected name %q and options %q", name, opts)
+	}
+}
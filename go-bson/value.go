@@ -0,0 +1,148 @@
+package bulbason
+
+import (
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// documentToMap evaluates a syntax tree into the data map returned by Parse.
+// Sections become nested maps, keys that appear twice are resolved with the
+// configured DuplicateKeyPolicy, and references are replaced by copies of the
+// values they refer to. A tree still holding includes is rejected.
+func documentToMap(doc *ast.Document, cfg *parseConfig) (map[string]interface{}, error) {
+	if err := checkIncludes(doc); err != nil {
+		return nil, err
+	}
+	m := bodyToMap(doc.Body, cfg)
+	if err := resolveReferences(m, cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// bodyToMap evaluates the entries of a document or section.
+func bodyToMap(body []ast.Entry, cfg *parseConfig) map[string]interface{} {
+	result := make(map[string]interface{})
+	var formes []*ast.Section
+	for _, entry := range body {
+		switch e := entry.(type) {
+		case *ast.Section:
+			if e.Forme != nil {
+				if cfg.profile != "" && e.Forme.Name == cfg.profile {
+					formes = append(formes, e)
+				}
+				continue
+			}
+			if _, exists := result[e.Name.Name]; exists && cfg.duplicateKeys == DuplicateFirstWins {
+				continue
+			}
+			result[e.Name.Name] = bodyToMap(e.Body, cfg)
+		case *ast.KeyValue:
+			if _, exists := result[e.Key.Name]; exists && cfg.duplicateKeys == DuplicateFirstWins {
+				continue
+			}
+			result[e.Key.Name] = evaluate(e.Value, cfg)
+		}
+	}
+
+	// The sections of the active profile go over the base, whatever the
+	// DuplicateKeyPolicy.
+	for _, s := range formes {
+		overlay := bodyToMap(s.Body, cfg)
+		if base, ok := result[s.Name.Name].(map[string]interface{}); ok {
+			mergeSection(base, overlay, MergeOptions{})
+		} else {
+			result[s.Name.Name] = overlay
+		}
+	}
+	return result
+}
+
+// evaluate converts a value node into its Go representation.
+func evaluate(v ast.Value, cfg *parseConfig) interface{} {
+	switch n := v.(type) {
+	case *ast.StringLit:
+		return n.Value
+	case *ast.NumberLit:
+		if cfg.useNumber {
+			return Number(n.Literal)
+		}
+		// The parser has already checked that the literal is a valid number.
+		num, _ := parseNumber(n.Literal, cfg.largeIntegers)
+		return num
+	case *ast.TimeLit:
+		// The lexer only emits timestamps that parse.
+		t, _ := time.Parse(time.RFC3339Nano, n.Literal)
+		return t
+	case *ast.DurationLit:
+		// The lexer only emits durations that parse.
+		d, _ := time.ParseDuration(n.Literal)
+		return d
+	case *ast.BytesLit:
+		// The lexer only emits valid base64.
+		b, _ := base64.StdEncoding.DecodeString(n.Literal)
+		return b
+	case *ast.BoolLit:
+		return n.Value
+	case *ast.DialectLit:
+		// The lexer only emits literals the dialect matches.
+		v, _ := cfg.dialect.match(n.Literal)
+		return v
+	case nil:
+		// A key without a value, accepted by the EmptyValues policy.
+		if cfg.emptyValues == EmptyValueString {
+			return ""
+		}
+		return nil
+	case *ast.ArrayLit:
+		// Multi-line arrays only ever hold sections, so they get a typed slice.
+		if n.Block {
+			var objects []map[string]interface{}
+			for _, elem := range n.Elements {
+				if obj, ok := elem.(*ast.ObjectLit); ok {
+					objects = append(objects, bodyToMap(obj.Body, cfg))
+				}
+			}
+			return objects
+		}
+		var arr []interface{}
+		for _, elem := range n.Elements {
+			arr = append(arr, evaluate(elem, cfg))
+		}
+		return arr
+	case *ast.ObjectLit:
+		return bodyToMap(n.Body, cfg)
+	case *ast.Reference:
+		// Resolved by documentToMap once the whole document is evaluated.
+		return &reference{node: n}
+	default:
+		return nil
+	}
+}
+
+// Number is a number literal as written in the document, with any digit
+// separators removed. It is returned instead of an int64 or float64 when the
+// UseNumber option is set.
+type Number string
+
+// String returns the literal text of the number.
+func (n Number) String() string {
+	return string(n)
+}
+
+// Int64 returns the number as an int64.
+func (n Number) Int64() (int64, error) {
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+// Float64 returns the number as a float64.
+func (n Number) Float64() (float64, error) {
+	if isNonFinite(string(n)) {
+		f, _ := parseNumber(string(n), LargeIntegerError)
+		return f.(float64), nil
+	}
+	return strconv.ParseFloat(string(n), 64)
+}
@@ -0,0 +1,202 @@
+package bulbason
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// Handler holds the callbacks Walk makes while it reads a document. Paths are
+// dotted key paths in the same form as DecodeError.Path, such as
+// "database.pool.max_connections" or "servers[0].host".
+//
+// Any callback may be nil. An error returned by a callback stops the walk
+// and is returned by Walk as is.
+type Handler struct {
+	// OnSectionStart is called for each section header, with the path of
+	// the section. The entries of the section follow.
+	OnSectionStart func(path string) error
+
+	// OnKeyValue is called for each key-value pair with its value, as Parse
+	// would return it. Inline arrays and objects are passed whole.
+	OnKeyValue func(path string, value interface{}) error
+
+	// OnArrayElement is called when an element of a multi-line array
+	// starts, with the path of the array and the index of the element. The
+	// entries of the element follow. Multi-line arrays are only reported
+	// through their elements, never through OnKeyValue.
+	OnArrayElement func(path string, index int) error
+}
+
+// Walk reads a document from r and reports its contents to h in document
+// order, without building the data map or syntax tree. It only holds the
+// current line and the sections enclosing it, so a few keys can be picked out
+// of a huge document cheaply.
+//
+// The document is checked as by Parse, except that DuplicateKeys has no
+// effect. Callbacks may already have been made for the part of the document
+// before an error. With CollectErrors, bad lines are skipped and reported
+// together once the walk is over.
+func Walk(r io.Reader, h Handler, opts ...ParseOption) error {
+	cfg := newParseConfig(opts)
+	w := &walker{
+		h:      h,
+		b:      newTreeBuilder(cfg),
+		paths:  make(map[*[]ast.Entry]string),
+		arrays: make(map[*ast.ArrayLit]*walkedArray),
+	}
+	w.paths[&w.b.doc.Body] = ""
+
+	var lexErrs ErrorList
+	var line []Token
+	l := newLexer(r, cfg)
+	for {
+		tok, err := l.Next()
+		// The lexer hands out whole lines, so an error or a new line number
+		// means the current line is complete.
+		if len(line) > 0 && (err != nil || tok.Line != line[0].Line || tok.Type == TOKEN_EOF) {
+			w.b.cfg = l.cfg // Set by the version of the header
+			if err := w.line(line); err != nil {
+				return err
+			}
+			line = line[:0]
+		}
+		if err != nil {
+			pe, ok := err.(*ParseError)
+			if !ok || !cfg.collectErrors {
+				return err
+			}
+			lexErrs = append(lexErrs, pe)
+			continue
+		}
+		if tok.Type == TOKEN_EOF {
+			break
+		}
+		line = append(line, tok)
+	}
+
+	_, err := w.b.finish()
+	if len(lexErrs) > 0 || err != nil {
+		return mergeErrors(lexErrs, err)
+	}
+	return nil
+}
+
+// walker reports the entries a treeBuilder adds, line by line, and then
+// drops them so the tree never grows.
+type walker struct {
+	h      Handler
+	b      *treeBuilder
+	paths  map[*[]ast.Entry]string // Path of each body on the builder's stack
+	arrays map[*ast.ArrayLit]*walkedArray
+}
+
+// walkedArray is the state of an open multi-line array.
+type walkedArray struct {
+	path string
+	next int // Index of the next element
+	kept int // Elements already reported but kept in the array
+}
+
+// line parses the tokens of one source line and reports what they added.
+func (w *walker) line(tokens []Token) error {
+	b := w.b
+	b.tokens, b.i = tokens, 0
+	errCount := len(b.errs)
+	for b.i < len(tokens) {
+		if err := b.step(); err != nil {
+			attachSnippet(err, tokens)
+			return err
+		}
+	}
+	for _, pe := range b.errs[errCount:] {
+		attachSnippet(pe, tokens)
+	}
+
+	for _, body := range b.stack {
+		for _, entry := range *body {
+			if err := w.report(w.paths[body], entry); err != nil {
+				return err
+			}
+		}
+	}
+	for _, block := range b.blocks {
+		arr := block.array
+		state := w.arrays[arr]
+		for _, elem := range arr.Elements[state.kept:] {
+			index := state.next
+			state.next++
+			w.paths[&elem.(*ast.ObjectLit).Body] = indexPath(state.path, index)
+			if w.h.OnArrayElement != nil {
+				if err := w.h.OnArrayElement(state.path, index); err != nil {
+					return err
+				}
+			}
+		}
+		// The last element stays, as the builder checks that there is one.
+		if len(arr.Elements) > 0 {
+			arr.Elements = arr.Elements[len(arr.Elements)-1:]
+			state.kept = 1
+		}
+	}
+
+	w.forget()
+	return nil
+}
+
+// report makes the callback for an entry added to the body at path.
+func (w *walker) report(path string, entry ast.Entry) error {
+	switch e := entry.(type) {
+	case *ast.Section:
+		if e.Forme != nil {
+			return fmt.Errorf("bulbason: line %d: profiles are not resolved by Walk", e.Header.Start.Line)
+		}
+		path = joinPath(path, e.Name.Name)
+		w.paths[&e.Body] = path
+		if w.h.OnSectionStart != nil {
+			return w.h.OnSectionStart(path)
+		}
+	case *ast.KeyValue:
+		path = joinPath(path, e.Key.Name)
+		if arr, ok := e.Value.(*ast.ArrayLit); ok && arr.Block {
+			w.arrays[arr] = &walkedArray{path: path}
+			return nil
+		}
+		if ref := firstReference(e.Value); ref != nil {
+			return fmt.Errorf("bulbason: line %d: references are not resolved by Walk", ref.Loc.Start.Line)
+		}
+		if w.h.OnKeyValue != nil {
+			return w.h.OnKeyValue(path, evaluate(e.Value, w.b.cfg))
+		}
+	case *ast.Include:
+		return includeError(e, errors.New("includes are not resolved by Walk"))
+	}
+	return nil
+}
+
+// forget empties the bodies on the builder's stack and drops the state of
+// bodies and arrays that are no longer open.
+func (w *walker) forget() {
+	open := make(map[*[]ast.Entry]bool, len(w.b.stack))
+	for _, body := range w.b.stack {
+		*body = (*body)[:0]
+		open[body] = true
+	}
+	for body := range w.paths {
+		if !open[body] {
+			delete(w.paths, body)
+		}
+	}
+
+	blocks := make(map[*ast.ArrayLit]bool, len(w.b.blocks))
+	for _, block := range w.b.blocks {
+		blocks[block.array] = true
+	}
+	for arr := range w.arrays {
+		if !blocks[arr] {
+			delete(w.arrays, arr)
+		}
+	}
+}
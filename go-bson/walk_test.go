@@ -0,0 +1,147 @@
+package bulbason
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	input := `BULBA!
+app_name ~~> "Pokedex_API"
+zZz Level 1
+(o) database (o)
+    host ~~> "127.0.0.1"
+    (O) pool (O)
+        max ~~> 10
+    tags ~~> <| "a", "b" |>
+servers ~~> <|
+(o)
+    host ~~> "alpha"
+(o)
+    host ~~> "beta"
+    (O) limits (O)
+        rps ~~> 5
+    port ~~> 8081
+|>
+done ~~> SuperEffective
+`
+	var events []string
+	h := Handler{
+		OnSectionStart: func(path string) error {
+			events = append(events, "section "+path)
+			return nil
+		},
+		OnKeyValue: func(path string, value interface{}) error {
+			events = append(events, fmt.Sprintf("%s = %v", path, value))
+			return nil
+		},
+		OnArrayElement: func(path string, index int) error {
+			events = append(events, fmt.Sprintf("element %s %d", path, index))
+			return nil
+		},
+	}
+	if err := Walk(strings.NewReader(input), h); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"app_name = Pokedex_API",
+		"section database",
+		"database.host = 127.0.0.1",
+		"section database.pool",
+		"database.pool.max = 10",
+		"database.tags = [a b]",
+		"element servers 0",
+		"servers[0].host = alpha",
+		"element servers 1",
+		"servers[1].host = beta",
+		"section servers[1].limits",
+		"servers[1].limits.rps = 5",
+		"servers[1].port = 8081",
+		"done = true",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(events, "\n"))
+	}
+}
+
+func TestWalk_Stop(t *testing.T) {
+	stop := errors.New("found it")
+	var seen []string
+	h := Handler{
+		OnKeyValue: func(path string, value interface{}) error {
+			seen = append(seen, path)
+			if path == "b" {
+				return stop
+			}
+			return nil
+		},
+	}
+	err := Walk(strings.NewReader("BULBA!\na ~> 1\nb ~> 2\nc ~> 3\n"), h)
+	if err != stop {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+	if !reflect.DeepEqual(seen, []string{"a", "b"}) {
+		t.Errorf("Expected the walk to stop at b, saw %v", seen)
+	}
+}
+
+func TestWalk_Errors(t *testing.T) {
+	var seen []string
+	h := Handler{
+		OnKeyValue: func(path string, value interface{}) error {
+			seen = append(seen, path)
+			return nil
+		},
+	}
+	err := Walk(strings.NewReader("BULBA!\na ~> 1\n  b ~> 2\nc ~> <|\n"), h)
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Code != CodeIndentation || pe.Line != 3 || pe.Snippet != "  b ~> 2" {
+		t.Errorf("Expected an indentation error on line 3, got %v", err)
+	}
+	if !reflect.DeepEqual(seen, []string{"a"}) {
+		t.Errorf("Expected only a before the error, saw %v", seen)
+	}
+
+	seen = nil
+	err = Walk(strings.NewReader("BULBA!\na ~> 1\n  b ~> 2\nCharizard ~> 3\nc ~> 4\n"), h, CollectErrors())
+	list, ok := err.(ErrorList)
+	if !ok || len(list) != 2 || list[0].Line != 3 || list[1].Code != CodeReservedKey {
+		t.Errorf("Expected two collected errors, got %v", err)
+	}
+	if !reflect.DeepEqual(seen, []string{"a", "c"}) {
+		t.Errorf("Expected a and c, saw %v", seen)
+	}
+}
+
+// FuzzWalk checks that Walk accepts exactly the documents Parse accepts. The
+// errors may differ, as Parse reports errors from the lexer first and Walk
+// reports them in document order.
+func FuzzWalk(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		_, parseErr := Parse(input)
+		walkErr := Walk(strings.NewReader(input), Handler{})
+		if (parseErr == nil) != (walkErr == nil) {
+			t.Fatalf("Parse and Walk disagree:\n%#v\n%#v", parseErr, walkErr)
+		}
+	})
+}
+
+func TestWalk_Unresolved(t *testing.T) {
+	err := Walk(strings.NewReader("BULBA!\nTransform \"shared.bson\"\n"), Handler{})
+	var ie *IncludeError
+	if !errors.As(err, &ie) || ie.Path != "shared.bson" {
+		t.Errorf("Expected an IncludeError, got %v", err)
+	}
+
+	err = Walk(strings.NewReader("BULBA!\nport ~> Copycat base.port\n"), Handler{})
+	if err == nil || !strings.Contains(err.Error(), "references are not resolved") {
+		t.Errorf("Expected references to be rejected, got %v", err)
+	}
+}
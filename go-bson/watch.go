@@ -0,0 +1,258 @@
+package bulbason
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// WatchOptions configures a Watcher. The zero value accepts any valid
+// document, and checks the file every second where it has to be polled.
+type WatchOptions struct {
+	// Interval is how often the file is checked for changes where the file
+	// system does not report them.
+	Interval time.Duration
+	// Schema, if set, is checked with ValidateSchema before a new version of
+	// the document is accepted.
+	Schema *ast.Document
+	// ParseOptions are passed to Parse.
+	ParseOptions []ParseOption
+}
+
+// defaultWatchInterval is the Interval of WatchOptions left unset.
+const defaultWatchInterval = time.Second
+
+// Watcher keeps a configuration file loaded, reloading it when it changes,
+// so services can pick up new settings without restarting.
+//
+// On Linux the file is checked whenever inotify reports a change to its
+// directory, which catches the renames editors and config management tools
+// write files with. Where inotify is missing, or the watch ends because the
+// directory is removed, the file is polled every WatchOptions.Interval
+// instead. Each new version is parsed and, if WatchOptions.Schema is set, validated.
+// A valid version replaces the current document atomically and is sent on
+// Updates; an invalid one is reported on Errors and the current document is
+// kept, so a bad edit never takes a service down.
+type Watcher struct {
+	path    string
+	opts    WatchOptions
+	current atomic.Pointer[Document]
+	updates chan Document
+	errors  chan error
+
+	// last holds the contents of the current version, and lastErr the text
+	// of the last error reported, so that it is not reported again on every
+	// check.
+	last    []byte
+	lastErr string
+	modTime time.Time
+	size    int64
+
+	// events receives a value when the file may have changed, and is nil
+	// while the file is polled.
+	events     <-chan struct{}
+	stopEvents func()
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWatcher loads the file at path and starts watching it. It returns an
+// error, and watches nothing, if the file cannot be read, parsed or
+// validated. Call Close to stop watching.
+func NewWatcher(path string, opts WatchOptions) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultWatchInterval
+	}
+	w := &Watcher{
+		path:    path,
+		opts:    opts,
+		updates: make(chan Document, 1),
+		errors:  make(chan error, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	// Watching starts before the first read, so that no change is missed.
+	events, stopEvents, err := watchEvents(path)
+	if err == nil {
+		w.events, w.stopEvents = events, stopEvents
+	}
+	doc, info, data, err := w.first()
+	if err != nil {
+		if w.stopEvents != nil {
+			w.stopEvents()
+		}
+		return nil, err
+	}
+	w.current.Store(&doc)
+	w.last, w.modTime, w.size = data, info.ModTime(), info.Size()
+
+	go w.run()
+	return w, nil
+}
+
+// first reads, parses and validates the file as NewWatcher finds it.
+func (w *Watcher) first() (Document, os.FileInfo, []byte, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	doc, err := w.load(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return doc, info, data, nil
+}
+
+// Current returns the last valid version of the document. It is shared with
+// other callers, so it must not be modified.
+func (w *Watcher) Current() Document {
+	return *w.current.Load()
+}
+
+// Updates returns the channel each new valid version of the document is sent
+// on. Only the latest version is kept for a slow receiver, which never
+// blocks the watcher. The channel is closed by Close.
+func (w *Watcher) Updates() <-chan Document {
+	return w.updates
+}
+
+// Errors returns the channel on which the watcher reports versions of the
+// file it could not read, parse or validate. As with Updates only the latest
+// error is kept, and the channel is closed by Close.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Close stops watching the file and closes the Updates and Errors channels.
+// Current keeps returning the last valid document.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+		<-w.done
+		close(w.updates)
+		close(w.errors)
+	})
+	return nil
+}
+
+// run checks the file after each change reported by watchEvents, or every
+// interval while polling, until the watcher is closed.
+func (w *Watcher) run() {
+	defer close(w.done)
+	if w.stopEvents != nil {
+		defer w.stopEvents()
+	}
+	// Only one of w.events and tick is set, as a nil channel is never ready.
+	var ticker *time.Ticker
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	var tick <-chan time.Time
+	if w.events == nil {
+		ticker = time.NewTicker(w.opts.Interval)
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-w.stop:
+			return
+		case _, ok := <-w.events:
+			if !ok {
+				// The watch ended; poll from now on, starting with a check
+				// for the change that ended it.
+				w.events = nil
+				ticker = time.NewTicker(w.opts.Interval)
+				tick = ticker.C
+			}
+			w.check(true)
+		case <-tick:
+			w.check(false)
+		}
+	}
+}
+
+// check reloads the file if it changed since the last check. A file whose
+// modification time and size are unchanged is only read after an event, as
+// a write within the time resolution of the file system keeps both.
+func (w *Watcher) check(event bool) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		w.report(err)
+		return
+	}
+	if !event && info.ModTime().Equal(w.modTime) && info.Size() == w.size && w.lastErr == "" {
+		return
+	}
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		w.report(err)
+		return
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+	if bytes.Equal(data, w.last) {
+		// Touched, or rewritten with the same contents.
+		w.lastErr = ""
+		return
+	}
+
+	doc, err := w.load(data)
+	if err != nil {
+		w.report(err)
+		return
+	}
+	w.last, w.lastErr = data, ""
+	w.current.Store(&doc)
+	sendLatest(w.updates, doc)
+}
+
+// load parses and validates a version of the file.
+func (w *Watcher) load(data []byte) (Document, error) {
+	m, err := Parse(string(data), w.opts.ParseOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if w.opts.Schema != nil {
+		if err := ValidateSchema(m, w.opts.Schema); err != nil {
+			return nil, err
+		}
+	}
+	return Document(m), nil
+}
+
+// report sends err on the Errors channel, unless it was the last error sent.
+func (w *Watcher) report(err error) {
+	if err.Error() == w.lastErr {
+		return
+	}
+	w.lastErr = err.Error()
+	sendLatest(w.errors, err)
+}
+
+// sendLatest sends v on ch, a channel buffering one value, replacing the
+// value still waiting there if any.
+func sendLatest[T any](ch chan T, v T) {
+	for {
+		select {
+		case ch <- v:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package bulbason
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// watchEvents asks inotify to report changes to the directory holding path,
+// rather than to the file itself, so that the watch survives the renames
+// editors save files with and the symlink swaps of Kubernetes ConfigMaps.
+// The returned channel receives a value after changes, several of which may
+// be folded into one, and is closed if the watch ends, as when the directory
+// is removed. Calling stop ends the watch.
+func watchEvents(path string) (events <-chan struct{}, stop func(), err error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("inotify_init1", err)
+	}
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), mask); err != nil {
+		syscall.Close(fd)
+		return nil, nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// A non-blocking descriptor is read through the runtime poller, so that
+	// closing the file interrupts a pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		var buf [4096]byte
+		for {
+			n, err := f.Read(buf[:])
+			if err != nil {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				if event.Mask&syscall.IN_IGNORED != 0 {
+					return
+				}
+				off += syscall.SizeofInotifyEvent + int(event.Len)
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, func() { f.Close() }, nil
+}
@@ -0,0 +1,69 @@
+package bulbason
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher_Events(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.bson")
+	writeConfig(t, path, "BULBA!\nport ~> 8080\n", time.Now().Add(-time.Hour))
+
+	// Polling once an hour, only an event can bring the changes in time.
+	w, err := NewWatcher(path, WatchOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer w.Close()
+
+	// Editors save by writing a new file and renaming it over the old one.
+	tmp := filepath.Join(dir, "config.bson.swp")
+	for _, port := range []int64{9090, 7070} {
+		content := fmt.Sprintf("BULBA!\nport ~> %d\n", port)
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case doc := <-w.Updates():
+			if n := doc.GetIntOr("port", 0); n != port {
+				t.Errorf("Expected %d, got %d", port, n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for port %d", port)
+		}
+	}
+}
+
+func TestWatchEvents_DirectoryRemoved(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "conf")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	events, stop, err := watchEvents(filepath.Join(dir, "config.bson"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stop()
+
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected the events to end with the directory")
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package bulbason
+
+import "errors"
+
+// watchEvents reports that changes cannot be watched for on this platform,
+// where a Watcher polls the file instead.
+func watchEvents(path string) (events <-chan struct{}, stop func(), err error) {
+	return nil, nil, errors.ErrUnsupported
+}
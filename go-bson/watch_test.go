@@ -0,0 +1,86 @@
+package bulbason
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file, moving its modification time forward so
+// that the change is seen whatever the file system's time resolution.
+func writeConfig(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.bson")
+	start := time.Now().Add(-time.Hour)
+	writeConfig(t, path, "BULBA!\nport ~> 8080\n", start)
+
+	schema, err := ParseAST("BULBA!\nport ~> \"int!\"\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w, err := NewWatcher(path, WatchOptions{Interval: 5 * time.Millisecond, Schema: schema})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer w.Close()
+	if n := w.Current().GetIntOr("port", 0); n != 8080 {
+		t.Fatalf("Expected 8080, got %d", n)
+	}
+
+	writeConfig(t, path, "BULBA!\nport ~> 9090\n", start.Add(time.Second))
+	select {
+	case doc := <-w.Updates():
+		if n := doc.GetIntOr("port", 0); n != 9090 {
+			t.Errorf("Expected 9090, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the update")
+	}
+	if n := w.Current().GetIntOr("port", 0); n != 9090 {
+		t.Errorf("Expected the current document to be swapped, got %d", n)
+	}
+
+	writeConfig(t, path, "BULBA!\nport ~> \"9090\"\n", start.Add(2*time.Second))
+	select {
+	case err := <-w.Errors():
+		var schemaErr *SchemaError
+		if !errors.As(err, &schemaErr) || schemaErr.Path != "port" {
+			t.Errorf("Expected a schema error for port, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the error")
+	}
+	if n := w.Current().GetIntOr("port", 0); n != 9090 {
+		t.Errorf("Expected the invalid version to be ignored, got %d", n)
+	}
+
+	w.Close()
+	if _, ok := <-w.Updates(); ok {
+		t.Errorf("Expected Updates to be closed")
+	}
+}
+
+func TestNewWatcher_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewWatcher(filepath.Join(dir, "missing.bson"), WatchOptions{}); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+
+	path := filepath.Join(dir, "config.bson")
+	writeConfig(t, path, "port ~> 8080\n", time.Now())
+	var parseErr *ParseError
+	if _, err := NewWatcher(path, WatchOptions{}); !errors.As(err, &parseErr) {
+		t.Errorf("Expected a ParseError, got %v", err)
+	}
+}
@@ -0,0 +1,757 @@
+package bulbason
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kubabialy/BulbaSaur-Object-Notation/go-bson/ast"
+)
+
+// ToYAML converts a document to YAML, keeping the order of its entries.
+//
+// Sections and objects become mappings and arrays become sequences. Strings
+// spanning several lines are written as literal block scalars, timestamps as
+// YAML timestamps and byte strings with the !!binary tag. Durations, which
+// YAML has no type for, become strings. A key without a value becomes null.
+// When a key appears more than once, the last value wins, as with Parse.
+func ToYAML(doc *ast.Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if len(doc.Body) == 0 {
+		buf.WriteString("{}\n")
+		return buf.Bytes(), nil
+	}
+	if err := writeYAMLMapping(&buf, doc.Body, "", "", ""); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeYAMLMapping writes the entries of a body at path as a block mapping.
+// Entries are indented by indent, except the first, which follows first so
+// that a mapping can start on the line of a sequence item's dash.
+func writeYAMLMapping(buf *bytes.Buffer, body []ast.Entry, first, indent, path string) error {
+	last := make(map[string]int, len(body))
+	for i, entry := range body {
+		last[entryName(entry)] = i
+	}
+
+	prefix := first
+	for i, entry := range body {
+		name := entryName(entry)
+		if last[name] != i {
+			continue
+		}
+		buf.WriteString(prefix + yamlString(name) + ":")
+		prefix = indent
+
+		var value ast.Value
+		switch e := entry.(type) {
+		case *ast.Section:
+			if e.Forme != nil {
+				return formeError(e, joinPath(path, name), "YAML")
+			}
+			value = &ast.ObjectLit{Body: e.Body}
+		case *ast.KeyValue:
+			value = e.Value
+		default:
+			return fmt.Errorf("bulbason: cannot convert node of type %T to YAML", entry)
+		}
+		if err := writeYAMLValue(buf, value, indent, joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeYAMLValue writes the value of a key whose line has been started at
+// indent, and ends the line. Nested collections are indented one step further.
+func writeYAMLValue(buf *bytes.Buffer, v ast.Value, indent, path string) error {
+	inner := indent + "  "
+	switch n := v.(type) {
+	case *ast.ObjectLit:
+		if len(n.Body) == 0 {
+			buf.WriteString(" {}\n")
+			return nil
+		}
+		buf.WriteByte('\n')
+		return writeYAMLMapping(buf, n.Body, inner, inner, path)
+	case *ast.ArrayLit:
+		if len(n.Elements) == 0 {
+			buf.WriteString(" []\n")
+			return nil
+		}
+		buf.WriteByte('\n')
+		for i, elem := range n.Elements {
+			if err := writeYAMLItem(buf, elem, inner, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	scalar, err := yamlScalar(v, inner, path)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(" " + scalar + "\n")
+	return nil
+}
+
+// writeYAMLItem writes an element of a sequence whose dashes are at indent.
+func writeYAMLItem(buf *bytes.Buffer, v ast.Value, indent, path string) error {
+	inner := indent + "  "
+	switch n := v.(type) {
+	case *ast.ObjectLit:
+		if len(n.Body) == 0 {
+			buf.WriteString(indent + "- {}\n")
+			return nil
+		}
+		return writeYAMLMapping(buf, n.Body, indent+"- ", inner, path)
+	case *ast.ArrayLit:
+		return fmt.Errorf("bulbason: cannot convert %s to YAML, arrays cannot be nested", path)
+	}
+	scalar, err := yamlScalar(v, inner, path)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(indent + "- " + scalar + "\n")
+	return nil
+}
+
+// yamlScalar returns the YAML form of a value that is not a collection. The
+// lines of a block scalar are indented by indent.
+func yamlScalar(v ast.Value, indent, path string) (string, error) {
+	switch n := v.(type) {
+	case *ast.StringLit:
+		if block, ok := yamlBlockScalar(n.Value, indent); ok {
+			return block, nil
+		}
+		return yamlString(n.Value), nil
+	case *ast.NumberLit:
+		switch n.Literal {
+		case literalInf:
+			return ".inf", nil
+		case literalNegInf:
+			return "-.inf", nil
+		case literalNaN:
+			return ".nan", nil
+		}
+		return n.Literal, nil
+	case *ast.TimeLit:
+		return n.Literal, nil
+	case *ast.DurationLit:
+		return yamlString(n.Literal), nil
+	case *ast.BytesLit:
+		return "!!binary " + n.Literal, nil
+	case *ast.BoolLit:
+		return strconv.FormatBool(n.Value), nil
+	case *ast.NullLit, nil:
+		return "null", nil
+	}
+	return "", fmt.Errorf("bulbason: cannot convert %s of type %T to YAML", path, v)
+}
+
+// yamlBlockScalar returns s as a literal block scalar with its lines indented
+// by indent, if s spans several lines and can be written that way.
+func yamlBlockScalar(s, indent string) (string, bool) {
+	body, chomp := s, "|-"
+	if strings.HasSuffix(s, "\n") {
+		body, chomp = s[:len(s)-1], "|"
+	}
+	if !strings.Contains(body, "\n") || strings.HasSuffix(body, "\n") || strings.HasPrefix(body, " ") {
+		return "", false
+	}
+	for _, r := range body {
+		if r != '\n' && !unicode.IsPrint(r) {
+			return "", false
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(chomp)
+	for _, line := range strings.Split(body, "\n") {
+		sb.WriteByte('\n')
+		if line != "" {
+			sb.WriteString(indent + line)
+		}
+	}
+	return sb.String(), true
+}
+
+// yamlString returns s as a plain scalar if a YAML reader would take it for
+// the same string, and double-quoted otherwise.
+func yamlString(s string) string {
+	if isPlainYAML(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// isPlainYAML reports whether s can be written as a plain scalar. It errs on
+// the side of quoting: s must start with a letter, hold no characters with a
+// meaning in YAML, and not read as a null or boolean in YAML 1.1 or 1.2.
+func isPlainYAML(s string) bool {
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) || strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") {
+		return false
+	}
+	if strings.ContainsAny(s, "#,[]{}\"'`\\") || strings.Contains(s, ": ") {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	switch strings.ToLower(s) {
+	case "null", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return false
+	}
+	return true
+}
+
+// FromYAML converts a YAML document whose root is a mapping to a document,
+// keeping the order of its keys, ready to be written with Encoder.EncodeAST.
+//
+// Mappings become sections and sequences become arrays, following the same
+// rules as FromJSON. Plain scalars are resolved as in YAML 1.2: null, ~,
+// true, false, decimal, hex and octal integers, floats including .inf and
+// .nan, and RFC 3339 timestamps keep their type, anything else is a string.
+// The !!binary tag gives a byte string.
+//
+// Only the block and flow styles in common use are read. Anchors, aliases,
+// other tags, complex keys and multi-line plain or quoted scalars are
+// rejected, as is anything BSON has no form for, such as nested sequences.
+// Errors name the line and, where it helps, the path.
+func FromYAML(data []byte) (*ast.Document, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	indent, text, ok := p.peek()
+	if ok && text == "---" {
+		p.i++
+		indent, _, ok = p.peek()
+	}
+	if !ok {
+		return &ast.Document{}, nil
+	}
+
+	root, err := p.block(indent, "")
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := root.(*ast.ObjectLit)
+	if !ok {
+		return nil, fmt.Errorf("bulbason: cannot convert YAML to a document, expected a mapping")
+	}
+	if _, text, ok := p.peek(); ok {
+		if text == "---" {
+			return nil, p.errorf("only a single document can be converted")
+		}
+		if text != "..." {
+			return nil, p.errorf("unexpected indentation")
+		}
+	}
+	return &ast.Document{Body: sectionsFromObjects(obj.Body)}, nil
+}
+
+// yamlParser reads a YAML document line by line. Values are read in the
+// inline form of FromJSON, objects being *ast.ObjectLit throughout.
+type yamlParser struct {
+	lines []string
+	i     int // Index of the next line to read
+	line  int // Number of the line last looked at, for errors
+}
+
+// errorf returns an error located at the line last looked at.
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("bulbason: cannot convert YAML line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// peek skips blank and comment lines, and returns the indentation and the
+// content of the next line, without its comment.
+func (p *yamlParser) peek() (int, string, bool) {
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		content := strings.TrimLeft(line, " ")
+		text := strings.TrimRight(stripYAMLComment(content), " \t")
+		if text == "" {
+			continue
+		}
+		p.line = p.i + 1
+		return len(line) - len(content), text, true
+	}
+	return 0, "", false
+}
+
+// block reads the collection or scalar whose first line is at indent.
+func (p *yamlParser) block(indent int, path string) (ast.Value, error) {
+	_, text, _ := p.peek()
+	if strings.HasPrefix(text, "\t") {
+		return nil, p.errorf("tabs cannot be used for indentation")
+	}
+	if isYAMLItem(text) {
+		return p.sequence(indent, path)
+	}
+	if _, _, ok := splitYAMLKey(text); ok {
+		return p.mapping(indent, path)
+	}
+	p.i++
+	return p.value(indent, text, path)
+}
+
+// mapping reads a block mapping whose keys are at indent.
+func (p *yamlParser) mapping(indent int, path string) (ast.Value, error) {
+	obj := &ast.ObjectLit{Inline: true}
+	for {
+		ind, text, ok := p.peek()
+		if !ok || ind < indent {
+			return obj, nil
+		}
+		if ind > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, rest, ok := splitYAMLKey(text)
+		if !ok {
+			if text == "---" || text == "..." {
+				return obj, nil
+			}
+			return nil, p.errorf("expected a key")
+		}
+		keyPath := joinPath(path, key)
+		if key == "<<" || key == "?" {
+			return nil, p.errorf("merge keys and complex keys are not supported")
+		}
+		if _, err := encodeKey(key); err != nil {
+			return nil, p.errorf("%q is not a valid key", key)
+		}
+		p.i++
+
+		var value ast.Value
+		var err error
+		if rest == "" {
+			value, err = p.nested(indent, true, keyPath)
+		} else {
+			value, err = p.value(indent, rest, keyPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		obj.Body = append(obj.Body, &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: value})
+	}
+}
+
+// sequence reads a block sequence whose dashes are at indent.
+func (p *yamlParser) sequence(indent int, path string) (ast.Value, error) {
+	arr := &ast.ArrayLit{}
+	for {
+		ind, text, ok := p.peek()
+		if !ok || ind < indent || ind == indent && !isYAMLItem(text) {
+			return arr, nil
+		}
+		if ind > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		elemPath := indexPath(path, len(arr.Elements))
+		rest := strings.TrimLeft(text[1:], " ")
+
+		var elem ast.Value
+		var err error
+		switch _, _, isKey := splitYAMLKey(rest); {
+		case rest == "":
+			p.i++
+			elem, err = p.nested(indent, false, elemPath)
+		case isYAMLItem(rest):
+			return nil, p.errorf("cannot convert %s, arrays cannot be nested", elemPath)
+		case isKey:
+			// A mapping starting on the line of the dash carries on at the
+			// column of its first key.
+			col := indent + len(text) - len(rest)
+			p.lines[p.i] = strings.Repeat(" ", col) + rest
+			elem, err = p.mapping(col, elemPath)
+		default:
+			p.i++
+			elem, err = p.value(indent, rest, elemPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := elem.(*ast.ArrayLit); ok {
+			return nil, p.errorf("cannot convert %s, arrays cannot be nested", elemPath)
+		}
+		arr.Elements = append(arr.Elements, elem)
+	}
+}
+
+// nested reads the value of a key or sequence item at indent that has
+// nothing after its colon or dash: a block on the following lines, or null.
+// The value of a key may be a sequence whose dashes are at the key's own
+// indentation.
+func (p *yamlParser) nested(indent int, isKey bool, path string) (ast.Value, error) {
+	ind, text, ok := p.peek()
+	switch {
+	case ok && ind > indent:
+		return p.block(ind, path)
+	case ok && ind == indent && isKey && isYAMLItem(text):
+		return p.sequence(ind, path)
+	}
+	return &ast.NullLit{}, nil
+}
+
+// value reads the text after the colon of a key, or the dash of a sequence
+// item, at indent.
+func (p *yamlParser) value(indent int, text, path string) (ast.Value, error) {
+	switch {
+	case text[0] == '|' || text[0] == '>':
+		return p.blockScalar(indent, text)
+	case text[0] == '&' || text[0] == '*':
+		return nil, p.errorf("anchors and aliases are not supported")
+	case strings.HasPrefix(text, "!!binary "):
+		literal := strings.TrimSpace(text[len("!!binary "):])
+		if _, err := base64.StdEncoding.DecodeString(literal); err != nil {
+			return nil, p.errorf("invalid !!binary data")
+		}
+		return &ast.BytesLit{Literal: literal}, nil
+	case text[0] == '!':
+		return nil, p.errorf("tags other than !!binary are not supported")
+	case text[0] == '[' || text[0] == '{':
+		f := &yamlFlow{p: p, s: text}
+		v, err := f.value(path)
+		if err != nil {
+			return nil, err
+		}
+		if f.skipSpace(); f.i < len(f.s) {
+			return nil, p.errorf("unexpected %q after %c", f.s[f.i:], text[0])
+		}
+		return v, nil
+	case text[0] == '"' || text[0] == '\'':
+		s, n, err := yamlQuoted(text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if strings.TrimSpace(text[n:]) != "" {
+			return nil, p.errorf("unexpected %q after a quoted string", strings.TrimSpace(text[n:]))
+		}
+		return &ast.StringLit{Value: s}, nil
+	}
+	if ind, next, ok := p.peek(); ok && ind > indent {
+		if _, _, isKey := splitYAMLKey(next); isKey || isYAMLItem(next) {
+			return nil, p.errorf("unexpected indentation")
+		}
+		return nil, p.errorf("multi-line plain scalars are not supported")
+	}
+	return resolveYAMLScalar(text), nil
+}
+
+// blockScalar reads a literal (|) or folded (>) block scalar with the given
+// header, whose lines are indented more than indent.
+func (p *yamlParser) blockScalar(indent int, header string) (ast.Value, error) {
+	style, chomp := header[0], header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, p.errorf("unsupported block scalar header %q", header)
+	}
+
+	var lines []string
+	contentIndent := -1
+	for ; p.i < len(p.lines); p.i++ {
+		line := strings.TrimRight(p.lines[p.i], " ")
+		content := strings.TrimLeft(line, " ")
+		if content == "" {
+			lines = append(lines, "")
+			continue
+		}
+		ind := len(line) - len(content)
+		if ind <= indent {
+			break
+		}
+		if contentIndent == -1 {
+			contentIndent = ind
+		}
+		if ind < contentIndent {
+			p.line = p.i + 1
+			return nil, p.errorf("block scalar lines must be indented at least as much as the first")
+		}
+		lines = append(lines, line[contentIndent:])
+	}
+
+	// Trailing blank lines only count for the keep indicator.
+	content := len(lines)
+	for content > 0 && lines[content-1] == "" {
+		content--
+	}
+	var text string
+	if style == '|' {
+		text = strings.Join(lines[:content], "\n")
+	} else {
+		text = foldYAMLLines(lines[:content])
+	}
+	switch {
+	case content == 0:
+	case chomp == "":
+		text += "\n"
+	case chomp == "+":
+		text += strings.Repeat("\n", len(lines)-content+1)
+	}
+	return &ast.StringLit{Value: text}, nil
+}
+
+// foldYAMLLines joins the lines of a folded block scalar: lines are joined
+// with spaces, each blank line becomes a line break, and more indented lines
+// keep their line breaks.
+func foldYAMLLines(lines []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case line == "":
+				sb.WriteByte('\n')
+			case prev == "":
+				// The blank lines before stand for the line break.
+			case strings.HasPrefix(line, " ") || strings.HasPrefix(prev, " "):
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// yamlFlow reads a flow collection such as [a, b] or {a: 1}, which must fit
+// on one line.
+type yamlFlow struct {
+	p *yamlParser
+	s string
+	i int
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+// value reads the flow node at the current position.
+func (f *yamlFlow) value(path string) (ast.Value, error) {
+	f.skipSpace()
+	if f.i == len(f.s) {
+		return nil, f.p.errorf("unexpected end of line, flow collections must fit on one line")
+	}
+	switch c := f.s[f.i]; c {
+	case '[':
+		f.i++
+		arr := &ast.ArrayLit{}
+		err := f.each(']', func() error {
+			elemPath := indexPath(path, len(arr.Elements))
+			elem, err := f.value(elemPath)
+			if err != nil {
+				return err
+			}
+			if _, ok := elem.(*ast.ArrayLit); ok {
+				return f.p.errorf("cannot convert %s, arrays cannot be nested", elemPath)
+			}
+			arr.Elements = append(arr.Elements, elem)
+			return nil
+		})
+		return arr, err
+	case '{':
+		f.i++
+		obj := &ast.ObjectLit{Inline: true}
+		err := f.each('}', func() error {
+			key, err := f.key()
+			if err != nil {
+				return err
+			}
+			value, err := f.value(joinPath(path, key))
+			if err != nil {
+				return err
+			}
+			obj.Body = append(obj.Body, &ast.KeyValue{Key: &ast.Ident{Name: key}, Value: value})
+			return nil
+		})
+		return obj, err
+	case '"', '\'':
+		s, n, err := yamlQuoted(f.s[f.i:])
+		if err != nil {
+			return nil, f.p.errorf("%v", err)
+		}
+		f.i += n
+		return &ast.StringLit{Value: s}, nil
+	case '&', '*', '!':
+		return nil, f.p.errorf("anchors, aliases and tags are not supported")
+	}
+	start := f.i
+	for f.i < len(f.s) && !strings.ContainsRune(",]}", rune(f.s[f.i])) {
+		f.i++
+	}
+	return resolveYAMLScalar(strings.TrimRight(f.s[start:f.i], " ")), nil
+}
+
+// each calls read for every entry of a flow collection up to the closing
+// delimiter end.
+func (f *yamlFlow) each(end byte, read func() error) error {
+	for {
+		f.skipSpace()
+		if f.i < len(f.s) && f.s[f.i] == end {
+			f.i++
+			return nil
+		}
+		if err := read(); err != nil {
+			return err
+		}
+		f.skipSpace()
+		switch {
+		case f.i == len(f.s):
+			return f.p.errorf("unexpected end of line, flow collections must fit on one line")
+		case f.s[f.i] == ',':
+			f.i++
+		case f.s[f.i] != end:
+			return f.p.errorf("expected , or %c", end)
+		}
+	}
+}
+
+// key reads a key of a flow mapping and its colon.
+func (f *yamlFlow) key() (string, error) {
+	f.skipSpace()
+	var key string
+	if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+		s, n, err := yamlQuoted(f.s[f.i:])
+		if err != nil {
+			return "", f.p.errorf("%v", err)
+		}
+		key = s
+		f.i += n
+		f.skipSpace()
+	} else {
+		start := f.i
+		for f.i < len(f.s) && !strings.ContainsRune(":,]}", rune(f.s[f.i])) {
+			f.i++
+		}
+		key = strings.TrimRight(f.s[start:f.i], " ")
+	}
+	if f.i == len(f.s) || f.s[f.i] != ':' {
+		return "", f.p.errorf("expected : after key %q", key)
+	}
+	f.i++
+	if _, err := encodeKey(key); err != nil {
+		return "", f.p.errorf("%q is not a valid key", key)
+	}
+	return key, nil
+}
+
+// isYAMLItem reports whether text is a block sequence item.
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a line of a block mapping into its key and the text
+// after the colon.
+func splitYAMLKey(text string) (string, string, bool) {
+	if text == "" {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		key, n, err := yamlQuoted(text)
+		if err != nil {
+			return "", "", false
+		}
+		rest := strings.TrimLeft(text[n:], " ")
+		if rest == ":" || strings.HasPrefix(rest, ": ") {
+			return key, strings.TrimSpace(rest[1:]), true
+		}
+		return "", "", false
+	}
+	if strings.ContainsRune("[{#&*!|>%@`", rune(text[0])) || isYAMLItem(text) {
+		return "", "", false
+	}
+	idx := strings.Index(text, ": ")
+	if idx == -1 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		idx = len(text) - 1
+	}
+	key := strings.TrimRight(text[:idx], " ")
+	return key, strings.TrimSpace(text[idx+1:]), key != ""
+}
+
+// yamlQuoted reads the double- or single-quoted scalar at the start of s and
+// returns its value and length.
+func yamlQuoted(s string) (string, int, error) {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q && q == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			if q == '\'' {
+				return strings.ReplaceAll(s[1:i], "''", "'"), i + 1, nil
+			}
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape in %s", s[:i+1])
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string, quoted strings must fit on one line")
+}
+
+// stripYAMLComment removes a comment from the content of a line. A # starts
+// a comment at the start of the content or after a space, outside quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\', quote == '\'' && c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" [{,:", s[i-1]) != -1):
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// resolveYAMLScalar gives a plain scalar its type, following the YAML 1.2
+// core schema, with RFC 3339 timestamps added.
+func resolveYAMLScalar(s string) ast.Value {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return &ast.NullLit{}
+	case "true", "True", "TRUE":
+		return &ast.BoolLit{Value: true}
+	case "false", "False", "FALSE":
+		return &ast.BoolLit{Value: false}
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return &ast.NumberLit{Literal: literalInf}
+	case "-.inf", "-.Inf", "-.INF":
+		return &ast.NumberLit{Literal: literalNegInf}
+	case ".nan", ".NaN", ".NAN":
+		return &ast.NumberLit{Literal: literalNaN}
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o") {
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return &ast.NumberLit{Literal: strconv.FormatInt(i, 10)}
+		}
+	}
+	if isNumberText(s) {
+		return &ast.NumberLit{Literal: strings.TrimPrefix(s, "+")}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return &ast.TimeLit{Literal: s}
+	}
+	return &ast.StringLit{Value: s}
+}
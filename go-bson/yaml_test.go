@@ -0,0 +1,205 @@
+package bulbason
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToYAML(t *testing.T) {
+	input := `BULBA!
+name ~~> "Bulby"
+motto ~~> "yes"
+level ~> 1_000
+hp ~> Eternatus
+when ~> 2024-05-01T12:00:00Z
+wait ~> 1h30m
+data ~> 0b64"aGVsbG8="
+shiny ~> NotVeryEffective
+owner ~> MissingNo
+tags ~> <| "a: b", { x ~> 1, y ~> 2 } |>
+empty ~> <| |>
+bio ~> """
+    Likes sun.
+    Naps a lot.
+    """
+(o) stats (o)
+    hp ~> 45
+    (O) nested (O)
+moves ~~> <|
+(o)
+    power ~~> 40
+    (O) meta (O)
+        pp ~~> 25
+(o)
+|>
+`
+	doc, err := ParseAST(input)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := ToYAML(doc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `name: Bulby
+motto: "yes"
+level: 1000
+hp: .inf
+when: 2024-05-01T12:00:00Z
+wait: "1h30m"
+data: !!binary aGVsbG8=
+shiny: false
+owner: null
+tags:
+  - "a: b"
+  - x: 1
+    "y": 2
+empty: []
+bio: |-
+  Likes sun.
+  Naps a lot.
+stats:
+  hp: 45
+  nested: {}
+moves:
+  - power: 40
+    meta:
+      pp: 25
+  - {}
+`
+	if string(out) != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	// The YAML converts back to the same data.
+	back, err := FromYAML(out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(back); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want, _ := Parse(input)
+	got, err := Parse(buf.String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n%s", err, buf.String())
+	}
+	want["wait"] = "1h30m" // Durations become strings
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", want, got)
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	input := `---
+# Service settings
+app_name: Pokedex_API   # trailing comment
+port: 0x1F90
+ratio: +1.5
+debug: True
+owner: ~
+"x-trace": 'it''s # not a comment'
+tags: [a, "b, c", {d: 1}]
+env: {region: eu, zones: [a, b]}
+database:
+  host: 127.0.0.1
+  pool:
+    max: 10
+servers:
+- host: alpha
+  ports:
+    - 80
+    - 443
+-   host: beta
+-
+  host: gamma
+script: >
+  echo one
+  echo two
+
+  done
+notes: |+
+  keep
+
+empty:
+...
+`
+	doc, err := FromYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeAST(doc); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `BULBA!
+app_name ~~~~> "Pokedex_API"
+port ~~~~> 8080
+ratio ~~~~> 1.5
+debug ~~~~> SuperEffective
+owner ~~~~> MissingNo
+"x-trace" ~~~~> "it's # not a comment"
+tags ~~~~> <| "a", "b, c", { d ~~~~> 1 } |>
+(o) env (o)
+    region ~~~~> "eu"
+    zones ~~~~> <| "a", "b" |>
+(o) database (o)
+    host ~~~~> "127.0.0.1"
+    (O) pool (O)
+        max ~~~~> 10
+servers ~~~~> <|
+(o)
+    host ~~~~> "alpha"
+    ports ~~~~> <| 80, 443 |>
+(o)
+    host ~~~~> "beta"
+(o)
+    host ~~~~> "gamma"
+|>
+script ~~~~> """
+    echo one echo two
+    done
+
+    """
+notes ~~~~> """
+    keep
+
+
+    """
+empty ~~~~> MissingNo
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestFromYAML_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		msg   string
+	}{
+		{"Not A Mapping", "- a\n- b\n", "expected a mapping"},
+		{"Nested Sequences", "a:\n  b:\n    - 1\n    - - 2\n", "line 4: cannot convert a.b[1], arrays cannot be nested"},
+		{"Nested Flow Sequences", "a: [1, [2]]\n", "line 1: cannot convert a[1], arrays cannot be nested"},
+		{"Bad Indentation", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"Anchor", "a: &x 1\n", "anchors"},
+		{"Tag", "a: !!str 1\n", "tags"},
+		{"Multi-line Plain", "a: one\n  two\n", "multi-line plain"},
+		{"Unterminated", "a: \"one\n", "line 1: unterminated string"},
+		{"Flow Across Lines", "a: [1,\n  2]\n", "flow collections must fit on one line"},
+		{"Reserved Key", "a:\n  Charizard: 1\n", `line 2: "Charizard" is not a valid key`},
+		{"Two Documents", "a: 1\n---\nb: 2\n", "line 2: only a single document"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromYAML([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected error containing %q, got %v", tt.msg, err)
+			}
+		})
+	}
+}